@@ -10,17 +10,52 @@ import (
 
 type (
 	Config struct {
-		Database   database   `yaml:"database"`
-		FusionAuth fusionAuth `yaml:"fusion_auth"`
-		Server     server     `yaml:"server"`
-		LogLevel   string     `yaml:"log_level" env:"LOG_LEVEL" env-default:"dev"`
-		Flags      flags      `yaml:"flags"`
+		Database      database      `yaml:"database"`
+		FusionAuth    fusionAuth    `yaml:"fusion_auth"`
+		Server        server        `yaml:"server"`
+		GRPC          grpc          `yaml:"grpc"`
+		Events        events        `yaml:"events"`
+		Mailer        mailer        `yaml:"mailer"`
+		OAuth         oauth         `yaml:"oauth"`
+		OIDC          oidc          `yaml:"oidc"`
+		MagicLink     magicLink     `yaml:"magic_link"`
+		WebAuthn      webAuthn      `yaml:"webauthn"`
+		Sessions      sessions      `yaml:"sessions"`
+		Cookies       cookies       `yaml:"cookies"`
+		CORS          cors          `yaml:"cors"`
+		CSRF          csrf          `yaml:"csrf"`
+		Password      password      `yaml:"password"`
+		Accounts      accounts      `yaml:"accounts"`
+		Privacy       privacy       `yaml:"privacy"`
+		Introspection introspection `yaml:"introspection"`
+		Admin         admin         `yaml:"admin"`
+		APIKeys       apiKeys       `yaml:"api_keys"`
+		Tenancy       tenancy       `yaml:"tenancy"`
+		Organizations organizations `yaml:"organizations"`
+		Impersonation impersonation `yaml:"impersonation"`
+		LoginAlerts   loginAlerts   `yaml:"login_alerts"`
+		Registration  registration  `yaml:"registration"`
+		LogLevel      string        `yaml:"log_level" env:"LOG_LEVEL" env-default:"dev"`
+		Flags         flags         `yaml:"flags"`
 	}
 
+	// server is the REST api. X-Forwarded-For is only read from
+	// TrustedProxies, addresses or CIDR networks of the reverse proxies
+	// in front of it. Without them the address of the connection is the
+	// client's.
 	server struct {
-		Port         string        `yaml:"port" env:"PORT" env-default:":8080"`
-		TimeoutRead  time.Duration `yaml:"timeout_read" env:"TIMEOUT_READ" env-default:"5s"`
-		TimeoutWrite time.Duration `yaml:"timeout_write" env:"TIMEOUT_WRITE" env-default:"5s"`
+		Port           string        `yaml:"port" env:"PORT" env-default:":8080"`
+		TimeoutRead    time.Duration `yaml:"timeout_read" env:"TIMEOUT_READ" env-default:"5s"`
+		TimeoutWrite   time.Duration `yaml:"timeout_write" env:"TIMEOUT_WRITE" env-default:"5s"`
+		TrustedProxies []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	}
+
+	// grpc serves the auth service to backend services next to the
+	// REST api. An empty port disables it. TrustedProxies are the
+	// services allowed to forward a user's address in x-forwarded-for.
+	grpc struct {
+		Port           string   `yaml:"port" env:"GRPC_PORT" env-default:":9090"`
+		TrustedProxies []string `yaml:"trusted_proxies" env:"GRPC_TRUSTED_PROXIES"`
 	}
 
 	fusionAuth struct {
@@ -29,6 +64,294 @@ type (
 		ApiKey string `yaml:"api_key" env:"FUSION_AUTH_API_KEY" env-required:"true"`
 	}
 
+	events struct {
+		PollInterval time.Duration `yaml:"poll_interval" env:"EVENTS_POLL_INTERVAL" env-default:"5s"`
+		BatchSize    int           `yaml:"batch_size" env:"EVENTS_BATCH_SIZE" env-default:"100"`
+		MaxAttempts  int           `yaml:"max_attempts" env:"EVENTS_MAX_ATTEMPTS" env-default:"10"`
+		Webhook      webhook       `yaml:"webhook"`
+	}
+
+	webhook struct {
+		URL     string        `yaml:"url" env:"EVENTS_WEBHOOK_URL"`
+		Secret  string        `yaml:"secret" env:"EVENTS_WEBHOOK_SECRET"`
+		Timeout time.Duration `yaml:"timeout" env:"EVENTS_WEBHOOK_TIMEOUT" env-default:"5s"`
+	}
+
+	oauth struct {
+		RedirectBaseURL string        `yaml:"redirect_base_url" env:"OAUTH_REDIRECT_BASE_URL" env-default:"http://localhost:8080"`
+		StateTTL        time.Duration `yaml:"state_ttl" env:"OAUTH_STATE_TTL" env-default:"10m"`
+		Google          oauthProvider `yaml:"google" env-prefix:"OAUTH_GOOGLE_"`
+		GitHub          oauthProvider `yaml:"github" env-prefix:"OAUTH_GITHUB_"`
+		OIDC            oauthProvider `yaml:"oidc" env-prefix:"OAUTH_OIDC_"`
+	}
+
+	// oauthProvider is disabled unless ClientID is set. Issuer is only
+	// used by OpenID Connect providers, the endpoints are discovered
+	// from it. AuthURL, TokenURL and APIURL are only used by GitHub and
+	// default to github.com.
+	oauthProvider struct {
+		ClientID     string   `yaml:"client_id" env:"CLIENT_ID"`
+		ClientSecret string   `yaml:"client_secret" env:"CLIENT_SECRET"`
+		Issuer       string   `yaml:"issuer" env:"ISSUER"`
+		AuthURL      string   `yaml:"auth_url" env:"AUTH_URL"`
+		TokenURL     string   `yaml:"token_url" env:"TOKEN_URL"`
+		APIURL       string   `yaml:"api_url" env:"API_URL"`
+		Scopes       []string `yaml:"scopes" env:"SCOPES"`
+	}
+
+	// oidc configures the service as an OpenID Connect provider for
+	// our own applications. Without SigningKeyPath a key is generated on
+	// startup, which is only suitable for development.
+	oidc struct {
+		Issuer          string        `yaml:"issuer" env:"OIDC_ISSUER" env-default:"http://localhost:8080"`
+		SigningKeyPath  string        `yaml:"signing_key_path" env:"OIDC_SIGNING_KEY_PATH"`
+		LoginURL        string        `yaml:"login_url" env:"OIDC_LOGIN_URL"`
+		CodeTTL         time.Duration `yaml:"code_ttl" env:"OIDC_CODE_TTL" env-default:"1m"`
+		AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"OIDC_ACCESS_TOKEN_TTL" env-default:"15m"`
+		IDTokenTTL      time.Duration `yaml:"id_token_ttl" env:"OIDC_ID_TOKEN_TTL" env-default:"1h"`
+		RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"OIDC_REFRESH_TOKEN_TTL" env-default:"720h"`
+	}
+
+	// magicLink configures passwordless login by email. URL is where
+	// the emailed link points to, the token is appended as a query
+	// parameter. The email is sent with the fusionauth template
+	// EmailTemplateID, which gets the link as ${requestData.link}.
+	magicLink struct {
+		URL               string        `yaml:"url" env:"MAGIC_LINK_URL" env-default:"http://localhost:8080/auth/magic-link/verify"`
+		TTL               time.Duration `yaml:"ttl" env:"MAGIC_LINK_TTL" env-default:"15m"`
+		EmailTemplateID   string        `yaml:"email_template_id" env:"MAGIC_LINK_EMAIL_TEMPLATE_ID"`
+		MaxPerEmail       int           `yaml:"max_per_email" env:"MAGIC_LINK_MAX_PER_EMAIL" env-default:"3"`
+		Window            time.Duration `yaml:"window" env:"MAGIC_LINK_WINDOW" env-default:"15m"`
+		RequestsPerMinute int           `yaml:"requests_per_minute" env:"MAGIC_LINK_REQUESTS_PER_MINUTE" env-default:"10"`
+	}
+
+	webAuthn struct {
+		RPID          string        `yaml:"rp_id" env:"WEBAUTHN_RP_ID" env-default:"localhost"`
+		RPDisplayName string        `yaml:"rp_display_name" env:"WEBAUTHN_RP_DISPLAY_NAME" env-default:"POC-Auth"`
+		RPOrigins     []string      `yaml:"rp_origins" env:"WEBAUTHN_RP_ORIGINS" env-default:"http://localhost:8080"`
+		ChallengeTTL  time.Duration `yaml:"challenge_ttl" env:"WEBAUTHN_CHALLENGE_TTL" env-default:"5m"`
+	}
+
+	// sessions ttls should match the token lifetimes configured for the
+	// application in FusionAuth.
+	sessions struct {
+		AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"SESSIONS_ACCESS_TOKEN_TTL" env-default:"1h"`
+		RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"SESSIONS_REFRESH_TOKEN_TTL" env-default:"720h"`
+		// EncryptionKey encrypts the fusionauth refresh token kept for
+		// every login, 32 base64 encoded bytes. Without it a key is
+		// generated on startup, which is only suitable for development.
+		EncryptionKey string `yaml:"encryption_key" env:"SESSIONS_ENCRYPTION_KEY"`
+	}
+
+	// cookies configures how tokens are delivered to browsers. With
+	// HostPrefix the names get the __Host- prefix, which requires
+	// Secure, Path "/" and no Domain, so those settings are ignored.
+	cookies struct {
+		RefreshTokenName string `yaml:"refresh_token_name" env:"COOKIES_REFRESH_TOKEN_NAME" env-default:"refresh_token"`
+		AccessTokenName  string `yaml:"access_token_name" env:"COOKIES_ACCESS_TOKEN_NAME" env-default:"access_token"`
+		Domain           string `yaml:"domain" env:"COOKIES_DOMAIN"`
+		Path             string `yaml:"path" env:"COOKIES_PATH" env-default:"/"`
+		SameSite         string `yaml:"same_site" env:"COOKIES_SAME_SITE" env-default:"lax"`
+		Secure           bool   `yaml:"secure" env:"COOKIES_SECURE" env-default:"true"`
+		HostPrefix       bool   `yaml:"host_prefix" env:"COOKIES_HOST_PREFIX"`
+		AccessToken      bool   `yaml:"access_token" env:"COOKIES_ACCESS_TOKEN"`
+		TokensInBody     bool   `yaml:"tokens_in_body" env:"COOKIES_TOKENS_IN_BODY" env-default:"true"`
+	}
+
+	// cors is disabled unless AllowOrigins is set, only same origin
+	// requests are possible then.
+	cors struct {
+		AllowOrigins []string      `yaml:"allow_origins" env:"CORS_ALLOW_ORIGINS"`
+		MaxAge       time.Duration `yaml:"max_age" env:"CORS_MAX_AGE" env-default:"10m"`
+	}
+
+	// csrf protects the endpoints that authenticate with cookies.
+	// Requests from the cors origins are trusted, TrustedOrigins adds
+	// origins that are not allowed to make cross origin requests.
+	csrf struct {
+		Enabled        bool     `yaml:"enabled" env:"CSRF_ENABLED" env-default:"true"`
+		CookieName     string   `yaml:"cookie_name" env:"CSRF_COOKIE_NAME" env-default:"csrf_token"`
+		HeaderName     string   `yaml:"header_name" env:"CSRF_HEADER_NAME" env-default:"X-CSRF-Token"`
+		TrustedOrigins []string `yaml:"trusted_origins" env:"CSRF_TRUSTED_ORIGINS"`
+	}
+
+	// password is the policy for every password a user sets. Lengths
+	// are counted in characters. BreachedListPath is a directory of
+	// hash prefix files or a single file of SHA-1 hashes, see
+	// pkg/breached. History is how many previous passwords can not be
+	// used again.
+	password struct {
+		MinLength              int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+		MaxLength              int    `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" env-default:"128"`
+		RequireUpper           bool   `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER"`
+		RequireLower           bool   `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER"`
+		RequireDigit           bool   `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+		RequireSymbol          bool   `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL"`
+		DisallowPersonalInfo   bool   `yaml:"disallow_personal_info" env:"PASSWORD_DISALLOW_PERSONAL_INFO" env-default:"true"`
+		History                int    `yaml:"history" env:"PASSWORD_HISTORY" env-default:"5"`
+		BreachedListPath       string `yaml:"breached_list_path" env:"PASSWORD_BREACHED_LIST_PATH"`
+		ChangedEmailTemplateID string `yaml:"changed_email_template_id" env:"PASSWORD_CHANGED_EMAIL_TEMPLATE_ID"`
+	}
+
+	// registration limits who can sign up, with a password or a social
+	// login. When AllowedDomains is set emails must be on one of them,
+	// and never on one of BlockedDomains, subdomains included.
+	// BlockDisposable rejects disposable email providers of the bundled
+	// list and of DisposableListPath, a file of one domain per line, see
+	// pkg/disposable. InviteOnly only lets users with an organization
+	// invitation register.
+	registration struct {
+		AllowedDomains     []string `yaml:"allowed_domains" env:"REGISTRATION_ALLOWED_DOMAINS"`
+		BlockedDomains     []string `yaml:"blocked_domains" env:"REGISTRATION_BLOCKED_DOMAINS"`
+		BlockDisposable    bool     `yaml:"block_disposable" env:"REGISTRATION_BLOCK_DISPOSABLE" env-default:"false"`
+		DisposableListPath string   `yaml:"disposable_list_path" env:"REGISTRATION_DISPOSABLE_LIST_PATH"`
+		InviteOnly         bool     `yaml:"invite_only" env:"REGISTRATION_INVITE_ONLY" env-default:"false"`
+	}
+
+	// mailer sends emails with the templates of this service instead of
+	// fusionauth's. Sender is smtp, file or memory, without one emails
+	// are sent by fusionauth with the template ids configured for them.
+	// The file sender writes .eml files to FileDir. Mails are queued
+	// and sent every PollInterval, failed ones are retried up to
+	// MaxAttempts times. TemplatesPath replaces the built in templates.
+	mailer struct {
+		Sender        string        `yaml:"sender" env:"MAILER_SENDER"`
+		From          string        `yaml:"from" env:"MAILER_FROM" env-default:"poc-auth <no-reply@localhost>"`
+		DefaultLocale string        `yaml:"default_locale" env:"MAILER_DEFAULT_LOCALE" env-default:"en"`
+		TemplatesPath string        `yaml:"templates_path" env:"MAILER_TEMPLATES_PATH"`
+		FileDir       string        `yaml:"file_dir" env:"MAILER_FILE_DIR" env-default:"mail"`
+		PollInterval  time.Duration `yaml:"poll_interval" env:"MAILER_POLL_INTERVAL" env-default:"5s"`
+		BatchSize     int           `yaml:"batch_size" env:"MAILER_BATCH_SIZE" env-default:"50"`
+		MaxAttempts   int           `yaml:"max_attempts" env:"MAILER_MAX_ATTEMPTS" env-default:"8"`
+		SMTP          smtp          `yaml:"smtp"`
+	}
+
+	// smtp is the server mails are sent through. TLS is starttls, tls
+	// for implicit TLS, usually on port 465, or none.
+	smtp struct {
+		Host     string        `yaml:"host" env:"MAILER_SMTP_HOST"`
+		Port     int           `yaml:"port" env:"MAILER_SMTP_PORT" env-default:"587"`
+		Username string        `yaml:"username" env:"MAILER_SMTP_USERNAME"`
+		Password string        `yaml:"password" env:"MAILER_SMTP_PASSWORD"`
+		TLS      string        `yaml:"tls" env:"MAILER_SMTP_TLS" env-default:"starttls"`
+		Timeout  time.Duration `yaml:"timeout" env:"MAILER_SMTP_TIMEOUT" env-default:"10s"`
+	}
+
+	// accounts configures self service account changes. A new email is
+	// confirmed by following EmailChangeURL with ?token= appended, the
+	// link is sent to the new address with EmailChangeTemplateID, the
+	// old address is told about it with EmailChangeNoticeTemplateID.
+	// Deleted accounts are kept for DeletionGracePeriod, logging in
+	// again in that time cancels the deletion. VerificationURL and
+	// PasswordResetURL are where the mailer's links point to, with
+	// ?token= appended, fusionauth's templates have their own.
+	accounts struct {
+		EmailChangeURL              string        `yaml:"email_change_url" env:"ACCOUNTS_EMAIL_CHANGE_URL" env-default:"http://localhost:8080/auth/me/email/verify"`
+		EmailChangeTemplateID       string        `yaml:"email_change_template_id" env:"ACCOUNTS_EMAIL_CHANGE_TEMPLATE_ID"`
+		EmailChangeTTL              time.Duration `yaml:"email_change_ttl" env:"ACCOUNTS_EMAIL_CHANGE_TTL" env-default:"24h"`
+		EmailChangeNoticeTemplateID string        `yaml:"email_change_notice_template_id" env:"ACCOUNTS_EMAIL_CHANGE_NOTICE_TEMPLATE_ID"`
+		DeletionGracePeriod         time.Duration `yaml:"deletion_grace_period" env:"ACCOUNTS_DELETION_GRACE_PERIOD" env-default:"720h"`
+		DeletionJobInterval         time.Duration `yaml:"deletion_job_interval" env:"ACCOUNTS_DELETION_JOB_INTERVAL" env-default:"1h"`
+		VerificationURL             string        `yaml:"verification_url" env:"ACCOUNTS_VERIFICATION_URL" env-default:"http://localhost:3000/verify-email"`
+		PasswordResetURL            string        `yaml:"password_reset_url" env:"ACCOUNTS_PASSWORD_RESET_URL" env-default:"http://localhost:3000/reset-password"`
+	}
+
+	// privacy configures data exports and erasures. Both are handled
+	// by a job running every JobInterval, archives can be downloaded
+	// for ExportTTL. Erasure records are signed with ErasureSigningKey,
+	// without it they only carry a plain digest.
+	privacy struct {
+		ExportTTL         time.Duration `yaml:"export_ttl" env:"PRIVACY_EXPORT_TTL" env-default:"168h"`
+		JobInterval       time.Duration `yaml:"job_interval" env:"PRIVACY_JOB_INTERVAL" env-default:"1m"`
+		ErasureSigningKey string        `yaml:"erasure_signing_key" env:"PRIVACY_ERASURE_SIGNING_KEY"`
+	}
+
+	// introspection configures POST /auth/introspect. Clients maps the
+	// ids of the services allowed to call it to their secrets, in env
+	// as "id1:secret1,id2:secret2". Results are cached for CacheTTL,
+	// never longer than the token is valid.
+	introspection struct {
+		Clients   map[string]string `yaml:"clients" env:"INTROSPECTION_CLIENTS"`
+		CacheTTL  time.Duration     `yaml:"cache_ttl" env:"INTROSPECTION_CACHE_TTL" env-default:"30s"`
+		CacheSize int               `yaml:"cache_size" env:"INTROSPECTION_CACHE_SIZE" env-default:"10000"`
+	}
+
+	// admin configures who may use the admin api: users whose
+	// fusionauth registration has Role, and API keys with the admin
+	// scope.
+	admin struct {
+		Role string `yaml:"role" env:"ADMIN_ROLE" env-default:"admin"`
+	}
+
+	// apiKeys configures service account keys. Keys expire after
+	// DefaultTTL unless created with a shorter or longer one, never
+	// more than MaxTTL. A rotated key keeps working for
+	// RotationOverlap so clients can switch over. Prefix must not
+	// contain underscores, they separate the parts of a key.
+	apiKeys struct {
+		Prefix          string        `yaml:"prefix" env:"API_KEYS_PREFIX" env-default:"pak"`
+		DefaultTTL      time.Duration `yaml:"default_ttl" env:"API_KEYS_DEFAULT_TTL" env-default:"2160h"`
+		MaxTTL          time.Duration `yaml:"max_ttl" env:"API_KEYS_MAX_TTL" env-default:"8760h"`
+		RotationOverlap time.Duration `yaml:"rotation_overlap" env:"API_KEYS_ROTATION_OVERLAP" env-default:"24h"`
+	}
+
+	// organizations configures invitations. InvitationURL is the page
+	// of the frontend that accepts them, the token is added as the
+	// token query parameter.
+	organizations struct {
+		InvitationURL        string        `yaml:"invitation_url" env:"ORGANIZATIONS_INVITATION_URL" env-default:"http://localhost:3000/invitations/accept"`
+		InvitationTemplateID string        `yaml:"invitation_template_id" env:"ORGANIZATIONS_INVITATION_TEMPLATE_ID"`
+		InvitationTTL        time.Duration `yaml:"invitation_ttl" env:"ORGANIZATIONS_INVITATION_TTL" env-default:"168h"`
+	}
+
+	// impersonation lets admins act as a user for support. Tokens last
+	// DefaultTTL unless asked for a shorter or longer one, never more
+	// than MaxTTL. ReadOnly makes every impersonation read only, not
+	// just the ones asked to be.
+	impersonation struct {
+		DefaultTTL time.Duration `yaml:"default_ttl" env:"IMPERSONATION_DEFAULT_TTL" env-default:"15m"`
+		MaxTTL     time.Duration `yaml:"max_ttl" env:"IMPERSONATION_MAX_TTL" env-default:"1h"`
+		ReadOnly   bool          `yaml:"read_only" env:"IMPERSONATION_READ_ONLY" env-default:"false"`
+	}
+
+	// loginAlerts emails users when they log in from a new device, a
+	// country they never logged in from, or a place too far from their
+	// last login to have travelled to faster than MaxTravelSpeed km/h.
+	// Each rule can be turned off. Logins less than MinTravelDistance
+	// km apart are never impossible travel, geoip databases are not that
+	// precise. Countries and distances need a geoip database at
+	// GeoIPPath. EmailTemplateID is the fusionauth template used without
+	// the mailer.
+	loginAlerts struct {
+		Enabled           bool    `yaml:"enabled" env:"LOGIN_ALERTS_ENABLED" env-default:"false"`
+		GeoIPPath         string  `yaml:"geoip_path" env:"LOGIN_ALERTS_GEOIP_PATH"`
+		NewDevice         bool    `yaml:"new_device" env:"LOGIN_ALERTS_NEW_DEVICE" env-default:"true"`
+		NewCountry        bool    `yaml:"new_country" env:"LOGIN_ALERTS_NEW_COUNTRY" env-default:"true"`
+		ImpossibleTravel  bool    `yaml:"impossible_travel" env:"LOGIN_ALERTS_IMPOSSIBLE_TRAVEL" env-default:"true"`
+		MaxTravelSpeed    float64 `yaml:"max_travel_speed" env:"LOGIN_ALERTS_MAX_TRAVEL_SPEED" env-default:"1000"`
+		MinTravelDistance float64 `yaml:"min_travel_distance" env:"LOGIN_ALERTS_MIN_TRAVEL_DISTANCE" env-default:"500"`
+		EmailTemplateID   string  `yaml:"email_template_id" env:"LOGIN_ALERTS_EMAIL_TEMPLATE_ID"`
+	}
+
+	// tenancy serves several tenants from one deployment. Requests name
+	// their tenant by host, a /t/<tenant> path prefix or Header, the
+	// ones naming none belong to the default tenant configured in
+	// fusion_auth. Tenants can only be configured in the config file.
+	tenancy struct {
+		Enabled bool              `yaml:"enabled" env:"TENANCY_ENABLED" env-default:"false"`
+		Header  string            `yaml:"header" env:"TENANCY_HEADER" env-default:"X-Tenant-ID"`
+		Tenants map[string]tenant `yaml:"tenants"`
+	}
+
+	// tenant is the fusionauth application, and optionally fusionauth
+	// tenant, users of a tenant register with.
+	tenant struct {
+		AppID                string   `yaml:"app_id"`
+		FusionTenantID       string   `yaml:"fusion_tenant_id"`
+		Hosts                []string `yaml:"hosts"`
+		RegistrationDisabled bool     `yaml:"registration_disabled"`
+	}
+
 	database struct {
 		MongoDB mongoConfig `yaml:"mongodb"`
 	}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"context"
+)
+
+// initAccounts starts the job that hard-deletes accounts once their
+// deletion grace period has passed.
+func (a *application) initAccounts() error {
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		a.authDomain.PurgeDeletedAccounts(ctx)
+	}()
+
+	a.cleanupFuncs = append(a.cleanupFuncs, func() {
+		cancel()
+		<-done
+
+		a.logger.InfoContext(a.ctx, "account deletion job stopped")
+	})
+
+	a.logger.InfoContext(a.ctx, "account deletion job started", "interval", a.cfg.Accounts.DeletionJobInterval)
+
+	return nil
+}
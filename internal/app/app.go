@@ -9,6 +9,9 @@ import (
 
 	"github.com/rasulov-emirlan/poc-auth/config"
 	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/events"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/oidc"
 	"github.com/rasulov-emirlan/poc-auth/internal/storage/mongodb"
 	"github.com/rasulov-emirlan/poc-auth/pkg/logging"
 )
@@ -22,8 +25,11 @@ type application struct {
 
 	// dependencies below
 
-	mdb        mongodb.RepoCombiner
-	authDomain auth.Service
+	mdb          mongodb.RepoCombiner
+	eventsDomain events.Service
+	mailerDomain *mailer.Service
+	authDomain   auth.Service
+	oidcDomain   oidc.Service
 }
 
 func Run() {
@@ -38,14 +44,34 @@ func Run() {
 		a.fatal("failed to init db", err)
 	}
 
+	if err := a.initEvents(); err != nil {
+		a.fatal("failed to init events", err)
+	}
+
+	if err := a.initMailer(); err != nil {
+		a.fatal("failed to init mailer", err)
+	}
+
 	if err := a.initDomains(); err != nil {
 		a.fatal("failed to init domains", err)
 	}
 
+	if err := a.initAccounts(); err != nil {
+		a.fatal("failed to init accounts", err)
+	}
+
+	if err := a.initPrivacy(); err != nil {
+		a.fatal("failed to init privacy", err)
+	}
+
 	if err := a.initHttp(); err != nil {
 		a.fatal("failed to init http", err)
 	}
 
+	if err := a.initGrpc(); err != nil {
+		a.fatal("failed to init grpc", err)
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
@@ -60,8 +86,10 @@ func (a *application) fatal(msg string, err error) {
 }
 
 func (a *application) cleanup() {
-	for _, f := range a.cleanupFuncs {
-		f()
+	// run in reverse order so that dependencies are released after
+	// everything that uses them has stopped
+	for i := len(a.cleanupFuncs) - 1; i >= 0; i-- {
+		a.cleanupFuncs[i]()
 	}
 
 	a.logger.InfoContext(a.ctx, "cleanup done. bye bye")
@@ -26,5 +26,9 @@ func (a *application) initDB() error {
 
 	a.logger.InfoContext(a.ctx, "mongodb connection established")
 
+	if err := a.mdb.EnsureIndexes(a.ctx); err != nil {
+		return fmt.Errorf("failed to init mongodb: %w", err)
+	}
+
 	return nil
 }
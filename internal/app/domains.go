@@ -1,16 +1,107 @@
 package app
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 
 	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/oidc"
+	"github.com/rasulov-emirlan/poc-auth/internal/transport/oauth"
+	"github.com/rasulov-emirlan/poc-auth/pkg/breached"
+	"github.com/rasulov-emirlan/poc-auth/pkg/disposable"
+	"github.com/rasulov-emirlan/poc-auth/pkg/geoip"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
 )
 
 func (a *application) initDomains() error {
+	var breachedPasswords auth.BreachedPasswords
+	if path := a.cfg.Password.BreachedListPath; path != "" {
+		list, err := breached.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to load breached passwords: %w", err)
+		}
+		breachedPasswords = list
+	}
+
+	var disposableDomains auth.DisposableDomains
+	if a.cfg.Registration.BlockDisposable {
+		if path := a.cfg.Registration.DisposableListPath; path != "" {
+			list, err := disposable.Open(path)
+			if err != nil {
+				return fmt.Errorf("failed to load disposable email domains: %w", err)
+			}
+			disposableDomains = list
+		} else {
+			disposableDomains = disposable.New()
+		}
+	}
+
+	var geo auth.GeoLocator
+	if path := a.cfg.LoginAlerts.GeoIPPath; path != "" {
+		db, err := geoip.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to load geoip database: %w", err)
+		}
+		geo = db
+	}
+
+	// a nil *mailer.Service would not be a nil auth.Mailer
+	var m auth.Mailer
+	if a.mailerDomain != nil {
+		m = a.mailerDomain
+	}
+
+	signer, err := a.signer()
+	if err != nil {
+		return fmt.Errorf("failed to init signer: %w", err)
+	}
+
+	sessionCipher, err := a.sessionCipher()
+	if err != nil {
+		return fmt.Errorf("failed to init session cipher: %w", err)
+	}
+
 	authDomain, err := auth.NewService(a.ctx, auth.ServiceConfigs{
-		UsersRepository: a.mdb.Users(),
-		Logger:          a.logger,
-		Cfg:             a.cfg,
+		UsersRepository:      a.mdb.Users(),
+		Sessions:             a.mdb.Sessions(),
+		RotatedRefreshTokens: a.mdb.RotatedRefreshTokens(),
+		Audit:                a.mdb.Audit(),
+		PasswordHistory:      a.mdb.PasswordHistory(),
+		EmailChanges:         a.mdb.EmailChanges(),
+		DataExports:          a.mdb.DataExports(),
+		Erasures:             a.mdb.Erasures(),
+		ServiceAccounts:      a.mdb.ServiceAccounts(),
+		APIKeys:              a.mdb.APIKeys(),
+		Organizations:        a.mdb.Organizations(),
+		Memberships:          a.mdb.Memberships(),
+		Invitations:          a.mdb.Invitations(),
+		Impersonations:       a.mdb.Impersonations(),
+		KnownDevices:         a.mdb.KnownDevices(),
+		PersonalDataStores: map[string]auth.PersonalDataStore{
+			"outbox":              a.mdb.Outbox(),
+			"mail_queue":          a.mdb.MailQueue(),
+			"oidc_codes":          a.mdb.OIDCCodes(),
+			"oidc_refresh_tokens": a.mdb.OIDCRefreshTokens(),
+		},
+		BreachedPasswords:  breachedPasswords,
+		DisposableDomains:  disposableDomains,
+		GeoLocator:         geo,
+		Events:             a.eventsDomain,
+		Transactor:         a.mdb,
+		Mailer:             m,
+		Hooks:              a.hooks(),
+		OAuthStates:        a.mdb.OAuthStates(),
+		OAuthProviders:     a.oauthProviders(),
+		MagicLinks:         a.mdb.MagicLinks(),
+		Passkeys:           a.mdb.Passkeys(),
+		WebAuthnChallenges: a.mdb.WebAuthnChallenges(),
+		Signer:             signer,
+		SessionCipher:      sessionCipher,
+		Logger:             a.logger,
+		Cfg:                a.cfg,
 	})
 
 	if err != nil {
@@ -19,7 +110,113 @@ func (a *application) initDomains() error {
 
 	a.authDomain = authDomain
 
+	oidcDomain, err := oidc.NewService(a.ctx, oidc.ServiceConfigs{
+		Authenticator:           a.authDomain,
+		UsersRepository:         a.mdb.Users(),
+		ClientsRepository:       a.mdb.OIDCClients(),
+		CodesRepository:         a.mdb.OIDCCodes(),
+		RefreshTokensRepository: a.mdb.OIDCRefreshTokens(),
+		Signer:                  signer,
+		Logger:                  a.logger,
+		Cfg:                     a.cfg,
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to init oidc domain: %w", err)
+	}
+
+	a.oidcDomain = oidcDomain
+
 	a.logger.InfoContext(a.ctx, "domains initialized")
 
 	return nil
 }
+
+// hooks are the auth hooks of this deployment in the order they run,
+// custom ones are added here.
+func (a *application) hooks() []auth.Hook {
+	var hooks []auth.Hook
+
+	return hooks
+}
+
+func (a *application) oauthProviders() map[string]auth.OAuthProvider {
+	cfg := a.cfg.OAuth
+	providers := make(map[string]auth.OAuthProvider)
+
+	if cfg.Google.ClientID != "" {
+		issuer := cfg.Google.Issuer
+		if issuer == "" {
+			issuer = "https://accounts.google.com"
+		}
+		providers["google"] = oauth.NewOIDCProvider("google", oauth.ProviderConfig{
+			ClientID:     cfg.Google.ClientID,
+			ClientSecret: cfg.Google.ClientSecret,
+			Issuer:       issuer,
+			Scopes:       cfg.Google.Scopes,
+		})
+	}
+
+	if cfg.GitHub.ClientID != "" {
+		providers["github"] = oauth.NewGitHubProvider(oauth.ProviderConfig{
+			ClientID:     cfg.GitHub.ClientID,
+			ClientSecret: cfg.GitHub.ClientSecret,
+			AuthURL:      cfg.GitHub.AuthURL,
+			TokenURL:     cfg.GitHub.TokenURL,
+			APIURL:       cfg.GitHub.APIURL,
+			Scopes:       cfg.GitHub.Scopes,
+		})
+	}
+
+	if cfg.OIDC.ClientID != "" {
+		providers["oidc"] = oauth.NewOIDCProvider("oidc", oauth.ProviderConfig{
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			Issuer:       cfg.OIDC.Issuer,
+			Scopes:       cfg.OIDC.Scopes,
+		})
+	}
+
+	for name := range providers {
+		a.logger.InfoContext(a.ctx, "oauth provider enabled", "provider", name)
+	}
+
+	return providers
+}
+
+func (a *application) signer() (jwks.Signer, error) {
+	if a.cfg.OIDC.SigningKeyPath != "" {
+		return jwks.LoadSigner(a.cfg.OIDC.SigningKeyPath)
+	}
+
+	a.logger.WarnContext(a.ctx, "no signing key configured, generating one. issued tokens will not survive a restart")
+
+	return jwks.GenerateSigner()
+}
+
+func (a *application) sessionCipher() (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(a.cfg.Sessions.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encryption key: %w", err)
+	}
+
+	if len(key) == 0 {
+		a.logger.WarnContext(a.ctx, "no session encryption key configured, generating one. sessions will not survive a restart")
+
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+		}
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/events"
+	"github.com/rasulov-emirlan/poc-auth/internal/transport/webhook"
+)
+
+func (a *application) initEvents() error {
+	var publisher events.Publisher
+	if a.cfg.Events.Webhook.URL != "" {
+		publisher = webhook.NewPublisher(a.cfg)
+	}
+
+	eventsDomain, err := events.NewService(a.ctx, events.ServiceConfigs{
+		OutboxRepository: a.mdb.Outbox(),
+		Publisher:        publisher,
+		Logger:           a.logger,
+		Cfg:              a.cfg,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to init events domain: %w", err)
+	}
+
+	a.eventsDomain = eventsDomain
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		a.eventsDomain.Relay(ctx)
+	}()
+
+	a.cleanupFuncs = append(a.cleanupFuncs, func() {
+		cancel()
+		<-done
+
+		a.logger.InfoContext(a.ctx, "events relay stopped")
+	})
+
+	a.logger.InfoContext(a.ctx, "events relay started", "webhook", a.cfg.Events.Webhook.URL != "")
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"github.com/rasulov-emirlan/poc-auth/internal/transport/grpc"
+	"github.com/rasulov-emirlan/poc-auth/pkg/realip"
+)
+
+func (a *application) initGrpc() error {
+	if a.cfg.GRPC.Port == "" {
+		a.logger.InfoContext(a.ctx, "grpc server disabled")
+		return nil
+	}
+
+	ipResolver, err := realip.New(a.cfg.GRPC.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	srvr := grpc.NewServer(grpc.ServerConfigs{
+		Cfg:        a.cfg,
+		AuthDomain: a.authDomain,
+		Logger:     a.logger,
+		IPResolver: ipResolver,
+	})
+
+	a.cleanupFuncs = append(a.cleanupFuncs, func() {
+		if err := srvr.Shutdown(a.ctx); err != nil {
+			a.logger.ErrorContext(
+				a.ctx,
+				"failed to shutdown grpc server",
+				"err", err.Error(),
+			)
+		}
+
+		a.logger.InfoContext(a.ctx, "grpc server stopped")
+	})
+
+	go func() {
+		if err := srvr.Start(); err != nil {
+			a.fatal("failed to start grpc server", err)
+		}
+	}()
+
+	a.logger.InfoContext(a.ctx, "grpc server started", "port", a.cfg.GRPC.Port)
+
+	return nil
+}
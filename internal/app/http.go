@@ -1,11 +1,21 @@
 package app
 
-import "github.com/rasulov-emirlan/poc-auth/internal/transport/rest"
+import (
+	"github.com/rasulov-emirlan/poc-auth/internal/transport/rest"
+	"github.com/rasulov-emirlan/poc-auth/pkg/realip"
+)
 
 func (a *application) initHttp() error {
+	ipResolver, err := realip.New(a.cfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
 	srvr := rest.NewServer(rest.ServerConfigs{
 		Cfg:        a.cfg,
 		AuthDomain: a.authDomain,
+		OIDCDomain: a.oidcDomain,
+		IPResolver: ipResolver,
 	})
 
 	a.cleanupFuncs = append(a.cleanupFuncs, func() {
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/transport/smtp"
+)
+
+// initMailer starts the mailer when a sender is configured, emails are
+// sent by fusionauth otherwise.
+func (a *application) initMailer() error {
+	var sender mailer.Sender
+
+	switch a.cfg.Mailer.Sender {
+	case "":
+		a.logger.InfoContext(a.ctx, "no mailer sender configured, emails are sent by fusionauth")
+		return nil
+	case "smtp":
+		s, err := smtp.NewSender(a.cfg)
+		if err != nil {
+			return fmt.Errorf("failed to init smtp sender: %w", err)
+		}
+		sender = s
+	case "file":
+		sender = mailer.NewFileSender(a.cfg.Mailer.FileDir)
+	case "memory":
+		sender = mailer.NewMemorySender()
+	default:
+		return fmt.Errorf("unknown mailer sender %q", a.cfg.Mailer.Sender)
+	}
+
+	mailerDomain, err := mailer.NewService(a.ctx, mailer.ServiceConfigs{
+		QueueRepository: a.mdb.MailQueue(),
+		Sender:          sender,
+		Logger:          a.logger,
+		Cfg:             a.cfg,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to init mailer domain: %w", err)
+	}
+
+	a.mailerDomain = &mailerDomain
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		mailerDomain.Relay(ctx)
+	}()
+
+	a.cleanupFuncs = append(a.cleanupFuncs, func() {
+		cancel()
+		<-done
+
+		a.logger.InfoContext(a.ctx, "mail relay stopped")
+	})
+
+	a.logger.InfoContext(a.ctx, "mail relay started", "sender", a.cfg.Mailer.Sender)
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"context"
+)
+
+// initPrivacy starts the job that compiles data exports and erases
+// users' data.
+func (a *application) initPrivacy() error {
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		a.authDomain.ProcessDataRequests(ctx)
+	}()
+
+	a.cleanupFuncs = append(a.cleanupFuncs, func() {
+		cancel()
+		<-done
+
+		a.logger.InfoContext(a.ctx, "data requests job stopped")
+	})
+
+	a.logger.InfoContext(a.ctx, "data requests job started", "interval", a.cfg.Privacy.JobInterval)
+
+	return nil
+}
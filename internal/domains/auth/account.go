@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type accountsConfig struct {
+	emailChangeURL              string
+	emailChangeTemplateID       string
+	emailChangeTTL              time.Duration
+	emailChangeNoticeTemplateID string
+	deletionGracePeriod         time.Duration
+	deletionJobInterval         time.Duration
+	verificationURL             string
+	passwordResetURL            string
+}
+
+// UpdateProfile changes the user's names in fusionauth and in our
+// database. A new email is not applied right away, a confirmation link
+// is sent to it instead and the old address is told about it.
+func (s Service) UpdateProfile(ctx context.Context, user entities.User, update ProfileUpdate) (entities.User, error) {
+	// the email change is checked first, a rejected one must not leave
+	// the names updated
+	changeEmail := update.Email != nil && *update.Email != user.Email
+	if changeEmail {
+		if err := s.checkEmailChange(ctx, user, *update.Email, update.CurrentPassword); err != nil {
+			return entities.User{}, err
+		}
+	}
+
+	stored, err := s.usersRepo.GetByEmail(ctx, user.Email)
+	if err != nil {
+		return entities.User{}, err
+	}
+
+	patch := map[string]any{}
+	if update.Firstname != nil {
+		if strings.TrimSpace(*update.Firstname) == "" {
+			return entities.User{}, ErrFirstnameOrLastnameTooShort
+		}
+		stored.Firstname = *update.Firstname
+		patch["firstName"] = *update.Firstname
+	}
+	if update.Lastname != nil {
+		if strings.TrimSpace(*update.Lastname) == "" {
+			return entities.User{}, ErrFirstnameOrLastnameTooShort
+		}
+		stored.Lastname = *update.Lastname
+		patch["lastName"] = *update.Lastname
+	}
+
+	// the email change is started before the names are saved, if its
+	// link can not be sent the profile is left as it was
+	if changeEmail {
+		if err := s.requestEmailChange(ctx, user, *update.Email); err != nil {
+			return entities.User{}, err
+		}
+	}
+
+	if len(patch) > 0 {
+		_, errs, err := s.fusion(ctx).PatchUserWithContext(ctx, user.ProviderID, map[string]any{"user": patch})
+		if err != nil {
+			return entities.User{}, fmt.Errorf("failed to update user: %w", err)
+		}
+
+		if errs != nil {
+			return entities.User{}, fmt.Errorf("failed to update user: %s", errs.Error())
+		}
+
+		err = s.withTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			stored, err = s.usersRepo.Update(ctx, stored)
+			if err != nil {
+				return err
+			}
+
+			return s.publish(ctx, EventUserUpdated, map[string]any{
+				"user_id":   user.ProviderID,
+				"email":     stored.Email,
+				"firstname": stored.Firstname,
+				"lastname":  stored.Lastname,
+			})
+		})
+		if err != nil {
+			return entities.User{}, fmt.Errorf("failed to update user: %w", err)
+		}
+
+		s.log.DebugContext(ctx, "Updated profile", "user_id", user.ProviderID)
+	}
+
+	return stored, nil
+}
+
+// checkEmailChange makes sure the user knows their password, so a
+// stolen access token is not enough to take the account over, and that
+// the new email could have registered.
+func (s Service) checkEmailChange(ctx context.Context, user entities.User, newEmail, currentPassword string) error {
+	if err := s.checkCurrentPassword(ctx, user, currentPassword); err != nil {
+		return err
+	}
+
+	if err := s.checkEmailDomain(newEmail); err != nil {
+		return err
+	}
+
+	existing, _, err := s.fusion(ctx).RetrieveUserByEmailWithContext(ctx, newEmail)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if existing.StatusCode != http.StatusNotFound {
+		return ErrEmailTaken
+	}
+
+	return nil
+}
+
+func (s Service) requestEmailChange(ctx context.Context, user entities.User, newEmail string) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate email change token: %w", err)
+	}
+
+	now := time.Now()
+
+	err = s.emailChanges.Create(ctx, entities.EmailChange{
+		TokenHash: hashToken(token),
+		UserID:    user.ProviderID,
+		TenantID:  TenantFromContext(ctx),
+		Email:     user.Email,
+		NewEmail:  newEmail,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.accountsCfg.emailChangeTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save email change: %w", err)
+	}
+
+	link, err := url.Parse(s.accountsCfg.emailChangeURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse email change url: %w", err)
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	err = s.sendMail(ctx, mailer.TemplateEmailChange, s.accountsCfg.emailChangeTemplateID, recipient{address: newEmail}, map[string]any{
+		"link":       link.String(),
+		"expires_in": s.accountsCfg.emailChangeTTL.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email change link: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Requested email change", "user_id", user.ProviderID)
+
+	// the owner of the old address learns about the change while they
+	// can still do something about it
+	if s.mailer != nil || s.accountsCfg.emailChangeNoticeTemplateID != "" {
+		info := clientInfo(ctx)
+		err := s.sendMail(ctx, mailer.TemplateEmailChangeNotice, s.accountsCfg.emailChangeNoticeTemplateID, recipient{userID: user.ProviderID, address: user.Email}, map[string]any{
+			"new_email":   newEmail,
+			"ip":          info.IP,
+			"device_name": info.DeviceName,
+			"firstname":   user.Firstname,
+		})
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to send email change notice", "user_id", user.ProviderID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies the email change of the token sent to the
+// new address.
+func (s Service) ConfirmEmailChange(ctx context.Context, token string) error {
+	change, err := s.emailChanges.Take(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(change.ExpiresAt) || change.TenantID != TenantFromContext(ctx) {
+		return ErrInvalidEmailChange
+	}
+
+	// the new address has just been verified by following the link
+	_, errs, err := s.fusion(ctx).PatchUserWithContext(ctx, change.UserID, map[string]any{
+		"user":             map[string]any{"email": change.NewEmail},
+		"skipVerification": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change email: %w", err)
+	}
+
+	if errs != nil {
+		if _, ok := errs.FieldErrors["user.email"]; ok {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to change email: %s", errs.Error())
+	}
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.usersRepo.ChangeEmail(ctx, change.Email, change.NewEmail); err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventUserEmailChanged, map[string]any{
+			"user_id":   change.UserID,
+			"old_email": change.Email,
+			"email":     change.NewEmail,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change email: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Changed email", "user_id", change.UserID)
+
+	s.recordAudit(ctx, AuditEmailChanged, change.UserID, map[string]any{
+		"old_email": change.Email,
+		"new_email": change.NewEmail,
+	})
+
+	return nil
+}
+
+// DeleteAccount schedules the user's account for deletion and logs them
+// out everywhere. Logging in again before the grace period is over
+// cancels the deletion.
+func (s Service) DeleteAccount(ctx context.Context, user entities.User) (time.Time, error) {
+	stored, err := s.usersRepo.GetByEmail(ctx, user.Email)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	deleteAt := time.Now().Add(s.accountsCfg.deletionGracePeriod)
+	stored.DeletionScheduledAt = &deleteAt
+
+	if _, err := s.usersRepo.Update(ctx, stored); err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+
+	if _, err := s.revokeOtherSessions(ctx, user, ""); err != nil {
+		return time.Time{}, err
+	}
+
+	s.log.DebugContext(ctx, "Scheduled account deletion", "user_id", user.ProviderID, "delete_at", deleteAt)
+
+	s.recordAudit(ctx, AuditDeletionScheduled, user.ProviderID, map[string]any{
+		"delete_at": deleteAt,
+	})
+
+	return deleteAt, nil
+}
+
+// cancelDeletion is called on every login, it cancels a scheduled
+// account deletion and erasures that are not due yet. Failures are
+// logged, they must not keep the user from logging in.
+func (s Service) cancelDeletion(ctx context.Context, email string) {
+	user, err := s.usersRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, ErrEmailNotFound) {
+			s.log.ErrorContext(ctx, "failed to get user", "error", err)
+		}
+		return
+	}
+
+	if user.ProviderID != "" {
+		n, err := s.erasures.CancelScheduled(ctx, user.ProviderID, time.Now())
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to cancel erasure", "user_id", user.ProviderID, "error", err)
+		}
+		if n > 0 {
+			s.log.DebugContext(ctx, "Canceled erasure", "user_id", user.ProviderID)
+			s.recordAudit(ctx, AuditErasureCanceled, user.ProviderID, nil)
+		}
+	}
+
+	if user.DeletionScheduledAt == nil {
+		return
+	}
+
+	user.DeletionScheduledAt = nil
+
+	if _, err := s.usersRepo.Update(ctx, user); err != nil {
+		s.log.ErrorContext(ctx, "failed to cancel account deletion", "user_id", user.ProviderID, "error", err)
+		return
+	}
+
+	s.log.DebugContext(ctx, "Canceled account deletion", "user_id", user.ProviderID)
+
+	s.recordAudit(ctx, AuditDeletionCanceled, user.ProviderID, nil)
+}
+
+// PurgeDeletedAccounts hands accounts whose grace period has passed
+// over to erasure, until ctx is canceled. The erasure itself is done by
+// ProcessDataRequests.
+func (s Service) PurgeDeletedAccounts(ctx context.Context) {
+	ticker := time.NewTicker(s.accountsCfg.deletionJobInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.purgeDue(ctx); err != nil {
+			s.log.ErrorContext(ctx, "failed to purge deleted accounts", "err", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s Service) purgeDue(ctx context.Context) error {
+	users, err := s.usersRepo.ListDeletionDue(ctx, time.Now(), 100)
+	if err != nil {
+		return fmt.Errorf("failed to list accounts to delete: %w", err)
+	}
+
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		ctx := WithTenant(ctx, user.TenantID)
+
+		if user.ProviderID == "" {
+			user.ProviderID, err = s.lookupProviderID(ctx, user.Email)
+			if err != nil {
+				s.log.ErrorContext(ctx, "failed to look up user", "email", user.Email, "error", err)
+				continue
+			}
+		}
+
+		// the grace period is over, the erasure is due right away
+		record, err := s.createErasure(ctx, user, erasureAccountDeleted, nil)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to create erasure", "user_id", user.ProviderID, "error", err)
+			continue
+		}
+
+		// the pending erasure takes over, the account is not listed again
+		user.DeletionScheduledAt = nil
+		if _, err := s.usersRepo.Update(ctx, user); err != nil {
+			s.log.ErrorContext(ctx, "failed to clear scheduled deletion", "user_id", user.ProviderID, "error", err)
+		}
+
+		s.log.InfoContext(ctx, "Account deletion is due", "user_id", user.ProviderID, "erasure_id", record.ID)
+	}
+
+	return nil
+}
+
+// lookupProviderID returns the fusionauth id of the user, or an empty
+// string if fusionauth does not know the email.
+func (s Service) lookupProviderID(ctx context.Context, email string) (string, error) {
+	res, errs, err := s.fusion(ctx).RetrieveUserByEmailWithContext(ctx, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+
+	if errs != nil {
+		return "", fmt.Errorf("failed to retrieve user: %s", errs.Error())
+	}
+
+	return res.User.Id, nil
+}
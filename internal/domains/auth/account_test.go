@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+)
+
+type disposableList []string
+
+func (l disposableList) Contains(domain string) bool {
+	return slices.Contains(l, domain)
+}
+
+// newAccountService knows user@example.com with currentPassword, no
+// other email is registered at fusionauth.
+func newAccountService(t *testing.T) (Service, *testRepos) {
+	t.Helper()
+
+	var changes int
+	fusion := newPasswordStub(t, http.StatusOK, &changes)
+	fusion.handle("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("email") == "" {
+			t.Errorf("unexpected fusionauth call %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	s, repos := newTestService(fusion)
+	s.accountsCfg.emailChangeURL = "https://example.com/email"
+	s.registrationPolicy.disposable = disposableList{"mailinator.com"}
+
+	user := testSessionUser()
+	repos.users.users[userKey(context.Background(), user.Email)] = user
+
+	return s, repos
+}
+
+func TestUpdateProfileRequestsEmailChange(t *testing.T) {
+	s, repos := newAccountService(t)
+	newEmail := "new@example.com"
+
+	_, err := s.UpdateProfile(context.Background(), testSessionUser(), ProfileUpdate{Email: &newEmail, CurrentPassword: currentPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repos.emailChanges.changes) != 1 || repos.emailChanges.changes[0].NewEmail != newEmail {
+		t.Fatalf("email changes %+v", repos.emailChanges.changes)
+	}
+
+	want := []string{
+		mailer.TemplateEmailChange + " new@example.com",
+		mailer.TemplateEmailChangeNotice + " user@example.com",
+	}
+	if got := repos.mails.sent(); !slices.Equal(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+func TestUpdateProfileEmailChangeNeedsPassword(t *testing.T) {
+	for _, password := range []string{"", "wrong"} {
+		s, repos := newAccountService(t)
+		newEmail := "new@example.com"
+		firstname := "Mallory"
+
+		// names are not applied either, the stub fails on the patch
+		_, err := s.UpdateProfile(context.Background(), testSessionUser(), ProfileUpdate{Firstname: &firstname, Email: &newEmail, CurrentPassword: password})
+		if !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("password %q: error %v, want %v", password, err, ErrWrongPassword)
+		}
+
+		if len(repos.emailChanges.changes) != 0 || len(repos.mails.sent()) != 0 {
+			t.Errorf("password %q: email change was requested", password)
+		}
+	}
+}
+
+func TestUpdateProfileEmailChangeNotSent(t *testing.T) {
+	s, repos := newAccountService(t)
+	repos.mails.err = errors.New("mail queue unavailable")
+	user := testSessionUser()
+	newEmail := "new@example.com"
+	firstname := "Mallory"
+
+	// names are not applied either, the stub fails on the patch
+	_, err := s.UpdateProfile(context.Background(), user, ProfileUpdate{Firstname: &firstname, Email: &newEmail, CurrentPassword: currentPassword})
+	if !errors.Is(err, repos.mails.err) {
+		t.Fatalf("error %v, want %v", err, repos.mails.err)
+	}
+
+	if stored := repos.users.users[userKey(context.Background(), user.Email)]; stored.Firstname != user.Firstname {
+		t.Errorf("firstname changed to %q", stored.Firstname)
+	}
+	if len(repos.events.events) != 0 {
+		t.Errorf("events %v", repos.events.events)
+	}
+}
+
+func TestUpdateProfileEmailChangeAppliesRegistrationPolicy(t *testing.T) {
+	s, repos := newAccountService(t)
+	newEmail := "someone@mailinator.com"
+
+	_, err := s.UpdateProfile(context.Background(), testSessionUser(), ProfileUpdate{Email: &newEmail, CurrentPassword: currentPassword})
+	if !errors.Is(err, ErrDisposableEmail) {
+		t.Fatalf("error %v, want %v", err, ErrDisposableEmail)
+	}
+
+	s.registrationPolicy.blockedDomains = []string{"example.org"}
+	newEmail = "someone@example.org"
+
+	_, err = s.UpdateProfile(context.Background(), testSessionUser(), ProfileUpdate{Email: &newEmail, CurrentPassword: currentPassword})
+	if !errors.Is(err, ErrEmailDomainNotAllowed) {
+		t.Fatalf("error %v, want %v", err, ErrEmailDomainNotAllowed)
+	}
+
+	if len(repos.emailChanges.changes) != 0 {
+		t.Error("email change was requested")
+	}
+}
@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// apiKeyUseInterval limits how often the last use of a key is written,
+// keys can be used for every request.
+const apiKeyUseInterval = time.Minute
+
+type apiKeysConfig struct {
+	prefix          string
+	defaultTTL      time.Duration
+	maxTTL          time.Duration
+	rotationOverlap time.Duration
+}
+
+func (s Service) CreateServiceAccount(ctx context.Context, actorID, name, description string, scopes []string) (entities.ServiceAccount, error) {
+	if err := validateScopes(scopes); err != nil {
+		return entities.ServiceAccount{}, err
+	}
+
+	account := entities.ServiceAccount{
+		ID:          uuid.New().String(),
+		TenantID:    TenantFromContext(ctx),
+		Name:        name,
+		Description: description,
+		Scopes:      scopes,
+		CreatedBy:   actorID,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.serviceAccounts.Create(ctx, account); err != nil {
+		return entities.ServiceAccount{}, fmt.Errorf("failed to save service account: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Created service account", "service_account_id", account.ID)
+
+	s.recordAudit(ctx, AuditServiceAccountCreated, actorID, map[string]any{
+		"service_account_id": account.ID,
+		"scopes":             account.Scopes,
+	})
+
+	return account, nil
+}
+
+func (s Service) ListServiceAccounts(ctx context.Context) ([]entities.ServiceAccount, error) {
+	return s.serviceAccounts.List(ctx)
+}
+
+func (s Service) GetServiceAccount(ctx context.Context, id string) (entities.ServiceAccount, error) {
+	return s.serviceAccounts.Get(ctx, id)
+}
+
+// DeleteServiceAccount revokes all keys of the account and deletes it.
+func (s Service) DeleteServiceAccount(ctx context.Context, actorID, id string) error {
+	if _, err := s.serviceAccounts.Get(ctx, id); err != nil {
+		return err
+	}
+
+	revoked, err := s.apiKeys.RevokeByAccount(ctx, id, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke api keys: %w", err)
+	}
+
+	if err := s.serviceAccounts.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.log.DebugContext(ctx, "Deleted service account", "service_account_id", id, "revoked_keys", revoked)
+
+	s.recordAudit(ctx, AuditServiceAccountDeleted, actorID, map[string]any{
+		"service_account_id": id,
+		"revoked_keys":       revoked,
+	})
+
+	return nil
+}
+
+// CreateAPIKey issues a key for the service account. Without scopes the
+// key gets all scopes of the account, without a ttl the default one.
+// The returned key is the only time it is readable.
+func (s Service) CreateAPIKey(ctx context.Context, actorID, accountID, name string, scopes []string, ttl time.Duration) (NewAPIKey, error) {
+	account, err := s.serviceAccounts.Get(ctx, accountID)
+	if err != nil {
+		return NewAPIKey{}, err
+	}
+
+	if len(scopes) == 0 {
+		scopes = account.Scopes
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(account.Scopes, scope) {
+			return NewAPIKey{}, ErrScopeNotAllowed
+		}
+	}
+
+	if ttl == 0 {
+		ttl = s.apiKeysCfg.defaultTTL
+	}
+
+	if ttl < 0 || ttl > s.apiKeysCfg.maxTTL {
+		return NewAPIKey{}, ErrInvalidAPIKeyTTL
+	}
+
+	res, err := s.issueAPIKey(ctx, actorID, account.ID, name, scopes, ttl)
+	if err != nil {
+		return NewAPIKey{}, err
+	}
+
+	s.recordAudit(ctx, AuditAPIKeyCreated, actorID, map[string]any{
+		"service_account_id": account.ID,
+		"api_key_id":         res.Key.ID,
+		"scopes":             res.Key.Scopes,
+		"expires_at":         res.Key.ExpiresAt,
+	})
+
+	return res, nil
+}
+
+func (s Service) ListAPIKeys(ctx context.Context, accountID string) ([]entities.APIKey, error) {
+	if _, err := s.serviceAccounts.Get(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	return s.apiKeys.ListByAccount(ctx, accountID)
+}
+
+// RotateAPIKey issues a replacement with the same scopes and lifetime.
+// The old key keeps working for the rotation overlap.
+func (s Service) RotateAPIKey(ctx context.Context, actorID, keyID string) (NewAPIKey, error) {
+	old, err := s.apiKeys.Get(ctx, keyID)
+	if err != nil {
+		return NewAPIKey{}, err
+	}
+
+	now := time.Now()
+	if old.RevokedAt != nil || !now.Before(old.ExpiresAt) {
+		return NewAPIKey{}, ErrAPIKeyRevoked
+	}
+
+	ttl := old.ExpiresAt.Sub(old.CreatedAt)
+	if ttl > s.apiKeysCfg.maxTTL {
+		ttl = s.apiKeysCfg.maxTTL
+	}
+
+	res, err := s.issueAPIKey(ctx, actorID, old.ServiceAccountID, old.Name, old.Scopes, ttl)
+	if err != nil {
+		return NewAPIKey{}, err
+	}
+
+	expiresAt := now.Add(s.apiKeysCfg.rotationOverlap)
+	if old.ExpiresAt.Before(expiresAt) {
+		expiresAt = old.ExpiresAt
+	}
+
+	if err := s.apiKeys.Replace(ctx, old.ID, res.Key.ID, expiresAt); err != nil {
+		return NewAPIKey{}, fmt.Errorf("failed to update rotated api key: %w", err)
+	}
+
+	s.recordAudit(ctx, AuditAPIKeyRotated, actorID, map[string]any{
+		"service_account_id": old.ServiceAccountID,
+		"api_key_id":         old.ID,
+		"replaced_by":        res.Key.ID,
+		"old_expires_at":     expiresAt,
+	})
+
+	return res, nil
+}
+
+func (s Service) RevokeAPIKey(ctx context.Context, actorID, keyID string) error {
+	key, err := s.apiKeys.Get(ctx, keyID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.apiKeys.Revoke(ctx, key.ID, time.Now()); err != nil {
+		return err
+	}
+
+	s.log.DebugContext(ctx, "Revoked api key", "api_key_id", key.ID)
+
+	s.recordAudit(ctx, AuditAPIKeyRevoked, actorID, map[string]any{
+		"service_account_id": key.ServiceAccountID,
+		"api_key_id":         key.ID,
+	})
+
+	return nil
+}
+
+// AuthenticateAPIKey returns the service account and key an API key
+// belongs to. Every failure is ErrInvalidAPIKey, rejected keys of known
+// ids are written to the audit log.
+func (s Service) AuthenticateAPIKey(ctx context.Context, apiKey string) (entities.ServiceAccount, entities.APIKey, error) {
+	id, secret, ok := s.parseAPIKey(apiKey)
+	if !ok {
+		return entities.ServiceAccount{}, entities.APIKey{}, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeys.Get(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return entities.ServiceAccount{}, entities.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return entities.ServiceAccount{}, entities.APIKey{}, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	now := time.Now()
+
+	reason := ""
+	switch {
+	case subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.SecretHash)) != 1:
+		reason = "wrong_secret"
+	case key.RevokedAt != nil:
+		reason = "revoked"
+	case !now.Before(key.ExpiresAt):
+		reason = "expired"
+	}
+
+	if reason != "" {
+		s.recordAudit(ctx, AuditAPIKeyRejected, key.ServiceAccountID, map[string]any{
+			"api_key_id": key.ID,
+			"reason":     reason,
+		})
+		return entities.ServiceAccount{}, entities.APIKey{}, ErrInvalidAPIKey
+	}
+
+	account, err := s.serviceAccounts.Get(ctx, key.ServiceAccountID)
+	if errors.Is(err, ErrServiceAccountNotFound) {
+		return entities.ServiceAccount{}, entities.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return entities.ServiceAccount{}, entities.APIKey{}, fmt.Errorf("failed to get service account: %w", err)
+	}
+
+	ip := clientInfo(ctx).IP
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUseInterval || key.LastUsedIP != ip {
+		if err := s.apiKeys.MarkUsed(ctx, key.ID, now, ip); err != nil {
+			s.log.ErrorContext(ctx, "failed to record api key use", "api_key_id", key.ID, "error", err)
+		}
+		key.LastUsedAt = &now
+		key.LastUsedIP = ip
+	}
+
+	return account, key, nil
+}
+
+func (s Service) issueAPIKey(ctx context.Context, actorID, accountID, name string, scopes []string, ttl time.Duration) (NewAPIKey, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return NewAPIKey{}, fmt.Errorf("failed to generate api key id: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return NewAPIKey{}, fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	now := time.Now()
+	prefix := s.apiKeysCfg.prefix + "_" + id
+
+	key := entities.APIKey{
+		ID:               id,
+		ServiceAccountID: accountID,
+		TenantID:         TenantFromContext(ctx),
+		Name:             name,
+		Prefix:           prefix,
+		SecretHash:       hashToken(secret),
+		Scopes:           scopes,
+		CreatedBy:        actorID,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(ttl),
+	}
+
+	if err := s.apiKeys.Create(ctx, key); err != nil {
+		return NewAPIKey{}, fmt.Errorf("failed to save api key: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Issued api key", "service_account_id", accountID, "api_key_id", id)
+
+	return NewAPIKey{Key: key, APIKey: prefix + "_" + secret}, nil
+}
+
+// parseAPIKey splits <prefix>_<id>_<secret>. The id is hex and the
+// prefix is configured without underscores, the secret may have them.
+func (s Service) parseAPIKey(apiKey string) (id, secret string, ok bool) {
+	prefix, rest, ok := strings.Cut(apiKey, "_")
+	if !ok || prefix != s.apiKeysCfg.prefix {
+		return "", "", false
+	}
+
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+
+	return id, secret, true
+}
+
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if strings.TrimSpace(scope) == "" || strings.ContainsAny(scope, " \t\n") {
+			return ErrInvalidScope
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// newAPIKeyService has the service account sa-1 with the read and admin
+// scopes.
+func newAPIKeyService(t *testing.T) (Service, *testRepos) {
+	t.Helper()
+
+	s, repos := newTestService(newFusionStub(t))
+	repos.serviceAccounts.accounts = append(repos.serviceAccounts.accounts, entities.ServiceAccount{
+		ID:     "sa-1",
+		Name:   "ci",
+		Scopes: []string{"read", "admin"},
+	})
+
+	return s, repos
+}
+
+// rejectReasons lists the reasons of rejected keys in the audit log.
+func rejectReasons(repos *testRepos) []string {
+	repos.audit.mu.Lock()
+	defer repos.audit.mu.Unlock()
+
+	var res []string
+	for _, e := range repos.audit.events {
+		if e.Type == AuditAPIKeyRejected {
+			res = append(res, e.Data["reason"].(string))
+		}
+	}
+	return res
+}
+
+func TestParseAPIKey(t *testing.T) {
+	s := Service{apiKeysCfg: apiKeysConfig{prefix: "pk"}}
+
+	tests := []struct {
+		apiKey string
+		id     string
+		secret string
+		ok     bool
+	}{
+		{apiKey: "pk_0123abcd_secret", id: "0123abcd", secret: "secret", ok: true},
+		{apiKey: "pk_0123abcd_sec_ret", id: "0123abcd", secret: "sec_ret", ok: true},
+		{apiKey: "sk_0123abcd_secret"},
+		{apiKey: "pk0123abcd_secret"},
+		{apiKey: "pk_0123abcd"},
+		{apiKey: "pk__secret"},
+		{apiKey: "pk_0123abcd_"},
+		{apiKey: ""},
+	}
+
+	for _, tt := range tests {
+		id, secret, ok := s.parseAPIKey(tt.apiKey)
+		if id != tt.id || secret != tt.secret || ok != tt.ok {
+			t.Errorf("parseAPIKey(%q) = %q, %q, %v, want %q, %q, %v", tt.apiKey, id, secret, ok, tt.id, tt.secret, tt.ok)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	s, repos := newAPIKeyService(t)
+	ctx := context.Background()
+
+	res, err := s.CreateAPIKey(ctx, "admin-1", "sa-1", "deploy", []string{"read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, key, err := s.AuthenticateAPIKey(ctx, res.APIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != "sa-1" || key.ID != res.Key.ID {
+		t.Errorf("authenticated %s with key %s, want sa-1 with %s", account.ID, key.ID, res.Key.ID)
+	}
+	if key.LastUsedAt == nil {
+		t.Error("use of the key is not recorded")
+	}
+
+	// same id and length, one character of the secret differs
+	wrong := []byte(res.APIKey)
+	wrong[len(wrong)-1] ^= 1
+	if _, _, err := s.AuthenticateAPIKey(ctx, string(wrong)); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("wrong secret: error %v, want %v", err, ErrInvalidAPIKey)
+	}
+
+	if _, _, err := s.AuthenticateAPIKey(ctx, "pk_unknown_secret"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("unknown key: error %v, want %v", err, ErrInvalidAPIKey)
+	}
+
+	if got := rejectReasons(repos); len(got) != 1 || got[0] != "wrong_secret" {
+		t.Errorf("rejected %v, want [wrong_secret]", got)
+	}
+}
+
+func TestAuthenticateAPIKeyExpiredOrRevoked(t *testing.T) {
+	tests := []struct {
+		reason string
+		update func(*entities.APIKey)
+	}{
+		{"expired", func(k *entities.APIKey) { k.ExpiresAt = time.Now().Add(-time.Second) }},
+		{"revoked", func(k *entities.APIKey) {
+			revokedAt := time.Now()
+			k.RevokedAt = &revokedAt
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			s, repos := newAPIKeyService(t)
+			ctx := context.Background()
+
+			res, err := s.CreateAPIKey(ctx, "admin-1", "sa-1", "deploy", nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := repos.apiKeys.update(res.Key.ID, tt.update); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := s.AuthenticateAPIKey(ctx, res.APIKey); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Fatalf("error %v, want %v", err, ErrInvalidAPIKey)
+			}
+			if got := rejectReasons(repos); len(got) != 1 || got[0] != tt.reason {
+				t.Errorf("rejected %v, want [%s]", got, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		overlap  time.Duration
+		oldWorks bool
+	}{
+		{name: "overlap", overlap: time.Hour, oldWorks: true},
+		{name: "no overlap", overlap: 0, oldWorks: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newAPIKeyService(t)
+			s.apiKeysCfg.rotationOverlap = tt.overlap
+			ctx := context.Background()
+
+			old, err := s.CreateAPIKey(ctx, "admin-1", "sa-1", "deploy", nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rotated, err := s.RotateAPIKey(ctx, "admin-1", old.Key.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rotated.APIKey == old.APIKey {
+				t.Fatal("rotation kept the secret")
+			}
+			if !slices.Equal(rotated.Key.Scopes, old.Key.Scopes) {
+				t.Errorf("rotated scopes %v, want %v", rotated.Key.Scopes, old.Key.Scopes)
+			}
+
+			if _, _, err := s.AuthenticateAPIKey(ctx, rotated.APIKey); err != nil {
+				t.Errorf("new key: %v", err)
+			}
+
+			_, _, err = s.AuthenticateAPIKey(ctx, old.APIKey)
+			if tt.oldWorks && err != nil {
+				t.Errorf("old key during the overlap: %v", err)
+			}
+			if !tt.oldWorks && !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("old key: error %v, want %v", err, ErrInvalidAPIKey)
+			}
+		})
+	}
+}
+
+func TestRotateAPIKeyKeepsEarlierExpiry(t *testing.T) {
+	s, repos := newAPIKeyService(t)
+	s.apiKeysCfg.rotationOverlap = 24 * time.Hour
+	ctx := context.Background()
+
+	old, err := s.CreateAPIKey(ctx, "admin-1", "sa-1", "deploy", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RotateAPIKey(ctx, "admin-1", old.Key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := repos.apiKeys.Get(ctx, old.Key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.ExpiresAt.Equal(old.Key.ExpiresAt) {
+		t.Errorf("rotated key expires at %v, want %v", key.ExpiresAt, old.Key.ExpiresAt)
+	}
+}
+
+func TestCreateAPIKeyLimits(t *testing.T) {
+	s, _ := newAPIKeyService(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		scopes []string
+		ttl    time.Duration
+		want   error
+	}{
+		{"account scopes", nil, 0, nil},
+		{"subset", []string{"read"}, time.Hour, nil},
+		{"max ttl", nil, s.apiKeysCfg.maxTTL, nil},
+		{"scope of other account", []string{"write"}, 0, ErrScopeNotAllowed},
+		{"ttl over max", nil, s.apiKeysCfg.maxTTL + time.Second, ErrInvalidAPIKeyTTL},
+		{"negative ttl", nil, -time.Hour, ErrInvalidAPIKeyTTL},
+	}
+
+	for _, tt := range tests {
+		_, err := s.CreateAPIKey(ctx, "admin-1", "sa-1", "deploy", tt.scopes, tt.ttl)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// recordAudit writes to the audit log. Failures are logged and do not
+// fail the request that triggered them.
+func (s Service) recordAudit(ctx context.Context, eventType, userID string, data map[string]any) {
+	info := clientInfo(ctx)
+
+	err := s.audit.Add(ctx, entities.AuditEvent{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		UserID:     userID,
+		TenantID:   TenantFromContext(ctx),
+		IP:         info.IP,
+		UserAgent:  info.UserAgent,
+		Data:       data,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to write audit log", "type", eventType, "user_id", userID, "error", err)
+	}
+}
@@ -3,8 +3,115 @@ package auth
 import "errors"
 
 var (
-	ErrEmailNotFound               = errors.New("email not found")
-	ErrEmailTaken                  = errors.New("email taken")
-	ErrPasswordTooShort            = errors.New("password must be at least 8 characters long")
-	ErrFirstnameOrLastnameTooShort = errors.New("firstname and lastname must be at least 1 character long")
+	ErrEmailNotFound                = errors.New("email not found")
+	ErrEmailTaken                   = errors.New("email taken")
+	ErrInvalidCredentials           = errors.New("invalid email or password")
+	ErrInvalidToken                 = errors.New("access token is invalid or expired")
+	ErrPasswordTooShort             = errors.New("password is too short")
+	ErrPasswordTooLong              = errors.New("password is too long")
+	ErrPasswordTooSimple            = errors.New("password does not contain the required kinds of characters")
+	ErrPasswordContainsPersonalInfo = errors.New("password must not contain your email or name")
+	ErrPasswordReused               = errors.New("password was used recently")
+	ErrPasswordBreached             = errors.New("password has appeared in a data breach")
+	ErrFirstnameOrLastnameTooShort  = errors.New("firstname and lastname must be at least 1 character long")
+	ErrUnknownOAuthProvider         = errors.New("unknown oauth provider")
+	ErrInvalidOAuthState            = errors.New("invalid or expired oauth state")
+	ErrOAuthEmailNotVerified        = errors.New("identity provider did not return a verified email")
+	ErrOAuthAccountNotVerified      = errors.New("an account with this email exists but is not verified, verify it or log in with its password")
+	ErrInvalidMagicLink             = errors.New("magic link is invalid, expired or already used")
+	ErrTooManyRequests              = errors.New("too many requests, try again later")
+	ErrPasskeyExists                = errors.New("passkey is already registered")
+	ErrInvalidPasskeyChallenge      = errors.New("passkey challenge is invalid or expired")
+	ErrInvalidPasskey               = errors.New("passkey verification failed")
+	ErrPasskeyCloned                = errors.New("passkey sign count did not increase, the authenticator may be cloned")
+	ErrSessionNotFound              = errors.New("session not found or revoked")
+	ErrWrongPassword                = errors.New("current password is incorrect")
+	ErrInvalidEmailChange           = errors.New("email change link is invalid or expired")
+	ErrRefreshTokenReused           = errors.New("refresh token was already used, the session has been revoked")
+	ErrDataExportNotFound           = errors.New("data export not found")
+	ErrDataExportNotReady           = errors.New("data export is not ready yet")
+	ErrErasureNotFound              = errors.New("erasure record not found")
+	ErrRegistrationDisabled         = errors.New("registration is disabled")
+	ErrServiceAccountNotFound       = errors.New("service account not found")
+	ErrAPIKeyNotFound               = errors.New("api key not found")
+	ErrInvalidAPIKey                = errors.New("api key is invalid, expired or revoked")
+	ErrAPIKeyRevoked                = errors.New("api key is already revoked or expired")
+	ErrInvalidAPIKeyTTL             = errors.New("api key lifetime is negative or exceeds the maximum")
+	ErrInvalidScope                 = errors.New("scopes must not be empty or contain spaces")
+	ErrScopeNotAllowed              = errors.New("api key scopes must be scopes of its service account")
+	ErrOrganizationNotFound         = errors.New("organization not found")
+	ErrMembershipNotFound           = errors.New("user is not a member of the organization")
+	ErrNotOrganizationMember        = errors.New("you are not a member of the organization")
+	ErrAlreadyOrganizationMember    = errors.New("user is already a member of the organization")
+	ErrOrganizationRoleRequired     = errors.New("your organization role does not allow this")
+	ErrInvalidOrganizationRole      = errors.New("roles must be owner, admin or member")
+	ErrLastOrganizationOwner        = errors.New("organization must keep an owner")
+	ErrInvalidInvitation            = errors.New("invitation is invalid, expired or already accepted")
+	ErrInvitationEmailMismatch      = errors.New("invitation was sent to another email")
+	ErrInvitationNotFound           = errors.New("invitation not found")
+	ErrUserNotFound                 = errors.New("user not found")
+	ErrImpersonationNotFound        = errors.New("impersonation not found")
+	ErrImpersonationNotAllowed      = errors.New("user can not be impersonated")
+	ErrImpersonationReadOnly        = errors.New("impersonation is read only")
+	ErrImpersonationForbidden       = errors.New("not allowed while impersonating")
+	ErrInvalidImpersonationTTL      = errors.New("impersonation lifetime is negative or exceeds the maximum")
+	ErrHookRejected                 = errors.New("rejected by hook")
+	ErrEmailDomainNotAllowed        = errors.New("email domain is not allowed to register")
+	ErrDisposableEmail              = errors.New("disposable email addresses can not register")
+	ErrInvitationRequired           = errors.New("registration requires an invitation")
+)
+
+// Risks of a login reported by login alerts.
+const (
+	LoginRiskNewDevice        = "new_device"
+	LoginRiskNewCountry       = "new_country"
+	LoginRiskImpossibleTravel = "impossible_travel"
+)
+
+const (
+	AuditRefreshTokenReused    = "session.refresh_token_reused"
+	AuditPasswordChanged       = "user.password_changed"
+	AuditEmailChanged          = "user.email_changed"
+	AuditDeletionScheduled     = "user.deletion_scheduled"
+	AuditDeletionCanceled      = "user.deletion_canceled"
+	AuditUserDeleted           = "user.deleted"
+	AuditDataExportRequested   = "user.data_export_requested"
+	AuditErasureRequested      = "user.erasure_requested"
+	AuditErasureCanceled       = "user.erasure_canceled"
+	AuditServiceAccountCreated = "service_account.created"
+	AuditServiceAccountDeleted = "service_account.deleted"
+	AuditAPIKeyCreated         = "api_key.created"
+	AuditAPIKeyRotated         = "api_key.rotated"
+	AuditAPIKeyRevoked         = "api_key.revoked"
+	AuditAPIKeyRejected        = "api_key.rejected"
+	AuditOrganizationCreated   = "organization.created"
+	AuditOrganizationDeleted   = "organization.deleted"
+	AuditOrganizationSwitched  = "organization.switched"
+	AuditInvitationCreated     = "invitation.created"
+	AuditInvitationAccepted    = "invitation.accepted"
+	AuditInvitationRevoked     = "invitation.revoked"
+	AuditMembershipUpdated     = "membership.updated"
+	AuditMembershipRemoved     = "membership.removed"
+	AuditImpersonationStarted  = "impersonation.started"
+	AuditImpersonationEnded    = "impersonation.ended"
+	AuditSuspiciousLogin       = "session.suspicious_login"
+)
+
+const (
+	EventUserRegistered      = "user.registered"
+	EventUserEmailVerified   = "user.email_verified"
+	EventUserPasswordChanged = "user.password_changed"
+	EventUserUpdated         = "user.updated"
+	EventUserEmailChanged    = "user.email_changed"
+	EventUserDeleted         = "user.deleted"
+
+	EventOrganizationCreated       = "organization.created"
+	EventOrganizationDeleted       = "organization.deleted"
+	EventOrganizationMemberAdded   = "organization.member_added"
+	EventOrganizationMemberRemoved = "organization.member_removed"
+
+	EventImpersonationStarted = "impersonation.started"
+	EventImpersonationEnded   = "impersonation.ended"
+
+	EventSuspiciousLogin = "session.suspicious_login"
 )
@@ -1,18 +1,174 @@
 package auth
 
 import (
+	"crypto/cipher"
 	"log/slog"
+	"time"
 
 	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
 )
 
 type ServiceConfigs struct {
-	UsersRepository UsersRepository
-	Logger          *slog.Logger
-	Cfg             config.Config
+	UsersRepository      UsersRepository
+	Sessions             SessionsRepository
+	RotatedRefreshTokens RotatedRefreshTokensRepository
+	Audit                AuditRepository
+	PasswordHistory      PasswordHistoryRepository
+	EmailChanges         EmailChangesRepository
+	DataExports          DataExportsRepository
+	ServiceAccounts      ServiceAccountsRepository
+	APIKeys              APIKeysRepository
+	Organizations        OrganizationsRepository
+	Memberships          MembershipsRepository
+	Invitations          InvitationsRepository
+	Impersonations       ImpersonationsRepository
+	KnownDevices         KnownDevicesRepository
+	Erasures             ErasuresRepository
+	// PersonalDataStores are the stores outside of this domain that
+	// take part in erasures, keyed by a name shown in erasure records.
+	PersonalDataStores map[string]PersonalDataStore
+	// BreachedPasswords is optional, passwords are not checked against
+	// a breach list without it.
+	BreachedPasswords BreachedPasswords
+	// DisposableDomains is optional, disposable emails can register
+	// without it.
+	DisposableDomains DisposableDomains
+	// GeoLocator is optional, login alerts only compare devices
+	// without it.
+	GeoLocator GeoLocator
+	Events     EventsPublisher
+	// Transactor is optional, without it events are written to the
+	// outbox separately from the changes they report.
+	Transactor Transactor
+	// Mailer is optional, emails are sent by fusionauth without it.
+	Mailer Mailer
+	// Hooks run in order around registration, login, refresh and
+	// password resets.
+	Hooks              []Hook
+	OAuthStates        OAuthStateRepository
+	OAuthProviders     map[string]OAuthProvider
+	MagicLinks         MagicLinksRepository
+	Passkeys           PasskeysRepository
+	WebAuthnChallenges WebAuthnChallengesRepository
+	Signer             jwks.Signer
+	// SessionCipher encrypts the fusionauth refresh tokens kept in
+	// sessions.
+	SessionCipher cipher.AEAD
+	Logger        *slog.Logger
+	Cfg           config.Config
 }
 
 type Session struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
+
+// SessionInfo is a device the user is logged in on.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// DataExportArchive is everything stored about a user, as handed out
+// by a data export.
+type DataExportArchive struct {
+	GeneratedAt     time.Time              `json:"generated_at"`
+	Profile         *entities.User         `json:"profile,omitempty"`
+	Provider        any                    `json:"provider,omitempty"`
+	Sessions        []SessionInfo          `json:"sessions"`
+	Passkeys        []entities.Passkey     `json:"passkeys"`
+	KnownDevices    []entities.KnownDevice `json:"known_devices"`
+	PasswordChanges []time.Time            `json:"password_changes"`
+	AuditEvents     []entities.AuditEvent  `json:"audit_events"`
+	Memberships     []entities.Membership  `json:"memberships"`
+}
+
+// UserOrganization is an organization the user is a member of.
+type UserOrganization struct {
+	entities.Organization
+	Roles  []string `json:"roles"`
+	Active bool     `json:"active"`
+}
+
+// ErasureVerification is an erasure record and whether its digest
+// matches its contents.
+type ErasureVerification struct {
+	Record   entities.ErasureRecord `json:"record"`
+	Verified bool                   `json:"verified"`
+}
+
+// TokenIntrospection describes an access token as defined by RFC 7662.
+// Only Active is set for tokens that are not active.
+type TokenIntrospection struct {
+	Active    bool     `json:"active"`
+	Subject   string   `json:"sub,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Tenant    string   `json:"tenant,omitempty"`
+	OrgID     string   `json:"org_id,omitempty"`
+	// Act is the admin impersonating the user.
+	Act *Actor `json:"act,omitempty"`
+}
+
+// Actor is who acts on behalf of the subject of a token.
+type Actor struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+}
+
+// ImpersonationToken is an access token for an impersonated user. It
+// can not be refreshed.
+type ImpersonationToken struct {
+	AccessToken   string                 `json:"access_token"`
+	TokenType     string                 `json:"token_type"`
+	ExpiresAt     time.Time              `json:"expires_at"`
+	Impersonation entities.Impersonation `json:"impersonation"`
+}
+
+// NewAPIKey is a key that has just been issued. APIKey is what clients
+// send, it can not be read again later.
+type NewAPIKey struct {
+	Key    entities.APIKey `json:"key"`
+	APIKey string          `json:"api_key"`
+}
+
+// ProfileUpdate holds the profile fields to change, nil fields are
+// left as they are. Changing the email needs CurrentPassword.
+type ProfileUpdate struct {
+	Firstname       *string
+	Lastname        *string
+	Email           *string
+	CurrentPassword string
+}
+
+// ExternalIdentity is what an OAuthProvider knows about the user after
+// a successful authorization.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Firstname     string
+	Lastname      string
+}
+
+// PasskeyChallenge is returned by the begin steps of a ceremony. The
+// options are passed to navigator.credentials.create or .get in the
+// browser, the ID has to be sent back with the finish request.
+type PasskeyChallenge struct {
+	ID      string `json:"challenge_id"`
+	Options any    `json:"options"`
+}
@@ -0,0 +1,1110 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// fusionStub stands in for fusionauth. Tests register the endpoints
+// they expect on mux, calls to any other endpoint fail the test.
+type fusionStub struct {
+	*httptest.Server
+	mux *http.ServeMux
+}
+
+func newFusionStub(t *testing.T) *fusionStub {
+	t.Helper()
+
+	stub := &fusionStub{mux: http.NewServeMux()}
+	stub.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected fusionauth call %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotImplemented)
+	})
+	stub.Server = httptest.NewServer(stub.mux)
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func (f *fusionStub) handle(pattern string, handler http.HandlerFunc) {
+	f.mux.HandleFunc(pattern, handler)
+}
+
+// client returns a fusionauth client calling the stub.
+func (f *fusionStub) client() *fusionauth.FusionAuthClient {
+	u, _ := url.Parse(f.URL)
+	return fusionauth.NewClient(f.Client(), u, "key")
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, status int, v any) {
+	t.Helper()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+func readJSON(t *testing.T, r *http.Request, v any) {
+	t.Helper()
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		t.Errorf("failed to decode %s %s: %v", r.Method, r.URL, err)
+	}
+}
+
+// newTestService returns a service talking to the fusionauth stub with
+// in memory repositories.
+func newTestService(fusion *fusionStub) (Service, *testRepos) {
+	repos := newTestRepos()
+
+	block, _ := aes.NewCipher(make([]byte, 32))
+	sessionCipher, _ := cipher.NewGCM(block)
+
+	return Service{
+		usersRepo:          repos.users,
+		sessions:           repos.sessions,
+		rotatedTokens:      repos.rotatedTokens,
+		passwordHistory:    repos.passwords,
+		emailChanges:       repos.emailChanges,
+		mailer:             repos.mails,
+		erasures:           repos.erasures,
+		organizations:      repos.organizations,
+		memberships:        repos.memberships,
+		invitations:        repos.invitations,
+		knownDevices:       repos.knownDevices,
+		oauthStates:        repos.oauthStates,
+		sessionCipher:      sessionCipher,
+		audit:              repos.audit,
+		events:             repos.events,
+		passkeys:           repos.passkeys,
+		webauthnChallenges: repos.challenges,
+		serviceAccounts:    repos.serviceAccounts,
+		apiKeys:            repos.apiKeys,
+		impersonations:     repos.impersonations,
+		sessionTTL:         time.Hour,
+		fusionClient:       fusion.client(),
+		applicationId:      "app",
+		log:                slog.New(slog.NewTextHandler(io.Discard, nil)),
+		apiKeysCfg: apiKeysConfig{
+			prefix:          "pk",
+			defaultTTL:      24 * time.Hour,
+			maxTTL:          30 * 24 * time.Hour,
+			rotationOverlap: time.Hour,
+		},
+	}, repos
+}
+
+type testRepos struct {
+	users         *memoryUsers
+	sessions      *memorySessions
+	rotatedTokens *memoryRotatedTokens
+	passwords     *memoryPasswordHistory
+	emailChanges  *memoryEmailChanges
+	mails         *memoryMailer
+	erasures      *memoryErasures
+	organizations *memoryOrganizations
+	memberships   *memoryMemberships
+	invitations   *memoryInvitations
+	knownDevices  *memoryKnownDevices
+	oauthStates   *memoryOAuthStates
+	audit         *memoryAudit
+	events        *memoryEvents
+	passkeys      *memoryPasskeys
+	challenges    *memoryChallenges
+
+	serviceAccounts *memoryServiceAccounts
+	apiKeys         *memoryAPIKeys
+	impersonations  *memoryImpersonations
+}
+
+func newTestRepos() *testRepos {
+	return &testRepos{
+		users:         &memoryUsers{users: make(map[string]entities.User)},
+		sessions:      &memorySessions{},
+		rotatedTokens: &memoryRotatedTokens{},
+		passwords:     &memoryPasswordHistory{},
+		emailChanges:  &memoryEmailChanges{},
+		mails:         &memoryMailer{},
+		erasures:      &memoryErasures{},
+		organizations: &memoryOrganizations{},
+		memberships:   &memoryMemberships{},
+		invitations:   &memoryInvitations{},
+		knownDevices:  &memoryKnownDevices{},
+		oauthStates:   &memoryOAuthStates{},
+		audit:         &memoryAudit{},
+		events:        &memoryEvents{},
+		passkeys:      &memoryPasskeys{},
+		challenges:    &memoryChallenges{challenges: make(map[string]entities.WebAuthnChallenge)},
+
+		serviceAccounts: &memoryServiceAccounts{},
+		apiKeys:         &memoryAPIKeys{},
+		impersonations:  &memoryImpersonations{},
+	}
+}
+
+// memoryUsers keys users by tenant and email like the unique index of
+// the users collection.
+type memoryUsers struct {
+	mu    sync.Mutex
+	users map[string]entities.User
+}
+
+func userKey(ctx context.Context, email string) string {
+	return TenantFromContext(ctx) + "/" + email
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user entities.User) (entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := userKey(ctx, user.Email)
+	if _, ok := r.users[key]; ok {
+		return entities.User{}, ErrEmailTaken
+	}
+	r.users[key] = user
+	return user, nil
+}
+
+func (r *memoryUsers) GetByEmail(ctx context.Context, email string) (entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userKey(ctx, email)]
+	if !ok {
+		return entities.User{}, ErrEmailNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUsers) Update(ctx context.Context, user entities.User) (entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := userKey(ctx, user.Email)
+	if _, ok := r.users[key]; !ok {
+		return entities.User{}, ErrEmailNotFound
+	}
+	r.users[key] = user
+	return user, nil
+}
+
+func (r *memoryUsers) ChangeEmail(ctx context.Context, email, newEmail string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userKey(ctx, email)]
+	if !ok {
+		return ErrEmailNotFound
+	}
+	delete(r.users, userKey(ctx, email))
+	user.Email = newEmail
+	r.users[userKey(ctx, newEmail)] = user
+	return nil
+}
+
+func (r *memoryUsers) ListDeletionDue(ctx context.Context, now time.Time, limit int) ([]entities.User, error) {
+	return nil, nil
+}
+
+func (r *memoryUsers) Delete(ctx context.Context, email string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userKey(ctx, email)]; !ok {
+		return 0, nil
+	}
+	delete(r.users, userKey(ctx, email))
+	return 1, nil
+}
+
+type memorySessions struct {
+	mu       sync.Mutex
+	sessions []entities.UserSession
+}
+
+func (r *memorySessions) Create(ctx context.Context, session entities.UserSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sessions = append(r.sessions, session)
+	return nil
+}
+
+func (r *memorySessions) GetByTokenHash(ctx context.Context, tokenHash string) (entities.UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if s.RefreshTokenHash == tokenHash && s.TenantID == TenantFromContext(ctx) {
+			return s, nil
+		}
+	}
+	return entities.UserSession{}, ErrSessionNotFound
+}
+
+func (r *memorySessions) GetByAccessTokenHash(ctx context.Context, tokenHash string) (entities.UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if s.AccessTokenHash == tokenHash && s.TenantID == TenantFromContext(ctx) {
+			return s, nil
+		}
+	}
+	return entities.UserSession{}, ErrSessionNotFound
+}
+
+func (r *memorySessions) SetActiveOrganization(ctx context.Context, id, orgID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.sessions {
+		if s.ID == id {
+			r.sessions[i].ActiveOrganizationID = orgID
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (r *memorySessions) ClearActiveOrganization(ctx context.Context, userID, orgID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for i, s := range r.sessions {
+		if s.UserID == userID && s.ActiveOrganizationID == orgID {
+			r.sessions[i].ActiveOrganizationID = ""
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memorySessions) ListByUser(ctx context.Context, userID string) ([]entities.UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.UserSession
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.TenantID == TenantFromContext(ctx) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (r *memorySessions) Rotate(ctx context.Context, session entities.UserSession, previousHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.sessions {
+		if s.ID == session.ID && s.RefreshTokenHash == previousHash {
+			r.sessions[i] = session
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (r *memorySessions) Delete(ctx context.Context, id, userID string) (entities.UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.sessions {
+		if s.ID == id && s.UserID == userID {
+			r.sessions = append(r.sessions[:i], r.sessions[i+1:]...)
+			return s, nil
+		}
+	}
+	return entities.UserSession{}, ErrSessionNotFound
+}
+
+func (r *memorySessions) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.sessions[:0]
+	for _, s := range r.sessions {
+		if s.UserID != userID {
+			kept = append(kept, s)
+		}
+	}
+	n := len(r.sessions) - len(kept)
+	r.sessions = kept
+	return n, nil
+}
+
+type memoryRotatedTokens struct {
+	mu     sync.Mutex
+	tokens []entities.RotatedRefreshToken
+}
+
+func (r *memoryRotatedTokens) Create(ctx context.Context, token entities.RotatedRefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryRotatedTokens) Get(ctx context.Context, tokenHash string) (entities.RotatedRefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return entities.RotatedRefreshToken{}, ErrSessionNotFound
+}
+
+func (r *memoryRotatedTokens) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+type memoryPasswordHistory struct {
+	mu      sync.Mutex
+	entries []entities.PasswordHistory
+	reads   int
+}
+
+func (r *memoryPasswordHistory) Add(ctx context.Context, entry entities.PasswordHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *memoryPasswordHistory) ListRecent(ctx context.Context, userID string, limit int) ([]entities.PasswordHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reads++
+
+	var res []entities.PasswordHistory
+	for i := len(r.entries) - 1; i >= 0 && len(res) < limit; i-- {
+		if r.entries[i].UserID == userID {
+			res = append(res, r.entries[i])
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryPasswordHistory) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+type memoryEmailChanges struct {
+	mu      sync.Mutex
+	changes []entities.EmailChange
+}
+
+func (r *memoryEmailChanges) Create(ctx context.Context, change entities.EmailChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.changes = append(r.changes, change)
+	return nil
+}
+
+func (r *memoryEmailChanges) Take(ctx context.Context, tokenHash string) (entities.EmailChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.changes {
+		if c.TokenHash == tokenHash {
+			r.changes = append(r.changes[:i], r.changes[i+1:]...)
+			return c, nil
+		}
+	}
+	return entities.EmailChange{}, ErrInvalidEmailChange
+}
+
+func (r *memoryEmailChanges) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+// memoryMailer records the template and recipient of every mail.
+// memoryMailer records the mails it is asked to send, or fails them
+// all with err.
+type memoryMailer struct {
+	mu    sync.Mutex
+	mails []string
+	err   error
+}
+
+func (m *memoryMailer) Send(ctx context.Context, template, locale, to string, data map[string]any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	m.mails = append(m.mails, template+" "+to)
+	return nil
+}
+
+func (m *memoryMailer) sent() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.mails...)
+}
+
+type memoryErasures struct {
+	mu      sync.Mutex
+	records []entities.ErasureRecord
+}
+
+func (r *memoryErasures) Create(ctx context.Context, record entities.ErasureRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, record)
+	return nil
+}
+
+func (r *memoryErasures) Get(ctx context.Context, id string) (entities.ErasureRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range r.records {
+		if record.ID == id {
+			return record, nil
+		}
+	}
+	return entities.ErasureRecord{}, ErrErasureNotFound
+}
+
+func (r *memoryErasures) ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.ErasureRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.ErasureRecord
+	for _, record := range r.records {
+		due := record.ScheduledAt == nil || !record.ScheduledAt.After(now)
+		if record.Status == entities.DataRequestPending && record.Attempts < maxAttempts && due && len(res) < limit {
+			res = append(res, record)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryErasures) Update(ctx context.Context, record entities.ErasureRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.records {
+		if r.records[i].ID == record.ID {
+			r.records[i] = record
+			return nil
+		}
+	}
+	return ErrErasureNotFound
+}
+
+func (r *memoryErasures) CancelScheduled(ctx context.Context, userID string, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for i, record := range r.records {
+		if record.UserID == userID && record.Status == entities.DataRequestPending && record.ScheduledAt != nil && record.ScheduledAt.After(now) {
+			r.records[i].Status = entities.DataRequestCanceled
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memoryOrganizations struct {
+	mu   sync.Mutex
+	orgs []entities.Organization
+}
+
+func (r *memoryOrganizations) Create(ctx context.Context, org entities.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.orgs = append(r.orgs, org)
+	return nil
+}
+
+func (r *memoryOrganizations) Get(ctx context.Context, id string) (entities.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, org := range r.orgs {
+		if org.ID == id && org.TenantID == TenantFromContext(ctx) {
+			return org, nil
+		}
+	}
+	return entities.Organization{}, ErrOrganizationNotFound
+}
+
+func (r *memoryOrganizations) List(ctx context.Context) ([]entities.Organization, error) {
+	return r.ListByIDs(ctx, nil)
+}
+
+func (r *memoryOrganizations) ListByIDs(ctx context.Context, ids []string) ([]entities.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.Organization
+	for _, org := range r.orgs {
+		if org.TenantID == TenantFromContext(ctx) && (ids == nil || slices.Contains(ids, org.ID)) {
+			res = append(res, org)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryOrganizations) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+type memoryMemberships struct {
+	mu          sync.Mutex
+	memberships []entities.Membership
+}
+
+func (r *memoryMemberships) Create(ctx context.Context, membership entities.Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.memberships = append(r.memberships, membership)
+	return nil
+}
+
+func (r *memoryMemberships) Get(ctx context.Context, orgID, userID string) (entities.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range r.memberships {
+		if m.OrganizationID == orgID && m.UserID == userID {
+			return m, nil
+		}
+	}
+	return entities.Membership{}, ErrMembershipNotFound
+}
+
+func (r *memoryMemberships) ListByOrganization(ctx context.Context, orgID string) ([]entities.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.Membership
+	for _, m := range r.memberships {
+		if m.OrganizationID == orgID {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryMemberships) ListByUser(ctx context.Context, userID string) ([]entities.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.Membership
+	for _, m := range r.memberships {
+		if m.UserID == userID {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryMemberships) UpdateRoles(ctx context.Context, orgID, userID string, roles []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, m := range r.memberships {
+		if m.OrganizationID == orgID && m.UserID == userID {
+			r.memberships[i].Roles = roles
+			return nil
+		}
+	}
+	return ErrMembershipNotFound
+}
+
+func (r *memoryMemberships) Delete(ctx context.Context, orgID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, m := range r.memberships {
+		if m.OrganizationID == orgID && m.UserID == userID {
+			r.memberships = append(r.memberships[:i], r.memberships[i+1:]...)
+			return nil
+		}
+	}
+	return ErrMembershipNotFound
+}
+
+func (r *memoryMemberships) DeleteByOrganization(ctx context.Context, orgID string) (int, error) {
+	return 0, nil
+}
+
+func (r *memoryMemberships) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+type memoryInvitations struct {
+	mu          sync.Mutex
+	invitations []entities.Invitation
+}
+
+func (r *memoryInvitations) Create(ctx context.Context, invitation entities.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.invitations = append(r.invitations, invitation)
+	return nil
+}
+
+func (r *memoryInvitations) Get(ctx context.Context, id string) (entities.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.invitations {
+		if i.ID == id && i.TenantID == TenantFromContext(ctx) {
+			return i, nil
+		}
+	}
+	return entities.Invitation{}, ErrInvitationNotFound
+}
+
+func (r *memoryInvitations) GetByTokenHash(ctx context.Context, tokenHash string) (entities.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.invitations {
+		if i.TokenHash == tokenHash && i.TenantID == TenantFromContext(ctx) {
+			return i, nil
+		}
+	}
+	return entities.Invitation{}, ErrInvitationNotFound
+}
+
+func (r *memoryInvitations) ListByOrganization(ctx context.Context, orgID string) ([]entities.Invitation, error) {
+	return nil, nil
+}
+
+func (r *memoryInvitations) MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) error {
+	return nil
+}
+
+func (r *memoryInvitations) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (r *memoryInvitations) DeleteByOrganization(ctx context.Context, orgID string) (int, error) {
+	return 0, nil
+}
+
+func (r *memoryInvitations) DeleteByEmail(ctx context.Context, email string) (int, error) {
+	return 0, nil
+}
+
+type memoryOAuthStates struct {
+	mu     sync.Mutex
+	states []entities.OAuthState
+}
+
+func (r *memoryOAuthStates) Create(ctx context.Context, state entities.OAuthState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states = append(r.states, state)
+	return nil
+}
+
+func (r *memoryOAuthStates) Take(ctx context.Context, state string) (entities.OAuthState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, st := range r.states {
+		if st.State == state {
+			r.states = append(r.states[:i], r.states[i+1:]...)
+			return st, nil
+		}
+	}
+	return entities.OAuthState{}, ErrInvalidOAuthState
+}
+
+// fakeOAuthProvider returns identity for every code.
+type fakeOAuthProvider struct {
+	identity ExternalIdentity
+}
+
+func (p fakeOAuthProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge, redirectURI string) (string, error) {
+	return "https://provider.example.com/authorize?state=" + state, nil
+}
+
+func (p fakeOAuthProvider) Exchange(ctx context.Context, code, codeVerifier, nonce, redirectURI string) (ExternalIdentity, error) {
+	return p.identity, nil
+}
+
+// recordingHook records the hook points it was called at, in order.
+// BeforeRegister and BeforeLogin return reject when it is set.
+type recordingHook struct {
+	NopHook
+	calls  []string
+	reject error
+	data   map[string]any
+}
+
+func (h *recordingHook) BeforeRegister(ctx context.Context, req *RegisterHookRequest) error {
+	h.calls = append(h.calls, "before_register")
+	req.Data = h.data
+	return h.reject
+}
+
+func (h *recordingHook) AfterRegister(ctx context.Context, user HookUser) error {
+	h.calls = append(h.calls, "after_register")
+	return nil
+}
+
+func (h *recordingHook) BeforeLogin(ctx context.Context, req *LoginHookRequest) error {
+	h.calls = append(h.calls, "before_login")
+	return h.reject
+}
+
+func (h *recordingHook) AfterLogin(ctx context.Context, user HookUser) error {
+	h.calls = append(h.calls, "after_login")
+	return nil
+}
+
+type memoryKnownDevices struct {
+	mu      sync.Mutex
+	devices []entities.KnownDevice
+}
+
+func (r *memoryKnownDevices) ListByUser(ctx context.Context, userID string) ([]entities.KnownDevice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.KnownDevice
+	for _, d := range r.devices {
+		if d.UserID == userID {
+			res = append([]entities.KnownDevice{d}, res...)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryKnownDevices) Save(ctx context.Context, device entities.KnownDevice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, d := range r.devices {
+		if d.UserID == device.UserID && d.Fingerprint == device.Fingerprint {
+			r.devices = append(r.devices[:i], r.devices[i+1:]...)
+			break
+		}
+	}
+	r.devices = append(r.devices, device)
+	return nil
+}
+
+func (r *memoryKnownDevices) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+type memoryServiceAccounts struct {
+	mu       sync.Mutex
+	accounts []entities.ServiceAccount
+}
+
+func (r *memoryServiceAccounts) Create(ctx context.Context, account entities.ServiceAccount) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.accounts = append(r.accounts, account)
+	return nil
+}
+
+func (r *memoryServiceAccounts) Get(ctx context.Context, id string) (entities.ServiceAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range r.accounts {
+		if a.ID == id && a.TenantID == TenantFromContext(ctx) {
+			return a, nil
+		}
+	}
+	return entities.ServiceAccount{}, ErrServiceAccountNotFound
+}
+
+func (r *memoryServiceAccounts) List(ctx context.Context) ([]entities.ServiceAccount, error) {
+	return nil, nil
+}
+
+func (r *memoryServiceAccounts) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+type memoryAPIKeys struct {
+	mu   sync.Mutex
+	keys []entities.APIKey
+}
+
+func (r *memoryAPIKeys) Create(ctx context.Context, key entities.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *memoryAPIKeys) Get(ctx context.Context, id string) (entities.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.ID == id && k.TenantID == TenantFromContext(ctx) {
+			return k, nil
+		}
+	}
+	return entities.APIKey{}, ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeys) ListByAccount(ctx context.Context, accountID string) ([]entities.APIKey, error) {
+	return nil, nil
+}
+
+// update applies fn to the key with the id.
+func (r *memoryAPIKeys) update(id string, fn func(*entities.APIKey)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			fn(&r.keys[i])
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeys) MarkUsed(ctx context.Context, id string, usedAt time.Time, ip string) error {
+	return r.update(id, func(k *entities.APIKey) {
+		k.LastUsedAt = &usedAt
+		k.LastUsedIP = ip
+	})
+}
+
+func (r *memoryAPIKeys) Replace(ctx context.Context, id, replacedBy string, expiresAt time.Time) error {
+	return r.update(id, func(k *entities.APIKey) {
+		k.ReplacedBy = replacedBy
+		k.ExpiresAt = expiresAt
+	})
+}
+
+func (r *memoryAPIKeys) Revoke(ctx context.Context, id string, revokedAt time.Time) error {
+	return r.update(id, func(k *entities.APIKey) {
+		k.RevokedAt = &revokedAt
+	})
+}
+
+func (r *memoryAPIKeys) RevokeByAccount(ctx context.Context, accountID string, revokedAt time.Time) (int, error) {
+	return 0, nil
+}
+
+type memoryImpersonations struct {
+	mu             sync.Mutex
+	impersonations []entities.Impersonation
+}
+
+func (r *memoryImpersonations) Create(ctx context.Context, impersonation entities.Impersonation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.impersonations = append(r.impersonations, impersonation)
+	return nil
+}
+
+func (r *memoryImpersonations) Get(ctx context.Context, id string) (entities.Impersonation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.impersonations {
+		if i.ID == id {
+			return i, nil
+		}
+	}
+	return entities.Impersonation{}, ErrImpersonationNotFound
+}
+
+func (r *memoryImpersonations) ListActive(ctx context.Context, now time.Time) ([]entities.Impersonation, error) {
+	return nil, nil
+}
+
+func (r *memoryImpersonations) End(ctx context.Context, id, endedBy string, endedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.impersonations {
+		if r.impersonations[i].ID == id && r.impersonations[i].EndedAt == nil {
+			r.impersonations[i].EndedAt = &endedAt
+			r.impersonations[i].EndedBy = endedBy
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryImpersonations) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+type memoryAudit struct {
+	mu     sync.Mutex
+	events []entities.AuditEvent
+}
+
+func (r *memoryAudit) Add(ctx context.Context, event entities.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *memoryAudit) ListByUser(ctx context.Context, userID string) ([]entities.AuditEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.AuditEvent
+	for _, e := range r.events {
+		if e.UserID == userID {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryAudit) Pseudonymize(ctx context.Context, userID, pseudonym string) (int, error) {
+	return 0, nil
+}
+
+func (r *memoryAudit) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []string
+	for _, e := range r.events {
+		res = append(res, e.Type)
+	}
+	return res
+}
+
+type memoryEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *memoryEvents) Publish(ctx context.Context, eventType string, payload map[string]any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, eventType)
+	return nil
+}
+
+type memoryPasskeys struct {
+	mu       sync.Mutex
+	passkeys []entities.Passkey
+}
+
+func (r *memoryPasskeys) Create(ctx context.Context, passkey entities.Passkey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.passkeys {
+		if p.ID == passkey.ID {
+			return ErrPasskeyExists
+		}
+	}
+	r.passkeys = append(r.passkeys, passkey)
+	return nil
+}
+
+func (r *memoryPasskeys) ListByUser(ctx context.Context, userID string) ([]entities.Passkey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []entities.Passkey
+	for _, p := range r.passkeys {
+		if p.UserID == userID {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryPasskeys) UpdateSignCount(ctx context.Context, id string, signCount uint32, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, p := range r.passkeys {
+		if p.ID == id {
+			r.passkeys[i].SignCount = signCount
+			r.passkeys[i].LastUsedAt = &usedAt
+			return nil
+		}
+	}
+	return ErrInvalidPasskey
+}
+
+func (r *memoryPasskeys) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+type memoryChallenges struct {
+	mu         sync.Mutex
+	challenges map[string]entities.WebAuthnChallenge
+}
+
+func (r *memoryChallenges) Create(ctx context.Context, challenge entities.WebAuthnChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.challenges[challenge.ID] = challenge
+	return nil
+}
+
+func (r *memoryChallenges) Take(ctx context.Context, id string) (entities.WebAuthnChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge, ok := r.challenges[id]
+	if !ok {
+		return entities.WebAuthnChallenge{}, ErrInvalidPasskeyChallenge
+	}
+	delete(r.challenges, id)
+	return challenge, nil
+}
+
+func (r *memoryChallenges) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+)
+
+// Hook adds custom logic around registration, login, token refresh and
+// password resets without changing this service. Embed NopHook and
+// override the methods needed.
+//
+// Before methods run before anything is done. They can change the
+// request through its pointer or veto it by returning an error, which
+// is returned to the client as is: wrap ErrHookRejected or another
+// domain error to get a status other than 500. After methods run once
+// the action succeeded and can not undo it, their errors are only
+// logged. Hooks run in the order they were registered, the first error
+// of a before method stops the rest.
+//
+// Login hooks run for every login that starts a session: passwords,
+// magic links, passkeys and social logins. Authenticate, used by the
+// OIDC login page, runs BeforeLogin only. Register hooks run for
+// password and social registrations. Magic links, passkeys and social
+// logins authenticated an email, hooks can not change it there.
+type Hook interface {
+	BeforeRegister(ctx context.Context, req *RegisterHookRequest) error
+	AfterRegister(ctx context.Context, user HookUser) error
+	BeforeLogin(ctx context.Context, req *LoginHookRequest) error
+	AfterLogin(ctx context.Context, user HookUser) error
+	BeforeRefresh(ctx context.Context, req *RefreshHookRequest) error
+	AfterRefresh(ctx context.Context, user HookUser) error
+	BeforePasswordReset(ctx context.Context, req *PasswordResetHookRequest) error
+	AfterPasswordReset(ctx context.Context, user HookUser) error
+}
+
+// RegisterHookRequest is a registration about to be sent to fusionauth.
+// Data is saved as the user's data in fusionauth, a JWT populate lambda
+// can copy it into the claims of the user's tokens.
+type RegisterHookRequest struct {
+	Email     string
+	Firstname string
+	Lastname  string
+	Data      map[string]any
+}
+
+type LoginHookRequest struct {
+	Email string
+}
+
+// RefreshHookRequest is the session a refresh token is exchanged for.
+type RefreshHookRequest struct {
+	UserID    string
+	SessionID string
+}
+
+// PasswordResetHookRequest is a reset password about to be set, the
+// user followed the link of a forgot password email.
+type PasswordResetHookRequest struct {
+	UserID string
+	Email  string
+}
+
+// HookUser is the user an action was done for. Email is empty after a
+// refresh.
+type HookUser struct {
+	ID       string
+	Email    string
+	TenantID string
+}
+
+// NopHook does nothing, embed it to implement only some of Hook.
+type NopHook struct{}
+
+func (NopHook) BeforeRegister(context.Context, *RegisterHookRequest) error           { return nil }
+func (NopHook) AfterRegister(context.Context, HookUser) error                        { return nil }
+func (NopHook) BeforeLogin(context.Context, *LoginHookRequest) error                 { return nil }
+func (NopHook) AfterLogin(context.Context, HookUser) error                           { return nil }
+func (NopHook) BeforeRefresh(context.Context, *RefreshHookRequest) error             { return nil }
+func (NopHook) AfterRefresh(context.Context, HookUser) error                         { return nil }
+func (NopHook) BeforePasswordReset(context.Context, *PasswordResetHookRequest) error { return nil }
+func (NopHook) AfterPasswordReset(context.Context, HookUser) error                   { return nil }
+
+// runBeforeHooks calls fn with every hook and stops at the first error.
+func (s Service) runBeforeHooks(fn func(Hook) error) error {
+	for _, hook := range s.hooks {
+		if err := fn(hook); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAfterHooks calls fn with every hook, errors are logged.
+func (s Service) runAfterHooks(ctx context.Context, point string, fn func(Hook) error) {
+	for _, hook := range s.hooks {
+		if err := fn(hook); err != nil {
+			s.log.ErrorContext(ctx, "after hook failed", "point", point, "error", err)
+		}
+	}
+}
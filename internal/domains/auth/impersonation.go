@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// impersonationAudience marks impersonation tokens, so tokens of the
+// openid connect provider signed with the same key are not taken for
+// them.
+const impersonationAudience = "impersonation"
+
+const (
+	impersonationScope         = "read write"
+	impersonationReadOnlyScope = "read"
+)
+
+type impersonationConfig struct {
+	issuer     string
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	readOnly   bool
+	// adminRole can not be impersonated, support staff would get the
+	// rights of another admin.
+	adminRole string
+}
+
+// impersonationClaims are the claims of impersonation tokens. They
+// carry the same claims as fusionauth access tokens, so introspection
+// reads them alike, and name the admin in the act claim of RFC 8693.
+type impersonationClaims struct {
+	accessTokenClaims
+	Email     string `json:"email"`
+	Firstname string `json:"given_name,omitempty"`
+	Lastname  string `json:"family_name,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	Act       Actor  `json:"act"`
+}
+
+// StartImpersonation issues a short lived token for the user to the
+// admin. The token is not refreshable and stops working when the
+// impersonation is ended. Admins and the admin's own account can not
+// be impersonated, and impersonations can not be nested.
+func (s Service) StartImpersonation(ctx context.Context, admin entities.User, userID, reason string, readOnly bool, ttl time.Duration) (ImpersonationToken, error) {
+	if admin.ImpersonatorID != "" || userID == admin.ProviderID {
+		return ImpersonationToken{}, ErrImpersonationNotAllowed
+	}
+
+	if ttl == 0 {
+		ttl = s.impersonationCfg.defaultTTL
+	}
+
+	if ttl < 0 || ttl > s.impersonationCfg.maxTTL {
+		return ImpersonationToken{}, ErrInvalidImpersonationTTL
+	}
+
+	res, errs, err := s.fusion(ctx).RetrieveUserWithContext(ctx, userID)
+	if err != nil {
+		return ImpersonationToken{}, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return ImpersonationToken{}, ErrUserNotFound
+	}
+
+	if errs != nil {
+		return ImpersonationToken{}, fmt.Errorf("failed to retrieve user: %s", errs.Error())
+	}
+
+	var (
+		roles      []string
+		registered bool
+	)
+	appID := s.appID(ctx)
+	for _, reg := range res.User.Registrations {
+		if reg.ApplicationId == appID {
+			roles = reg.Roles
+			registered = true
+		}
+	}
+
+	// users of other tenants are not found
+	if s.tenants != nil && !registered {
+		return ImpersonationToken{}, ErrUserNotFound
+	}
+
+	if slices.Contains(roles, s.impersonationCfg.adminRole) {
+		return ImpersonationToken{}, ErrImpersonationNotAllowed
+	}
+
+	now := time.Now()
+	impersonation := entities.Impersonation{
+		ID:         uuid.New().String(),
+		TenantID:   TenantFromContext(ctx),
+		ActorID:    admin.ProviderID,
+		ActorEmail: admin.Email,
+		UserID:     res.User.Id,
+		UserEmail:  res.User.Email,
+		Reason:     reason,
+		ReadOnly:   readOnly || s.impersonationCfg.readOnly,
+		StartedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	scope := impersonationScope
+	if impersonation.ReadOnly {
+		scope = impersonationReadOnlyScope
+	}
+
+	token, err := s.signer.Sign(impersonationClaims{
+		accessTokenClaims: accessTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        impersonation.ID,
+				Issuer:    s.impersonationCfg.issuer,
+				Subject:   impersonation.UserID,
+				Audience:  jwt.ClaimStrings{impersonationAudience},
+				ExpiresAt: jwt.NewNumericDate(impersonation.ExpiresAt),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+			Roles:         roles,
+			Scope:         scope,
+			ApplicationID: appID,
+		},
+		Email:     res.User.Email,
+		Firstname: res.User.FirstName,
+		Lastname:  res.User.LastName,
+		Tenant:    impersonation.TenantID,
+		Act:       Actor{Subject: admin.ProviderID, Email: admin.Email},
+	})
+	if err != nil {
+		return ImpersonationToken{}, fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.impersonations.Create(ctx, impersonation); err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventImpersonationStarted, map[string]any{
+			"impersonation_id": impersonation.ID,
+			"actor_id":         impersonation.ActorID,
+			"user_id":          impersonation.UserID,
+		})
+	})
+	if err != nil {
+		return ImpersonationToken{}, fmt.Errorf("failed to save impersonation: %w", err)
+	}
+
+	s.log.InfoContext(ctx, "Started impersonation", "impersonation_id", impersonation.ID, "actor_id", admin.ProviderID, "user_id", impersonation.UserID)
+
+	s.recordAudit(ctx, AuditImpersonationStarted, admin.ProviderID, map[string]any{
+		"impersonation_id": impersonation.ID,
+		"user_id":          impersonation.UserID,
+		"reason":           impersonation.Reason,
+		"read_only":        impersonation.ReadOnly,
+		"expires_at":       impersonation.ExpiresAt,
+	})
+
+	return ImpersonationToken{
+		AccessToken:   token,
+		TokenType:     "Bearer",
+		ExpiresAt:     impersonation.ExpiresAt,
+		Impersonation: impersonation,
+	}, nil
+}
+
+func (s Service) ListActiveImpersonations(ctx context.Context) ([]entities.Impersonation, error) {
+	return s.impersonations.ListActive(ctx, time.Now())
+}
+
+// EndImpersonation ends an impersonation, its token stops working right
+// away. actorID is who ended it, the admin or the impersonation itself.
+func (s Service) EndImpersonation(ctx context.Context, actorID, id string) error {
+	impersonation, err := s.impersonations.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ended := false
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		ended, err = s.impersonations.End(ctx, id, actorID, now)
+		// ended before, nothing to record
+		if err != nil || !ended {
+			return err
+		}
+
+		return s.publish(ctx, EventImpersonationEnded, map[string]any{
+			"impersonation_id": id,
+			"actor_id":         impersonation.ActorID,
+			"user_id":          impersonation.UserID,
+		})
+	})
+	if err != nil || !ended {
+		return err
+	}
+
+	s.log.InfoContext(ctx, "Ended impersonation", "impersonation_id", id, "ended_by", actorID)
+
+	s.recordAudit(ctx, AuditImpersonationEnded, impersonation.ActorID, map[string]any{
+		"impersonation_id": id,
+		"user_id":          impersonation.UserID,
+		"ended_by":         actorID,
+		"duration":         now.Sub(impersonation.StartedAt).Round(time.Second).String(),
+	})
+
+	return nil
+}
+
+// verifyImpersonation checks tokens signed by this service. ok is false
+// for any other token, those are left to fusionauth.
+func (s Service) verifyImpersonation(ctx context.Context, token string) (user entities.User, ok bool, err error) {
+	if s.signer.KeyID() == "" {
+		return entities.User{}, false, nil
+	}
+
+	var claims impersonationClaims
+	if err := s.signer.Parse(token, &claims,
+		jwt.WithIssuer(s.impersonationCfg.issuer),
+		jwt.WithAudience(impersonationAudience),
+		jwt.WithExpirationRequired(),
+	); err != nil {
+		return entities.User{}, false, nil
+	}
+
+	impersonation, err := s.impersonations.Get(ctx, claims.ID)
+	if errors.Is(err, ErrImpersonationNotFound) {
+		return entities.User{}, true, ErrInvalidToken
+	}
+	if err != nil {
+		return entities.User{}, true, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+
+	if impersonation.EndedAt != nil || impersonation.TenantID != TenantFromContext(ctx) {
+		return entities.User{}, true, ErrInvalidToken
+	}
+
+	return entities.User{
+		ProviderID:            impersonation.UserID,
+		Email:                 claims.Email,
+		Firstname:             claims.Firstname,
+		Lastname:              claims.Lastname,
+		TenantID:              impersonation.TenantID,
+		Roles:                 claims.Roles,
+		ImpersonatorID:        impersonation.ActorID,
+		ImpersonationID:       impersonation.ID,
+		ImpersonationReadOnly: impersonation.ReadOnly,
+	}, true, nil
+}
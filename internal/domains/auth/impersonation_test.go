@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+var testAdmin = entities.User{ProviderID: "admin-1", Email: "admin@example.com", Roles: []string{"admin"}}
+
+// newImpersonationService can impersonate user-1, and admin-2 who has
+// the admin role.
+func newImpersonationService(t *testing.T) (Service, *testRepos) {
+	t.Helper()
+
+	fusion := newFusionStub(t)
+	fusion.handle("/api/user/", func(w http.ResponseWriter, r *http.Request) {
+		var res fusionauth.UserResponse
+		res.User.Id = strings.TrimPrefix(r.URL.Path, "/api/user/")
+		res.User.Email = res.User.Id + "@example.com"
+
+		roles := []string{"member"}
+		if res.User.Id == "admin-2" {
+			roles = []string{"admin"}
+		}
+		res.User.Registrations = []fusionauth.UserRegistration{{ApplicationId: "app", Roles: roles}}
+
+		writeJSON(t, w, http.StatusOK, res)
+	})
+
+	signer, err := jwks.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, repos := newTestService(fusion)
+	s.signer = signer
+	s.impersonationCfg = impersonationConfig{
+		issuer:     "https://auth.example.com",
+		defaultTTL: 15 * time.Minute,
+		maxTTL:     time.Hour,
+		adminRole:  "admin",
+	}
+
+	return s, repos
+}
+
+func TestStartImpersonationNotAllowed(t *testing.T) {
+	s, repos := newImpersonationService(t)
+	ctx := context.Background()
+
+	impersonating := testAdmin
+	impersonating.ProviderID = "user-2"
+	impersonating.ImpersonatorID = "admin-1"
+	impersonating.ImpersonationID = "impersonation-1"
+
+	tests := []struct {
+		name   string
+		admin  entities.User
+		userID string
+		want   error
+	}{
+		{"admin", testAdmin, "admin-2", ErrImpersonationNotAllowed},
+		{"self", testAdmin, "admin-1", ErrImpersonationNotAllowed},
+		{"nested", impersonating, "user-1", ErrImpersonationNotAllowed},
+		{"user", testAdmin, "user-1", nil},
+	}
+
+	for _, tt := range tests {
+		_, err := s.StartImpersonation(ctx, tt.admin, tt.userID, "ticket 42", false, 0)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if n := len(repos.impersonations.impersonations); n != 1 {
+		t.Errorf("%d impersonations saved, want 1", n)
+	}
+}
+
+func TestStartImpersonationTTL(t *testing.T) {
+	s, _ := newImpersonationService(t)
+
+	for _, ttl := range []time.Duration{-time.Minute, 2 * time.Hour} {
+		_, err := s.StartImpersonation(context.Background(), testAdmin, "user-1", "ticket 42", false, ttl)
+		if !errors.Is(err, ErrInvalidImpersonationTTL) {
+			t.Errorf("ttl %v: error %v, want %v", ttl, err, ErrInvalidImpersonationTTL)
+		}
+	}
+}
+
+func TestImpersonationTokenStopsWhenEnded(t *testing.T) {
+	s, _ := newImpersonationService(t)
+	ctx := context.Background()
+
+	res, err := s.StartImpersonation(ctx, testAdmin, "user-1", "ticket 42", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.VerifyToken(ctx, res.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ProviderID != "user-1" || user.ImpersonatorID != "admin-1" || user.ImpersonationReadOnly {
+		t.Errorf("token is of %s impersonated by %q, read only %v", user.ProviderID, user.ImpersonatorID, user.ImpersonationReadOnly)
+	}
+
+	if err := s.EndImpersonation(ctx, "admin-1", res.Impersonation.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// fusionauth is not asked, the stub fails the test otherwise
+	if _, err := s.VerifyToken(ctx, res.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ended impersonation: error %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestImpersonationTokenOfOtherTenant(t *testing.T) {
+	s, _ := newImpersonationService(t)
+
+	res, err := s.StartImpersonation(context.Background(), testAdmin, "user-1", "ticket 42", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithTenant(context.Background(), "tenant-2")
+	if _, err := s.VerifyToken(ctx, res.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("error %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestImpersonationReadOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		forced   bool
+		want     bool
+	}{
+		{name: "read write", want: false},
+		{name: "requested", readOnly: true, want: true},
+		{name: "configured", forced: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newImpersonationService(t)
+			s.impersonationCfg.readOnly = tt.forced
+			ctx := context.Background()
+
+			res, err := s.StartImpersonation(ctx, testAdmin, "user-1", "ticket 42", tt.readOnly, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := s.VerifyToken(ctx, res.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ImpersonationReadOnly != tt.want {
+				t.Errorf("read only %v, want %v", user.ImpersonationReadOnly, tt.want)
+			}
+		})
+	}
+}
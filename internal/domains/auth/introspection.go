@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessTokenClaims are the claims of fusionauth access tokens that
+// introspection hands out.
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	Roles         []string `json:"roles"`
+	Scope         string   `json:"scope"`
+	ApplicationID string   `json:"applicationId"`
+}
+
+// IntrospectToken tells whether an access token is active and what it
+// grants, in the shape of RFC 7662. Invalid tokens are not an error,
+// they are reported as inactive. Requests that name no tenant get
+// tokens of any tenant checked against the tenant of their application.
+func (s Service) IntrospectToken(ctx context.Context, token string) (TokenIntrospection, error) {
+	// the signature is verified by VerifyToken below
+	var claims accessTokenClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return TokenIntrospection{}, nil
+	}
+
+	if TenantFromContext(ctx) == "" {
+		if tenantID, ok := s.tenantOfApp(claims.ApplicationID); ok {
+			ctx = WithTenant(ctx, tenantID)
+		}
+	}
+
+	key := introspectionKey(TenantFromContext(ctx), hashToken(token))
+	now := time.Now()
+
+	if res, ok := s.introspectionCache.get(key, now); ok {
+		return res, nil
+	}
+
+	user, err := s.VerifyToken(ctx, token)
+	if errors.Is(err, ErrInvalidToken) {
+		s.introspectionCache.put(key, TokenIntrospection{}, now)
+		return TokenIntrospection{}, nil
+	}
+	if err != nil {
+		return TokenIntrospection{}, err
+	}
+
+	res := TokenIntrospection{
+		Active:    true,
+		Subject:   user.ProviderID,
+		Email:     user.Email,
+		Roles:     claims.Roles,
+		Scope:     claims.Scope,
+		ClientID:  claims.ApplicationID,
+		TokenType: "Bearer",
+		Issuer:    claims.Issuer,
+		Tenant:    user.TenantID,
+		OrgID:     user.ActiveOrganizationID,
+	}
+
+	if user.ImpersonatorID != "" {
+		res.Act = &Actor{Subject: user.ImpersonatorID}
+	}
+
+	if claims.ExpiresAt != nil {
+		if !claims.ExpiresAt.After(now) {
+			return TokenIntrospection{}, nil
+		}
+		res.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+
+	if claims.IssuedAt != nil {
+		res.IssuedAt = claims.IssuedAt.Unix()
+	}
+
+	s.introspectionCache.put(key, res, now)
+
+	return res, nil
+}
+
+func introspectionKey(tenantID, tokenHash string) string {
+	return tenantID + ":" + tokenHash
+}
+
+// introspectionCache keeps introspection results in memory, so every
+// instance has its own. A nil cache caches nothing.
+type introspectionCache struct {
+	mu      sync.Mutex
+	entries map[string]introspectionEntry
+	ttl     time.Duration
+	size    int
+}
+
+type introspectionEntry struct {
+	res       TokenIntrospection
+	expiresAt time.Time
+}
+
+func newIntrospectionCache(ttl time.Duration, size int) *introspectionCache {
+	if ttl <= 0 || size <= 0 {
+		return nil
+	}
+
+	return &introspectionCache{
+		entries: make(map[string]introspectionEntry),
+		ttl:     ttl,
+		size:    size,
+	}
+}
+
+func (c *introspectionCache) get(key string, now time.Time) (TokenIntrospection, bool) {
+	if c == nil {
+		return TokenIntrospection{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return TokenIntrospection{}, false
+	}
+
+	if !now.Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return TokenIntrospection{}, false
+	}
+
+	return entry.res, true
+}
+
+// put caches the result for the cache's ttl, an active token only until
+// it expires.
+func (c *introspectionCache) put(key string, res TokenIntrospection, now time.Time) {
+	if c == nil {
+		return
+	}
+
+	expiresAt := now.Add(c.ttl)
+	if res.ExpiresAt != 0 && time.Unix(res.ExpiresAt, 0).Before(expiresAt) {
+		expiresAt = time.Unix(res.ExpiresAt, 0)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	// still full, make room by dropping whatever comes first
+	for k := range c.entries {
+		if len(c.entries) < c.size {
+			break
+		}
+		delete(c.entries, k)
+	}
+
+	c.entries[key] = introspectionEntry{res: res, expiresAt: expiresAt}
+}
+
+// forget drops the cached result of a token, for sessions that are
+// revoked. Other instances keep theirs until it expires.
+func (c *introspectionCache) forget(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
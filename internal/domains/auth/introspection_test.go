@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newIntrospectionStub verifies every access token for user-1 of the
+// application app until the refresh token is revoked, and counts the
+// verifications.
+func newIntrospectionStub(t *testing.T, verified *int) *fusionStub {
+	t.Helper()
+
+	revoked := false
+	fusion := newFusionStub(t)
+	fusion.handle("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		*verified++
+		if revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var res fusionauth.UserResponse
+		res.User.Id = "user-1"
+		res.User.Email = "user@example.com"
+		res.User.Registrations = []fusionauth.UserRegistration{{ApplicationId: "app", Roles: []string{"member"}}}
+		writeJSON(t, w, http.StatusOK, res)
+	})
+	fusion.handle("/api/jwt/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("unexpected fusionauth call %s %s", r.Method, r.URL)
+		}
+		revoked = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return fusion
+}
+
+// testAccessToken is an access token of the application app, its
+// signature is left to fusionauth.
+func testAccessToken(t *testing.T) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Roles:         []string{"member"},
+		ApplicationID: "app",
+	}).SignedString([]byte("fusionauth"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestIntrospectTokenIsCached(t *testing.T) {
+	var verified int
+	s, _ := newTestService(newIntrospectionStub(t, &verified))
+	s.introspectionCache = newIntrospectionCache(time.Minute, 10)
+	token := testAccessToken(t)
+
+	for i := 0; i < 2; i++ {
+		res, err := s.IntrospectToken(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Active || res.Subject != "user-1" {
+			t.Fatalf("introspection %+v, want user-1 active", res)
+		}
+	}
+
+	if verified != 1 {
+		t.Errorf("token verified %d times, want once", verified)
+	}
+}
+
+func TestIntrospectTokenCacheIsPerTenant(t *testing.T) {
+	var verified int
+	fusion := newIntrospectionStub(t, &verified)
+	s, _ := newTestService(fusion)
+	s.introspectionCache = newIntrospectionCache(time.Minute, 10)
+	s.tenants = map[string]tenantConfig{
+		"acme": {appID: "acme-app", fusionClient: fusion.client()},
+	}
+	token := testAccessToken(t)
+
+	res, err := s.IntrospectToken(context.Background(), token)
+	if err != nil || !res.Active {
+		t.Fatalf("default tenant: %+v, %v", res, err)
+	}
+
+	// user-1 is not registered with the application of acme
+	res, err = s.IntrospectToken(WithTenant(context.Background(), "acme"), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Active {
+		t.Error("token of the default tenant is active at acme")
+	}
+}
+
+func TestIntrospectRevokedSession(t *testing.T) {
+	var verified int
+	s, repos := newTestService(newIntrospectionStub(t, &verified))
+	s.introspectionCache = newIntrospectionCache(time.Minute, 10)
+	ctx := context.Background()
+	token := testAccessToken(t)
+
+	if _, err := s.startSession(ctx, "user-1", "", Session{AccessToken: token, RefreshToken: "provider-refresh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := s.IntrospectToken(ctx, token); err != nil || !res.Active {
+		t.Fatalf("before revoking: %+v, %v", res, err)
+	}
+
+	if err := s.RevokeSession(ctx, testSessionUser(), repos.sessions.sessions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.IntrospectToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Active {
+		t.Error("token of a revoked session is active")
+	}
+}
+
+func TestIntrospectionCacheExpiry(t *testing.T) {
+	c := newIntrospectionCache(time.Minute, 10)
+	now := time.Now()
+
+	c.put("a", TokenIntrospection{Active: true}, now)
+	// the token expires before the cache ttl
+	c.put("b", TokenIntrospection{Active: true, ExpiresAt: now.Add(10 * time.Second).Unix()}, now)
+
+	tests := []struct {
+		key string
+		at  time.Duration
+		ok  bool
+	}{
+		{"a", 30 * time.Second, true},
+		{"b", 5 * time.Second, true},
+		{"b", 10 * time.Second, false},
+		{"a", time.Minute, false},
+		{"c", 0, false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := c.get(tt.key, now.Add(tt.at)); ok != tt.ok {
+			t.Errorf("%s after %v: cached %v, want %v", tt.key, tt.at, ok, tt.ok)
+		}
+	}
+}
+
+func TestIntrospectionCacheSize(t *testing.T) {
+	c := newIntrospectionCache(time.Minute, 2)
+	now := time.Now()
+
+	for _, key := range []string{"a", "b", "c"} {
+		c.put(key, TokenIntrospection{Active: true}, now)
+	}
+
+	if len(c.entries) != 2 {
+		t.Errorf("%d entries cached, want 2", len(c.entries))
+	}
+	if _, ok := c.get("c", now); !ok {
+		t.Error("latest entry was dropped")
+	}
+}
+
+func TestIntrospectionCacheDisabled(t *testing.T) {
+	for _, c := range []*introspectionCache{newIntrospectionCache(0, 10), newIntrospectionCache(time.Minute, 0)} {
+		c.put("a", TokenIntrospection{Active: true}, time.Now())
+		if _, ok := c.get("a", time.Now()); ok {
+			t.Error("disabled cache returned an entry")
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+	"github.com/rasulov-emirlan/poc-auth/pkg/geoip"
+)
+
+type loginAlertsConfig struct {
+	enabled          bool
+	newDevice        bool
+	newCountry       bool
+	impossibleTravel bool
+	// maxTravelSpeed is in km/h, minTravelDistance in km.
+	maxTravelSpeed    float64
+	minTravelDistance float64
+	emailTemplateID   string
+}
+
+// checkLogin compares the device of a login with the ones the user
+// logged in from before and remembers it. Risky logins are written to
+// the audit log, published and emailed to the user. The first login of
+// a user is never risky. Failures are only logged, they do not fail
+// the login.
+func (s Service) checkLogin(ctx context.Context, userID string) {
+	if !s.loginAlertsCfg.enabled {
+		return
+	}
+
+	info := clientInfo(ctx)
+	now := time.Now()
+
+	device := entities.KnownDevice{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		TenantID:    TenantFromContext(ctx),
+		Fingerprint: deviceFingerprint(info.UserAgent, info.DeviceName),
+		DeviceName:  info.DeviceName,
+		UserAgent:   info.UserAgent,
+		IP:          info.IP,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+
+	if s.geo != nil {
+		if loc, ok := s.geo.Lookup(info.IP); ok {
+			device.Country = loc.Country
+			device.City = loc.City
+			device.Latitude = loc.Latitude
+			device.Longitude = loc.Longitude
+		}
+	}
+
+	known, err := s.knownDevices.ListByUser(ctx, userID)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to list known devices", "user_id", userID, "error", err)
+		return
+	}
+
+	risks := s.loginRisks(device, known)
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.knownDevices.Save(ctx, device); err != nil {
+			return err
+		}
+		if len(risks) == 0 {
+			return nil
+		}
+
+		return s.publish(ctx, EventSuspiciousLogin, map[string]any{
+			"user_id":     userID,
+			"risks":       risks,
+			"ip":          device.IP,
+			"device_name": device.DeviceName,
+			"country":     device.Country,
+		})
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to save known device", "user_id", userID, "error", err)
+	}
+
+	if len(risks) == 0 {
+		return
+	}
+
+	s.log.WarnContext(ctx, "Suspicious login", "user_id", userID, "risks", risks, "ip", info.IP)
+
+	s.recordAudit(ctx, AuditSuspiciousLogin, userID, map[string]any{
+		"risks":       risks,
+		"device_name": device.DeviceName,
+		"country":     device.Country,
+		"city":        device.City,
+	})
+
+	s.notifyLogin(ctx, device)
+}
+
+// loginRisks applies the configured rules to a login from device.
+// known are the user's devices from before the login, the one used
+// last first.
+func (s Service) loginRisks(device entities.KnownDevice, known []entities.KnownDevice) []string {
+	if len(known) == 0 {
+		return nil
+	}
+
+	cfg := s.loginAlertsCfg
+	var risks []string
+
+	// devices saved before the fingerprint left out browser versions
+	// are compared by what they were saved with
+	sameDevice := func(d entities.KnownDevice) bool {
+		return d.Fingerprint == device.Fingerprint || deviceFingerprint(d.UserAgent, d.DeviceName) == device.Fingerprint
+	}
+	if cfg.newDevice && !containsDevice(known, sameDevice) {
+		risks = append(risks, LoginRiskNewDevice)
+	}
+
+	// devices seen before the geoip database was configured have no
+	// country, a login is only from a new country once one is known
+	if cfg.newCountry && device.Country != "" &&
+		containsDevice(known, func(d entities.KnownDevice) bool { return d.Country != "" }) &&
+		!containsDevice(known, func(d entities.KnownDevice) bool { return d.Country == device.Country }) {
+		risks = append(risks, LoginRiskNewCountry)
+	}
+
+	if cfg.impossibleTravel && impossibleTravel(known[0], device, cfg.maxTravelSpeed, cfg.minTravelDistance) {
+		risks = append(risks, LoginRiskImpossibleTravel)
+	}
+
+	return risks
+}
+
+// deviceFingerprint identifies a device by its browser family and
+// operating system, so browser updates do not make it a new one, and
+// by the name of the request, which is the one the client sent or the
+// same label again.
+func deviceFingerprint(userAgent, name string) string {
+	return hashToken(deviceName(userAgent) + "\n" + name)
+}
+
+func containsDevice(devices []entities.KnownDevice, fn func(entities.KnownDevice) bool) bool {
+	for _, d := range devices {
+		if fn(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// impossibleTravel reports whether getting from the last login to the
+// current one takes travelling faster than maxSpeed.
+func impossibleTravel(last, current entities.KnownDevice, maxSpeed, minDistance float64) bool {
+	from := deviceLocation(last)
+	to := deviceLocation(current)
+	if !from.HasCoordinates() || !to.HasCoordinates() {
+		return false
+	}
+
+	distance := geoip.Distance(from, to)
+	if distance < minDistance {
+		return false
+	}
+
+	hours := current.LastSeenAt.Sub(last.LastSeenAt).Hours()
+	return hours <= 0 || distance/hours > maxSpeed
+}
+
+func deviceLocation(d entities.KnownDevice) geoip.Location {
+	return geoip.Location{
+		Country:   d.Country,
+		City:      d.City,
+		Latitude:  d.Latitude,
+		Longitude: d.Longitude,
+	}
+}
+
+// notifyLogin emails the user about a login from device.
+func (s Service) notifyLogin(ctx context.Context, device entities.KnownDevice) {
+	if s.mailer == nil && s.loginAlertsCfg.emailTemplateID == "" {
+		return
+	}
+
+	res, errs, err := s.fusion(ctx).RetrieveUserWithContext(ctx, device.UserID)
+	if err != nil || res.StatusCode == http.StatusNotFound || errs != nil {
+		s.log.ErrorContext(ctx, "failed to retrieve user for login alert", "user_id", device.UserID, "error", err, "errors", errs)
+		return
+	}
+
+	var location string
+	if device.Country != "" {
+		location = deviceLocation(device).String()
+	}
+
+	err = s.sendMail(ctx, mailer.TemplateNewDevice, s.loginAlertsCfg.emailTemplateID, userRecipient(res.User), map[string]any{
+		"firstname":   res.User.FirstName,
+		"device_name": device.DeviceName,
+		"ip":          device.IP,
+		"location":    location,
+		"time":        device.LastSeenAt.UTC().Format(time.RFC1123),
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to send login alert", "user_id", device.UserID, "error", err)
+	}
+}
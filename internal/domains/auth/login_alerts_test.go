@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+const (
+	chrome120 = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	chrome121 = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
+	firefox   = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0"
+)
+
+// newLoginAlertService alerts on new devices only, without emails.
+func newLoginAlertService(t *testing.T) (Service, *testRepos) {
+	t.Helper()
+
+	s, repos := newTestService(newFusionStub(t))
+	s.mailer = nil
+	s.loginAlertsCfg = loginAlertsConfig{enabled: true, newDevice: true}
+
+	return s, repos
+}
+
+// loginFrom logs user-1 in and reports whether the login was suspicious.
+func loginFrom(s Service, repos *testRepos, info ClientInfo) bool {
+	before := len(repos.audit.types())
+	s.checkLogin(WithClientInfo(context.Background(), info), "user-1")
+	return slices.Contains(repos.audit.types()[before:], AuditSuspiciousLogin)
+}
+
+func TestLoginAlertsNewDevice(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      ClientInfo
+		then       ClientInfo
+		suspicious bool
+	}{
+		{
+			name:  "browser update",
+			first: ClientInfo{UserAgent: chrome120, IP: "203.0.113.1"},
+			then:  ClientInfo{UserAgent: chrome121, IP: "203.0.113.2"},
+		},
+		{
+			name:       "other browser",
+			first:      ClientInfo{UserAgent: chrome120},
+			then:       ClientInfo{UserAgent: firefox},
+			suspicious: true,
+		},
+		{
+			name:  "named device",
+			first: ClientInfo{UserAgent: "app/1.0", DeviceName: "Work laptop"},
+			then:  ClientInfo{UserAgent: "app/1.1", DeviceName: "Work laptop"},
+		},
+		{
+			name:       "other named device",
+			first:      ClientInfo{UserAgent: "app/1.0", DeviceName: "Work laptop"},
+			then:       ClientInfo{UserAgent: "app/1.0", DeviceName: "Home laptop"},
+			suspicious: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repos := newLoginAlertService(t)
+
+			if loginFrom(s, repos, tt.first) {
+				t.Fatal("first login is suspicious")
+			}
+			if got := loginFrom(s, repos, tt.then); got != tt.suspicious {
+				t.Errorf("suspicious %v, want %v", got, tt.suspicious)
+			}
+		})
+	}
+}
+
+func TestLoginAlertsKnowDevicesSavedByUserAgent(t *testing.T) {
+	s, repos := newLoginAlertService(t)
+	repos.knownDevices.devices = append(repos.knownDevices.devices, entities.KnownDevice{
+		ID:          "device-1",
+		UserID:      "user-1",
+		Fingerprint: hashToken(chrome120),
+		DeviceName:  deviceName(chrome120),
+		UserAgent:   chrome120,
+		LastSeenAt:  time.Now().Add(-time.Hour),
+	})
+
+	if loginFrom(s, repos, ClientInfo{UserAgent: chrome121}) {
+		t.Error("device saved before is new")
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type magicLinkConfig struct {
+	url             string
+	ttl             time.Duration
+	emailTemplateID string
+	maxPerEmail     int
+	window          time.Duration
+}
+
+// RequestMagicLink emails a single use login link. Unknown emails are
+// not reported as an error, so the endpoint can not be used to find out
+// who has an account.
+func (s Service) RequestMagicLink(ctx context.Context, email string) error {
+	now := time.Now()
+
+	count, err := s.magicLinks.CountSince(ctx, email, now.Add(-s.magicLinkCfg.window))
+	if err != nil {
+		return fmt.Errorf("failed to count magic links: %w", err)
+	}
+
+	if count >= s.magicLinkCfg.maxPerEmail {
+		return ErrTooManyRequests
+	}
+
+	user, errs, err := s.fusion(ctx).RetrieveUserByEmailWithContext(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if user.StatusCode == http.StatusNotFound {
+		s.log.DebugContext(ctx, "Magic link requested for unknown email", "email", email)
+		return nil
+	}
+
+	if errs != nil {
+		return fmt.Errorf("failed to retrieve user: %s", errs.Error())
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate magic link token: %w", err)
+	}
+
+	err = s.magicLinks.Create(ctx, entities.MagicLink{
+		TokenHash: hashToken(token),
+		Email:     email,
+		TenantID:  TenantFromContext(ctx),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.magicLinkCfg.ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save magic link: %w", err)
+	}
+
+	link, err := url.Parse(s.magicLinkCfg.url)
+	if err != nil {
+		return fmt.Errorf("failed to parse magic link url: %w", err)
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	err = s.sendMail(ctx, mailer.TemplateMagicLink, s.magicLinkCfg.emailTemplateID, userRecipient(user.User), map[string]any{
+		"link":       link.String(),
+		"expires_in": s.magicLinkCfg.ttl.String(),
+		"firstname":  user.User.FirstName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send magic link: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Sent magic link", "email", email)
+
+	return nil
+}
+
+// VerifyMagicLink exchanges the token from a magic link for a session.
+func (s Service) VerifyMagicLink(ctx context.Context, token string) (Session, error) {
+	if token == "" {
+		return Session{}, ErrInvalidMagicLink
+	}
+
+	link, err := s.magicLinks.Consume(ctx, hashToken(token), time.Now())
+	if err != nil {
+		return Session{}, err
+	}
+
+	if link.TenantID != TenantFromContext(ctx) {
+		return Session{}, ErrInvalidMagicLink
+	}
+
+	s.log.DebugContext(ctx, "Magic link used", "email", link.Email)
+
+	return s.issueSession(ctx, link.Email)
+}
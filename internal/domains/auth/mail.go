@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+)
+
+// recipient is who an email goes to. userID lets fusionauth fill in
+// the user's details in its templates, locale picks the language of
+// the mailer's templates. Both can be empty.
+type recipient struct {
+	userID  string
+	address string
+	locale  string
+}
+
+func userRecipient(user fusionauth.User) recipient {
+	r := recipient{userID: user.Id, address: user.Email}
+	if len(user.PreferredLanguages) > 0 {
+		r.locale = user.PreferredLanguages[0]
+	}
+	return r
+}
+
+// sendMail queues the mailer's template when a mailer is configured and
+// sends the fusionauth template otherwise. Without a locale of their
+// own recipients get the language of the request.
+func (s Service) sendMail(ctx context.Context, template, templateID string, to recipient, data map[string]any) error {
+	if s.mailer != nil {
+		locale := to.locale
+		if locale == "" {
+			locale = clientInfo(ctx).Locale
+		}
+		return s.mailer.Send(ctx, template, locale, to.address, data)
+	}
+
+	req := fusionauth.SendRequest{
+		ApplicationId: s.appID(ctx),
+		RequestData:   data,
+	}
+
+	// addresses that are not the user's email yet, such as a new email
+	// that has to be confirmed, are sent to as they are
+	if to.userID != "" {
+		req.UserIds = []string{to.userID}
+	} else {
+		req.ToAddresses = []fusionauth.EmailAddress{{Address: to.address}}
+	}
+
+	return s.sendEmail(ctx, templateID, req)
+}
+
+func (s Service) sendEmail(ctx context.Context, templateID string, req fusionauth.SendRequest) error {
+	res, errs, err := s.fusion(ctx).SendEmailWithContext(ctx, templateID, req)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	if errs != nil {
+		return fmt.Errorf("failed to send email: %s", errs.Error())
+	}
+
+	// results only has entries for recipients the template failed for
+	if len(res.Results) > 0 {
+		return fmt.Errorf("failed to render email template %s: %v", templateID, res.Results)
+	}
+
+	s.log.DebugContext(ctx, "Sent email", "template", templateID, "user_ids", req.UserIds)
+
+	return nil
+}
+
+// linkWithToken adds the token to the url as the token query parameter.
+func linkWithToken(rawURL, token string) (string, error) {
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+	return link.String(), nil
+}
+
+// sendVerification emails a link to verify the user's email. Failures
+// are only logged, the user can still log in.
+func (s Service) sendVerification(ctx context.Context, user fusionauth.User) {
+	res, err := s.fusion(ctx).GenerateEmailVerificationIdWithContext(ctx, user.Email)
+	if err != nil || res.VerificationId == "" {
+		s.log.ErrorContext(ctx, "failed to generate email verification id", "user_id", user.Id, "error", err)
+		return
+	}
+
+	link, err := linkWithToken(s.accountsCfg.verificationURL, res.VerificationId)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to parse verification url", "error", err)
+		return
+	}
+
+	err = s.sendMail(ctx, mailer.TemplateVerification, "", userRecipient(user), map[string]any{
+		"link":      link,
+		"firstname": user.FirstName,
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to send verification email", "user_id", user.Id, "error", err)
+	}
+}
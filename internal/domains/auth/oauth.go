@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// OAuthStart prepares an authorization code flow with PKCE and returns
+// the url of the provider the user has to be redirected to.
+func (s Service) OAuthStart(ctx context.Context, provider string) (string, error) {
+	p, ok := s.oauthProviders[provider]
+	if !ok {
+		return "", ErrUnknownOAuthProvider
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+
+	err = s.oauthStates.Create(ctx, entities.OAuthState{
+		State:        state,
+		Provider:     provider,
+		TenantID:     TenantFromContext(ctx),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(s.oauthStateTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save oauth state: %w", err)
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, pkceChallenge(verifier), s.oauthRedirectURI(provider))
+	if err != nil {
+		return "", fmt.Errorf("failed to build authorization url: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Started oauth flow", "provider", provider)
+
+	return authURL, nil
+}
+
+// OAuthCallback finishes the flow started by OAuthStart. The external
+// identity is linked to an existing user with the same verified email
+// or a new user is registered for it.
+func (s Service) OAuthCallback(ctx context.Context, provider, state, code string) (Session, error) {
+	p, ok := s.oauthProviders[provider]
+	if !ok {
+		return Session{}, ErrUnknownOAuthProvider
+	}
+
+	st, err := s.oauthStates.Take(ctx, state)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if st.Provider != provider || time.Now().After(st.ExpiresAt) {
+		return Session{}, ErrInvalidOAuthState
+	}
+
+	// the callback url is shared by all tenants, the flow belongs to
+	// the one it was started for
+	ctx = WithTenant(ctx, st.TenantID)
+
+	identity, err := p.Exchange(ctx, code, st.CodeVerifier, st.Nonce, s.oauthRedirectURI(provider))
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to exchange oauth code", "provider", provider, "error", err)
+		return Session{}, fmt.Errorf("failed to exchange oauth code: %w", err)
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return Session{}, ErrOAuthEmailNotVerified
+	}
+
+	if err := s.linkExternalIdentity(ctx, identity); err != nil {
+		return Session{}, err
+	}
+
+	return s.issueSession(ctx, identity.Email)
+}
+
+func (s Service) oauthRedirectURI(provider string) string {
+	return s.oauthRedirect + "/auth/oauth/" + provider + "/callback"
+}
+
+func (s Service) linkExternalIdentity(ctx context.Context, identity ExternalIdentity) error {
+	res, errs, err := s.fusion(ctx).RetrieveUserByEmailWithContext(ctx, identity.Email)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return s.registerExternalIdentity(ctx, identity)
+	}
+
+	if errs != nil {
+		return fmt.Errorf("failed to retrieve user: %s", errs.Error())
+	}
+
+	// anyone can register an email they do not own and wait for its
+	// owner to log in with a provider. linking would hand them the
+	// account with the password they set, so only verified accounts
+	// are linked.
+	if !res.User.Verified {
+		return ErrOAuthAccountNotVerified
+	}
+
+	u, err := s.usersRepo.GetByEmail(ctx, identity.Email)
+	if errors.Is(err, ErrEmailNotFound) {
+		u, err = s.usersRepo.Create(ctx, entities.User{
+			ProviderID: res.User.Id,
+			TenantID:   TenantFromContext(ctx),
+			Email:      identity.Email,
+			Firstname:  res.User.FirstName,
+			Lastname:   res.User.LastName,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	for _, i := range u.Identities {
+		if i.Provider == identity.Provider && i.Subject == identity.Subject {
+			return nil
+		}
+	}
+
+	u.Identities = append(u.Identities, entities.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		LinkedAt: time.Now(),
+	})
+
+	if _, err := s.usersRepo.Update(ctx, u); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Linked external identity", "email", identity.Email, "provider", identity.Provider)
+
+	return nil
+}
+
+func (s Service) registerExternalIdentity(ctx context.Context, identity ExternalIdentity) error {
+	if s.tenant(ctx).registrationDisabled {
+		return ErrRegistrationDisabled
+	}
+	// social logins can not carry an invitation
+	if s.registrationPolicy.inviteOnly {
+		return ErrInvitationRequired
+	}
+
+	// the provider verified the email, hooks can change the names only
+	hookReq := RegisterHookRequest{Email: identity.Email, Firstname: identity.Firstname, Lastname: identity.Lastname}
+	if err := s.runBeforeHooks(func(h Hook) error { return h.BeforeRegister(ctx, &hookReq) }); err != nil {
+		return err
+	}
+	identity.Firstname, identity.Lastname = hookReq.Firstname, hookReq.Lastname
+
+	if err := s.checkEmailDomain(identity.Email); err != nil {
+		return err
+	}
+
+	// the user never sees this password, it only satisfies fusionauth.
+	// they can set a real one with the forgot password flow.
+	password, err := randomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	var user fusionauth.RegistrationRequest
+
+	user.Registration = fusionauth.UserRegistration{
+		ApplicationId: s.appID(ctx),
+	}
+	user.SkipVerification = true
+	user.User.Email = identity.Email
+	user.User.Password = password
+	user.User.FirstName = identity.Firstname
+	user.User.LastName = identity.Lastname
+	user.User.Data = hookReq.Data
+
+	res, errs, err := s.fusion(ctx).Register("", user)
+	if err != nil {
+		return fmt.Errorf("failed to register: %w", err)
+	}
+
+	if errs != nil {
+		return fmt.Errorf("failed to register: %s", errs.Error())
+	}
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.usersRepo.Create(ctx, entities.User{
+			ProviderID: res.User.Id,
+			TenantID:   TenantFromContext(ctx),
+			Email:      identity.Email,
+			Firstname:  identity.Firstname,
+			Lastname:   identity.Lastname,
+			Identities: []entities.UserIdentity{{
+				Provider: identity.Provider,
+				Subject:  identity.Subject,
+				LinkedAt: time.Now(),
+			}},
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventUserRegistered, map[string]any{
+			"user_id":   res.User.Id,
+			"email":     identity.Email,
+			"firstname": identity.Firstname,
+			"lastname":  identity.Lastname,
+			"provider":  identity.Provider,
+		})
+	})
+	if err != nil {
+		if res, _, err := s.fusion(ctx).DeleteUser(res.User.Id); err != nil {
+			s.log.ErrorContext(ctx, "Failed to delete user", "error", err, "response", res)
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Registered user from external identity", "email", identity.Email, "provider", identity.Provider)
+
+	s.runAfterHooks(ctx, "register", func(h Hook) error {
+		return h.AfterRegister(ctx, HookUser{ID: res.User.Id, Email: identity.Email, TenantID: TenantFromContext(ctx)})
+	})
+
+	return nil
+}
+
+// issueSession logs in a user that has already been authenticated by
+// other means. It relies on the passwordless login being enabled for
+// the fusionauth application. Login hooks run like for passwords, but
+// can not change the email that was authenticated.
+func (s Service) issueSession(ctx context.Context, email string) (Session, error) {
+	hookReq := LoginHookRequest{Email: email}
+	if err := s.runBeforeHooks(func(h Hook) error { return h.BeforeLogin(ctx, &hookReq) }); err != nil {
+		return Session{}, err
+	}
+
+	start, errs, err := s.fusion(ctx).StartPasswordlessLoginWithContext(ctx, fusionauth.PasswordlessStartRequest{
+		ApplicationId: s.appID(ctx),
+		LoginId:       email,
+	})
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to start passwordless login: %w", err)
+	}
+
+	if errs != nil {
+		return Session{}, fmt.Errorf("failed to start passwordless login: %s", errs.Error())
+	}
+
+	var req fusionauth.PasswordlessLoginRequest
+
+	req.ApplicationId = s.appID(ctx)
+	req.Code = start.Code
+
+	res, errs, err := s.fusion(ctx).PasswordlessLoginWithContext(ctx, req)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to login: %w", err)
+	}
+
+	if errs != nil {
+		return Session{}, fmt.Errorf("failed to login: %s", errs.Error())
+	}
+
+	s.log.DebugContext(ctx, "Issued session", "email", email)
+
+	s.cancelDeletion(ctx, email)
+
+	session, err := s.startSession(ctx, res.User.Id, res.RefreshTokenId, Session{res.Token, res.RefreshToken})
+	if err != nil {
+		return Session{}, err
+	}
+
+	s.runAfterHooks(ctx, "login", func(h Hook) error {
+		return h.AfterLogin(ctx, HookUser{ID: res.User.Id, Email: email, TenantID: TenantFromContext(ctx)})
+	})
+
+	return session, nil
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// newOAuthService signs in new@example.com with the provider "google".
+// The fusionauth stub does not know the email, so the callback
+// registers it. Registrations are counted in registered.
+func newOAuthService(t *testing.T, hook *recordingHook, registered *int) (Service, *testRepos) {
+	t.Helper()
+
+	fusion := newFusionStub(t)
+	fusion.handle("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	fusion.handle("/api/user/registration", func(w http.ResponseWriter, r *http.Request) {
+		var req fusionauth.RegistrationRequest
+		readJSON(t, r, &req)
+		if fmt.Sprint(req.User.Data) != fmt.Sprint(hook.data) {
+			t.Errorf("registered with data %v, want %v", req.User.Data, hook.data)
+		}
+
+		*registered++
+		var res fusionauth.RegistrationResponse
+		res.User.Id = "user-1"
+		res.User.Email = req.User.Email
+		writeJSON(t, w, http.StatusOK, res)
+	})
+	fusion.handle("/api/passwordless/start", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, http.StatusOK, fusionauth.PasswordlessStartResponse{Code: "code"})
+	})
+	fusion.handle("/api/passwordless/login", func(w http.ResponseWriter, r *http.Request) {
+		res := fusionauth.LoginResponse{Token: "access", RefreshToken: "provider-refresh"}
+		res.User.Id = "user-1"
+		writeJSON(t, w, http.StatusOK, res)
+	})
+
+	s, repos := newTestService(fusion)
+	s.hooks = []Hook{hook}
+	s.oauthProviders = map[string]OAuthProvider{"google": fakeOAuthProvider{identity: ExternalIdentity{
+		Provider:      "google",
+		Subject:       "google-1",
+		Email:         "new@example.com",
+		EmailVerified: true,
+		Firstname:     "Jane",
+		Lastname:      "Doe",
+	}}}
+	repos.oauthStates.states = append(repos.oauthStates.states, entities.OAuthState{
+		State:     "state",
+		Provider:  "google",
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+
+	return s, repos
+}
+
+func TestOAuthRegistrationRunsHooks(t *testing.T) {
+	hook := &recordingHook{data: map[string]any{"plan": "free"}}
+	var registered int
+	s, repos := newOAuthService(t, hook, &registered)
+
+	session, err := s.OAuthCallback(context.Background(), "google", "state", "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"before_register", "after_register", "before_login", "after_login"}
+	if !slices.Equal(hook.calls, want) {
+		t.Errorf("hooks %v, want %v", hook.calls, want)
+	}
+	if registered != 1 || len(repos.users.users) != 1 {
+		t.Errorf("%d fusionauth and %d stored users, want 1", registered, len(repos.users.users))
+	}
+	if session.RefreshToken == "" || len(repos.sessions.sessions) != 1 {
+		t.Error("no session was started")
+	}
+}
+
+func TestOAuthRegistrationRejectedByHook(t *testing.T) {
+	hook := &recordingHook{reject: fmt.Errorf("%w: example.com can not register", ErrHookRejected)}
+	var registered int
+	s, repos := newOAuthService(t, hook, &registered)
+
+	_, err := s.OAuthCallback(context.Background(), "google", "state", "code")
+	if !errors.Is(err, ErrHookRejected) {
+		t.Fatalf("error %v, want %v", err, ErrHookRejected)
+	}
+
+	if registered != 0 || len(repos.users.users) != 0 {
+		t.Error("user was registered")
+	}
+	if len(repos.sessions.sessions) != 0 {
+		t.Error("session was started")
+	}
+}
@@ -0,0 +1,522 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type organizationsConfig struct {
+	invitationURL        string
+	invitationTemplateID string
+	invitationTTL        time.Duration
+}
+
+// CreateOrganization creates an organization owned by the user.
+func (s Service) CreateOrganization(ctx context.Context, user entities.User, name string) (entities.Organization, error) {
+	org, err := s.createOrganization(ctx, user.ProviderID, name)
+	if err != nil {
+		return entities.Organization{}, err
+	}
+
+	err = s.memberships.Create(ctx, entities.Membership{
+		OrganizationID: org.ID,
+		UserID:         user.ProviderID,
+		Email:          user.Email,
+		Roles:          []string{entities.OrgRoleOwner},
+		JoinedAt:       org.CreatedAt,
+	})
+	if err != nil {
+		return entities.Organization{}, fmt.Errorf("failed to add owner: %w", err)
+	}
+
+	return org, nil
+}
+
+// CreateOrganizationFor lets an admin create an organization for a
+// customer, the owner is invited by email.
+func (s Service) CreateOrganizationFor(ctx context.Context, actorID, name, ownerEmail string) (entities.Organization, entities.Invitation, error) {
+	org, err := s.createOrganization(ctx, actorID, name)
+	if err != nil {
+		return entities.Organization{}, entities.Invitation{}, err
+	}
+
+	invitation, err := s.CreateInvitation(ctx, actorID, org.ID, ownerEmail, []string{entities.OrgRoleOwner})
+	if err != nil {
+		return entities.Organization{}, entities.Invitation{}, err
+	}
+
+	return org, invitation, nil
+}
+
+func (s Service) createOrganization(ctx context.Context, actorID, name string) (entities.Organization, error) {
+	org := entities.Organization{
+		ID:        uuid.New().String(),
+		TenantID:  TenantFromContext(ctx),
+		Name:      name,
+		CreatedBy: actorID,
+		CreatedAt: time.Now(),
+	}
+
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.organizations.Create(ctx, org); err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventOrganizationCreated, map[string]any{
+			"organization_id": org.ID,
+			"name":            org.Name,
+		})
+	})
+	if err != nil {
+		return entities.Organization{}, fmt.Errorf("failed to save organization: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Created organization", "organization_id", org.ID)
+
+	s.recordAudit(ctx, AuditOrganizationCreated, actorID, map[string]any{
+		"organization_id": org.ID,
+	})
+
+	return org, nil
+}
+
+// ListUserOrganizations returns the organizations the user is a member
+// of and their roles there.
+func (s Service) ListUserOrganizations(ctx context.Context, user entities.User) ([]UserOrganization, error) {
+	memberships, err := s.memberships.ListByUser(ctx, user.ProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	ids := make([]string, 0, len(memberships))
+	roles := make(map[string][]string, len(memberships))
+	for _, m := range memberships {
+		ids = append(ids, m.OrganizationID)
+		roles[m.OrganizationID] = m.Roles
+	}
+
+	orgs, err := s.organizations.ListByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	res := make([]UserOrganization, 0, len(orgs))
+	for _, org := range orgs {
+		res = append(res, UserOrganization{
+			Organization: org,
+			Roles:        roles[org.ID],
+			Active:       org.ID == user.ActiveOrganizationID,
+		})
+	}
+
+	return res, nil
+}
+
+// SwitchOrganization refreshes the session and makes the organization
+// its active one. It is kept on the session, not the user, so every
+// device can work in another organization.
+func (s Service) SwitchOrganization(ctx context.Context, user entities.User, orgID, refreshToken string) (Session, error) {
+	if _, err := s.organizations.Get(ctx, orgID); err != nil {
+		return Session{}, err
+	}
+
+	_, err := s.memberships.Get(ctx, orgID, user.ProviderID)
+	if errors.Is(err, ErrMembershipNotFound) {
+		return Session{}, ErrNotOrganizationMember
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to get membership: %w", err)
+	}
+
+	// the refresh token has to be the user's own, unknown ones are left
+	// to RefreshToken
+	current, err := s.sessions.GetByTokenHash(ctx, hashToken(refreshToken))
+	if err == nil && current.UserID != user.ProviderID {
+		return Session{}, ErrSessionNotFound
+	}
+
+	session, err := s.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if err := s.sessions.SetActiveOrganization(ctx, current.ID, orgID); err != nil {
+		return Session{}, fmt.Errorf("failed to set active organization: %w", err)
+	}
+
+	s.recordAudit(ctx, AuditOrganizationSwitched, user.ProviderID, map[string]any{
+		"organization_id": orgID,
+	})
+
+	return session, nil
+}
+
+// InviteMember is CreateInvitation for members of the organization.
+// Owners and admins can invite, only owners can invite owners.
+func (s Service) InviteMember(ctx context.Context, user entities.User, orgID, email string, roles []string) (entities.Invitation, error) {
+	membership, err := s.memberships.Get(ctx, orgID, user.ProviderID)
+	if errors.Is(err, ErrMembershipNotFound) {
+		return entities.Invitation{}, ErrNotOrganizationMember
+	}
+	if err != nil {
+		return entities.Invitation{}, fmt.Errorf("failed to get membership: %w", err)
+	}
+
+	switch {
+	case slices.Contains(membership.Roles, entities.OrgRoleOwner):
+	case slices.Contains(membership.Roles, entities.OrgRoleAdmin) && !slices.Contains(roles, entities.OrgRoleOwner):
+	default:
+		return entities.Invitation{}, ErrOrganizationRoleRequired
+	}
+
+	return s.CreateInvitation(ctx, user.ProviderID, orgID, email, roles)
+}
+
+// CreateInvitation emails a link to join the organization with the
+// roles, members get the member role if none are given.
+func (s Service) CreateInvitation(ctx context.Context, actorID, orgID, email string, roles []string) (entities.Invitation, error) {
+	if len(roles) == 0 {
+		roles = []string{entities.OrgRoleMember}
+	}
+	if err := validateOrgRoles(roles); err != nil {
+		return entities.Invitation{}, err
+	}
+
+	org, err := s.organizations.Get(ctx, orgID)
+	if err != nil {
+		return entities.Invitation{}, err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return entities.Invitation{}, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+
+	now := time.Now()
+
+	invitation := entities.Invitation{
+		ID:             uuid.New().String(),
+		TokenHash:      hashToken(token),
+		OrganizationID: orgID,
+		TenantID:       TenantFromContext(ctx),
+		Email:          strings.ToLower(email),
+		Roles:          roles,
+		InvitedBy:      actorID,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(s.organizationsCfg.invitationTTL),
+	}
+
+	if err := s.invitations.Create(ctx, invitation); err != nil {
+		return entities.Invitation{}, fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	link, err := url.Parse(s.organizationsCfg.invitationURL)
+	if err != nil {
+		return entities.Invitation{}, fmt.Errorf("failed to parse invitation url: %w", err)
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	err = s.sendMail(ctx, mailer.TemplateInvitation, s.organizationsCfg.invitationTemplateID, recipient{address: invitation.Email}, map[string]any{
+		"link":              link.String(),
+		"organization_id":   orgID,
+		"organization_name": org.Name,
+		"expires_in":        s.organizationsCfg.invitationTTL.String(),
+	})
+	if err != nil {
+		return entities.Invitation{}, fmt.Errorf("failed to send invitation: %w", err)
+	}
+
+	s.recordAudit(ctx, AuditInvitationCreated, actorID, map[string]any{
+		"organization_id": orgID,
+		"invitation_id":   invitation.ID,
+		"roles":           roles,
+	})
+
+	return invitation, nil
+}
+
+// CheckInvitation tells whether the invitation can be accepted by the
+// email, before logging in or registering with it.
+func (s Service) CheckInvitation(ctx context.Context, token, email string) error {
+	_, err := s.pendingInvitation(ctx, token, email)
+	return err
+}
+
+// AcceptInvitation adds the user to the organization they were invited
+// to. It has to be accepted with the email it was sent to.
+func (s Service) AcceptInvitation(ctx context.Context, user entities.User, token string) (entities.Membership, error) {
+	invitation, err := s.pendingInvitation(ctx, token, user.Email)
+	if err != nil {
+		return entities.Membership{}, err
+	}
+
+	now := time.Now()
+
+	membership := entities.Membership{
+		OrganizationID: invitation.OrganizationID,
+		UserID:         user.ProviderID,
+		Email:          user.Email,
+		Roles:          invitation.Roles,
+		InvitedBy:      invitation.InvitedBy,
+		JoinedAt:       now,
+	}
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.invitations.MarkAccepted(ctx, invitation.ID, user.ProviderID, now); err != nil {
+			return err
+		}
+
+		if err := s.memberships.Create(ctx, membership); err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventOrganizationMemberAdded, map[string]any{
+			"organization_id": invitation.OrganizationID,
+			"user_id":         user.ProviderID,
+			"roles":           invitation.Roles,
+		})
+	})
+	if err != nil {
+		return entities.Membership{}, err
+	}
+
+	s.log.DebugContext(ctx, "Accepted invitation", "invitation_id", invitation.ID, "user_id", user.ProviderID)
+
+	s.recordAudit(ctx, AuditInvitationAccepted, user.ProviderID, map[string]any{
+		"organization_id": invitation.OrganizationID,
+		"invitation_id":   invitation.ID,
+		"roles":           invitation.Roles,
+	})
+
+	return membership, nil
+}
+
+func (s Service) pendingInvitation(ctx context.Context, token, email string) (entities.Invitation, error) {
+	invitation, err := s.invitations.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		return entities.Invitation{}, err
+	}
+
+	if invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		return entities.Invitation{}, ErrInvalidInvitation
+	}
+
+	if !strings.EqualFold(invitation.Email, email) {
+		return entities.Invitation{}, ErrInvitationEmailMismatch
+	}
+
+	return invitation, nil
+}
+
+func (s Service) ListOrganizations(ctx context.Context) ([]entities.Organization, error) {
+	return s.organizations.List(ctx)
+}
+
+func (s Service) GetOrganization(ctx context.Context, id string) (entities.Organization, error) {
+	return s.organizations.Get(ctx, id)
+}
+
+// DeleteOrganization removes the organization with its memberships and
+// invitations.
+func (s Service) DeleteOrganization(ctx context.Context, actorID, id string) error {
+	if _, err := s.organizations.Get(ctx, id); err != nil {
+		return err
+	}
+
+	members := 0
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		members, err = s.memberships.DeleteByOrganization(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete memberships: %w", err)
+		}
+
+		if _, err := s.invitations.DeleteByOrganization(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete invitations: %w", err)
+		}
+
+		if err := s.organizations.Delete(ctx, id); err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventOrganizationDeleted, map[string]any{
+			"organization_id": id,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.recordAudit(ctx, AuditOrganizationDeleted, actorID, map[string]any{
+		"organization_id": id,
+		"members":         members,
+	})
+
+	return nil
+}
+
+func (s Service) ListMembers(ctx context.Context, orgID string) ([]entities.Membership, error) {
+	if _, err := s.organizations.Get(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	return s.memberships.ListByOrganization(ctx, orgID)
+}
+
+func (s Service) ListInvitations(ctx context.Context, orgID string) ([]entities.Invitation, error) {
+	if _, err := s.organizations.Get(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	return s.invitations.ListByOrganization(ctx, orgID)
+}
+
+func (s Service) RevokeInvitation(ctx context.Context, actorID, id string) error {
+	invitation, err := s.invitations.Get(ctx, id)
+	if errors.Is(err, ErrInvalidInvitation) {
+		return ErrInvitationNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.invitations.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.recordAudit(ctx, AuditInvitationRevoked, actorID, map[string]any{
+		"organization_id": invitation.OrganizationID,
+		"invitation_id":   id,
+	})
+
+	return nil
+}
+
+// UpdateMemberRoles replaces the roles of a member. An organization
+// always keeps an owner.
+func (s Service) UpdateMemberRoles(ctx context.Context, actorID, orgID, userID string, roles []string) (entities.Membership, error) {
+	if len(roles) == 0 {
+		return entities.Membership{}, ErrInvalidOrganizationRole
+	}
+	if err := validateOrgRoles(roles); err != nil {
+		return entities.Membership{}, err
+	}
+
+	membership, err := s.member(ctx, orgID, userID)
+	if err != nil {
+		return entities.Membership{}, err
+	}
+
+	if !slices.Contains(roles, entities.OrgRoleOwner) {
+		if err := s.keepOwner(ctx, membership); err != nil {
+			return entities.Membership{}, err
+		}
+	}
+
+	if err := s.memberships.UpdateRoles(ctx, orgID, userID, roles); err != nil {
+		return entities.Membership{}, err
+	}
+
+	s.recordAudit(ctx, AuditMembershipUpdated, actorID, map[string]any{
+		"organization_id": orgID,
+		"user_id":         userID,
+		"old_roles":       membership.Roles,
+		"roles":           roles,
+	})
+
+	membership.Roles = roles
+
+	return membership, nil
+}
+
+func (s Service) RemoveMember(ctx context.Context, actorID, orgID, userID string) error {
+	membership, err := s.member(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.keepOwner(ctx, membership); err != nil {
+		return err
+	}
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.memberships.Delete(ctx, orgID, userID); err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventOrganizationMemberRemoved, map[string]any{
+			"organization_id": orgID,
+			"user_id":         userID,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// tokens issued before keep working until they expire, but no
+	// longer carry the organization
+	if _, err := s.sessions.ClearActiveOrganization(ctx, userID, orgID); err != nil {
+		s.log.ErrorContext(ctx, "failed to clear active organization", "user_id", userID, "error", err)
+	}
+
+	s.recordAudit(ctx, AuditMembershipRemoved, actorID, map[string]any{
+		"organization_id": orgID,
+		"user_id":         userID,
+	})
+
+	return nil
+}
+
+// member returns a membership of an organization of the request's
+// tenant, memberships themselves are not tenant scoped.
+func (s Service) member(ctx context.Context, orgID, userID string) (entities.Membership, error) {
+	if _, err := s.organizations.Get(ctx, orgID); err != nil {
+		return entities.Membership{}, err
+	}
+
+	return s.memberships.Get(ctx, orgID, userID)
+}
+
+// keepOwner fails if the membership is the last owner of its
+// organization.
+func (s Service) keepOwner(ctx context.Context, membership entities.Membership) error {
+	if !slices.Contains(membership.Roles, entities.OrgRoleOwner) {
+		return nil
+	}
+
+	members, err := s.memberships.ListByOrganization(ctx, membership.OrganizationID)
+	if err != nil {
+		return fmt.Errorf("failed to list members: %w", err)
+	}
+
+	for _, m := range members {
+		if m.UserID != membership.UserID && slices.Contains(m.Roles, entities.OrgRoleOwner) {
+			return nil
+		}
+	}
+
+	return ErrLastOrganizationOwner
+}
+
+func validateOrgRoles(roles []string) error {
+	for _, role := range roles {
+		switch role {
+		case entities.OrgRoleOwner, entities.OrgRoleAdmin, entities.OrgRoleMember:
+		default:
+			return ErrInvalidOrganizationRole
+		}
+	}
+	return nil
+}
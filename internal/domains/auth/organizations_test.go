@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// newOrganizationService has user-1 as a member of org-1 with two
+// sessions, refreshed tokens are access-2. The fusionauth stub accepts
+// every access token of user-1.
+func newOrganizationService(t *testing.T) (Service, *testRepos, [2]Session) {
+	t.Helper()
+
+	fusion := newRefreshStub(t, "provider-refresh")
+	fusion.handle("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("unexpected fusionauth call %s %s", r.Method, r.URL)
+		}
+
+		var res fusionauth.UserResponse
+		res.User.Id = "user-1"
+		res.User.Email = "user@example.com"
+		writeJSON(t, w, http.StatusOK, res)
+	})
+
+	s, repos := newTestService(fusion)
+	ctx := context.Background()
+
+	repos.organizations.orgs = append(repos.organizations.orgs, entities.Organization{ID: "org-1", Name: "Acme"})
+	repos.memberships.memberships = append(repos.memberships.memberships, entities.Membership{
+		OrganizationID: "org-1",
+		UserID:         "user-1",
+		Roles:          []string{entities.OrgRoleMember},
+	})
+
+	var sessions [2]Session
+	for i, access := range []string{"access-a", "access-b"} {
+		session, err := s.startSession(ctx, "user-1", "", Session{AccessToken: access, RefreshToken: "provider-refresh"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[i] = session
+	}
+
+	return s, repos, sessions
+}
+
+func activeOrganizationOf(t *testing.T, s Service, accessToken string) string {
+	t.Helper()
+
+	user, err := s.VerifyToken(context.Background(), accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ActiveOrganizationID
+}
+
+func TestSwitchOrganizationIsPerSession(t *testing.T) {
+	s, _, sessions := newOrganizationService(t)
+
+	session, err := s.SwitchOrganization(context.Background(), testSessionUser(), "org-1", sessions[0].RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := activeOrganizationOf(t, s, session.AccessToken); got != "org-1" {
+		t.Errorf("switched session is in %q, want org-1", got)
+	}
+	if got := activeOrganizationOf(t, s, sessions[1].AccessToken); got != "" {
+		t.Errorf("other session is in %q, want none", got)
+	}
+}
+
+func TestSwitchOrganizationNeedsOwnSession(t *testing.T) {
+	s, repos, sessions := newOrganizationService(t)
+	repos.memberships.memberships = append(repos.memberships.memberships, entities.Membership{
+		OrganizationID: "org-1",
+		UserID:         "user-2",
+		Roles:          []string{entities.OrgRoleMember},
+	})
+
+	// the stub fails the test if the refresh reaches fusionauth
+	mallory := entities.User{ProviderID: "user-2", Email: "mallory@example.com"}
+	_, err := s.SwitchOrganization(context.Background(), mallory, "org-1", sessions[0].RefreshToken)
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("error %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if repos.sessions.sessions[0].RefreshTokenHash != hashToken(sessions[0].RefreshToken) {
+		t.Error("session was rotated")
+	}
+	if got := activeOrganizationOf(t, s, sessions[0].AccessToken); got != "" {
+		t.Errorf("session is in %q, want none", got)
+	}
+}
+
+func TestSwitchOrganizationNeedsMembership(t *testing.T) {
+	s, repos, sessions := newOrganizationService(t)
+	repos.memberships.memberships = nil
+
+	_, err := s.SwitchOrganization(context.Background(), testSessionUser(), "org-1", sessions[0].RefreshToken)
+	if !errors.Is(err, ErrNotOrganizationMember) {
+		t.Fatalf("error %v, want %v", err, ErrNotOrganizationMember)
+	}
+}
+
+func TestRemoveMemberClearsActiveOrganization(t *testing.T) {
+	s, _, sessions := newOrganizationService(t)
+	ctx := context.Background()
+
+	session, err := s.SwitchOrganization(ctx, testSessionUser(), "org-1", sessions[0].RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RemoveMember(ctx, "admin-1", "org-1", "user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := activeOrganizationOf(t, s, session.AccessToken); got != "" {
+		t.Errorf("removed member is still in %q", got)
+	}
+}
+
+func TestRegisterInviteOnly(t *testing.T) {
+	var deleted int
+	s, repos := newTestService(newRegisterStub(t, "", &deleted))
+	s.registrationPolicy.inviteOnly = true
+	repos.invitations.invitations = append(repos.invitations.invitations, entities.Invitation{
+		ID:             "invitation-1",
+		TokenHash:      hashToken("invitation"),
+		OrganizationID: "org-1",
+		Email:          "user@example.com",
+		ExpiresAt:      time.Now().Add(time.Hour),
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		email      string
+		invitation string
+		want       error
+	}{
+		{"user@example.com", "", ErrInvitationRequired},
+		{"user@example.com", "unknown", ErrInvitationNotFound},
+		{"mallory@example.com", "invitation", ErrInvitationEmailMismatch},
+		{"user@example.com", "invitation", nil},
+	}
+
+	for _, tt := range tests {
+		_, err := s.Register(ctx, tt.email, "password", "Jane", "Doe", tt.invitation)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s with %q: error %v, want %v", tt.email, tt.invitation, err, tt.want)
+		}
+	}
+
+	if len(repos.users.users) != 1 {
+		t.Errorf("%d users registered, want the invited one", len(repos.users.users))
+	}
+}
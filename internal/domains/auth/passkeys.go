@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+const (
+	challengeRegistration = "registration"
+	challengeLogin        = "login"
+)
+
+type passkeyUser struct {
+	id          string
+	email       string
+	displayName string
+	credentials []webauthn.Credential
+}
+
+func (u passkeyUser) WebAuthnID() []byte                         { return []byte(u.id) }
+func (u passkeyUser) WebAuthnName() string                       { return u.email }
+func (u passkeyUser) WebAuthnDisplayName() string                { return u.displayName }
+func (u passkeyUser) WebAuthnIcon() string                       { return "" }
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func (s Service) BeginPasskeyRegistration(ctx context.Context, user entities.User) (PasskeyChallenge, error) {
+	u, err := s.loadPasskeyUser(ctx, user.ProviderID)
+	if err != nil {
+		return PasskeyChallenge{}, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	options, session, err := s.webauthn.BeginRegistration(u,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to begin registration: %w", err)
+	}
+
+	return s.saveChallenge(ctx, challengeRegistration, u.id, session, options)
+}
+
+func (s Service) FinishPasskeyRegistration(ctx context.Context, user entities.User, challengeID, name string, body io.Reader) (entities.Passkey, error) {
+	session, err := s.takeChallenge(ctx, challengeID, challengeRegistration)
+	if err != nil {
+		return entities.Passkey{}, err
+	}
+
+	u, err := s.loadPasskeyUser(ctx, user.ProviderID)
+	if err != nil {
+		return entities.Passkey{}, err
+	}
+
+	if string(session.UserID) != u.id {
+		return entities.Passkey{}, ErrInvalidPasskeyChallenge
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to parse passkey registration", "error", err)
+		return entities.Passkey{}, ErrInvalidPasskey
+	}
+
+	credential, err := s.webauthn.CreateCredential(u, session, parsed)
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to verify passkey registration", "error", err)
+		return entities.Passkey{}, ErrInvalidPasskey
+	}
+
+	if strings.TrimSpace(name) == "" {
+		name = "Passkey"
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	passkey := entities.Passkey{
+		ID:              base64.RawURLEncoding.EncodeToString(credential.ID),
+		UserID:          u.id,
+		Name:            name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+
+	if err := s.passkeys.Create(ctx, passkey); err != nil {
+		return entities.Passkey{}, err
+	}
+
+	s.log.DebugContext(ctx, "Registered passkey", "user_id", u.id, "passkey", passkey.ID)
+
+	return passkey, nil
+}
+
+// BeginPasskeyLogin starts a login ceremony. Without an email the
+// browser lets the user pick any discoverable passkey for the site.
+func (s Service) BeginPasskeyLogin(ctx context.Context, email string) (PasskeyChallenge, error) {
+	if email == "" {
+		options, session, err := s.webauthn.BeginDiscoverableLogin()
+		if err != nil {
+			return PasskeyChallenge{}, fmt.Errorf("failed to begin login: %w", err)
+		}
+		return s.saveChallenge(ctx, challengeLogin, "", session, options)
+	}
+
+	res, errs, err := s.fusion(ctx).RetrieveUserByEmailWithContext(ctx, email)
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return PasskeyChallenge{}, ErrInvalidPasskey
+	}
+
+	if errs != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to retrieve user: %s", errs.Error())
+	}
+
+	u, err := s.loadPasskeyUser(ctx, res.User.Id)
+	if err != nil {
+		return PasskeyChallenge{}, err
+	}
+
+	if len(u.credentials) == 0 {
+		return PasskeyChallenge{}, ErrInvalidPasskey
+	}
+
+	options, session, err := s.webauthn.BeginLogin(u)
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to begin login: %w", err)
+	}
+
+	return s.saveChallenge(ctx, challengeLogin, u.id, session, options)
+}
+
+func (s Service) FinishPasskeyLogin(ctx context.Context, challengeID string, body io.Reader) (Session, error) {
+	session, err := s.takeChallenge(ctx, challengeID, challengeLogin)
+	if err != nil {
+		return Session{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to parse passkey assertion", "error", err)
+		return Session{}, ErrInvalidPasskey
+	}
+
+	var (
+		u          passkeyUser
+		credential *webauthn.Credential
+	)
+
+	if len(session.UserID) > 0 {
+		u, err = s.loadPasskeyUser(ctx, string(session.UserID))
+		if err != nil {
+			return Session{}, err
+		}
+		credential, err = s.webauthn.ValidateLogin(u, session, parsed)
+	} else {
+		credential, err = s.webauthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			u, err = s.loadPasskeyUser(ctx, string(userHandle))
+			return u, err
+		}, session, parsed)
+	}
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to verify passkey assertion", "error", err)
+		return Session{}, ErrInvalidPasskey
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+
+	// the library flags a sign count that did not increase. Authenticators
+	// that do not implement counters always report zero and are allowed.
+	if credential.Authenticator.CloneWarning {
+		s.log.WarnContext(ctx, "passkey sign count did not increase", "user_id", u.id, "passkey", id)
+		return Session{}, ErrPasskeyCloned
+	}
+
+	if err := s.passkeys.UpdateSignCount(ctx, id, credential.Authenticator.SignCount, time.Now()); err != nil {
+		return Session{}, fmt.Errorf("failed to update passkey: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Logged in with passkey", "user_id", u.id, "passkey", id)
+
+	return s.issueSession(ctx, u.email)
+}
+
+func (s Service) loadPasskeyUser(ctx context.Context, userID string) (passkeyUser, error) {
+	if userID == "" {
+		return passkeyUser{}, ErrInvalidPasskey
+	}
+
+	res, errs, err := s.fusion(ctx).RetrieveUserWithContext(ctx, userID)
+	if err != nil {
+		return passkeyUser{}, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return passkeyUser{}, ErrInvalidPasskey
+	}
+
+	if errs != nil {
+		return passkeyUser{}, fmt.Errorf("failed to retrieve user: %s", errs.Error())
+	}
+
+	passkeys, err := s.passkeys.ListByUser(ctx, userID)
+	if err != nil {
+		return passkeyUser{}, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(passkeys))
+	for _, p := range passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(p.ID)
+		if err != nil {
+			continue
+		}
+
+		transports := make([]protocol.AuthenticatorTransport, 0, len(p.Transports))
+		for _, t := range p.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: p.BackupEligible,
+				BackupState:    p.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    p.AAGUID,
+				SignCount: p.SignCount,
+			},
+		})
+	}
+
+	displayName := strings.TrimSpace(res.User.FirstName + " " + res.User.LastName)
+	if displayName == "" {
+		displayName = res.User.Email
+	}
+
+	return passkeyUser{
+		id:          userID,
+		email:       res.User.Email,
+		displayName: displayName,
+		credentials: credentials,
+	}, nil
+}
+
+func (s Service) saveChallenge(ctx context.Context, kind, userID string, session *webauthn.SessionData, options any) (PasskeyChallenge, error) {
+	id, err := randomToken(32)
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to generate challenge id: %w", err)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	err = s.webauthnChallenges.Create(ctx, entities.WebAuthnChallenge{
+		ID:          id,
+		Kind:        kind,
+		UserID:      userID,
+		SessionData: data,
+		ExpiresAt:   time.Now().Add(s.webauthnChallengeTTL),
+	})
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to save challenge: %w", err)
+	}
+
+	return PasskeyChallenge{ID: id, Options: options}, nil
+}
+
+func (s Service) takeChallenge(ctx context.Context, id, kind string) (webauthn.SessionData, error) {
+	challenge, err := s.webauthnChallenges.Take(ctx, id)
+	if err != nil {
+		return webauthn.SessionData{}, err
+	}
+
+	if challenge.Kind != kind || time.Now().After(challenge.ExpiresAt) {
+		return webauthn.SessionData{}, ErrInvalidPasskeyChallenge
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(challenge.SessionData, &session); err != nil {
+		return webauthn.SessionData{}, errors.Join(ErrInvalidPasskeyChallenge, err)
+	}
+
+	return session, nil
+}
@@ -0,0 +1,429 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+const (
+	testOrigin = "http://localhost:8080"
+	testRPID   = "localhost"
+)
+
+// softAuthenticator is a WebAuthn authenticator in software. It holds
+// one ES256 credential and answers the options of the begin steps the
+// way a browser would.
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	signCount  uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+
+	var data bytes.Buffer
+	data.Write(rpIDHash[:])
+	data.WriteByte(flags)
+	_ = binary.Write(&data, binary.BigEndian, a.signCount)
+	data.Write(attested)
+	return data.Bytes()
+}
+
+func clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create answers navigator.credentials.create with a "none"
+// attestation.
+func (a *softAuthenticator) create(options any) []byte {
+	a.t.Helper()
+
+	creation, ok := options.(*protocol.CredentialCreation)
+	if !ok {
+		a.t.Fatalf("unexpected registration options %T", options)
+	}
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	var attested bytes.Buffer
+	attested.Write(make([]byte, 16)) // aaguid
+	_ = binary.Write(&attested, binary.BigEndian, uint16(len(a.id)))
+	attested.Write(a.id)
+	attested.Write(publicKey)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(flagUserPresent|flagUserVerified|flagAttestedData, attested.Bytes()),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(clientData(a.t, "webauthn.create", creation.Response.Challenge)),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// get answers navigator.credentials.get, signing with key.
+func (a *softAuthenticator) get(options any, key *ecdsa.PrivateKey) []byte {
+	a.t.Helper()
+
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	if !ok {
+		a.t.Fatalf("unexpected login options %T", options)
+	}
+
+	authData := a.authData(flagUserPresent|flagUserVerified, nil)
+	data := clientData(a.t, "webauthn.get", assertion.Response.Challenge)
+	dataHash := sha256.Sum256(data)
+
+	digest := sha256.Sum256(append(authData, dataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(data),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]string) []byte {
+	a.t.Helper()
+
+	body, err := json.Marshal(map[string]any{
+		"id":       encode(a.id),
+		"rawId":    encode(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return body
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// newPasskeyService returns a service with the user "user-1" in
+// fusionauth that passwordless logins succeed for.
+func newPasskeyService(t *testing.T) (Service, *testRepos) {
+	t.Helper()
+
+	fusion := newFusionStub(t)
+	fusion.handle("/api/user/user-1", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, http.StatusOK, fusionauth.UserResponse{User: testUser()})
+	})
+	fusion.handle("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("email") != "user@example.com" {
+			writeJSON(t, w, http.StatusNotFound, fusionauth.Errors{})
+			return
+		}
+		writeJSON(t, w, http.StatusOK, fusionauth.UserResponse{User: testUser()})
+	})
+	fusion.handle("/api/passwordless/start", func(w http.ResponseWriter, r *http.Request) {
+		var req fusionauth.PasswordlessStartRequest
+		readJSON(t, r, &req)
+		if req.LoginId != "user@example.com" {
+			t.Errorf("passwordless login started for %q", req.LoginId)
+		}
+		writeJSON(t, w, http.StatusOK, fusionauth.PasswordlessStartResponse{Code: "code"})
+	})
+	fusion.handle("/api/passwordless/login", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, http.StatusOK, fusionauth.LoginResponse{
+			Token:          "access",
+			RefreshToken:   "provider-refresh",
+			RefreshTokenId: "provider-refresh-id",
+			User:           testUser(),
+		})
+	})
+
+	s, repos := newTestService(fusion)
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Test",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.webauthn = wa
+	s.webauthnChallengeTTL = time.Minute
+
+	return s, repos
+}
+
+func testUser() fusionauth.User {
+	var u fusionauth.User
+	u.Id = "user-1"
+	u.Email = "user@example.com"
+	u.FirstName = "Jane"
+	u.LastName = "Doe"
+	u.Verified = true
+	return u
+}
+
+// registerPasskey runs the registration ceremony for the authenticator.
+func registerPasskey(t *testing.T, s Service, a *softAuthenticator) entities.Passkey {
+	t.Helper()
+
+	ctx := context.Background()
+	user := entities.User{ProviderID: "user-1", Email: "user@example.com"}
+
+	challenge, err := s.BeginPasskeyRegistration(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passkey, err := s.FinishPasskeyRegistration(ctx, user, challenge.ID, "Laptop", bytes.NewReader(a.create(challenge.Options)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return passkey
+}
+
+func loginWithPasskey(t *testing.T, s Service, a *softAuthenticator, key *ecdsa.PrivateKey) (Session, error) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	challenge, err := s.BeginPasskeyLogin(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.FinishPasskeyLogin(ctx, challenge.ID, bytes.NewReader(a.get(challenge.Options, key)))
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	s, repos := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+
+	passkey := registerPasskey(t, s, a)
+	if passkey.ID != encode(a.id) || passkey.UserID != "user-1" || passkey.Name != "Laptop" {
+		t.Errorf("unexpected passkey %+v", passkey)
+	}
+
+	a.signCount = 1
+	session, err := loginWithPasskey(t, s, a, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if session.AccessToken != "access" || session.RefreshToken == "" || session.RefreshToken == "provider-refresh" {
+		t.Errorf("unexpected session %+v", session)
+	}
+	if len(repos.sessions.sessions) != 1 || repos.sessions.sessions[0].UserID != "user-1" {
+		t.Errorf("sessions %+v, want one of user-1", repos.sessions.sessions)
+	}
+
+	stored, _ := repos.passkeys.ListByUser(context.Background(), "user-1")
+	if len(stored) != 1 || stored[0].SignCount != 1 || stored[0].LastUsedAt == nil {
+		t.Errorf("sign count of %+v was not updated", stored)
+	}
+}
+
+func TestPasskeyRegistrationRejectsRegisteredPasskey(t *testing.T) {
+	s, _ := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+
+	registerPasskey(t, s, a)
+
+	ctx := context.Background()
+	user := entities.User{ProviderID: "user-1", Email: "user@example.com"}
+
+	challenge, err := s.BeginPasskeyRegistration(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the browser would refuse because of the exclusion list, a client
+	// that ignores it is stopped when the passkey is saved
+	creation := challenge.Options.(*protocol.CredentialCreation)
+	if len(creation.Response.CredentialExcludeList) != 1 {
+		t.Errorf("exclude list %+v, want the registered passkey", creation.Response.CredentialExcludeList)
+	}
+
+	_, err = s.FinishPasskeyRegistration(ctx, user, challenge.ID, "Again", bytes.NewReader(a.create(challenge.Options)))
+	if !errors.Is(err, ErrPasskeyExists) {
+		t.Fatalf("error %v, want %v", err, ErrPasskeyExists)
+	}
+}
+
+func TestPasskeyLoginWithEmail(t *testing.T) {
+	s, _ := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+
+	registerPasskey(t, s, a)
+
+	ctx := context.Background()
+	challenge, err := s.BeginPasskeyLogin(ctx, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := challenge.Options.(*protocol.CredentialAssertion).Response.AllowedCredentials
+	if len(allowed) != 1 || !bytes.Equal(allowed[0].CredentialID, a.id) {
+		t.Errorf("allowed credentials %+v, want the registered passkey", allowed)
+	}
+
+	a.signCount = 1
+	if _, err := s.FinishPasskeyLogin(ctx, challenge.ID, bytes.NewReader(a.get(challenge.Options, a.key))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasskeyLoginRejectsWrongKey(t *testing.T) {
+	s, repos := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+
+	registerPasskey(t, s, a)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.signCount = 1
+	_, err = loginWithPasskey(t, s, a, other)
+	if !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("error %v, want %v", err, ErrInvalidPasskey)
+	}
+	if len(repos.sessions.sessions) != 0 {
+		t.Error("session was started")
+	}
+}
+
+func TestPasskeyLoginRejectsClonedAuthenticator(t *testing.T) {
+	s, repos := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+
+	registerPasskey(t, s, a)
+
+	a.signCount = 5
+	if _, err := loginWithPasskey(t, s, a, a.key); err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy of the key that did not see the last login
+	a.signCount = 3
+	_, err := loginWithPasskey(t, s, a, a.key)
+	if !errors.Is(err, ErrPasskeyCloned) {
+		t.Fatalf("error %v, want %v", err, ErrPasskeyCloned)
+	}
+	if len(repos.sessions.sessions) != 1 {
+		t.Errorf("%d sessions, want only the first login's", len(repos.sessions.sessions))
+	}
+}
+
+func TestPasskeyChallengeCanBeUsedOnce(t *testing.T) {
+	s, _ := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+
+	registerPasskey(t, s, a)
+
+	ctx := context.Background()
+	challenge, err := s.BeginPasskeyLogin(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.signCount = 1
+	body := a.get(challenge.Options, a.key)
+	if _, err := s.FinishPasskeyLogin(ctx, challenge.ID, bytes.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.FinishPasskeyLogin(ctx, challenge.ID, bytes.NewReader(body))
+	if !errors.Is(err, ErrInvalidPasskeyChallenge) {
+		t.Fatalf("error %v, want %v", err, ErrInvalidPasskeyChallenge)
+	}
+}
+
+func TestPasskeyChallengeOfOtherCeremony(t *testing.T) {
+	s, _ := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+
+	ctx := context.Background()
+	challenge, err := s.BeginPasskeyRegistration(ctx, entities.User{ProviderID: "user-1", Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.FinishPasskeyLogin(ctx, challenge.ID, bytes.NewReader(a.create(challenge.Options)))
+	if !errors.Is(err, ErrInvalidPasskeyChallenge) {
+		t.Fatalf("error %v, want %v", err, ErrInvalidPasskeyChallenge)
+	}
+}
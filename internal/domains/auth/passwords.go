@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type passwordPolicy struct {
+	minLength            int
+	maxLength            int
+	requireUpper         bool
+	requireLower         bool
+	requireDigit         bool
+	requireSymbol        bool
+	disallowPersonalInfo bool
+	history              int
+}
+
+// checkPassword applies the password policy. The user is the one the
+// password is for, it has no ProviderID yet during registration.
+func (s Service) checkPassword(ctx context.Context, password string, user entities.User) error {
+	p := s.passwordPolicy
+
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return ErrPasswordTooShort
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		return ErrPasswordTooLong
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	if (p.requireUpper && !upper) || (p.requireLower && !lower) || (p.requireDigit && !digit) || (p.requireSymbol && !symbol) {
+		return ErrPasswordTooSimple
+	}
+
+	if p.disallowPersonalInfo && containsPersonalInfo(password, user) {
+		return ErrPasswordContainsPersonalInfo
+	}
+
+	if s.breachedPasswords != nil {
+		breached, err := s.breachedPasswords.Contains(password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached passwords: %w", err)
+		}
+		if breached {
+			return ErrPasswordBreached
+		}
+	}
+
+	if p.history > 0 && user.ProviderID != "" {
+		previous, err := s.passwordHistory.ListRecent(ctx, user.ProviderID, p.history)
+		if err != nil {
+			return fmt.Errorf("failed to get password history: %w", err)
+		}
+
+		for _, entry := range previous {
+			if bcrypt.CompareHashAndPassword(entry.Hash, []byte(password)) == nil {
+				return ErrPasswordReused
+			}
+		}
+	}
+
+	return nil
+}
+
+// rememberPassword adds the password to the user's history. It is
+// called after the password was set, so failures are only logged.
+func (s Service) rememberPassword(ctx context.Context, userID, password string) {
+	if s.passwordPolicy.history <= 0 {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to hash password for history", "user_id", userID, "error", err)
+		return
+	}
+
+	err = s.passwordHistory.Add(ctx, entities.PasswordHistory{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to save password history", "user_id", userID, "error", err)
+	}
+}
+
+// containsPersonalInfo reports whether the password contains the email,
+// its local part or the user's names. Parts shorter than three
+// characters are ignored, they would reject too many passwords.
+func containsPersonalInfo(password string, user entities.User) bool {
+	password = strings.ToLower(password)
+
+	local, _, _ := strings.Cut(user.Email, "@")
+
+	for _, part := range []string{user.Email, local, user.Firstname, user.Lastname} {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if utf8.RuneCountInString(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyPassword checks the password of the user with the login id
+// and returns their fusionauth id. No token is issued, so it does not
+// start a session, but failed attempts still count towards fusionauth's
+// lockout.
+func (s Service) verifyPassword(ctx context.Context, loginID, password string) (string, error) {
+	var credentials fusionauth.LoginRequest
+
+	credentials.LoginId = loginID
+	credentials.Password = password
+	credentials.NoJWT = true
+
+	res, errs, err := s.fusion(ctx).LoginWithContext(ctx, credentials)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify password: %w", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return "", ErrInvalidCredentials
+	}
+
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode >= http.StatusInternalServerError {
+		if errs != nil {
+			return "", fmt.Errorf("failed to verify password: %s", errs.Error())
+		}
+		return "", fmt.Errorf("failed to verify password: fusionauth responded with %d", res.StatusCode)
+	}
+
+	// locked, expired or otherwise not allowed to log in, fusionauth
+	// reports these with errors too
+	if res.StatusCode != http.StatusOK {
+		return "", ErrInvalidCredentials
+	}
+
+	// fusionauth does not issue refresh tokens without a jwt, revoke
+	// one anyway should that ever change
+	if res.RefreshTokenId != "" {
+		if _, errs, err := s.fusion(ctx).RevokeRefreshTokenByIdWithContext(ctx, res.RefreshTokenId); err != nil || errs != nil {
+			s.log.ErrorContext(ctx, "failed to revoke refresh token of password check", "user_id", res.User.Id, "error", err, "errors", errs)
+		}
+	}
+
+	return res.User.Id, nil
+}
+
+// checkCurrentPassword confirms a sensitive change with the user's
+// password, so a stolen access token alone is not enough to make it.
+func (s Service) checkCurrentPassword(ctx context.Context, user entities.User, password string) error {
+	if password == "" {
+		return ErrWrongPassword
+	}
+
+	_, err := s.verifyPassword(ctx, user.Email, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return ErrWrongPassword
+	}
+	return err
+}
+
+// ChangePassword sets a new password for a logged in user after
+// checking the current one. With revokeOthers every session except
+// the one of currentRefreshToken is revoked.
+func (s Service) ChangePassword(ctx context.Context, user entities.User, currentPassword, newPassword string, revokeOthers bool, currentRefreshToken string) error {
+	// the current password is checked before the policy, otherwise the
+	// history check would tell whoever holds a stolen access token
+	// which passwords the user had, without counting towards lockout
+	if err := s.checkCurrentPassword(ctx, user, currentPassword); err != nil {
+		return err
+	}
+
+	if err := s.checkPassword(ctx, newPassword, user); err != nil {
+		return err
+	}
+
+	res, errs, err := s.fusion(ctx).ChangePasswordByIdentityWithContext(ctx, fusionauth.ChangePasswordRequest{
+		ApplicationId:   s.appID(ctx),
+		LoginId:         user.Email,
+		CurrentPassword: currentPassword,
+		Password:        newPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+
+	// fusionauth responds with not found if the current password does
+	// not match
+	if res.StatusCode == http.StatusNotFound {
+		return ErrWrongPassword
+	}
+
+	if errs != nil {
+		if _, ok := errs.FieldErrors["currentPassword"]; ok {
+			return ErrWrongPassword
+		}
+		return fmt.Errorf("failed to change password: %s", errs.Error())
+	}
+
+	s.log.DebugContext(ctx, "Changed password", "user_id", user.ProviderID)
+
+	s.rememberPassword(ctx, user.ProviderID, newPassword)
+
+	revoked := 0
+	if revokeOthers {
+		revoked, err = s.revokeOtherSessions(ctx, user, currentRefreshToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.recordAudit(ctx, AuditPasswordChanged, user.ProviderID, map[string]any{
+		"revoked_sessions": revoked,
+	})
+
+	s.publishLogged(ctx, EventUserPasswordChanged, map[string]any{
+		"user_id": user.ProviderID,
+		"email":   user.Email,
+	})
+
+	if s.mailer != nil || s.passwordChangedTemplateID != "" {
+		info := clientInfo(ctx)
+		err := s.sendMail(ctx, mailer.TemplatePasswordChanged, s.passwordChangedTemplateID, recipient{userID: user.ProviderID, address: user.Email}, map[string]any{
+			"ip":          info.IP,
+			"device_name": info.DeviceName,
+			"firstname":   user.Firstname,
+		})
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to send password changed email", "user_id", user.ProviderID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (s Service) revokeOtherSessions(ctx context.Context, user entities.User, currentRefreshToken string) (int, error) {
+	sessions, err := s.sessions.ListByUser(ctx, user.ProviderID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var current string
+	if currentRefreshToken != "" {
+		current = hashToken(currentRefreshToken)
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.RefreshTokenHash == current {
+			continue
+		}
+
+		_, err := s.sessions.Delete(ctx, session.ID, user.ProviderID)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return revoked, fmt.Errorf("failed to revoke session: %w", err)
+		}
+
+		s.revokeProviderToken(ctx, session)
+		revoked++
+	}
+
+	s.log.DebugContext(ctx, "Revoked other sessions", "user_id", user.ProviderID, "count", revoked)
+
+	return revoked, nil
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+const currentPassword = "Current-password-1"
+
+// newPasswordStub answers logins with loginStatus for the current
+// password and counts password changes.
+func newPasswordStub(t *testing.T, loginStatus int, changes *int) *fusionStub {
+	t.Helper()
+
+	fusion := newFusionStub(t)
+	fusion.handle("/api/login", func(w http.ResponseWriter, r *http.Request) {
+		var req fusionauth.LoginRequest
+		readJSON(t, r, &req)
+		if !req.NoJWT {
+			t.Error("password check asked for a jwt")
+		}
+
+		if req.LoginId != "user@example.com" || req.Password != currentPassword {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if loginStatus != http.StatusOK {
+			w.WriteHeader(loginStatus)
+			return
+		}
+		writeJSON(t, w, http.StatusOK, fusionauth.LoginResponse{User: fusionauth.User{SecureIdentity: fusionauth.SecureIdentity{Id: "user-1"}}})
+	})
+	fusion.handle("/api/user/change-password", func(w http.ResponseWriter, r *http.Request) {
+		*changes++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return fusion
+}
+
+func newPasswordService(t *testing.T, loginStatus int, changes *int) (Service, *testRepos) {
+	t.Helper()
+
+	s, repos := newTestService(newPasswordStub(t, loginStatus, changes))
+	s.passwordPolicy = passwordPolicy{minLength: 8, history: 3}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("Old-password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos.passwords.entries = append(repos.passwords.entries, entities.PasswordHistory{UserID: "user-1", Hash: hash})
+
+	return s, repos
+}
+
+func TestChangePassword(t *testing.T) {
+	var changes int
+	s, repos := newPasswordService(t, http.StatusOK, &changes)
+
+	err := s.ChangePassword(context.Background(), testSessionUser(), currentPassword, "New-password-1", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changes != 1 {
+		t.Errorf("password was changed %d times, want once", changes)
+	}
+	if len(repos.passwords.entries) != 2 {
+		t.Error("new password was not added to the history")
+	}
+}
+
+func TestChangePasswordChecksCurrentPasswordFirst(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     string
+		loginStatus int
+	}{
+		{"wrong password", "wrong", http.StatusOK},
+		{"locked account", currentPassword, http.StatusConflict},
+		{"expired account", currentPassword, http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes int
+			s, repos := newPasswordService(t, tt.loginStatus, &changes)
+
+			// a reused password must not reveal anything about the
+			// history to a caller without the current password
+			err := s.ChangePassword(context.Background(), testSessionUser(), tt.current, "Old-password-1", false, "")
+			if !errors.Is(err, ErrWrongPassword) {
+				t.Fatalf("error %v, want %v", err, ErrWrongPassword)
+			}
+
+			if repos.passwords.reads != 0 {
+				t.Error("password history was checked before the current password")
+			}
+			if changes != 0 {
+				t.Error("password was changed")
+			}
+		})
+	}
+}
+
+func TestChangePasswordAppliesPolicyAfterCurrentPassword(t *testing.T) {
+	var changes int
+	s, _ := newPasswordService(t, http.StatusOK, &changes)
+
+	err := s.ChangePassword(context.Background(), testSessionUser(), currentPassword, "Old-password-1", false, "")
+	if !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("error %v, want %v", err, ErrPasswordReused)
+	}
+	if changes != 0 {
+		t.Error("reused password was set")
+	}
+}
+
+func TestVerifyPasswordFailsOnFusionAuthErrors(t *testing.T) {
+	var changes int
+	s, _ := newPasswordService(t, http.StatusInternalServerError, &changes)
+
+	_, err := s.verifyPassword(context.Background(), "user@example.com", currentPassword)
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("error %v, want a failure that is not about the credentials", err)
+	}
+}
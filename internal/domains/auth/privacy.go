@@ -0,0 +1,487 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+const (
+	erasureRequested      = "requested"
+	erasureAccountDeleted = "account_deleted"
+
+	maxDataRequestAttempts = 5
+)
+
+type privacyConfig struct {
+	exportTTL         time.Duration
+	jobInterval       time.Duration
+	erasureSigningKey []byte
+}
+
+// RequestDataExport queues the compilation of everything stored about
+// the user. The archive can be downloaded once the export is completed.
+func (s Service) RequestDataExport(ctx context.Context, user entities.User) (entities.DataExport, error) {
+	now := time.Now()
+
+	export := entities.DataExport{
+		ID:          uuid.New().String(),
+		UserID:      user.ProviderID,
+		TenantID:    TenantFromContext(ctx),
+		Email:       user.Email,
+		Status:      entities.DataRequestPending,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(s.privacyCfg.exportTTL),
+	}
+
+	if err := s.dataExports.Create(ctx, export); err != nil {
+		return entities.DataExport{}, fmt.Errorf("failed to save data export: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Requested data export", "user_id", user.ProviderID, "export_id", export.ID)
+
+	s.recordAudit(ctx, AuditDataExportRequested, user.ProviderID, map[string]any{
+		"export_id": export.ID,
+	})
+
+	return export, nil
+}
+
+func (s Service) GetDataExport(ctx context.Context, user entities.User, id string) (entities.DataExport, error) {
+	export, err := s.dataExports.Get(ctx, id, user.ProviderID)
+	if err != nil {
+		return entities.DataExport{}, err
+	}
+
+	if time.Now().After(export.ExpiresAt) {
+		return entities.DataExport{}, ErrDataExportNotFound
+	}
+
+	return export, nil
+}
+
+// DownloadDataExport returns the archive of a completed export.
+func (s Service) DownloadDataExport(ctx context.Context, user entities.User, id string) ([]byte, error) {
+	export, err := s.GetDataExport(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if export.Status != entities.DataRequestCompleted {
+		return nil, ErrDataExportNotReady
+	}
+
+	return export.Archive, nil
+}
+
+// RequestErasure schedules the erasure of all of the user's data after
+// the grace period of DeleteAccount and logs them out everywhere. It
+// needs the user's password, logging in again before the erasure is
+// due cancels it.
+func (s Service) RequestErasure(ctx context.Context, user entities.User, currentPassword string) (entities.ErasureRecord, error) {
+	if err := s.checkCurrentPassword(ctx, user, currentPassword); err != nil {
+		return entities.ErasureRecord{}, err
+	}
+
+	scheduledAt := time.Now().Add(s.accountsCfg.deletionGracePeriod)
+
+	record, err := s.createErasure(ctx, user, erasureRequested, &scheduledAt)
+	if err != nil {
+		return entities.ErasureRecord{}, err
+	}
+
+	if _, err := s.revokeOtherSessions(ctx, user, ""); err != nil {
+		return entities.ErasureRecord{}, err
+	}
+
+	s.log.DebugContext(ctx, "Requested erasure", "user_id", user.ProviderID, "erasure_id", record.ID)
+
+	s.recordAudit(ctx, AuditErasureRequested, user.ProviderID, map[string]any{
+		"erasure_id":   record.ID,
+		"scheduled_at": scheduledAt,
+	})
+
+	return record, nil
+}
+
+// VerifyErasure returns the erasure record and whether its digest
+// matches its contents.
+func (s Service) VerifyErasure(ctx context.Context, id string) (ErasureVerification, error) {
+	record, err := s.erasures.Get(ctx, id)
+	if err != nil {
+		return ErasureVerification{}, err
+	}
+
+	verified := record.Status == entities.DataRequestCompleted &&
+		hmac.Equal([]byte(record.Digest), []byte(s.erasureDigest(record)))
+
+	return ErasureVerification{Record: record, Verified: verified}, nil
+}
+
+// ProcessDataRequests compiles pending exports, runs pending erasures
+// and removes expired archives, until ctx is canceled.
+func (s Service) ProcessDataRequests(ctx context.Context) {
+	ticker := time.NewTicker(s.privacyCfg.jobInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.processExports(ctx); err != nil {
+			s.log.ErrorContext(ctx, "failed to process data exports", "err", err.Error())
+		}
+
+		if err := s.processErasures(ctx); err != nil {
+			s.log.ErrorContext(ctx, "failed to process erasures", "err", err.Error())
+		}
+
+		if _, err := s.dataExports.DeleteExpired(ctx, time.Now()); err != nil {
+			s.log.ErrorContext(ctx, "failed to delete expired data exports", "err", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s Service) processExports(ctx context.Context) error {
+	exports, err := s.dataExports.ListPending(ctx, maxDataRequestAttempts, 10)
+	if err != nil {
+		return fmt.Errorf("failed to list data exports: %w", err)
+	}
+
+	for _, export := range exports {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		archive, err := s.compileExport(WithTenant(ctx, export.TenantID), export)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to compile data export", "export_id", export.ID, "error", err)
+
+			export.Attempts++
+			export.LastError = err.Error()
+			if export.Attempts >= maxDataRequestAttempts {
+				export.Status = entities.DataRequestFailed
+			}
+		} else {
+			now := time.Now()
+			export.Status = entities.DataRequestCompleted
+			export.Archive = archive
+			export.LastError = ""
+			export.CompletedAt = &now
+		}
+
+		if err := s.dataExports.Update(ctx, export); err != nil {
+			s.log.ErrorContext(ctx, "failed to save data export", "export_id", export.ID, "error", err)
+			continue
+		}
+
+		s.log.DebugContext(ctx, "Processed data export", "export_id", export.ID, "status", export.Status)
+	}
+
+	return nil
+}
+
+func (s Service) compileExport(ctx context.Context, export entities.DataExport) ([]byte, error) {
+	archive := DataExportArchive{
+		GeneratedAt:     time.Now(),
+		Sessions:        []SessionInfo{},
+		Passkeys:        []entities.Passkey{},
+		KnownDevices:    []entities.KnownDevice{},
+		PasswordChanges: []time.Time{},
+	}
+
+	profile, err := s.usersRepo.GetByEmail(ctx, export.Email)
+	if err != nil && !errors.Is(err, ErrEmailNotFound) {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err == nil {
+		archive.Profile = &profile
+	}
+
+	res, errs, err := s.fusion(ctx).RetrieveUserWithContext(ctx, export.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if res.StatusCode != http.StatusNotFound {
+		if errs != nil {
+			return nil, fmt.Errorf("failed to retrieve user: %s", errs.Error())
+		}
+		archive.Provider = res.User
+	}
+
+	sessions, err := s.sessions.ListByUser(ctx, export.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		archive.Sessions = append(archive.Sessions, SessionInfo{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+		})
+	}
+
+	devices, err := s.knownDevices.ListByUser(ctx, export.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list known devices: %w", err)
+	}
+	archive.KnownDevices = append(archive.KnownDevices, devices...)
+
+	passkeys, err := s.passkeys.ListByUser(ctx, export.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	archive.Passkeys = append(archive.Passkeys, passkeys...)
+
+	// only when the password was changed, hashes are not handed out
+	history, err := s.passwordHistory.ListRecent(ctx, export.UserID, s.passwordPolicy.history)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list password history: %w", err)
+	}
+
+	for _, entry := range history {
+		archive.PasswordChanges = append(archive.PasswordChanges, entry.CreatedAt)
+	}
+
+	archive.AuditEvents, err = s.audit.ListByUser(ctx, export.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	archive.Memberships, err = s.memberships.ListByUser(ctx, export.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal archive: %w", err)
+	}
+
+	return data, nil
+}
+
+// createErasure queues an erasure, it is not processed before
+// scheduledAt unless that is nil.
+func (s Service) createErasure(ctx context.Context, user entities.User, reason string, scheduledAt *time.Time) (entities.ErasureRecord, error) {
+	subject := user.ProviderID
+	if subject == "" {
+		subject = user.Email
+	}
+
+	record := entities.ErasureRecord{
+		ID:          uuid.New().String(),
+		SubjectHash: hashToken(subject),
+		Reason:      reason,
+		Status:      entities.DataRequestPending,
+		UserID:      user.ProviderID,
+		TenantID:    TenantFromContext(ctx),
+		Email:       user.Email,
+		RequestedAt: time.Now(),
+		ScheduledAt: scheduledAt,
+	}
+
+	if err := s.erasures.Create(ctx, record); err != nil {
+		return entities.ErasureRecord{}, fmt.Errorf("failed to save erasure: %w", err)
+	}
+
+	return record, nil
+}
+
+func (s Service) processErasures(ctx context.Context) error {
+	records, err := s.erasures.ListPending(ctx, time.Now(), maxDataRequestAttempts, 10)
+	if err != nil {
+		return fmt.Errorf("failed to list erasures: %w", err)
+	}
+
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		stores, err := s.eraseUser(WithTenant(ctx, record.TenantID), record.UserID, record.Email, record.SubjectHash)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to erase user", "erasure_id", record.ID, "error", err)
+
+			record.Attempts++
+			record.LastError = err.Error()
+			if record.Attempts >= maxDataRequestAttempts {
+				record.Status = entities.DataRequestFailed
+			}
+
+			if err := s.erasures.Update(ctx, record); err != nil {
+				s.log.ErrorContext(ctx, "failed to save erasure", "erasure_id", record.ID, "error", err)
+			}
+			continue
+		}
+
+		// mongodb keeps milliseconds, the digest has to match what is read back
+		completedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+		record.Status = entities.DataRequestCompleted
+		record.UserID = ""
+		record.Email = ""
+		record.LastError = ""
+		record.Stores = stores
+		record.CompletedAt = &completedAt
+		record.Digest = s.erasureDigest(record)
+
+		err = s.withTransaction(ctx, func(ctx context.Context) error {
+			if err := s.erasures.Update(ctx, record); err != nil {
+				return err
+			}
+
+			return s.publish(ctx, EventUserDeleted, map[string]any{
+				"subject_hash": record.SubjectHash,
+				"erasure_id":   record.ID,
+			})
+		})
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to save erasure", "erasure_id", record.ID, "error", err)
+			continue
+		}
+
+		s.log.InfoContext(ctx, "Erased user", "erasure_id", record.ID, "reason", record.Reason)
+
+		s.recordAudit(ctx, AuditUserDeleted, record.SubjectHash, map[string]any{
+			"erasure_id": record.ID,
+			"reason":     record.Reason,
+		})
+	}
+
+	return nil
+}
+
+// eraseUser deletes the user from fusionauth and every store, audit
+// events and events in stores outside of this domain are pseudonymized.
+// Every step can be repeated, so a failed erasure is simply retried.
+// The user document goes last, it is what lets the user log in again.
+func (s Service) eraseUser(ctx context.Context, userID, email, pseudonym string) (map[string]int, error) {
+	stores := map[string]int{}
+
+	if userID != "" {
+		res, errs, err := s.fusion(ctx).DeleteUserWithContext(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete user in fusionauth: %w", err)
+		}
+
+		switch {
+		case res.StatusCode == http.StatusNotFound:
+			stores["fusionauth"] = 0
+		case errs != nil:
+			return nil, fmt.Errorf("failed to delete user in fusionauth: %s", errs.Error())
+		default:
+			stores["fusionauth"] = 1
+		}
+
+		byUser := []struct {
+			name  string
+			erase func(ctx context.Context, userID string) (int, error)
+		}{
+			{"sessions", s.sessions.DeleteByUser},
+			{"rotated_refresh_tokens", s.rotatedTokens.DeleteByUser},
+			{"passkeys", s.passkeys.DeleteByUser},
+			{"webauthn_challenges", s.webauthnChallenges.DeleteByUser},
+			{"password_history", s.passwordHistory.DeleteByUser},
+			{"email_changes", s.emailChanges.DeleteByUser},
+			{"data_exports", s.dataExports.DeleteByUser},
+			{"memberships", s.memberships.DeleteByUser},
+			{"impersonations", s.impersonations.DeleteByUser},
+			{"known_devices", s.knownDevices.DeleteByUser},
+		}
+
+		for _, store := range byUser {
+			n, err := store.erase(ctx, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to erase %s: %w", store.name, err)
+			}
+			stores[store.name] = n
+		}
+
+		n, err := s.audit.Pseudonymize(ctx, userID, pseudonym)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pseudonymize audit log: %w", err)
+		}
+		stores["audit_log"] = n
+	}
+
+	n, err := s.magicLinks.DeleteByEmail(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase magic_links: %w", err)
+	}
+	stores["magic_links"] = n
+
+	n, err = s.invitations.DeleteByEmail(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase invitations: %w", err)
+	}
+	stores["invitations"] = n
+
+	for name, store := range s.personalDataStores {
+		n, err := store.EraseUser(ctx, userID, email, pseudonym)
+		if err != nil {
+			return nil, fmt.Errorf("failed to erase %s: %w", name, err)
+		}
+		stores[name] = n
+	}
+
+	n, err = s.usersRepo.Delete(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase users: %w", err)
+	}
+	stores["users"] = n
+
+	return stores, nil
+}
+
+// erasureDigest is an HMAC of the record's contents when a signing key
+// is configured and a plain SHA-256 otherwise.
+func (s Service) erasureDigest(record entities.ErasureRecord) string {
+	names := make([]string, 0, len(record.Stores))
+	for name := range record.Stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(record.ID + "\n")
+	b.WriteString(record.SubjectHash + "\n")
+	b.WriteString(record.Reason + "\n")
+	if record.CompletedAt != nil {
+		b.WriteString(record.CompletedAt.UTC().Format(time.RFC3339Nano))
+	}
+	b.WriteString("\n")
+	for _, name := range names {
+		b.WriteString(name + "=" + strconv.Itoa(record.Stores[name]) + "\n")
+	}
+
+	if len(s.privacyCfg.erasureSigningKey) == 0 {
+		sum := sha256.Sum256([]byte(b.String()))
+		return hex.EncodeToString(sum[:])
+	}
+
+	mac := hmac.New(sha256.New, s.privacyCfg.erasureSigningKey)
+	mac.Write([]byte(b.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+func newErasureService(t *testing.T) (Service, *testRepos) {
+	t.Helper()
+
+	var changes int
+	s, repos := newTestService(newPasswordStub(t, http.StatusOK, &changes))
+	s.accountsCfg.deletionGracePeriod = 30 * 24 * time.Hour
+
+	user := testSessionUser()
+	repos.users.users[userKey(context.Background(), user.Email)] = user
+	repos.sessions.sessions = append(repos.sessions.sessions, entities.UserSession{ID: "session-1", UserID: user.ProviderID, RefreshTokenHash: hashToken("refresh")})
+
+	return s, repos
+}
+
+func TestRequestErasureNeedsPassword(t *testing.T) {
+	for _, password := range []string{"", "wrong"} {
+		s, repos := newErasureService(t)
+
+		_, err := s.RequestErasure(context.Background(), testSessionUser(), password)
+		if !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("password %q: error %v, want %v", password, err, ErrWrongPassword)
+		}
+
+		if len(repos.erasures.records) != 0 {
+			t.Errorf("password %q: erasure was requested", password)
+		}
+		if len(repos.sessions.sessions) != 1 {
+			t.Errorf("password %q: sessions were revoked", password)
+		}
+	}
+}
+
+func TestRequestErasureWaitsForGracePeriod(t *testing.T) {
+	s, repos := newErasureService(t)
+	ctx := context.Background()
+
+	record, err := s.RequestErasure(ctx, testSessionUser(), currentPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.ScheduledAt == nil || time.Until(*record.ScheduledAt) < 29*24*time.Hour {
+		t.Fatalf("erasure is scheduled at %v, want after the grace period", record.ScheduledAt)
+	}
+	if len(repos.sessions.sessions) != 0 {
+		t.Error("sessions were not revoked")
+	}
+
+	// nothing is erased yet, the stub fails on deleting the user
+	if err := s.processErasures(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := repos.erasures.Get(ctx, record.ID); stored.Status != entities.DataRequestPending {
+		t.Errorf("erasure is %s before it is due", stored.Status)
+	}
+}
+
+func TestLoginCancelsScheduledErasure(t *testing.T) {
+	s, repos := newErasureService(t)
+	ctx := context.Background()
+
+	record, err := s.RequestErasure(ctx, testSessionUser(), currentPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.cancelDeletion(ctx, testSessionUser().Email)
+
+	if stored, _ := repos.erasures.Get(ctx, record.ID); stored.Status != entities.DataRequestCanceled {
+		t.Errorf("erasure is %s after logging in, want %s", stored.Status, entities.DataRequestCanceled)
+	}
+	if !slices.Contains(repos.audit.types(), AuditErasureCanceled) {
+		t.Error("cancellation was not audited")
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"strings"
+)
+
+type registrationPolicy struct {
+	allowedDomains []string
+	blockedDomains []string
+	disposable     DisposableDomains
+	inviteOnly     bool
+}
+
+// checkEmailDomain applies the registration policy to the domain of the
+// email. Blocked domains win over allowed ones.
+func (s Service) checkEmailDomain(email string) error {
+	p := s.registrationPolicy
+	domain := emailDomain(email)
+
+	if len(p.allowedDomains) > 0 && !matchesDomain(domain, p.allowedDomains) {
+		return ErrEmailDomainNotAllowed
+	}
+
+	if matchesDomain(domain, p.blockedDomains) {
+		return ErrEmailDomainNotAllowed
+	}
+
+	if p.disposable != nil && p.disposable.Contains(domain) {
+		return ErrDisposableEmail
+	}
+
+	return nil
+}
+
+func emailDomain(email string) string {
+	i := strings.LastIndexByte(email, '@')
+	return strings.ToLower(strings.TrimSuffix(email[i+1:], "."))
+}
+
+// matchesDomain reports whether domain is one of domains or a subdomain
+// of one.
+func matchesDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomains(domains []string) []string {
+	res := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "@."))
+		if d != "" {
+			res = append(res, d)
+		}
+	}
+	return res
+}
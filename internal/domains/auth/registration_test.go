@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/rasulov-emirlan/poc-auth/pkg/disposable"
+)
+
+func TestCheckEmailDomain(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy registrationPolicy
+		email  string
+		want   error
+	}{
+		{"no policy", registrationPolicy{}, "user@example.com", nil},
+		{"allowed", registrationPolicy{allowedDomains: []string{"example.com"}}, "user@example.com", nil},
+		{"allowed subdomain", registrationPolicy{allowedDomains: []string{"example.com"}}, "user@eu.example.com", nil},
+		{"allowed case", registrationPolicy{allowedDomains: []string{"example.com"}}, "user@Example.COM.", nil},
+		{"not allowed", registrationPolicy{allowedDomains: []string{"example.com"}}, "user@example.org", ErrEmailDomainNotAllowed},
+		{"allowed suffix", registrationPolicy{allowedDomains: []string{"example.com"}}, "user@badexample.com", ErrEmailDomainNotAllowed},
+		{"blocked", registrationPolicy{blockedDomains: []string{"example.org"}}, "user@example.org", ErrEmailDomainNotAllowed},
+		{"blocked subdomain", registrationPolicy{blockedDomains: []string{"example.org"}}, "user@mail.example.org", ErrEmailDomainNotAllowed},
+		{"blocked suffix", registrationPolicy{blockedDomains: []string{"example.org"}}, "user@myexample.org", nil},
+		{"blocked wins", registrationPolicy{
+			allowedDomains: []string{"example.com"},
+			blockedDomains: []string{"contractors.example.com"},
+		}, "user@contractors.example.com", ErrEmailDomainNotAllowed},
+		{"disposable", registrationPolicy{disposable: disposable.New()}, "user@mailinator.com", ErrDisposableEmail},
+		{"disposable subdomain", registrationPolicy{disposable: disposable.New()}, "user@x.mailinator.com", ErrDisposableEmail},
+		{"not disposable", registrationPolicy{disposable: disposable.New()}, "user@example.com", nil},
+		{"allowed disposable", registrationPolicy{
+			allowedDomains: []string{"mailinator.com"},
+			disposable:     disposable.New(),
+		}, "user@mailinator.com", ErrDisposableEmail},
+	}
+
+	for _, tt := range tests {
+		s := Service{registrationPolicy: tt.policy}
+		if err := s.checkEmailDomain(tt.email); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDomains(t *testing.T) {
+	got := normalizeDomains([]string{" Example.com ", "@example.org", "example.net.", "", "  "})
+	want := []string{"example.com", "example.org", "example.net"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("normalized %v, want %v", got, want)
+	}
+}
+
+func TestRegisterEmailDomainPolicy(t *testing.T) {
+	var deleted int
+	s, repos := newTestService(newRegisterStub(t, "", &deleted))
+	s.registrationPolicy = registrationPolicy{
+		allowedDomains: []string{"example.com", "mailinator.com"},
+		blockedDomains: []string{"contractors.example.com"},
+		disposable:     disposable.New(),
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		email string
+		want  error
+	}{
+		{"user@example.org", ErrEmailDomainNotAllowed},
+		{"user@contractors.example.com", ErrEmailDomainNotAllowed},
+		{"user@mailinator.com", ErrDisposableEmail},
+		{"user@example.com", nil},
+	}
+
+	for _, tt := range tests {
+		_, err := s.Register(ctx, tt.email, "password", "Jane", "Doe", "")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.email, err, tt.want)
+		}
+	}
+
+	if len(repos.users.users) != 1 {
+		t.Errorf("%d users registered, want the allowed one", len(repos.users.users))
+	}
+}
@@ -2,15 +2,22 @@ package auth
 
 import (
 	"context"
+	"crypto/cipher"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/FusionAuth/go-client/pkg/fusionauth"
+	"github.com/go-webauthn/webauthn/webauthn"
 
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
 	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+	"github.com/rasulov-emirlan/poc-auth/pkg/geoip"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
 )
 
 type (
@@ -18,12 +25,251 @@ type (
 		Create(ctx context.Context, user entities.User) (entities.User, error)
 		GetByEmail(ctx context.Context, email string) (entities.User, error)
 		Update(ctx context.Context, user entities.User) (entities.User, error)
+		ChangeEmail(ctx context.Context, email, newEmail string) error
+		ListDeletionDue(ctx context.Context, now time.Time, limit int) ([]entities.User, error)
+		Delete(ctx context.Context, email string) (int, error)
+	}
+
+	EmailChangesRepository interface {
+		Create(ctx context.Context, change entities.EmailChange) error
+		Take(ctx context.Context, tokenHash string) (entities.EmailChange, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	// Mailer sends emails with templates of this service. locale can be
+	// an Accept-Language list.
+	Mailer interface {
+		Send(ctx context.Context, template, locale, to string, data map[string]any) error
+	}
+
+	// Transactor runs fn in a database transaction, the writes made with
+	// the context fn gets are committed together or not at all.
+	Transactor interface {
+		WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	}
+
+	EventsPublisher interface {
+		Publish(ctx context.Context, eventType string, payload map[string]any) error
+	}
+
+	OAuthStateRepository interface {
+		Create(ctx context.Context, state entities.OAuthState) error
+		Take(ctx context.Context, state string) (entities.OAuthState, error)
+	}
+
+	OAuthProvider interface {
+		AuthCodeURL(ctx context.Context, state, nonce, codeChallenge, redirectURI string) (string, error)
+		Exchange(ctx context.Context, code, codeVerifier, nonce, redirectURI string) (ExternalIdentity, error)
+	}
+
+	MagicLinksRepository interface {
+		Create(ctx context.Context, link entities.MagicLink) error
+		CountSince(ctx context.Context, email string, since time.Time) (int, error)
+		Consume(ctx context.Context, tokenHash string, now time.Time) (entities.MagicLink, error)
+		DeleteByEmail(ctx context.Context, email string) (int, error)
+	}
+
+	PasskeysRepository interface {
+		Create(ctx context.Context, passkey entities.Passkey) error
+		ListByUser(ctx context.Context, userID string) ([]entities.Passkey, error)
+		UpdateSignCount(ctx context.Context, id string, signCount uint32, usedAt time.Time) error
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	WebAuthnChallengesRepository interface {
+		Create(ctx context.Context, challenge entities.WebAuthnChallenge) error
+		Take(ctx context.Context, id string) (entities.WebAuthnChallenge, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	SessionsRepository interface {
+		Create(ctx context.Context, session entities.UserSession) error
+		GetByTokenHash(ctx context.Context, tokenHash string) (entities.UserSession, error)
+		GetByAccessTokenHash(ctx context.Context, tokenHash string) (entities.UserSession, error)
+		SetActiveOrganization(ctx context.Context, id, orgID string) error
+		ClearActiveOrganization(ctx context.Context, userID, orgID string) (int, error)
+		ListByUser(ctx context.Context, userID string) ([]entities.UserSession, error)
+		Rotate(ctx context.Context, session entities.UserSession, previousHash string) error
+		Delete(ctx context.Context, id, userID string) (entities.UserSession, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	RotatedRefreshTokensRepository interface {
+		Create(ctx context.Context, token entities.RotatedRefreshToken) error
+		Get(ctx context.Context, tokenHash string) (entities.RotatedRefreshToken, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	PasswordHistoryRepository interface {
+		Add(ctx context.Context, entry entities.PasswordHistory) error
+		ListRecent(ctx context.Context, userID string, limit int) ([]entities.PasswordHistory, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	BreachedPasswords interface {
+		Contains(password string) (bool, error)
+	}
+
+	AuditRepository interface {
+		Add(ctx context.Context, event entities.AuditEvent) error
+		ListByUser(ctx context.Context, userID string) ([]entities.AuditEvent, error)
+		Pseudonymize(ctx context.Context, userID, pseudonym string) (int, error)
+	}
+
+	DataExportsRepository interface {
+		Create(ctx context.Context, export entities.DataExport) error
+		Get(ctx context.Context, id, userID string) (entities.DataExport, error)
+		ListPending(ctx context.Context, maxAttempts, limit int) ([]entities.DataExport, error)
+		Update(ctx context.Context, export entities.DataExport) error
+		DeleteExpired(ctx context.Context, now time.Time) (int, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	ErasuresRepository interface {
+		Create(ctx context.Context, record entities.ErasureRecord) error
+		Get(ctx context.Context, id string) (entities.ErasureRecord, error)
+		ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.ErasureRecord, error)
+		Update(ctx context.Context, record entities.ErasureRecord) error
+		CancelScheduled(ctx context.Context, userID string, now time.Time) (int, error)
+	}
+
+	ServiceAccountsRepository interface {
+		Create(ctx context.Context, account entities.ServiceAccount) error
+		Get(ctx context.Context, id string) (entities.ServiceAccount, error)
+		List(ctx context.Context) ([]entities.ServiceAccount, error)
+		Delete(ctx context.Context, id string) error
+	}
+
+	APIKeysRepository interface {
+		Create(ctx context.Context, key entities.APIKey) error
+		Get(ctx context.Context, id string) (entities.APIKey, error)
+		ListByAccount(ctx context.Context, accountID string) ([]entities.APIKey, error)
+		MarkUsed(ctx context.Context, id string, usedAt time.Time, ip string) error
+		Replace(ctx context.Context, id, replacedBy string, expiresAt time.Time) error
+		Revoke(ctx context.Context, id string, revokedAt time.Time) error
+		RevokeByAccount(ctx context.Context, accountID string, revokedAt time.Time) (int, error)
+	}
+
+	OrganizationsRepository interface {
+		Create(ctx context.Context, org entities.Organization) error
+		Get(ctx context.Context, id string) (entities.Organization, error)
+		List(ctx context.Context) ([]entities.Organization, error)
+		ListByIDs(ctx context.Context, ids []string) ([]entities.Organization, error)
+		Delete(ctx context.Context, id string) error
+	}
+
+	MembershipsRepository interface {
+		Create(ctx context.Context, membership entities.Membership) error
+		Get(ctx context.Context, orgID, userID string) (entities.Membership, error)
+		ListByOrganization(ctx context.Context, orgID string) ([]entities.Membership, error)
+		ListByUser(ctx context.Context, userID string) ([]entities.Membership, error)
+		UpdateRoles(ctx context.Context, orgID, userID string, roles []string) error
+		Delete(ctx context.Context, orgID, userID string) error
+		DeleteByOrganization(ctx context.Context, orgID string) (int, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	InvitationsRepository interface {
+		Create(ctx context.Context, invitation entities.Invitation) error
+		Get(ctx context.Context, id string) (entities.Invitation, error)
+		GetByTokenHash(ctx context.Context, tokenHash string) (entities.Invitation, error)
+		ListByOrganization(ctx context.Context, orgID string) ([]entities.Invitation, error)
+		MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) error
+		Delete(ctx context.Context, id string) error
+		DeleteByOrganization(ctx context.Context, orgID string) (int, error)
+		DeleteByEmail(ctx context.Context, email string) (int, error)
+	}
+
+	ImpersonationsRepository interface {
+		Create(ctx context.Context, impersonation entities.Impersonation) error
+		Get(ctx context.Context, id string) (entities.Impersonation, error)
+		ListActive(ctx context.Context, now time.Time) ([]entities.Impersonation, error)
+		End(ctx context.Context, id, endedBy string, endedAt time.Time) (bool, error)
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	KnownDevicesRepository interface {
+		ListByUser(ctx context.Context, userID string) ([]entities.KnownDevice, error)
+		Save(ctx context.Context, device entities.KnownDevice) error
+		DeleteByUser(ctx context.Context, userID string) (int, error)
+	}
+
+	DisposableDomains interface {
+		Contains(domain string) bool
+	}
+
+	GeoLocator interface {
+		Lookup(ip string) (geoip.Location, bool)
+	}
+
+	// PersonalDataStore is a store outside of this domain that keeps
+	// data about users. Erasing a user deletes or pseudonymizes it and
+	// returns how many records were affected.
+	PersonalDataStore interface {
+		EraseUser(ctx context.Context, userID, email, pseudonym string) (int, error)
 	}
 
 	Service struct {
-		usersRepo     UsersRepository
+		usersRepo      UsersRepository
+		sessions       SessionsRepository
+		rotatedTokens  RotatedRefreshTokensRepository
+		sessionTTL     time.Duration
+		sessionCipher  cipher.AEAD
+		audit          AuditRepository
+		events         EventsPublisher
+		tx             Transactor
+		mailer         Mailer
+		hooks          []Hook
+		oauthStates    OAuthStateRepository
+		oauthProviders map[string]OAuthProvider
+		oauthRedirect  string
+		oauthStateTTL  time.Duration
+		magicLinks     MagicLinksRepository
+		magicLinkCfg   magicLinkConfig
+
+		passwordPolicy            passwordPolicy
+		passwordHistory           PasswordHistoryRepository
+		breachedPasswords         BreachedPasswords
+		registrationPolicy        registrationPolicy
+		passwordChangedTemplateID string
+
+		emailChanges EmailChangesRepository
+		accountsCfg  accountsConfig
+
+		dataExports        DataExportsRepository
+		erasures           ErasuresRepository
+		personalDataStores map[string]PersonalDataStore
+		privacyCfg         privacyConfig
+
+		introspectionCache *introspectionCache
+
+		serviceAccounts ServiceAccountsRepository
+		apiKeys         APIKeysRepository
+		apiKeysCfg      apiKeysConfig
+
+		organizations    OrganizationsRepository
+		memberships      MembershipsRepository
+		invitations      InvitationsRepository
+		organizationsCfg organizationsConfig
+
+		impersonations   ImpersonationsRepository
+		impersonationCfg impersonationConfig
+		signer           jwks.Signer
+
+		knownDevices   KnownDevicesRepository
+		geo            GeoLocator
+		loginAlertsCfg loginAlertsConfig
+
+		passkeys             PasskeysRepository
+		webauthnChallenges   WebAuthnChallengesRepository
+		webauthn             *webauthn.WebAuthn
+		webauthnChallengeTTL time.Duration
+
+		// fusionClient and applicationId belong to the default tenant,
+		// use fusion and appID to get the ones of the request.
 		fusionClient  *fusionauth.FusionAuthClient
 		applicationId string
+		tenants       map[string]tenantConfig
 		log           *slog.Logger
 	}
 )
@@ -39,26 +285,148 @@ func NewService(ctx context.Context, cfg ServiceConfigs) (Service, error) {
 
 	authClient := fusionauth.NewClient(httpclient, baseUrl, cfg.Cfg.FusionAuth.ApiKey)
 
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.Cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.Cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.Cfg.WebAuthn.RPOrigins,
+	})
+	if err != nil {
+		return Service{}, fmt.Errorf("failed to configure webauthn: %w", err)
+	}
+
 	return Service{
-		usersRepo:     cfg.UsersRepository,
+		usersRepo:      cfg.UsersRepository,
+		sessions:       cfg.Sessions,
+		rotatedTokens:  cfg.RotatedRefreshTokens,
+		sessionTTL:     cfg.Cfg.Sessions.RefreshTokenTTL,
+		sessionCipher:  cfg.SessionCipher,
+		audit:          cfg.Audit,
+		events:         cfg.Events,
+		tx:             cfg.Transactor,
+		mailer:         cfg.Mailer,
+		hooks:          cfg.Hooks,
+		oauthStates:    cfg.OAuthStates,
+		oauthProviders: cfg.OAuthProviders,
+		oauthRedirect:  strings.TrimSuffix(cfg.Cfg.OAuth.RedirectBaseURL, "/"),
+		oauthStateTTL:  cfg.Cfg.OAuth.StateTTL,
+		magicLinks:     cfg.MagicLinks,
+		passwordPolicy: passwordPolicy{
+			minLength:            cfg.Cfg.Password.MinLength,
+			maxLength:            cfg.Cfg.Password.MaxLength,
+			requireUpper:         cfg.Cfg.Password.RequireUpper,
+			requireLower:         cfg.Cfg.Password.RequireLower,
+			requireDigit:         cfg.Cfg.Password.RequireDigit,
+			requireSymbol:        cfg.Cfg.Password.RequireSymbol,
+			disallowPersonalInfo: cfg.Cfg.Password.DisallowPersonalInfo,
+			history:              cfg.Cfg.Password.History,
+		},
+		passwordHistory:           cfg.PasswordHistory,
+		breachedPasswords:         cfg.BreachedPasswords,
+		passwordChangedTemplateID: cfg.Cfg.Password.ChangedEmailTemplateID,
+		registrationPolicy: registrationPolicy{
+			allowedDomains: normalizeDomains(cfg.Cfg.Registration.AllowedDomains),
+			blockedDomains: normalizeDomains(cfg.Cfg.Registration.BlockedDomains),
+			disposable:     cfg.DisposableDomains,
+			inviteOnly:     cfg.Cfg.Registration.InviteOnly,
+		},
+		emailChanges: cfg.EmailChanges,
+		accountsCfg: accountsConfig{
+			emailChangeURL:              cfg.Cfg.Accounts.EmailChangeURL,
+			emailChangeTemplateID:       cfg.Cfg.Accounts.EmailChangeTemplateID,
+			emailChangeTTL:              cfg.Cfg.Accounts.EmailChangeTTL,
+			emailChangeNoticeTemplateID: cfg.Cfg.Accounts.EmailChangeNoticeTemplateID,
+			deletionGracePeriod:         cfg.Cfg.Accounts.DeletionGracePeriod,
+			deletionJobInterval:         cfg.Cfg.Accounts.DeletionJobInterval,
+			verificationURL:             cfg.Cfg.Accounts.VerificationURL,
+			passwordResetURL:            cfg.Cfg.Accounts.PasswordResetURL,
+		},
+		dataExports:        cfg.DataExports,
+		erasures:           cfg.Erasures,
+		personalDataStores: cfg.PersonalDataStores,
+		privacyCfg: privacyConfig{
+			exportTTL:         cfg.Cfg.Privacy.ExportTTL,
+			jobInterval:       cfg.Cfg.Privacy.JobInterval,
+			erasureSigningKey: []byte(cfg.Cfg.Privacy.ErasureSigningKey),
+		},
+		introspectionCache: newIntrospectionCache(cfg.Cfg.Introspection.CacheTTL, cfg.Cfg.Introspection.CacheSize),
+		serviceAccounts:    cfg.ServiceAccounts,
+		apiKeys:            cfg.APIKeys,
+		apiKeysCfg: apiKeysConfig{
+			prefix:          cfg.Cfg.APIKeys.Prefix,
+			defaultTTL:      cfg.Cfg.APIKeys.DefaultTTL,
+			maxTTL:          cfg.Cfg.APIKeys.MaxTTL,
+			rotationOverlap: cfg.Cfg.APIKeys.RotationOverlap,
+		},
+		organizations: cfg.Organizations,
+		memberships:   cfg.Memberships,
+		invitations:   cfg.Invitations,
+		organizationsCfg: organizationsConfig{
+			invitationURL:        cfg.Cfg.Organizations.InvitationURL,
+			invitationTemplateID: cfg.Cfg.Organizations.InvitationTemplateID,
+			invitationTTL:        cfg.Cfg.Organizations.InvitationTTL,
+		},
+		impersonations: cfg.Impersonations,
+		impersonationCfg: impersonationConfig{
+			issuer:     cfg.Cfg.OIDC.Issuer,
+			defaultTTL: cfg.Cfg.Impersonation.DefaultTTL,
+			maxTTL:     cfg.Cfg.Impersonation.MaxTTL,
+			readOnly:   cfg.Cfg.Impersonation.ReadOnly,
+			adminRole:  cfg.Cfg.Admin.Role,
+		},
+		signer: cfg.Signer,
+		magicLinkCfg: magicLinkConfig{
+			url:             cfg.Cfg.MagicLink.URL,
+			ttl:             cfg.Cfg.MagicLink.TTL,
+			emailTemplateID: cfg.Cfg.MagicLink.EmailTemplateID,
+			maxPerEmail:     cfg.Cfg.MagicLink.MaxPerEmail,
+			window:          cfg.Cfg.MagicLink.Window,
+		},
+		passkeys:             cfg.Passkeys,
+		webauthnChallenges:   cfg.WebAuthnChallenges,
+		webauthn:             wa,
+		webauthnChallengeTTL: cfg.Cfg.WebAuthn.ChallengeTTL,
+		knownDevices:         cfg.KnownDevices,
+		geo:                  cfg.GeoLocator,
+		loginAlertsCfg: loginAlertsConfig{
+			enabled:           cfg.Cfg.LoginAlerts.Enabled,
+			newDevice:         cfg.Cfg.LoginAlerts.NewDevice,
+			newCountry:        cfg.Cfg.LoginAlerts.NewCountry,
+			impossibleTravel:  cfg.Cfg.LoginAlerts.ImpossibleTravel,
+			maxTravelSpeed:    cfg.Cfg.LoginAlerts.MaxTravelSpeed,
+			minTravelDistance: cfg.Cfg.LoginAlerts.MinTravelDistance,
+			emailTemplateID:   cfg.Cfg.LoginAlerts.EmailTemplateID,
+		},
 		fusionClient:  authClient,
 		applicationId: cfg.Cfg.FusionAuth.AppId,
+		tenants:       newTenantConfigs(cfg.Cfg, httpclient, baseUrl),
 		log:           cfg.Logger,
 	}, nil
 }
 
 func (s Service) Login(ctx context.Context, email, password string) (Session, error) {
+	hookReq := LoginHookRequest{Email: email}
+	if err := s.runBeforeHooks(func(h Hook) error { return h.BeforeLogin(ctx, &hookReq) }); err != nil {
+		return Session{}, err
+	}
+	email = hookReq.Email
+
 	var credentials fusionauth.LoginRequest
 
 	credentials.LoginId = email
 	credentials.Password = password
+	// fusionauth issues a refresh token only for logins to an application
+	credentials.ApplicationId = s.appID(ctx)
 
-	authResponse, errors, err := s.fusionClient.Login(credentials)
+	authResponse, errors, err := s.fusion(ctx).LoginWithContext(ctx, credentials)
 	if err != nil {
 		s.log.DebugContext(ctx, "failed to login", "error", err)
 		return Session{}, fmt.Errorf("failed to login: %w", err)
 	}
 
+	if authResponse.StatusCode == http.StatusNotFound {
+		return Session{}, ErrInvalidCredentials
+	}
+
 	if errors != nil {
 		s.log.DebugContext(ctx, "failed to login", "error", errors)
 		return Session{}, fmt.Errorf("failed to login: %s", errors.Error())
@@ -66,64 +434,163 @@ func (s Service) Login(ctx context.Context, email, password string) (Session, er
 
 	s.log.DebugContext(ctx, "Logged user in fusionauth", "email", email, "response", authResponse.Token)
 
-	return Session{authResponse.Token, authResponse.RefreshToken}, nil
+	s.cancelDeletion(ctx, email)
+
+	session, err := s.startSession(ctx, authResponse.User.Id, authResponse.RefreshTokenId, Session{authResponse.Token, authResponse.RefreshToken})
+	if err != nil {
+		return Session{}, err
+	}
+
+	s.runAfterHooks(ctx, "login", func(h Hook) error {
+		return h.AfterLogin(ctx, HookUser{ID: authResponse.User.Id, Email: authResponse.User.Email, TenantID: TenantFromContext(ctx)})
+	})
+
+	return session, nil
+}
+
+// Authenticate checks the credentials of a user without starting a
+// session, it is used by login pages of other applications. Before
+// login hooks run, after hooks and login alerts do not since nothing
+// is logged in here.
+func (s Service) Authenticate(ctx context.Context, email, password string) (entities.User, error) {
+	hookReq := LoginHookRequest{Email: email}
+	if err := s.runBeforeHooks(func(h Hook) error { return h.BeforeLogin(ctx, &hookReq) }); err != nil {
+		return entities.User{}, err
+	}
+	email = hookReq.Email
+
+	if _, err := s.verifyPassword(ctx, email, password); err != nil {
+		return entities.User{}, err
+	}
+
+	user, err := s.usersRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
 }
 
-func (s Service) Register(ctx context.Context, email, password, firstname, lastname string) (Session, error) {
-	if len(password) < 8 {
-		return Session{}, ErrPasswordTooShort
+// Register creates a user with a password. The invitation is only
+// checked here, accepting it is left to the caller once the user has a
+// session. Invite only registration needs one.
+func (s Service) Register(ctx context.Context, email, password, firstname, lastname, invitation string) (Session, error) {
+	if s.tenant(ctx).registrationDisabled {
+		return Session{}, ErrRegistrationDisabled
+	}
+
+	hookReq := RegisterHookRequest{Email: email, Firstname: firstname, Lastname: lastname}
+	if err := s.runBeforeHooks(func(h Hook) error { return h.BeforeRegister(ctx, &hookReq) }); err != nil {
+		return Session{}, err
+	}
+	email, firstname, lastname = hookReq.Email, hookReq.Firstname, hookReq.Lastname
+
+	if err := s.checkEmailDomain(email); err != nil {
+		return Session{}, err
 	}
+
+	if invitation != "" {
+		if err := s.CheckInvitation(ctx, invitation, email); err != nil {
+			return Session{}, err
+		}
+	} else if s.registrationPolicy.inviteOnly {
+		return Session{}, ErrInvitationRequired
+	}
+
 	if len(firstname) < 1 || len(lastname) < 1 {
 		return Session{}, ErrFirstnameOrLastnameTooShort
 	}
+	err := s.checkPassword(ctx, password, entities.User{
+		Email:     email,
+		Firstname: firstname,
+		Lastname:  lastname,
+	})
+	if err != nil {
+		return Session{}, err
+	}
 	var user fusionauth.RegistrationRequest
 
 	user.Registration = fusionauth.UserRegistration{
-		ApplicationId: s.applicationId,
+		ApplicationId: s.appID(ctx),
 	}
 	user.User.Email = email
 	user.User.Password = password
 	user.User.FirstName = firstname
 	user.User.LastName = lastname
+	user.User.Data = hookReq.Data
 
-	res, errors, err := s.fusionClient.Register("", user)
+	res, errs, err := s.fusion(ctx).Register("", user)
 	if err != nil {
 		s.log.DebugContext(ctx, "failed to register", "error", err)
 		return Session{}, fmt.Errorf("failed to register: %w", err)
 	}
 
-	if errors != nil {
-		s.log.DebugContext(ctx, "failed to register", "error", errors)
-		return Session{}, fmt.Errorf("failed to register: %s", errors.Error())
+	if errs != nil {
+		s.log.DebugContext(ctx, "failed to register", "error", errs)
+		if _, ok := errs.FieldErrors["user.email"]; ok {
+			return Session{}, ErrEmailTaken
+		}
+		return Session{}, fmt.Errorf("failed to register: %s", errs.Error())
 	}
 
 	s.log.DebugContext(ctx, "Registered user in fusionauth", "email", email, "response", res)
 
-	u, err := s.usersRepo.Create(ctx, entities.User{
-		Email:     email,
-		Firstname: firstname,
-		Lastname:  lastname,
+	var u entities.User
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = s.usersRepo.Create(ctx, entities.User{
+			ProviderID: res.User.Id,
+			TenantID:   TenantFromContext(ctx),
+			Email:      email,
+			Firstname:  firstname,
+			Lastname:   lastname,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.publish(ctx, EventUserRegistered, map[string]any{
+			"user_id":   res.User.Id,
+			"email":     email,
+			"firstname": firstname,
+			"lastname":  lastname,
+		})
 	})
 	if err != nil {
-		if res, _, err := s.fusionClient.DeleteUser(res.User.Id); err != nil {
+		if res, _, err := s.fusion(ctx).DeleteUser(res.User.Id); err != nil {
 			s.log.ErrorContext(ctx, "Failed to delete user", "error", err, "response", res)
 		}
 		s.log.DebugContext(ctx, "Failed to create user in db, deleted it in fustionauth", "error", err)
+		if errors.Is(err, ErrEmailTaken) {
+			return Session{}, ErrEmailTaken
+		}
 		return Session{}, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	s.log.DebugContext(ctx, "Created user in database", "email", email, "user", u)
 
-	return Session{res.Token, res.RefreshToken}, nil
+	s.rememberPassword(ctx, res.User.Id, password)
+
+	if s.mailer != nil && !res.User.Verified {
+		s.sendVerification(ctx, res.User)
+	}
+
+	s.runAfterHooks(ctx, "register", func(h Hook) error {
+		return h.AfterRegister(ctx, HookUser{ID: res.User.Id, Email: email, TenantID: TenantFromContext(ctx)})
+	})
+
+	return s.startSession(ctx, res.User.Id, "", Session{res.Token, res.RefreshToken})
 }
 
 func (s Service) ForgotPassword(ctx context.Context, email string) error {
 	var req fusionauth.ForgotPasswordRequest
 
-	req.ApplicationId = s.applicationId
+	req.ApplicationId = s.appID(ctx)
 	req.Email = email
+	// the mailer sends its own email with the change password id
+	req.SendForgotPasswordEmail = s.mailer == nil
 
-	res, errors, err := s.fusionClient.ForgotPassword(req)
+	res, errors, err := s.fusion(ctx).ForgotPassword(req)
 	if err != nil {
 		s.log.DebugContext(ctx, "failed to forgot password", "error", err)
 		return fmt.Errorf("failed to forgot password: %w", err)
@@ -136,16 +603,57 @@ func (s Service) ForgotPassword(ctx context.Context, email string) error {
 
 	s.log.DebugContext(ctx, "Forgot password", "email", email, "change_id", res.ChangePasswordId)
 
+	// unknown emails get no change password id
+	if s.mailer != nil && res.ChangePasswordId != "" {
+		link, err := linkWithToken(s.accountsCfg.passwordResetURL, res.ChangePasswordId)
+		if err != nil {
+			return fmt.Errorf("failed to parse password reset url: %w", err)
+		}
+
+		err = s.sendMail(ctx, mailer.TemplatePasswordReset, "", recipient{address: email}, map[string]any{
+			"link": link,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send password reset email: %w", err)
+		}
+	}
+
 	return nil
 }
 
 func (s Service) ResetPassword(ctx context.Context, password, token string) error {
+	user, errors, err := s.fusion(ctx).RetrieveUserByChangePasswordId(token)
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to reset password", "error", err)
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	if errors != nil {
+		s.log.DebugContext(ctx, "failed to reset password", "error", errors)
+		return fmt.Errorf("failed to reset password: %s", errors.Error())
+	}
+
+	hookReq := PasswordResetHookRequest{UserID: user.User.Id, Email: user.User.Email}
+	if err := s.runBeforeHooks(func(h Hook) error { return h.BeforePasswordReset(ctx, &hookReq) }); err != nil {
+		return err
+	}
+
+	err = s.checkPassword(ctx, password, entities.User{
+		ProviderID: user.User.Id,
+		Email:      user.User.Email,
+		Firstname:  user.User.FirstName,
+		Lastname:   user.User.LastName,
+	})
+	if err != nil {
+		return err
+	}
+
 	var req fusionauth.ChangePasswordRequest
 
-	req.ApplicationId = s.applicationId
+	req.ApplicationId = s.appID(ctx)
 	req.Password = password
 
-	res, errors, err := s.fusionClient.ChangePassword(token, req)
+	res, errors, err := s.fusion(ctx).ChangePassword(token, req)
 	if err != nil {
 		s.log.DebugContext(ctx, "failed to reset password", "error", err)
 		return fmt.Errorf("failed to reset password: %w", err)
@@ -158,37 +666,166 @@ func (s Service) ResetPassword(ctx context.Context, password, token string) erro
 
 	s.log.DebugContext(ctx, "Reset password", "response", res)
 
+	s.rememberPassword(ctx, user.User.Id, password)
+
+	s.publishLogged(ctx, EventUserPasswordChanged, map[string]any{
+		"user_id": user.User.Id,
+		"email":   user.User.Email,
+	})
+
+	s.runAfterHooks(ctx, "password_reset", func(h Hook) error {
+		return h.AfterPasswordReset(ctx, HookUser{ID: user.User.Id, Email: user.User.Email, TenantID: TenantFromContext(ctx)})
+	})
+
 	return nil
 }
 
+func (s Service) VerifyEmail(ctx context.Context, verificationId string) error {
+	user, errors, err := s.fusion(ctx).RetrieveUserByVerificationId(verificationId)
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to verify email", "error", err)
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if errors != nil {
+		s.log.DebugContext(ctx, "failed to verify email", "error", errors)
+		return fmt.Errorf("failed to verify email: %s", errors.Error())
+	}
+
+	var req fusionauth.VerifyEmailRequest
+
+	req.VerificationId = verificationId
+
+	res, errors, err := s.fusion(ctx).VerifyEmailAddress(req)
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to verify email", "error", err)
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if errors != nil {
+		s.log.DebugContext(ctx, "failed to verify email", "error", errors)
+		return fmt.Errorf("failed to verify email: %s", errors.Error())
+	}
+
+	s.log.DebugContext(ctx, "Verified email", "email", user.User.Email, "response", res)
+
+	s.publishLogged(ctx, EventUserEmailVerified, map[string]any{
+		"user_id": user.User.Id,
+		"email":   user.User.Email,
+	})
+
+	return nil
+}
+
+// RefreshToken exchanges a refresh token for a new session. Every
+// token can be used once, presenting one that was already rotated
+// revokes the whole session, the legitimate client and whoever stole
+// the token both have to log in again.
 func (s Service) RefreshToken(ctx context.Context, refreshToken string) (Session, error) {
+	tokenHash := hashToken(refreshToken)
+
+	session, err := s.sessions.GetByTokenHash(ctx, tokenHash)
+	if errors.Is(err, ErrSessionNotFound) {
+		return Session{}, s.detectRefreshTokenReuse(ctx, tokenHash)
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	now := time.Now()
+	if now.After(session.ExpiresAt) || session.TenantID != TenantFromContext(ctx) {
+		return Session{}, ErrSessionNotFound
+	}
+
+	hookReq := RefreshHookRequest{UserID: session.UserID, SessionID: session.ID}
+	if err := s.runBeforeHooks(func(h Hook) error { return h.BeforeRefresh(ctx, &hookReq) }); err != nil {
+		return Session{}, err
+	}
+
+	providerToken, err := s.openProviderToken(session)
+	if err != nil {
+		return Session{}, err
+	}
+
 	var req fusionauth.RefreshRequest
 
-	req.RefreshToken = refreshToken
+	req.RefreshToken = providerToken
 
-	res, errors, err := s.fusionClient.ExchangeRefreshTokenForJWTWithContext(ctx, req)
+	res, errs, err := s.fusion(ctx).ExchangeRefreshTokenForJWTWithContext(ctx, req)
 	if err != nil {
 		s.log.DebugContext(ctx, "failed to refresh token", "error", err)
 		return Session{}, fmt.Errorf("failed to refresh token: %w", err)
 	}
 
-	if errors != nil {
-		s.log.DebugContext(ctx, "failed to refresh token", "error", errors)
-		return Session{}, fmt.Errorf("failed to refresh token: %s", errors.Error())
+	if errs != nil {
+		s.log.DebugContext(ctx, "failed to refresh token", "error", errs)
+		return Session{}, fmt.Errorf("failed to refresh token: %s", errs.Error())
+	}
+
+	s.log.DebugContext(ctx, "Refreshed token", "session_id", session.ID)
+
+	newToken, err := randomToken(32)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	info := clientInfo(ctx)
+
+	// fusionauth only rotates its own token if the application uses
+	// the one time use policy
+	if res.RefreshToken != "" {
+		session.ProviderRefreshToken, err = s.sealProviderToken(session.ID, res.RefreshToken)
+		if err != nil {
+			return Session{}, err
+		}
+	}
+	if res.RefreshTokenId != "" {
+		session.ProviderTokenID = res.RefreshTokenId
+	}
+	session.RefreshTokenHash = hashToken(newToken)
+	session.AccessTokenHash = hashToken(res.Token)
+	session.Generation++
+	session.UserAgent = info.UserAgent
+	session.IP = info.IP
+	session.LastUsedAt = now
+
+	if err := s.sessions.Rotate(ctx, session, tokenHash); err != nil {
+		return Session{}, err
+	}
+
+	err = s.rotatedTokens.Create(ctx, entities.RotatedRefreshToken{
+		TokenHash: tokenHash,
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		RotatedAt: now,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to save rotated refresh token", "session_id", session.ID, "error", err)
 	}
 
-	s.log.DebugContext(ctx, "Refreshed token", "response", res)
+	s.runAfterHooks(ctx, "refresh", func(h Hook) error {
+		return h.AfterRefresh(ctx, HookUser{ID: session.UserID, TenantID: session.TenantID})
+	})
 
-	return Session{res.Token, res.RefreshToken}, nil
+	return Session{res.Token, newToken}, nil
 }
 
 func (s Service) VerifyToken(ctx context.Context, tokenString string) (entities.User, error) {
-	res, errs, err := s.fusionClient.RetrieveUserUsingJWTWithContext(ctx, tokenString)
+	if user, ok, err := s.verifyImpersonation(ctx, tokenString); ok {
+		return user, err
+	}
+
+	res, errs, err := s.fusion(ctx).RetrieveUserUsingJWTWithContext(ctx, tokenString)
 	if err != nil {
 		s.log.DebugContext(ctx, "Failed to verify token", "error", err.Error(), "errors", errs.Error())
 		return entities.User{}, fmt.Errorf("failed to verify token: %w", err)
 	}
 
+	if res.StatusCode == http.StatusUnauthorized {
+		return entities.User{}, ErrInvalidToken
+	}
+
 	if errs != nil {
 		s.log.DebugContext(ctx, "Failed to verify token", "error", errs.Error())
 		return entities.User{}, fmt.Errorf("failed to verify token: %s", errs.Error())
@@ -196,13 +833,71 @@ func (s Service) VerifyToken(ctx context.Context, tokenString string) (entities.
 
 	s.log.DebugContext(ctx, "Verified token", "response", res)
 
-	if res.User.Email != "" {
-		return entities.User{
-			Email:     res.User.Email,
-			Firstname: res.User.FirstName,
-			Lastname:  res.User.LastName,
-		}, nil
+	if res.User.Email == "" {
+		return entities.User{}, ErrInvalidToken
+	}
+
+	var (
+		roles      []string
+		registered bool
+	)
+	appID := s.appID(ctx)
+	for _, reg := range res.User.Registrations {
+		if reg.ApplicationId == appID {
+			roles = reg.Roles
+			registered = true
+		}
+	}
+
+	// users of one tenant can not use their tokens at another
+	if s.tenants != nil && !registered {
+		return entities.User{}, ErrInvalidToken
+	}
+
+	activeOrganization, err := s.activeOrganization(ctx, res.User.Id, tokenString)
+	if err != nil {
+		return entities.User{}, err
 	}
 
-	return entities.User{}, fmt.Errorf("invalid token")
+	return entities.User{
+		ProviderID: res.User.Id,
+		Email:      res.User.Email,
+		Firstname:  res.User.FirstName,
+		Lastname:   res.User.LastName,
+		TenantID:   TenantFromContext(ctx),
+		Roles:      roles,
+		// set by SwitchOrganization for the session of the token,
+		// membership is checked where it matters
+		ActiveOrganizationID: activeOrganization,
+	}, nil
+}
+
+// publish adds the event to the outbox. Called with the context of
+// withTransaction it is written together with the change it reports.
+func (s Service) publish(ctx context.Context, eventType string, payload map[string]any) error {
+	if tenantID := TenantFromContext(ctx); tenantID != "" {
+		payload["tenant_id"] = tenantID
+	}
+	if err := s.events.Publish(ctx, eventType, payload); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", eventType, err)
+	}
+	return nil
+}
+
+// publishLogged publishes events of changes made in fusionauth, which
+// can not be part of a transaction. The change is done by then, so a
+// failure is only logged.
+func (s Service) publishLogged(ctx context.Context, eventType string, payload map[string]any) {
+	if err := s.publish(ctx, eventType, payload); err != nil {
+		s.log.ErrorContext(ctx, "failed to publish event", "type", eventType, "error", err)
+	}
+}
+
+// withTransaction runs fn in a transaction when the service has a
+// transactor, and as it is otherwise.
+func (s Service) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.tx == nil {
+		return fn(ctx)
+	}
+	return s.tx.WithTransaction(ctx, fn)
 }
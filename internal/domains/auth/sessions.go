@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type clientInfoKey struct{}
+
+// ClientInfo describes the device a request comes from. The transport
+// layer puts it in the request context with WithClientInfo.
+type ClientInfo struct {
+	IP         string
+	UserAgent  string
+	DeviceName string
+	// Locale is the Accept-Language of the request, emails sent for it
+	// are in that language unless the user has a preferred one.
+	Locale string
+}
+
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFromContext returns the client info as the transport layer
+// put it in the context.
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+func clientInfo(ctx context.Context) ClientInfo {
+	info := ClientInfoFromContext(ctx)
+	if info.DeviceName == "" {
+		info.DeviceName = deviceName(info.UserAgent)
+	}
+	return info
+}
+
+// ListSessions returns the devices the user is logged in on. The
+// session the refresh token belongs to is marked as current.
+func (s Service) ListSessions(ctx context.Context, user entities.User, refreshToken string) ([]SessionInfo, error) {
+	sessions, err := s.sessions.ListByUser(ctx, user.ProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var current string
+	if refreshToken != "" {
+		current = hashToken(refreshToken)
+	}
+
+	res := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, SessionInfo{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.RefreshTokenHash == current,
+		})
+	}
+
+	return res, nil
+}
+
+// RevokeSession logs the user out on one device. The refresh token
+// stops working right away, access tokens already issued stay valid
+// until they expire.
+func (s Service) RevokeSession(ctx context.Context, user entities.User, id string) error {
+	session, err := s.sessions.Delete(ctx, id, user.ProviderID)
+	if err != nil {
+		return err
+	}
+
+	s.revokeProviderToken(ctx, session)
+
+	s.log.DebugContext(ctx, "Revoked session", "user_id", user.ProviderID, "session_id", id)
+
+	return nil
+}
+
+// startSession records the refresh token issued by fusionauth together
+// with the device it was issued to, and hands out a refresh token of
+// our own in its place. Logins from unusual devices are reported.
+func (s Service) startSession(ctx context.Context, userID, refreshTokenID string, session Session) (Session, error) {
+	s.checkLogin(ctx, userID)
+
+	if session.RefreshToken == "" {
+		return session, nil
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	id := uuid.New().String()
+
+	providerToken, err := s.sealProviderToken(id, session.RefreshToken)
+	if err != nil {
+		return Session{}, err
+	}
+
+	info := clientInfo(ctx)
+	now := time.Now()
+
+	err = s.sessions.Create(ctx, entities.UserSession{
+		ID:                   id,
+		UserID:               userID,
+		TenantID:             TenantFromContext(ctx),
+		RefreshTokenHash:     hashToken(refreshToken),
+		ProviderRefreshToken: providerToken,
+		ProviderTokenID:      refreshTokenID,
+		AccessTokenHash:      hashToken(session.AccessToken),
+		DeviceName:           info.DeviceName,
+		UserAgent:            info.UserAgent,
+		IP:                   info.IP,
+		CreatedAt:            now,
+		LastUsedAt:           now,
+		ExpiresAt:            now.Add(s.sessionTTL),
+	})
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return Session{session.AccessToken, refreshToken}, nil
+}
+
+// detectRefreshTokenReuse is called for refresh tokens that do not
+// belong to any session. If the token was rotated before, its session
+// is revoked.
+func (s Service) detectRefreshTokenReuse(ctx context.Context, tokenHash string) error {
+	rotated, err := s.rotatedTokens.Get(ctx, tokenHash)
+	if errors.Is(err, ErrSessionNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get rotated refresh token: %w", err)
+	}
+
+	s.log.WarnContext(ctx, "Refresh token reused, revoking session", "user_id", rotated.UserID, "session_id", rotated.SessionID)
+
+	s.recordAudit(ctx, AuditRefreshTokenReused, rotated.UserID, map[string]any{
+		"session_id": rotated.SessionID,
+		"rotated_at": rotated.RotatedAt,
+	})
+
+	session, err := s.sessions.Delete(ctx, rotated.SessionID, rotated.UserID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if err == nil {
+		s.revokeProviderToken(ctx, session)
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// revokeProviderToken revokes the fusionauth refresh token of a session
+// that was deleted, and stops introspection from answering for its
+// access token out of the cache.
+func (s Service) revokeProviderToken(ctx context.Context, session entities.UserSession) {
+	if session.AccessTokenHash != "" {
+		s.introspectionCache.forget(introspectionKey(session.TenantID, session.AccessTokenHash))
+	}
+
+	var (
+		errs *fusionauth.Errors
+		err  error
+	)
+
+	switch {
+	case session.ProviderTokenID != "":
+		_, errs, err = s.fusion(ctx).RevokeRefreshTokenByIdWithContext(ctx, session.ProviderTokenID)
+	case session.ProviderRefreshToken != "":
+		token, openErr := s.openProviderToken(session)
+		if openErr != nil {
+			s.log.ErrorContext(ctx, "failed to revoke refresh token", "session_id", session.ID, "error", openErr)
+			return
+		}
+		_, errs, err = s.fusion(ctx).RevokeRefreshTokenByTokenWithContext(ctx, token)
+	default:
+		return
+	}
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to revoke refresh token", "session_id", session.ID, "error", err)
+		return
+	}
+
+	if errs != nil {
+		s.log.ErrorContext(ctx, "failed to revoke refresh token", "session_id", session.ID, "error", errs.Error())
+	}
+}
+
+// sealedTokenPrefix marks encrypted fusionauth refresh tokens. Sessions
+// started before they were encrypted keep the plain token until their
+// next refresh.
+const sealedTokenPrefix = "v1:"
+
+// sealProviderToken encrypts the fusionauth refresh token of a session.
+// The session id is authenticated with it, a token copied to another
+// session does not open.
+func (s Service) sealProviderToken(sessionID, token string) (string, error) {
+	nonce := make([]byte, s.sessionCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := s.sessionCipher.Seal(nonce, nonce, []byte(token), []byte(sessionID))
+	return sealedTokenPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (s Service) openProviderToken(session entities.UserSession) (string, error) {
+	sealed, ok := strings.CutPrefix(session.ProviderRefreshToken, sealedTokenPrefix)
+	if !ok {
+		return session.ProviderRefreshToken, nil
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < s.sessionCipher.NonceSize() {
+		return "", fmt.Errorf("failed to decode refresh token of session %s", session.ID)
+	}
+
+	nonce, ciphertext := data[:s.sessionCipher.NonceSize()], data[s.sessionCipher.NonceSize():]
+	token, err := s.sessionCipher.Open(nil, nonce, ciphertext, []byte(session.ID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt refresh token of session %s: %w", session.ID, err)
+	}
+
+	return string(token), nil
+}
+
+// deviceName makes a short label like "Chrome on macOS" out of a user
+// agent. It is only a fallback for clients that do not send a name.
+func deviceName(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	var browser string
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	var os string
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		os = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		os = "iOS"
+	case strings.Contains(userAgent, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(userAgent, "Windows"):
+		os = "Windows"
+	case strings.Contains(userAgent, "Linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+
+	// the product without its version, like "curl"
+	name, _, _ := strings.Cut(userAgent, " ")
+	name, _, _ = strings.Cut(name, "/")
+	return name
+}
+
+// activeOrganization returns the organization the session that issued
+// the access token switched to. Tokens issued without a session have
+// none.
+func (s Service) activeOrganization(ctx context.Context, userID, accessToken string) (string, error) {
+	session, err := s.sessions.GetByAccessTokenHash(ctx, hashToken(accessToken))
+	if errors.Is(err, ErrSessionNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if session.UserID != userID {
+		return "", nil
+	}
+
+	return session.ActiveOrganizationID, nil
+}
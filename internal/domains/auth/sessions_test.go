@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// newRefreshStub answers refreshes of the fusionauth refresh token
+// want with a rotated token "provider-refresh-2".
+func newRefreshStub(t *testing.T, want string) *fusionStub {
+	t.Helper()
+
+	fusion := newFusionStub(t)
+	fusion.handle("/api/jwt/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			if got := r.URL.Query().Get("token"); got != want {
+				t.Errorf("revoked %q, want %q", got, want)
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var req fusionauth.RefreshRequest
+		readJSON(t, r, &req)
+		if req.RefreshToken != want {
+			t.Errorf("refreshed with %q, want %q", req.RefreshToken, want)
+		}
+		writeJSON(t, w, http.StatusOK, fusionauth.JWTRefreshResponse{Token: "access-2", RefreshToken: "provider-refresh-2"})
+	})
+
+	return fusion
+}
+
+func TestSessionsStoreProviderTokenEncrypted(t *testing.T) {
+	s, repos := newTestService(newRefreshStub(t, "provider-refresh"))
+	ctx := context.Background()
+
+	session, err := s.startSession(ctx, "user-1", "", Session{AccessToken: "access", RefreshToken: "provider-refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := repos.sessions.sessions[0]
+	if !strings.HasPrefix(stored.ProviderRefreshToken, sealedTokenPrefix) || strings.Contains(stored.ProviderRefreshToken, "provider-refresh") {
+		t.Fatalf("provider refresh token is stored as %q", stored.ProviderRefreshToken)
+	}
+
+	refreshed, err := s.RefreshToken(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.AccessToken != "access-2" {
+		t.Errorf("access token %q, want access-2", refreshed.AccessToken)
+	}
+
+	// the rotated fusionauth token is encrypted too
+	stored = repos.sessions.sessions[0]
+	token, err := s.openProviderToken(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "provider-refresh-2" || strings.Contains(stored.ProviderRefreshToken, "provider-refresh-2") {
+		t.Errorf("rotated token is stored as %q", stored.ProviderRefreshToken)
+	}
+}
+
+func TestSessionsProviderTokenIsBoundToSession(t *testing.T) {
+	s, repos := newTestService(newFusionStub(t))
+	ctx := context.Background()
+
+	if _, err := s.startSession(ctx, "user-1", "", Session{AccessToken: "access", RefreshToken: "provider-refresh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := repos.sessions.sessions[0]
+	stored.ID = "other"
+	if _, err := s.openProviderToken(stored); err == nil {
+		t.Fatal("token of another session was decrypted")
+	}
+}
+
+func TestSessionsRefreshPlainProviderToken(t *testing.T) {
+	s, repos := newTestService(newRefreshStub(t, "legacy"))
+	ctx := context.Background()
+
+	session, err := s.startSession(ctx, "user-1", "", Session{AccessToken: "access", RefreshToken: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sessions saved before tokens were encrypted
+	repos.sessions.sessions[0].ProviderRefreshToken = "legacy"
+
+	if _, err := s.RefreshToken(ctx, session.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored := repos.sessions.sessions[0].ProviderRefreshToken; !strings.HasPrefix(stored, sealedTokenPrefix) {
+		t.Errorf("token is still stored as %q after a refresh", stored)
+	}
+}
+
+func TestRevokeSessionRevokesDecryptedToken(t *testing.T) {
+	s, repos := newTestService(newRefreshStub(t, "provider-refresh"))
+	ctx := context.Background()
+
+	if _, err := s.startSession(ctx, "user-1", "", Session{AccessToken: "access", RefreshToken: "provider-refresh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	id := repos.sessions.sessions[0].ID
+	if err := s.RevokeSession(ctx, testSessionUser(), id); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repos.sessions.sessions) != 0 {
+		t.Error("session was not deleted")
+	}
+}
+
+func TestLoginStartsSession(t *testing.T) {
+	fusion := newFusionStub(t)
+	fusion.handle("/api/login", func(w http.ResponseWriter, r *http.Request) {
+		var req fusionauth.LoginRequest
+		readJSON(t, r, &req)
+
+		res := fusionauth.LoginResponse{Token: "access", User: fusionauth.User{SecureIdentity: fusionauth.SecureIdentity{Id: "user-1"}}}
+		// like fusionauth, refresh tokens are issued for applications only
+		if req.ApplicationId == "app" {
+			res.RefreshToken = "provider-refresh"
+		}
+		writeJSON(t, w, http.StatusOK, res)
+	})
+
+	s, repos := newTestService(fusion)
+
+	session, err := s.Login(context.Background(), "user@example.com", currentPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repos.sessions.sessions) != 1 {
+		t.Fatalf("%d sessions recorded, want 1", len(repos.sessions.sessions))
+	}
+	if session.RefreshToken == "" || session.RefreshToken == "provider-refresh" {
+		t.Fatalf("refresh token %q is not ours", session.RefreshToken)
+	}
+	if repos.sessions.sessions[0].RefreshTokenHash != hashToken(session.RefreshToken) {
+		t.Error("session is not recorded for the refresh token")
+	}
+}
+
+// newRotationStub refreshes any fusionauth token, the rotated one is
+// "provider-refresh-2". Revoked tokens are appended to revoked.
+func newRotationStub(t *testing.T, revoked *[]string) *fusionStub {
+	t.Helper()
+
+	fusion := newFusionStub(t)
+	fusion.handle("/api/jwt/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			*revoked = append(*revoked, r.URL.Query().Get("token"))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		writeJSON(t, w, http.StatusOK, fusionauth.JWTRefreshResponse{Token: "access-2", RefreshToken: "provider-refresh-2"})
+	})
+
+	return fusion
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	var revoked []string
+	s, repos := newTestService(newRotationStub(t, &revoked))
+	ctx := context.Background()
+
+	session, err := s.startSession(ctx, "user-1", "", Session{AccessToken: "access", RefreshToken: "provider-refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, err := s.RefreshToken(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == session.RefreshToken {
+		t.Fatalf("refresh token %q was not rotated", refreshed.RefreshToken)
+	}
+
+	stored := repos.sessions.sessions[0]
+	if stored.RefreshTokenHash != hashToken(refreshed.RefreshToken) || stored.Generation != 1 {
+		t.Errorf("session hash or generation %d not rotated", stored.Generation)
+	}
+	if rotated, err := repos.rotatedTokens.Get(ctx, hashToken(session.RefreshToken)); err != nil || rotated.SessionID != stored.ID {
+		t.Errorf("old token is not remembered: %+v, %v", rotated, err)
+	}
+
+	// the new token keeps working
+	if _, err := s.RefreshToken(ctx, refreshed.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 0 {
+		t.Errorf("tokens %v were revoked", revoked)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	var revoked []string
+	s, repos := newTestService(newRotationStub(t, &revoked))
+	ctx := context.Background()
+
+	session, err := s.startSession(ctx, "user-1", "", Session{AccessToken: "access", RefreshToken: "provider-refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := s.RefreshToken(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an attacker replays the stolen token
+	if _, err := s.RefreshToken(ctx, session.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("error %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	if len(repos.sessions.sessions) != 0 {
+		t.Error("session was not revoked")
+	}
+	if !slices.Equal(revoked, []string{"provider-refresh-2"}) {
+		t.Errorf("revoked %v, want the current fusionauth token", revoked)
+	}
+	if !slices.Contains(repos.audit.types(), AuditRefreshTokenReused) {
+		t.Error("reuse was not audited")
+	}
+
+	// the legitimate client is logged out too
+	if _, err := s.RefreshToken(ctx, refreshed.RefreshToken); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("current token: error %v, want %v", err, ErrSessionNotFound)
+	}
+
+	// replaying again still reports the reuse
+	if _, err := s.RefreshToken(ctx, session.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("second replay: error %v, want %v", err, ErrRefreshTokenReused)
+	}
+}
+
+func TestRefreshUnknownToken(t *testing.T) {
+	s, _ := newTestService(newFusionStub(t))
+
+	if _, err := s.RefreshToken(context.Background(), "unknown"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func testSessionUser() entities.User {
+	return entities.User{ProviderID: "user-1", Email: "user@example.com"}
+}
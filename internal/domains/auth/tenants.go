@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+)
+
+type tenantKey struct{}
+
+// WithTenant puts the tenant a request is for in its context. The
+// transport layer resolves it, an empty id is the default tenant.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant of the request, empty for the
+// default tenant. Repositories use it to scope their queries.
+func TenantFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
+
+// tenantConfig is how a tenant talks to fusionauth. Tenants with their
+// own fusionauth tenant get a client that sends its id.
+type tenantConfig struct {
+	appID                string
+	fusionClient         *fusionauth.FusionAuthClient
+	registrationDisabled bool
+}
+
+func newTenantConfigs(cfg config.Config, httpclient *http.Client, baseUrl *url.URL) map[string]tenantConfig {
+	if !cfg.Tenancy.Enabled {
+		return nil
+	}
+
+	tenants := make(map[string]tenantConfig, len(cfg.Tenancy.Tenants))
+	for id, t := range cfg.Tenancy.Tenants {
+		client := fusionauth.NewClient(httpclient, baseUrl, cfg.FusionAuth.ApiKey)
+		client.SetTenantId(t.FusionTenantID)
+
+		tenants[id] = tenantConfig{
+			appID:                t.AppID,
+			fusionClient:         client,
+			registrationDisabled: t.RegistrationDisabled,
+		}
+	}
+
+	return tenants
+}
+
+// HasTenant tells whether the tenant is configured. The default tenant
+// always exists.
+func (s Service) HasTenant(tenantID string) bool {
+	if tenantID == "" {
+		return true
+	}
+	_, ok := s.tenants[tenantID]
+	return ok
+}
+
+func (s Service) tenant(ctx context.Context) tenantConfig {
+	if t, ok := s.tenants[TenantFromContext(ctx)]; ok {
+		return t
+	}
+	return tenantConfig{appID: s.applicationId, fusionClient: s.fusionClient}
+}
+
+// fusion is the fusionauth client of the request's tenant.
+func (s Service) fusion(ctx context.Context) *fusionauth.FusionAuthClient {
+	return s.tenant(ctx).fusionClient
+}
+
+// appID is the fusionauth application of the request's tenant.
+func (s Service) appID(ctx context.Context) string {
+	return s.tenant(ctx).appID
+}
+
+// tenantOfApp maps the application id of a fusionauth token back to
+// the tenant.
+func (s Service) tenantOfApp(appID string) (string, bool) {
+	if appID == s.applicationId {
+		return "", true
+	}
+	for id, t := range s.tenants {
+		if t.appID == appID {
+			return id, true
+		}
+	}
+	return "", false
+}
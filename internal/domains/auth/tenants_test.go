@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/FusionAuth/go-client/pkg/fusionauth"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// newRegisterStub registers every email with a new fusionauth id, emails
+// in taken are rejected like fusionauth rejects duplicates. Deleted
+// users are counted in deleted.
+func newRegisterStub(t *testing.T, taken string, deleted *int) *fusionStub {
+	t.Helper()
+
+	fusion := newFusionStub(t)
+	ids := 0
+	fusion.handle("/api/user/registration", func(w http.ResponseWriter, r *http.Request) {
+		var req fusionauth.RegistrationRequest
+		readJSON(t, r, &req)
+
+		if req.User.Email == taken {
+			writeJSON(t, w, http.StatusBadRequest, fusionauth.Errors{FieldErrors: map[string][]fusionauth.Error{
+				"user.email": {{Code: "[duplicate]user.email", Message: "already exists"}},
+			}})
+			return
+		}
+
+		ids++
+		res := fusionauth.RegistrationResponse{Token: "access", RefreshToken: "provider-refresh"}
+		res.User.Id = fmt.Sprintf("user-%d", ids)
+		res.User.Email = req.User.Email
+		res.User.Verified = true
+		writeJSON(t, w, http.StatusOK, res)
+	})
+	fusion.handle("/api/user/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("unexpected fusionauth call %s %s", r.Method, r.URL)
+		}
+		*deleted++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return fusion
+}
+
+func TestRegisterSameEmailInTwoTenants(t *testing.T) {
+	var deleted int
+	s, repos := newTestService(newRegisterStub(t, "", &deleted))
+
+	for _, tenant := range []string{"", "acme"} {
+		ctx := WithTenant(context.Background(), tenant)
+		if _, err := s.Register(ctx, "user@example.com", "password", "Jane", "Doe", ""); err != nil {
+			t.Fatalf("tenant %q: %v", tenant, err)
+		}
+	}
+
+	if len(repos.users.users) != 2 {
+		t.Errorf("%d users stored, want one per tenant", len(repos.users.users))
+	}
+}
+
+func TestRegisterTakenEmail(t *testing.T) {
+	t.Run("in fusionauth", func(t *testing.T) {
+		var deleted int
+		s, _ := newTestService(newRegisterStub(t, "user@example.com", &deleted))
+
+		_, err := s.Register(context.Background(), "user@example.com", "password", "Jane", "Doe", "")
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("error %v, want %v", err, ErrEmailTaken)
+		}
+	})
+
+	t.Run("in the database", func(t *testing.T) {
+		var deleted int
+		s, repos := newTestService(newRegisterStub(t, "", &deleted))
+		repos.users.users[userKey(context.Background(), "user@example.com")] = testSessionUser()
+
+		// the unique index on tenant and email rejects the user
+		_, err := s.Register(context.Background(), "user@example.com", "password", "Jane", "Doe", "")
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("error %v, want %v", err, ErrEmailTaken)
+		}
+		if deleted != 1 {
+			t.Error("fusionauth user was not deleted")
+		}
+	})
+}
+
+func TestSessionsAreScopedToTenant(t *testing.T) {
+	s, repos := newTestService(newFusionStub(t))
+	acme := WithTenant(context.Background(), "acme")
+
+	session, err := s.startSession(acme, "user-1", "", Session{AccessToken: "access", RefreshToken: "provider-refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stub fails the test if the refresh reaches fusionauth
+	if _, err := s.RefreshToken(context.Background(), session.RefreshToken); err == nil {
+		t.Fatal("session of another tenant was refreshed")
+	}
+	if len(repos.sessions.sessions) != 1 || repos.sessions.sessions[0].TenantID != "acme" {
+		t.Errorf("sessions %+v", repos.sessions.sessions)
+	}
+}
+
+func TestEmailChangeIsScopedToTenant(t *testing.T) {
+	s, repos := newTestService(newFusionStub(t))
+
+	repos.emailChanges.changes = append(repos.emailChanges.changes, entities.EmailChange{
+		TokenHash: hashToken("token"),
+		UserID:    "user-1",
+		TenantID:  "acme",
+		Email:     "user@example.com",
+		NewEmail:  "new@example.com",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	// the stub fails the test if the email is changed in fusionauth
+	err := s.ConfirmEmailChange(context.Background(), "token")
+	if !errors.Is(err, ErrInvalidEmailChange) {
+		t.Fatalf("error %v, want %v", err, ErrInvalidEmailChange)
+	}
+}
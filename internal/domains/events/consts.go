@@ -0,0 +1,7 @@
+package events
+
+import "errors"
+
+var (
+	ErrEmptyEventType = errors.New("event type must not be empty")
+)
@@ -0,0 +1,16 @@
+package events
+
+import (
+	"log/slog"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+)
+
+type ServiceConfigs struct {
+	OutboxRepository OutboxRepository
+	// Publisher delivers events to the outside world. When it is nil
+	// events are dropped instead of being written to the outbox.
+	Publisher Publisher
+	Logger    *slog.Logger
+	Cfg       config.Config
+}
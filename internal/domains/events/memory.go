@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// MemoryPublisher keeps published events in memory. It is meant for
+// tests and local development.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []entities.Event
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event entities.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *MemoryPublisher) Events() []entities.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := make([]entities.Event, len(p.events))
+	copy(events, p.events)
+	return events
+}
+
+func (p *MemoryPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = nil
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type (
+	OutboxRepository interface {
+		Add(ctx context.Context, event entities.Event) error
+		ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.Event, error)
+		MarkPublished(ctx context.Context, id string, publishedAt time.Time) error
+		MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, reason string) error
+	}
+
+	Publisher interface {
+		Publish(ctx context.Context, event entities.Event) error
+	}
+
+	Service struct {
+		outboxRepo   OutboxRepository
+		publisher    Publisher
+		pollInterval time.Duration
+		batchSize    int
+		maxAttempts  int
+		log          *slog.Logger
+	}
+)
+
+func NewService(ctx context.Context, cfg ServiceConfigs) (Service, error) {
+	return Service{
+		outboxRepo:   cfg.OutboxRepository,
+		publisher:    cfg.Publisher,
+		pollInterval: cfg.Cfg.Events.PollInterval,
+		batchSize:    cfg.Cfg.Events.BatchSize,
+		maxAttempts:  cfg.Cfg.Events.MaxAttempts,
+		log:          cfg.Logger,
+	}, nil
+}
+
+// Publish stores the event in the outbox. Actual delivery happens
+// asynchronously in Relay, so a slow or unavailable subscriber never
+// blocks the caller.
+func (s Service) Publish(ctx context.Context, eventType string, payload map[string]any) error {
+	if eventType == "" {
+		return ErrEmptyEventType
+	}
+
+	if s.publisher == nil {
+		s.log.DebugContext(ctx, "No event publisher configured, dropping event", "type", eventType)
+		return nil
+	}
+
+	now := time.Now()
+	event := entities.Event{
+		ID:            uuid.New().String(),
+		Type:          eventType,
+		Payload:       payload,
+		OccurredAt:    now,
+		NextAttemptAt: now,
+	}
+
+	if err := s.outboxRepo.Add(ctx, event); err != nil {
+		return fmt.Errorf("failed to add event to outbox: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Event added to outbox", "id", event.ID, "type", event.Type)
+
+	return nil
+}
+
+// Relay delivers pending outbox events until ctx is cancelled.
+func (s Service) Relay(ctx context.Context) {
+	if s.publisher == nil {
+		return
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deliverPending(ctx); err != nil {
+			s.log.ErrorContext(ctx, "failed to deliver pending events", "err", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s Service) deliverPending(ctx context.Context) error {
+	pending, err := s.outboxRepo.ListPending(ctx, time.Now(), s.maxAttempts, s.batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to list pending events: %w", err)
+	}
+
+	for _, event := range pending {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := s.publisher.Publish(ctx, event); err != nil {
+			nextAttemptAt := time.Now().Add(backoff(event.Attempts + 1))
+			s.log.WarnContext(ctx, "failed to publish event", "id", event.ID, "type", event.Type, "attempt", event.Attempts+1, "err", err.Error())
+
+			if err := s.outboxRepo.MarkFailed(ctx, event.ID, nextAttemptAt, err.Error()); err != nil {
+				return fmt.Errorf("failed to mark event as failed: %w", err)
+			}
+			continue
+		}
+
+		if err := s.outboxRepo.MarkPublished(ctx, event.ID, time.Now()); err != nil {
+			return fmt.Errorf("failed to mark event as published: %w", err)
+		}
+
+		s.log.DebugContext(ctx, "Event published", "id", event.ID, "type", event.Type)
+	}
+
+	return nil
+}
+
+// backoff grows exponentially with the number of attempts and is
+// capped at one hour.
+func backoff(attempt int) time.Duration {
+	d := time.Second << attempt
+	if d <= 0 || d > time.Hour {
+		return time.Hour
+	}
+	return d
+}
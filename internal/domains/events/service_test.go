@@ -0,0 +1,242 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// memoryOutbox is an OutboxRepository that behaves like the mongodb one.
+type memoryOutbox struct {
+	mu     sync.Mutex
+	events map[string]*entities.Event
+}
+
+func newMemoryOutbox() *memoryOutbox {
+	return &memoryOutbox{events: make(map[string]*entities.Event)}
+}
+
+func (o *memoryOutbox) Add(ctx context.Context, event entities.Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events[event.ID] = &event
+	return nil
+}
+
+func (o *memoryOutbox) ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.Event, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var pending []entities.Event
+	for _, e := range o.events {
+		if e.PublishedAt == nil && !e.NextAttemptAt.After(now) && e.Attempts < maxAttempts && len(pending) < limit {
+			pending = append(pending, *e)
+		}
+	}
+	return pending, nil
+}
+
+func (o *memoryOutbox) MarkPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events[id].PublishedAt = &publishedAt
+	return nil
+}
+
+func (o *memoryOutbox) MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, reason string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events[id].Attempts++
+	o.events[id].NextAttemptAt = nextAttemptAt
+	o.events[id].LastError = reason
+	return nil
+}
+
+func (o *memoryOutbox) get(id string) entities.Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return *o.events[id]
+}
+
+// failingPublisher fails the first failures calls.
+type failingPublisher struct {
+	*MemoryPublisher
+	failures int
+	calls    int
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, event entities.Event) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("subscriber is down")
+	}
+	return p.MemoryPublisher.Publish(ctx, event)
+}
+
+func newTestService(t *testing.T, outbox OutboxRepository, publisher Publisher) Service {
+	t.Helper()
+
+	var cfg config.Config
+	cfg.Events.BatchSize = 10
+	cfg.Events.MaxAttempts = 3
+
+	s, err := NewService(context.Background(), ServiceConfigs{
+		OutboxRepository: outbox,
+		Publisher:        publisher,
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Cfg:              cfg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPublishDeliversThroughOutbox(t *testing.T) {
+	ctx := context.Background()
+	outbox := newMemoryOutbox()
+	publisher := NewMemoryPublisher()
+	s := newTestService(t, outbox, publisher)
+
+	if err := s.Publish(ctx, "user.registered", map[string]any{"user_id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(publisher.Events()); got != 0 {
+		t.Fatalf("event delivered before the relay ran, got %d", got)
+	}
+
+	if err := s.deliverPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := publisher.Events()
+	if len(events) != 1 || events[0].Type != "user.registered" || events[0].Payload["user_id"] != "1" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if outbox.get(events[0].ID).PublishedAt == nil {
+		t.Fatal("event not marked as published")
+	}
+
+	// published events are not delivered again
+	if err := s.deliverPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(publisher.Events()); got != 1 {
+		t.Fatalf("event delivered %d times", got)
+	}
+}
+
+func TestPublishRejectsEmptyType(t *testing.T) {
+	s := newTestService(t, newMemoryOutbox(), NewMemoryPublisher())
+
+	if err := s.Publish(context.Background(), "", nil); !errors.Is(err, ErrEmptyEventType) {
+		t.Fatalf("expected ErrEmptyEventType, got %v", err)
+	}
+}
+
+func TestPublishWithoutPublisherDropsEvents(t *testing.T) {
+	outbox := newMemoryOutbox()
+	s := newTestService(t, outbox, nil)
+
+	if err := s.Publish(context.Background(), "user.registered", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox.events) != 0 {
+		t.Fatal("event written to the outbox without a publisher")
+	}
+}
+
+func TestFailedDeliveryIsRetriedWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	outbox := newMemoryOutbox()
+	publisher := &failingPublisher{MemoryPublisher: NewMemoryPublisher(), failures: 1}
+	s := newTestService(t, outbox, publisher)
+
+	if err := s.Publish(ctx, "user.registered", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := s.deliverPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	for k := range outbox.events {
+		id = k
+	}
+	event := outbox.get(id)
+	if event.Attempts != 1 || event.LastError == "" || event.PublishedAt != nil {
+		t.Fatalf("failed delivery not recorded: %+v", event)
+	}
+	if event.NextAttemptAt.Before(before.Add(backoff(1))) {
+		t.Fatalf("retry scheduled too early: %v", event.NextAttemptAt)
+	}
+
+	// not due yet, the relay leaves it alone
+	if err := s.deliverPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.calls != 1 {
+		t.Fatalf("event retried before its backoff, %d calls", publisher.calls)
+	}
+
+	outbox.events[id].NextAttemptAt = time.Now()
+	if err := s.deliverPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.Events()) != 1 || outbox.get(id).PublishedAt == nil {
+		t.Fatal("event not delivered on retry")
+	}
+}
+
+func TestDeliveryStopsAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	outbox := newMemoryOutbox()
+	publisher := &failingPublisher{MemoryPublisher: NewMemoryPublisher(), failures: 100}
+	s := newTestService(t, outbox, publisher)
+
+	if err := s.Publish(ctx, "user.registered", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		for _, e := range outbox.events {
+			e.NextAttemptAt = time.Now()
+		}
+		if err := s.deliverPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if publisher.calls != s.maxAttempts {
+		t.Fatalf("expected %d attempts, got %d", s.maxAttempts, publisher.calls)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if got := backoff(1); got != 2*time.Second {
+		t.Fatalf("backoff(1) = %v", got)
+	}
+	if got := backoff(3); got != 8*time.Second {
+		t.Fatalf("backoff(3) = %v", got)
+	}
+	if got := backoff(30); got != time.Hour {
+		t.Fatalf("backoff(30) = %v", got)
+	}
+	if got := backoff(100); got != time.Hour {
+		t.Fatalf("backoff(100) = %v", got)
+	}
+}
@@ -0,0 +1,21 @@
+package mailer
+
+import "errors"
+
+var (
+	ErrUnknownTemplate  = errors.New("unknown mail template")
+	ErrInvalidRecipient = errors.New("invalid mail recipient")
+)
+
+// Templates shipped with the service. Custom template directories have
+// to provide them for the default locale.
+const (
+	TemplateVerification      = "verification"
+	TemplatePasswordReset     = "password_reset"
+	TemplatePasswordChanged   = "password_changed"
+	TemplateMagicLink         = "magic_link"
+	TemplateEmailChange       = "email_change"
+	TemplateEmailChangeNotice = "email_change_notice"
+	TemplateNewDevice         = "new_device"
+	TemplateInvitation        = "invitation"
+)
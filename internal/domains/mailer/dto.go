@@ -0,0 +1,14 @@
+package mailer
+
+import (
+	"log/slog"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+)
+
+type ServiceConfigs struct {
+	QueueRepository QueueRepository
+	Sender          Sender
+	Logger          *slog.Logger
+	Cfg             config.Config
+}
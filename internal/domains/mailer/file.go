@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// FileSender writes every mail to an .eml file in a directory instead
+// of sending it, they open in any mail client. It is meant for local
+// development.
+type FileSender struct {
+	dir string
+}
+
+func NewFileSender(dir string) FileSender {
+	return FileSender{dir: dir}
+}
+
+func (s FileSender) Send(ctx context.Context, mail entities.Mail) error {
+	msg, err := Message(mail, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", mail.CreatedAt.UTC().Format("20060102T150405"), mail.ID)
+	if err := os.WriteFile(filepath.Join(s.dir, name), msg, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// MemorySender keeps sent mails in memory. It is meant for tests and
+// local development.
+type MemorySender struct {
+	mu    sync.Mutex
+	mails []entities.Mail
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, mail entities.Mail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mails = append(s.mails, mail)
+	return nil
+}
+
+func (s *MemorySender) Mails() []entities.Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mails := make([]entities.Mail, len(s.mails))
+	copy(mails, s.mails)
+	return mails
+}
+
+func (s *MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mails = nil
+}
@@ -0,0 +1,93 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// Message encodes the mail as a MIME message, with a text and an html
+// alternative when it has both.
+func Message(m entities.Mail, now time.Time) ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse from address: %w", err)
+	}
+
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return nil, ErrInvalidRecipient
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var buf bytes.Buffer
+
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", m.ID, domain))
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+
+	// clients show the last alternative they understand
+	for _, part := range []struct{ contentType, body string }{
+		{`text/plain; charset="utf-8"`, m.Text},
+		{`text/html; charset="utf-8"`, m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
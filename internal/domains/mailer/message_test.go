@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+func TestMessage(t *testing.T) {
+	msg, err := Message(entities.Mail{
+		ID:      "mail-1",
+		From:    "poc-auth <no-reply@example.com>",
+		To:      "user@example.com",
+		Subject: "Подтвердите email",
+		Text:    "Hi,\n\nhttps://example.com/verify?token=abc\n",
+		HTML:    `<a href="https://example.com/verify?token=abc">Verify</a>`,
+	}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != "Подтвердите email" {
+		t.Errorf("subject %q, %v", subject, err)
+	}
+	if got := m.Header.Get("Message-ID"); got != "<mail-1@example.com>" {
+		t.Errorf("message id %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q, %v", mediaType, err)
+	}
+
+	var types []string
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(body), "https://example.com/verify?token=abc") {
+			t.Errorf("part %s is %q", part.Header.Get("Content-Type"), body)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+
+	// html last, clients show the last alternative they understand
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Errorf("parts %v", types)
+	}
+}
+
+func TestMessageTextOnly(t *testing.T) {
+	msg, err := Message(entities.Mail{
+		ID:   "mail-1",
+		From: "no-reply@example.com",
+		To:   "user@example.com",
+		Text: "Hi",
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("content type %q", got)
+	}
+}
+
+func TestMessageInvalidRecipient(t *testing.T) {
+	_, err := Message(entities.Mail{From: "no-reply@example.com", To: "user"}, time.Now())
+	if !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("error %v, want %v", err, ErrInvalidRecipient)
+	}
+}
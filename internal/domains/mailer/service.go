@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type (
+	QueueRepository interface {
+		Add(ctx context.Context, mail entities.Mail) error
+		ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.Mail, error)
+		MarkSent(ctx context.Context, id string, sentAt time.Time) error
+		MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, reason string) error
+	}
+
+	// Sender delivers a rendered mail, such as over SMTP.
+	Sender interface {
+		Send(ctx context.Context, mail entities.Mail) error
+	}
+
+	Service struct {
+		queue        QueueRepository
+		sender       Sender
+		templates    templates
+		from         string
+		pollInterval time.Duration
+		batchSize    int
+		maxAttempts  int
+		log          *slog.Logger
+	}
+)
+
+func NewService(ctx context.Context, cfg ServiceConfigs) (Service, error) {
+	if _, err := mail.ParseAddress(cfg.Cfg.Mailer.From); err != nil {
+		return Service{}, fmt.Errorf("failed to parse from address: %w", err)
+	}
+
+	tmpls, err := loadTemplates(cfg.Cfg.Mailer.TemplatesPath, cfg.Cfg.Mailer.DefaultLocale)
+	if err != nil {
+		return Service{}, fmt.Errorf("failed to load mail templates: %w", err)
+	}
+
+	return Service{
+		queue:        cfg.QueueRepository,
+		sender:       cfg.Sender,
+		templates:    tmpls,
+		from:         cfg.Cfg.Mailer.From,
+		pollInterval: cfg.Cfg.Mailer.PollInterval,
+		batchSize:    cfg.Cfg.Mailer.BatchSize,
+		maxAttempts:  cfg.Cfg.Mailer.MaxAttempts,
+		log:          cfg.Logger,
+	}, nil
+}
+
+// Send renders the template and queues the mail, Relay delivers it.
+// locale can be a language tag or an Accept-Language list, the closest
+// locale the template exists in is used and the default one otherwise.
+// Rendering errors are returned right away, failed deliveries are
+// retried.
+func (s Service) Send(ctx context.Context, template, locale, to string, data map[string]any) error {
+	if _, err := mail.ParseAddress(to); err != nil {
+		return ErrInvalidRecipient
+	}
+
+	rendered, err := s.templates.render(template, locale, data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	m := entities.Mail{
+		ID:            uuid.New().String(),
+		Template:      template,
+		Locale:        rendered.locale,
+		From:          s.from,
+		To:            to,
+		Subject:       rendered.subject,
+		Text:          rendered.text,
+		HTML:          rendered.html,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+
+	if err := s.queue.Add(ctx, m); err != nil {
+		return fmt.Errorf("failed to queue mail: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Mail queued", "id", m.ID, "template", template, "locale", m.Locale)
+
+	return nil
+}
+
+// Relay sends queued mails until ctx is cancelled.
+func (s Service) Relay(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sendPending(ctx); err != nil {
+			s.log.ErrorContext(ctx, "failed to send pending mails", "err", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s Service) sendPending(ctx context.Context) error {
+	pending, err := s.queue.ListPending(ctx, time.Now(), s.maxAttempts, s.batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to list pending mails: %w", err)
+	}
+
+	for _, m := range pending {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := s.sender.Send(ctx, m); err != nil {
+			nextAttemptAt := time.Now().Add(backoff(m.Attempts + 1))
+			s.log.WarnContext(ctx, "failed to send mail", "id", m.ID, "template", m.Template, "attempt", m.Attempts+1, "err", err.Error())
+
+			if err := s.queue.MarkFailed(ctx, m.ID, nextAttemptAt, err.Error()); err != nil {
+				return fmt.Errorf("failed to mark mail as failed: %w", err)
+			}
+			continue
+		}
+
+		if err := s.queue.MarkSent(ctx, m.ID, time.Now()); err != nil {
+			return fmt.Errorf("failed to mark mail as sent: %w", err)
+		}
+
+		s.log.DebugContext(ctx, "Mail sent", "id", m.ID, "template", m.Template)
+	}
+
+	return nil
+}
+
+// backoff grows exponentially with the number of attempts and is
+// capped at one hour.
+func backoff(attempt int) time.Duration {
+	d := time.Second << attempt
+	if d <= 0 || d > time.Hour {
+		return time.Hour
+	}
+	return d
+}
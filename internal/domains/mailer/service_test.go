@@ -0,0 +1,230 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// memoryQueue picks mails like the mail_queue collection does: unsent,
+// due and below the attempt limit, oldest first.
+type memoryQueue struct {
+	mu    sync.Mutex
+	mails []entities.Mail
+}
+
+func (q *memoryQueue) Add(ctx context.Context, mail entities.Mail) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.mails = append(q.mails, mail)
+	return nil
+}
+
+func (q *memoryQueue) ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.Mail, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var res []entities.Mail
+	for _, m := range q.mails {
+		if m.SentAt == nil && !m.NextAttemptAt.After(now) && m.Attempts < maxAttempts && len(res) < limit {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (q *memoryQueue) MarkSent(ctx context.Context, id string, sentAt time.Time) error {
+	return q.update(id, func(m *entities.Mail) { m.SentAt = &sentAt })
+}
+
+func (q *memoryQueue) MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, reason string) error {
+	return q.update(id, func(m *entities.Mail) {
+		m.Attempts++
+		m.NextAttemptAt = nextAttemptAt
+		m.LastError = reason
+	})
+}
+
+func (q *memoryQueue) update(id string, fn func(*entities.Mail)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.mails {
+		if q.mails[i].ID == id {
+			fn(&q.mails[i])
+			return nil
+		}
+	}
+	return errors.New("mail not found")
+}
+
+// due makes every queued mail due for its next attempt.
+func (q *memoryQueue) due() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.mails {
+		q.mails[i].NextAttemptAt = time.Time{}
+	}
+}
+
+// fakeSender fails the first failures sends and records the others.
+type fakeSender struct {
+	failures int
+	attempts int
+	sent     []entities.Mail
+}
+
+func (s *fakeSender) Send(ctx context.Context, mail entities.Mail) error {
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("421 service not available")
+	}
+	s.sent = append(s.sent, mail)
+	return nil
+}
+
+func newTestService(t *testing.T, sender Sender) (Service, *memoryQueue) {
+	t.Helper()
+
+	tmpls, err := loadTemplates("", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := &memoryQueue{}
+	return Service{
+		queue:       queue,
+		sender:      sender,
+		templates:   tmpls,
+		from:        "poc-auth <no-reply@example.com>",
+		batchSize:   10,
+		maxAttempts: 3,
+		log:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, queue
+}
+
+func TestSendQueuesRenderedMail(t *testing.T) {
+	s, queue := newTestService(t, &fakeSender{})
+
+	err := s.Send(context.Background(), TemplateMagicLink, "ru-RU,en;q=0.5", "user@example.com", map[string]any{"link": "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queue.mails) != 1 {
+		t.Fatalf("%d mails queued, want 1", len(queue.mails))
+	}
+	m := queue.mails[0]
+	if m.Locale != "ru" || m.Template != TemplateMagicLink || m.To != "user@example.com" || m.Subject == "" || m.HTML == "" {
+		t.Errorf("queued %+v", m)
+	}
+}
+
+func TestSendRejectsInvalidMails(t *testing.T) {
+	s, queue := newTestService(t, &fakeSender{})
+	ctx := context.Background()
+
+	if err := s.Send(ctx, TemplateMagicLink, "en", "not an address", nil); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("error %v, want %v", err, ErrInvalidRecipient)
+	}
+	if err := s.Send(ctx, "newsletter", "en", "user@example.com", nil); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("error %v, want %v", err, ErrUnknownTemplate)
+	}
+
+	if len(queue.mails) != 0 {
+		t.Errorf("%d mails queued", len(queue.mails))
+	}
+}
+
+func TestSendPendingRetries(t *testing.T) {
+	sender := &fakeSender{failures: 1}
+	s, queue := newTestService(t, sender)
+	ctx := context.Background()
+
+	if err := s.Send(ctx, TemplateMagicLink, "en", "user@example.com", map[string]any{"link": "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := s.sendPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m := queue.mails[0]
+	if m.Attempts != 1 || m.SentAt != nil || m.LastError == "" {
+		t.Fatalf("failed mail %+v", m)
+	}
+	if wait := m.NextAttemptAt.Sub(before); wait < backoff(1) {
+		t.Errorf("retried after %v, want at least %v", wait, backoff(1))
+	}
+
+	// not due yet
+	if err := s.sendPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sender.attempts != 1 {
+		t.Fatalf("%d attempts before the backoff passed", sender.attempts)
+	}
+
+	queue.due()
+	if err := s.sendPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sender.sent) != 1 || queue.mails[0].SentAt == nil {
+		t.Errorf("mail was not sent on the retry")
+	}
+}
+
+func TestSendPendingGivesUp(t *testing.T) {
+	sender := &fakeSender{failures: 100}
+	s, queue := newTestService(t, sender)
+	ctx := context.Background()
+
+	if err := s.Send(ctx, TemplateMagicLink, "en", "user@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < s.maxAttempts+2; i++ {
+		if err := s.sendPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		queue.due()
+	}
+
+	if sender.attempts != s.maxAttempts {
+		t.Errorf("%d attempts, want %d", sender.attempts, s.maxAttempts)
+	}
+	if queue.mails[0].SentAt != nil {
+		t.Error("failed mail is marked sent")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{5, 32 * time.Second},
+		{11, 2048 * time.Second},
+		{12, time.Hour},
+		{64, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// defaultTemplates are used unless a templates directory is configured.
+// It has the same layout: layout.html and a directory per locale with
+// <name>.txt and optionally <name>.html for every template.
+//
+//go:embed templates
+var defaultTemplates embed.FS
+
+// mailTemplate is a template in one locale. The text template defines
+// the subject block, the html one the content block of layout.html.
+type mailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type templates struct {
+	locales       map[string]map[string]mailTemplate
+	defaultLocale string
+}
+
+type renderedMail struct {
+	locale  string
+	subject string
+	text    string
+	html    string
+}
+
+func loadTemplates(dir, defaultLocale string) (templates, error) {
+	var fsys fs.FS = os.DirFS(dir)
+	if dir == "" {
+		sub, err := fs.Sub(defaultTemplates, "templates")
+		if err != nil {
+			return templates{}, err
+		}
+		fsys = sub
+	}
+
+	return parseTemplates(fsys, normalizeLocale(defaultLocale))
+}
+
+func parseTemplates(fsys fs.FS, defaultLocale string) (templates, error) {
+	layout, err := fs.ReadFile(fsys, "layout.html")
+	if err != nil {
+		return templates{}, fmt.Errorf("failed to read layout: %w", err)
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return templates{}, err
+	}
+
+	t := templates{
+		locales:       make(map[string]map[string]mailTemplate),
+		defaultLocale: defaultLocale,
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		locale := entry.Name()
+
+		files, err := fs.Glob(fsys, locale+"/*.txt")
+		if err != nil {
+			return templates{}, err
+		}
+
+		t.locales[normalizeLocale(locale)] = make(map[string]mailTemplate, len(files))
+
+		for _, file := range files {
+			name := strings.TrimSuffix(path.Base(file), ".txt")
+
+			tmpl, err := parseTemplate(fsys, string(layout), locale, name)
+			if err != nil {
+				return templates{}, fmt.Errorf("failed to parse %s/%s: %w", locale, name, err)
+			}
+
+			t.locales[normalizeLocale(locale)][name] = tmpl
+		}
+	}
+
+	defaults, ok := t.locales[defaultLocale]
+	if !ok {
+		return templates{}, fmt.Errorf("no templates for the default locale %q", defaultLocale)
+	}
+
+	for _, name := range []string{
+		TemplateVerification, TemplatePasswordReset, TemplatePasswordChanged, TemplateMagicLink,
+		TemplateEmailChange, TemplateEmailChangeNotice, TemplateNewDevice, TemplateInvitation,
+	} {
+		if _, ok := defaults[name]; !ok {
+			return templates{}, fmt.Errorf("template %s is missing for the default locale", name)
+		}
+	}
+
+	return t, nil
+}
+
+func parseTemplate(fsys fs.FS, layout, locale, name string) (mailTemplate, error) {
+	text, err := fs.ReadFile(fsys, locale+"/"+name+".txt")
+	if err != nil {
+		return mailTemplate{}, err
+	}
+
+	var tmpl mailTemplate
+
+	tmpl.text, err = texttemplate.New(name).Option("missingkey=zero").Parse(string(text))
+	if err != nil {
+		return mailTemplate{}, err
+	}
+
+	if tmpl.text.Lookup("subject") == nil {
+		return mailTemplate{}, fmt.Errorf("subject is not defined")
+	}
+
+	html, err := fs.ReadFile(fsys, locale+"/"+name+".html")
+	if err != nil {
+		// text only
+		if errors.Is(err, fs.ErrNotExist) {
+			return tmpl, nil
+		}
+		return mailTemplate{}, err
+	}
+
+	tmpl.html, err = htmltemplate.New("layout").Option("missingkey=zero").Parse(layout)
+	if err != nil {
+		return mailTemplate{}, fmt.Errorf("failed to parse layout: %w", err)
+	}
+
+	if _, err := tmpl.html.Parse(string(html)); err != nil {
+		return mailTemplate{}, err
+	}
+
+	return tmpl, nil
+}
+
+func (t templates) render(name, locale string, data map[string]any) (renderedMail, error) {
+	tmpl, locale, ok := t.lookup(name, locale)
+	if !ok {
+		return renderedMail{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	vars := make(map[string]any, len(data)+1)
+	for k, v := range data {
+		vars[k] = v
+	}
+	vars["locale"] = locale
+
+	res := renderedMail{locale: locale}
+
+	var buf bytes.Buffer
+
+	if err := tmpl.text.ExecuteTemplate(&buf, "subject", vars); err != nil {
+		return renderedMail{}, fmt.Errorf("failed to render subject of %s: %w", name, err)
+	}
+	res.subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := tmpl.text.Execute(&buf, vars); err != nil {
+		return renderedMail{}, fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	res.text = strings.TrimSpace(buf.String()) + "\n"
+
+	if tmpl.html != nil {
+		buf.Reset()
+		if err := tmpl.html.Execute(&buf, vars); err != nil {
+			return renderedMail{}, fmt.Errorf("failed to render html of %s: %w", name, err)
+		}
+		res.html = buf.String()
+	}
+
+	return res, nil
+}
+
+// lookup finds the template in the first locale of an Accept-Language
+// style list it exists in, trying "pt" for "pt-BR", and falls back to
+// the default locale.
+func (t templates) lookup(name, locales string) (mailTemplate, string, bool) {
+	for _, tag := range strings.Split(locales, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		tag = normalizeLocale(tag)
+		if tag == "" {
+			continue
+		}
+
+		if tmpl, ok := t.locales[tag][name]; ok {
+			return tmpl, tag, true
+		}
+
+		if base, _, ok := strings.Cut(tag, "-"); ok {
+			if tmpl, ok := t.locales[base][name]; ok {
+				return tmpl, base, true
+			}
+		}
+	}
+
+	tmpl, ok := t.locales[t.defaultLocale][name]
+	return tmpl, t.defaultLocale, ok
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
@@ -0,0 +1,166 @@
+package mailer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderLocaleFallback(t *testing.T) {
+	tmpls, err := loadTemplates("", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"ru", "ru"},
+		{"RU", "ru"},
+		{"ru-RU", "ru"},
+		{"ru_RU", "ru"},
+		{"de-DE, ru;q=0.8, en;q=0.5", "ru"},
+		{"en-GB,ru", "en"},
+		{"de", "en"},
+		{"", "en"},
+		{",;q=1", "en"},
+	}
+
+	for _, tt := range tests {
+		res, err := tmpls.render(TemplateVerification, tt.locale, nil)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.locale, err)
+		}
+		if res.locale != tt.want {
+			t.Errorf("%q: rendered in %q, want %q", tt.locale, res.locale, tt.want)
+		}
+	}
+}
+
+func TestRenderVerification(t *testing.T) {
+	tmpls, err := loadTemplates("", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := tmpls.render(TemplateVerification, "en", map[string]any{
+		"firstname": "Jane",
+		"link":      `https://example.com/verify?token=abc&next="<script>"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.subject != "Verify your email" {
+		t.Errorf("subject %q", res.subject)
+	}
+	if !strings.HasPrefix(res.text, "Hi Jane,\n") || !strings.Contains(res.text, `token=abc&next="<script>"`) {
+		t.Errorf("text %q", res.text)
+	}
+	if !strings.Contains(res.html, `<html lang="en">`) {
+		t.Error("html is not in the layout")
+	}
+	if strings.Contains(res.html, "<script>") {
+		t.Errorf("link is not escaped in %s", res.html)
+	}
+}
+
+func TestRenderOptionalData(t *testing.T) {
+	tmpls, err := loadTemplates("", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := tmpls.render(TemplateNewDevice, "en", map[string]any{
+		"device_name": "Chrome on macOS",
+		"ip":          "203.0.113.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(res.text, "Hi,\n") || strings.Contains(res.text, "Location") || strings.Contains(res.text, "Time") {
+		t.Errorf("text %q", res.text)
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	tmpls, err := loadTemplates("", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tmpls.render("newsletter", "en", nil); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("error %v, want %v", err, ErrUnknownTemplate)
+	}
+}
+
+// customTemplates has every template in en, and the verification in de
+// without html.
+func customTemplates() fstest.MapFS {
+	fsys := fstest.MapFS{
+		"layout.html":         {Data: []byte(`<html lang="{{.locale}}">{{template "content" .}}</html>`)},
+		"de/verification.txt": {Data: []byte(`{{define "subject"}}E-Mail bestätigen{{end}}{{.link}}`)},
+	}
+	for _, name := range []string{
+		TemplateVerification, TemplatePasswordReset, TemplatePasswordChanged, TemplateMagicLink,
+		TemplateEmailChange, TemplateEmailChangeNotice, TemplateNewDevice, TemplateInvitation,
+	} {
+		fsys["en/"+name+".txt"] = &fstest.MapFile{Data: []byte(`{{define "subject"}}` + name + `{{end}}{{.link}}`)}
+		fsys["en/"+name+".html"] = &fstest.MapFile{Data: []byte(`{{define "content"}}<a href="{{.link}}">link</a>{{end}}`)}
+	}
+	return fsys
+}
+
+func TestParseCustomTemplates(t *testing.T) {
+	tmpls, err := parseTemplates(customTemplates(), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := tmpls.render(TemplateVerification, "de-AT", map[string]any{"link": "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.locale != "de" || res.subject != "E-Mail bestätigen" || res.html != "" {
+		t.Errorf("rendered %+v, want the text only de template", res)
+	}
+
+	// only the verification is translated
+	res, err = tmpls.render(TemplateMagicLink, "de", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.locale != "en" {
+		t.Errorf("rendered in %q, want the default locale", res.locale)
+	}
+}
+
+func TestParseTemplatesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(fstest.MapFS)
+		locale string
+	}{
+		{"no layout", func(fsys fstest.MapFS) { delete(fsys, "layout.html") }, "en"},
+		{"no default locale", func(fstest.MapFS) {}, "fr"},
+		{"missing template", func(fsys fstest.MapFS) { delete(fsys, "en/"+TemplateInvitation+".txt") }, "en"},
+		{"no subject", func(fsys fstest.MapFS) {
+			fsys["en/"+TemplateMagicLink+".txt"] = &fstest.MapFile{Data: []byte(`{{.link}}`)}
+		}, "en"},
+		{"syntax error", func(fsys fstest.MapFS) {
+			fsys["en/"+TemplateMagicLink+".html"] = &fstest.MapFile{Data: []byte(`{{define "content"}}{{.link}`)}
+		}, "en"},
+	}
+
+	for _, tt := range tests {
+		fsys := customTemplates()
+		tt.change(fsys)
+
+		if _, err := parseTemplates(fsys, tt.locale); err == nil {
+			t.Errorf("%s: parsed", tt.name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// ValidateAuthorizeRequest checks the client and its redirect uri. Only
+// after it succeeds errors may be reported by redirecting back to the
+// client, see ErrorRedirect.
+func (s Service) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (entities.OIDCClient, error) {
+	client, err := s.clientsRepo.GetByID(ctx, req.ClientID)
+	if err != nil {
+		return entities.OIDCClient{}, err
+	}
+
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return entities.OIDCClient{}, fmt.Errorf("%w: redirect_uri is not registered", ErrInvalidRequest)
+	}
+
+	return client, nil
+}
+
+// AuthorizeWithToken authorizes the request on behalf of the user the
+// access token was issued to. Impersonation tokens are refused, the
+// tokens of the client would outlive the impersonation.
+func (s Service) AuthorizeWithToken(ctx context.Context, req AuthorizeRequest, accessToken string) (string, error) {
+	user, err := s.authenticator.VerifyToken(ctx, accessToken)
+	if err != nil {
+		return "", ErrLoginRequired
+	}
+
+	if user.ImpersonatorID != "" {
+		return "", ErrAccessDenied
+	}
+
+	return s.authorize(ctx, req, user)
+}
+
+// AuthorizeWithPassword is used by login pages that post the user's
+// credentials together with the original authorization request. Only
+// the credentials are checked, the user gets no session of their own.
+func (s Service) AuthorizeWithPassword(ctx context.Context, req AuthorizeRequest, email, password string) (string, error) {
+	user, err := s.authenticator.Authenticate(ctx, email, password)
+	if err != nil {
+		s.log.DebugContext(ctx, "failed to authenticate user", "error", err)
+		return "", ErrAccessDenied
+	}
+
+	return s.authorize(ctx, req, user)
+}
+
+// LoginRedirect returns the url of the login page with the original
+// request attached, or ErrLoginRequired when no login page is set up.
+func (s Service) LoginRedirect(req AuthorizeRequest) (string, error) {
+	if s.loginURL == "" {
+		return "", ErrLoginRequired
+	}
+
+	u, err := url.Parse(s.loginURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse login url: %w", err)
+	}
+
+	q := u.Query()
+	for k, v := range authorizeParams(req) {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// ErrorRedirect reports err to the client's redirect uri. It must only
+// be used with requests that passed ValidateAuthorizeRequest.
+func (s Service) ErrorRedirect(req AuthorizeRequest, err error) string {
+	params := url.Values{"error": {ErrorCode(err)}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params)
+}
+
+func (s Service) authorize(ctx context.Context, req AuthorizeRequest, user entities.User) (string, error) {
+	client, err := s.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if req.ResponseType != "code" {
+		return "", ErrUnsupportedResponseType
+	}
+
+	if !slices.Contains(client.GrantTypes, GrantAuthorizationCode) {
+		return "", ErrUnauthorizedClient
+	}
+
+	if err := allowedScope(client, req.Scope); err != nil {
+		return "", err
+	}
+
+	if client.Public && req.CodeChallenge == "" {
+		return "", fmt.Errorf("%w: public clients must use pkce", ErrInvalidRequest)
+	}
+
+	method := req.CodeChallengeMethod
+	if req.CodeChallenge != "" && method == "" {
+		method = "plain"
+	}
+	if method != "" && method != "S256" && method != "plain" {
+		return "", fmt.Errorf("%w: unsupported code_challenge_method", ErrInvalidRequest)
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+
+	now := time.Now()
+	err = s.codesRepo.Create(ctx, entities.OIDCAuthorizationCode{
+		CodeHash:            HashSecret(code),
+		ClientID:            client.ID,
+		RedirectURI:         req.RedirectURI,
+		Subject:             user.ProviderID,
+		Email:               user.Email,
+		TenantID:            auth.TenantFromContext(ctx),
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: method,
+		AuthTime:            now,
+		ExpiresAt:           now.Add(s.codeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save authorization code: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Issued authorization code", "client_id", client.ID, "sub", user.ProviderID)
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+func authorizeParams(req AuthorizeRequest) url.Values {
+	params := url.Values{}
+	for k, v := range map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	} {
+		if v != "" {
+			params.Set(k, v)
+		}
+	}
+	return params
+}
@@ -0,0 +1,28 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizeWithTokenRejectsImpersonation(t *testing.T) {
+	s, repos := newTestService(t)
+	user := repos.authenticator.tokens["access"]
+	user.ImpersonatorID = "admin-1"
+	repos.authenticator.tokens["impersonation"] = user
+
+	req := AuthorizeRequest{ResponseType: "code", ClientID: "app", RedirectURI: testRedirectURI, Scope: "openid offline_access"}
+
+	_, err := s.AuthorizeWithToken(context.Background(), req, "impersonation")
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("error %v, want %v", err, ErrAccessDenied)
+	}
+	if len(repos.codes.codes) != 0 {
+		t.Error("code was issued to an impersonation")
+	}
+
+	if _, err := s.AuthorizeWithToken(context.Background(), req, "access"); err != nil {
+		t.Fatalf("the user's own token is refused: %v", err)
+	}
+}
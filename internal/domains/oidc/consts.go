@@ -0,0 +1,27 @@
+package oidc
+
+import "errors"
+
+// The error messages are the error codes defined by RFC 6749 and
+// OpenID Connect, so they can be returned to clients as they are.
+var (
+	ErrInvalidRequest          = errors.New("invalid_request")
+	ErrInvalidClient           = errors.New("invalid_client")
+	ErrInvalidGrant            = errors.New("invalid_grant")
+	ErrInvalidScope            = errors.New("invalid_scope")
+	ErrInvalidToken            = errors.New("invalid_token")
+	ErrUnauthorizedClient      = errors.New("unauthorized_client")
+	ErrUnsupportedGrantType    = errors.New("unsupported_grant_type")
+	ErrUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrAccessDenied            = errors.New("access_denied")
+	ErrLoginRequired           = errors.New("login_required")
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+
+	ScopeOpenID        = "openid"
+	ScopeOfflineAccess = "offline_access"
+)
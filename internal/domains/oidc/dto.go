@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"log/slog"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+type ServiceConfigs struct {
+	Authenticator           Authenticator
+	UsersRepository         UsersRepository
+	ClientsRepository       ClientsRepository
+	CodesRepository         CodesRepository
+	RefreshTokensRepository RefreshTokensRepository
+	Signer                  jwks.Signer
+	Logger                  *slog.Logger
+	Cfg                     config.Config
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `query:"response_type" form:"response_type"`
+	ClientID            string `query:"client_id" form:"client_id"`
+	RedirectURI         string `query:"redirect_uri" form:"redirect_uri"`
+	Scope               string `query:"scope" form:"scope"`
+	State               string `query:"state" form:"state"`
+	Nonce               string `query:"nonce" form:"nonce"`
+	CodeChallenge       string `query:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method"`
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type EndSessionRequest struct {
+	IDTokenHint           string `query:"id_token_hint" form:"id_token_hint"`
+	ClientID              string `query:"client_id" form:"client_id"`
+	PostLogoutRedirectURI string `query:"post_logout_redirect_uri" form:"post_logout_redirect_uri"`
+	State                 string `query:"state" form:"state"`
+}
+
+type UserInfo struct {
+	Subject    string `json:"sub"`
+	Email      string `json:"email,omitempty"`
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+}
+
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+	Email    string `json:"email,omitempty"`
+	// Tenant is empty for users of the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce      string `json:"nonce,omitempty"`
+	AuthTime   int64  `json:"auth_time,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+}
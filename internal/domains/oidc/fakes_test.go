@@ -0,0 +1,182 @@
+package oidc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+const (
+	testIssuer      = "https://auth.example.com"
+	testRedirectURI = "https://app.example.com/callback"
+	testSecret      = "client-secret"
+)
+
+// newTestService knows user@example.com, who is logged in with the
+// access token "access", a confidential client "app" with the secret
+// testSecret and a public client "spa".
+func newTestService(t *testing.T) (Service, *testRepos) {
+	t.Helper()
+
+	signer, err := jwks.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := entities.User{ProviderID: "user-1", Email: "user@example.com", Firstname: "Jane", Lastname: "Doe"}
+	grants := []string{GrantAuthorizationCode, GrantRefreshToken}
+
+	repos := &testRepos{
+		authenticator: &fakeAuthenticator{tokens: map[string]entities.User{"access": user}},
+		users:         &memoryUsers{users: []entities.User{user}},
+		clients: &memoryClients{clients: []entities.OIDCClient{
+			{ID: "app", SecretHash: HashSecret(testSecret), RedirectURIs: []string{testRedirectURI}, GrantTypes: grants},
+			{ID: "spa", Public: true, RedirectURIs: []string{testRedirectURI}, GrantTypes: grants},
+		}},
+		codes:         &memoryCodes{},
+		refreshTokens: &memoryRefreshTokens{},
+	}
+
+	return Service{
+		authenticator:   repos.authenticator,
+		usersRepo:       repos.users,
+		clientsRepo:     repos.clients,
+		codesRepo:       repos.codes,
+		refreshRepo:     repos.refreshTokens,
+		signer:          signer,
+		issuer:          testIssuer,
+		codeTTL:         time.Minute,
+		accessTokenTTL:  time.Minute,
+		idTokenTTL:      time.Minute,
+		refreshTokenTTL: time.Hour,
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, repos
+}
+
+type testRepos struct {
+	authenticator *fakeAuthenticator
+	users         *memoryUsers
+	clients       *memoryClients
+	codes         *memoryCodes
+	refreshTokens *memoryRefreshTokens
+}
+
+type fakeAuthenticator struct {
+	tokens map[string]entities.User
+}
+
+func (a *fakeAuthenticator) Authenticate(ctx context.Context, email, password string) (entities.User, error) {
+	for _, user := range a.tokens {
+		if user.Email == email && password == "password" {
+			return user, nil
+		}
+	}
+	return entities.User{}, auth.ErrInvalidCredentials
+}
+
+func (a *fakeAuthenticator) VerifyToken(ctx context.Context, tokenString string) (entities.User, error) {
+	user, ok := a.tokens[tokenString]
+	if !ok {
+		return entities.User{}, auth.ErrInvalidToken
+	}
+	return user, nil
+}
+
+type memoryUsers struct {
+	users []entities.User
+}
+
+func (r *memoryUsers) GetByEmail(ctx context.Context, email string) (entities.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return entities.User{}, auth.ErrEmailNotFound
+}
+
+type memoryClients struct {
+	clients []entities.OIDCClient
+}
+
+func (r *memoryClients) GetByID(ctx context.Context, id string) (entities.OIDCClient, error) {
+	for _, client := range r.clients {
+		if client.ID == id {
+			return client, nil
+		}
+	}
+	return entities.OIDCClient{}, ErrInvalidClient
+}
+
+type memoryCodes struct {
+	mu    sync.Mutex
+	codes []entities.OIDCAuthorizationCode
+}
+
+func (r *memoryCodes) Create(ctx context.Context, code entities.OIDCAuthorizationCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codes = append(r.codes, code)
+	return nil
+}
+
+func (r *memoryCodes) Take(ctx context.Context, codeHash string) (entities.OIDCAuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, code := range r.codes {
+		if code.CodeHash == codeHash {
+			r.codes = append(r.codes[:i], r.codes[i+1:]...)
+			return code, nil
+		}
+	}
+	return entities.OIDCAuthorizationCode{}, ErrInvalidGrant
+}
+
+type memoryRefreshTokens struct {
+	mu     sync.Mutex
+	tokens []entities.OIDCRefreshToken
+}
+
+func (r *memoryRefreshTokens) Create(ctx context.Context, token entities.OIDCRefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryRefreshTokens) Take(ctx context.Context, tokenHash string) (entities.OIDCRefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			r.tokens = append(r.tokens[:i], r.tokens[i+1:]...)
+			return token, nil
+		}
+	}
+	return entities.OIDCRefreshToken{}, ErrInvalidGrant
+}
+
+func (r *memoryRefreshTokens) DeleteBySubject(ctx context.Context, subject, clientID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.tokens[:0]
+	for _, token := range r.tokens {
+		if token.Subject != subject || token.ClientID != clientID {
+			kept = append(kept, token)
+		}
+	}
+	r.tokens = kept
+	return nil
+}
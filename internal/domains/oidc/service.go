@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+type (
+	// Authenticator is implemented by auth.Service.
+	Authenticator interface {
+		Authenticate(ctx context.Context, email, password string) (entities.User, error)
+		VerifyToken(ctx context.Context, tokenString string) (entities.User, error)
+	}
+
+	UsersRepository interface {
+		GetByEmail(ctx context.Context, email string) (entities.User, error)
+	}
+
+	ClientsRepository interface {
+		GetByID(ctx context.Context, id string) (entities.OIDCClient, error)
+	}
+
+	CodesRepository interface {
+		Create(ctx context.Context, code entities.OIDCAuthorizationCode) error
+		Take(ctx context.Context, codeHash string) (entities.OIDCAuthorizationCode, error)
+	}
+
+	RefreshTokensRepository interface {
+		Create(ctx context.Context, token entities.OIDCRefreshToken) error
+		Take(ctx context.Context, tokenHash string) (entities.OIDCRefreshToken, error)
+		DeleteBySubject(ctx context.Context, subject, clientID string) error
+	}
+
+	Service struct {
+		authenticator   Authenticator
+		usersRepo       UsersRepository
+		clientsRepo     ClientsRepository
+		codesRepo       CodesRepository
+		refreshRepo     RefreshTokensRepository
+		signer          jwks.Signer
+		issuer          string
+		loginURL        string
+		codeTTL         time.Duration
+		accessTokenTTL  time.Duration
+		idTokenTTL      time.Duration
+		refreshTokenTTL time.Duration
+		log             *slog.Logger
+	}
+)
+
+func NewService(ctx context.Context, cfg ServiceConfigs) (Service, error) {
+	return Service{
+		authenticator:   cfg.Authenticator,
+		usersRepo:       cfg.UsersRepository,
+		clientsRepo:     cfg.ClientsRepository,
+		codesRepo:       cfg.CodesRepository,
+		refreshRepo:     cfg.RefreshTokensRepository,
+		signer:          cfg.Signer,
+		issuer:          strings.TrimSuffix(cfg.Cfg.OIDC.Issuer, "/"),
+		loginURL:        cfg.Cfg.OIDC.LoginURL,
+		codeTTL:         cfg.Cfg.OIDC.CodeTTL,
+		accessTokenTTL:  cfg.Cfg.OIDC.AccessTokenTTL,
+		idTokenTTL:      cfg.Cfg.OIDC.IDTokenTTL,
+		refreshTokenTTL: cfg.Cfg.OIDC.RefreshTokenTTL,
+		log:             cfg.Logger,
+	}, nil
+}
+
+func (s Service) Discovery() Discovery {
+	return Discovery{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             s.issuer + "/oauth2/authorize",
+		TokenEndpoint:                     s.issuer + "/oauth2/token",
+		UserinfoEndpoint:                  s.issuer + "/oauth2/userinfo",
+		EndSessionEndpoint:                s.issuer + "/oauth2/logout",
+		JWKSURI:                           s.issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   []string{ScopeOpenID, "email", "profile", ScopeOfflineAccess},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256", "plain"},
+		ClaimsSupported:                   []string{"sub", "email", "name", "given_name", "family_name", "nonce", "auth_time", "tenant"},
+	}
+}
+
+func (s Service) JWKS() jwks.Set {
+	return s.signer.Set()
+}
+
+// authenticateClient checks the client secret. Public clients must not
+// send one, confidential clients must.
+func (s Service) authenticateClient(ctx context.Context, clientID, clientSecret string) (entities.OIDCClient, error) {
+	client, err := s.clientsRepo.GetByID(ctx, clientID)
+	if err != nil {
+		return entities.OIDCClient{}, err
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return entities.OIDCClient{}, ErrInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashSecret(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return entities.OIDCClient{}, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// allowedScope makes sure every requested scope was granted to the
+// client. An empty client scope list allows anything.
+func allowedScope(client entities.OIDCClient, scope string) error {
+	if len(client.Scopes) == 0 {
+		return nil
+	}
+
+	for _, sc := range strings.Fields(scope) {
+		if !slices.Contains(client.Scopes, sc) {
+			return fmt.Errorf("%w: scope %q is not allowed for this client", ErrInvalidScope, sc)
+		}
+	}
+
+	return nil
+}
+
+func hasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
+
+// HashSecret is used for client secrets, codes and refresh tokens. They
+// are all long random strings, so a plain sha256 is sufficient.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,279 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+func (s Service) Token(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if !slices.Contains(client.GrantTypes, req.GrantType) {
+		switch req.GrantType {
+		case GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials:
+			return TokenResponse{}, ErrUnauthorizedClient
+		default:
+			return TokenResponse{}, ErrUnsupportedGrantType
+		}
+	}
+
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantRefreshToken:
+		return s.exchangeRefreshToken(ctx, client, req)
+	case GrantClientCredentials:
+		return s.clientCredentials(ctx, client, req)
+	default:
+		return TokenResponse{}, ErrUnsupportedGrantType
+	}
+}
+
+func (s Service) exchangeCode(ctx context.Context, client entities.OIDCClient, req TokenRequest) (TokenResponse, error) {
+	code, err := s.codesRepo.Take(ctx, HashSecret(req.Code))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI || time.Now().After(code.ExpiresAt) ||
+		code.TenantID != auth.TenantFromContext(ctx) {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	if !verifyPKCE(code.CodeChallenge, code.CodeChallengeMethod, req.CodeVerifier) {
+		return TokenResponse{}, fmt.Errorf("%w: code_verifier does not match", ErrInvalidGrant)
+	}
+
+	user, err := s.usersRepo.GetByEmail(ctx, code.Email)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	res, err := s.issueTokens(ctx, client, code.Subject, code.Email, code.Scope, code.AuthTime)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if hasScope(code.Scope, ScopeOpenID) {
+		res.IDToken, err = s.signer.Sign(IDTokenClaims{
+			RegisteredClaims: s.registeredClaims(code.Subject, client.ID, s.idTokenTTL),
+			Nonce:            code.Nonce,
+			AuthTime:         code.AuthTime.Unix(),
+			Email:            user.Email,
+			Name:             strings.TrimSpace(user.Firstname + " " + user.Lastname),
+			GivenName:        user.Firstname,
+			FamilyName:       user.Lastname,
+			Tenant:           auth.TenantFromContext(ctx),
+		})
+		if err != nil {
+			return TokenResponse{}, fmt.Errorf("failed to sign id token: %w", err)
+		}
+	}
+
+	s.log.DebugContext(ctx, "Exchanged authorization code", "client_id", client.ID, "sub", code.Subject)
+
+	return res, nil
+}
+
+// exchangeRefreshToken rotates the refresh token, the old one can not
+// be used again.
+func (s Service) exchangeRefreshToken(ctx context.Context, client entities.OIDCClient, req TokenRequest) (TokenResponse, error) {
+	token, err := s.refreshRepo.Take(ctx, HashSecret(req.RefreshToken))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if token.ClientID != client.ID || time.Now().After(token.ExpiresAt) || token.TenantID != auth.TenantFromContext(ctx) {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	scope := token.Scope
+	if req.Scope != "" {
+		for _, sc := range strings.Fields(req.Scope) {
+			if !hasScope(token.Scope, sc) {
+				return TokenResponse{}, ErrInvalidScope
+			}
+		}
+		scope = req.Scope
+	}
+
+	s.log.DebugContext(ctx, "Exchanged refresh token", "client_id", client.ID, "sub", token.Subject)
+
+	return s.issueTokens(ctx, client, token.Subject, token.Email, scope, token.AuthTime)
+}
+
+func (s Service) clientCredentials(ctx context.Context, client entities.OIDCClient, req TokenRequest) (TokenResponse, error) {
+	if client.Public {
+		return TokenResponse{}, ErrUnauthorizedClient
+	}
+
+	if err := allowedScope(client, req.Scope); err != nil {
+		return TokenResponse{}, err
+	}
+
+	accessToken, err := s.signer.Sign(AccessTokenClaims{
+		RegisteredClaims: s.registeredClaims(client.ID, client.ID, s.accessTokenTTL),
+		ClientID:         client.ID,
+		Scope:            req.Scope,
+	})
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	s.log.DebugContext(ctx, "Issued client credentials token", "client_id", client.ID)
+
+	return TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.accessTokenTTL.Seconds()),
+		Scope:       req.Scope,
+	}, nil
+}
+
+func (s Service) issueTokens(ctx context.Context, client entities.OIDCClient, subject, email, scope string, authTime time.Time) (TokenResponse, error) {
+	accessToken, err := s.signer.Sign(AccessTokenClaims{
+		RegisteredClaims: s.registeredClaims(subject, client.ID, s.accessTokenTTL),
+		ClientID:         client.ID,
+		Scope:            scope,
+		Email:            email,
+		Tenant:           auth.TenantFromContext(ctx),
+	})
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	res := TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.accessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+
+	if hasScope(scope, ScopeOfflineAccess) && slices.Contains(client.GrantTypes, GrantRefreshToken) {
+		refreshToken, err := randomToken(32)
+		if err != nil {
+			return TokenResponse{}, fmt.Errorf("failed to generate refresh token: %w", err)
+		}
+
+		err = s.refreshRepo.Create(ctx, entities.OIDCRefreshToken{
+			TokenHash: HashSecret(refreshToken),
+			ClientID:  client.ID,
+			Subject:   subject,
+			Email:     email,
+			TenantID:  auth.TenantFromContext(ctx),
+			Scope:     scope,
+			AuthTime:  authTime,
+			ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+		})
+		if err != nil {
+			return TokenResponse{}, fmt.Errorf("failed to save refresh token: %w", err)
+		}
+
+		res.RefreshToken = refreshToken
+	}
+
+	return res, nil
+}
+
+func (s Service) registeredClaims(subject, audience string, ttl time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Issuer:    s.issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        uuid.New().String(),
+	}
+}
+
+func (s Service) UserInfo(ctx context.Context, accessToken string) (UserInfo, error) {
+	var claims AccessTokenClaims
+	if err := s.signer.Parse(accessToken, &claims, jwt.WithIssuer(s.issuer), jwt.WithExpirationRequired()); err != nil {
+		return UserInfo{}, ErrInvalidToken
+	}
+
+	if claims.Email == "" || !hasScope(claims.Scope, ScopeOpenID) || claims.Tenant != auth.TenantFromContext(ctx) {
+		return UserInfo{}, ErrInvalidToken
+	}
+
+	user, err := s.usersRepo.GetByEmail(ctx, claims.Email)
+	if err != nil {
+		if errors.Is(err, auth.ErrEmailNotFound) {
+			return UserInfo{}, ErrInvalidToken
+		}
+		return UserInfo{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return UserInfo{
+		Subject:    claims.Subject,
+		Email:      user.Email,
+		Name:       strings.TrimSpace(user.Firstname + " " + user.Lastname),
+		GivenName:  user.Firstname,
+		FamilyName: user.Lastname,
+		Tenant:     user.TenantID,
+	}, nil
+}
+
+// EndSession revokes the refresh tokens the client holds for the user
+// and returns where the user agent should be sent next, if anywhere.
+func (s Service) EndSession(ctx context.Context, req EndSessionRequest) (string, error) {
+	clientID := req.ClientID
+
+	if req.IDTokenHint != "" {
+		var claims IDTokenClaims
+		// an expired id token is still a valid hint
+		err := s.signer.Parse(req.IDTokenHint, &claims, jwt.WithIssuer(s.issuer), jwt.WithoutClaimsValidation())
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid id_token_hint", ErrInvalidRequest)
+		}
+
+		if len(claims.Audience) == 0 || (clientID != "" && !slices.Contains(claims.Audience, clientID)) {
+			return "", fmt.Errorf("%w: id_token_hint was issued to another client", ErrInvalidRequest)
+		}
+		clientID = claims.Audience[0]
+
+		if err := s.refreshRepo.DeleteBySubject(ctx, claims.Subject, clientID); err != nil {
+			return "", fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+
+		s.log.DebugContext(ctx, "Ended session", "client_id", clientID, "sub", claims.Subject)
+	}
+
+	if req.PostLogoutRedirectURI == "" {
+		return "", nil
+	}
+
+	if clientID == "" {
+		return "", fmt.Errorf("%w: client_id or id_token_hint is required", ErrInvalidRequest)
+	}
+
+	client, err := s.clientsRepo.GetByID(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	if !slices.Contains(client.PostLogoutRedirectURIs, req.PostLogoutRedirectURI) {
+		return "", fmt.Errorf("%w: post_logout_redirect_uri is not registered", ErrInvalidRequest)
+	}
+
+	if req.State == "" {
+		return req.PostLogoutRedirectURI, nil
+	}
+
+	return appendQuery(req.PostLogoutRedirectURI, url.Values{"state": {req.State}}), nil
+}
@@ -0,0 +1,270 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizeCode runs the authorize step for user@example.com and
+// returns the code from the redirect.
+func authorizeCode(t *testing.T, s Service, req AuthorizeRequest) string {
+	t.Helper()
+
+	redirect, err := s.AuthorizeWithToken(context.Background(), req, "access")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("state") != req.State {
+		t.Errorf("state %q, want %q", u.Query().Get("state"), req.State)
+	}
+	return u.Query().Get("code")
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		want      bool
+	}{
+		{"s256", s256(testVerifier), "S256", testVerifier, true},
+		{"s256 wrong verifier", s256(testVerifier), "S256", "wrong", false},
+		{"s256 challenge as verifier", s256(testVerifier), "S256", s256(testVerifier), false},
+		{"plain", testVerifier, "plain", testVerifier, true},
+		{"plain wrong verifier", testVerifier, "plain", "wrong", false},
+		{"plain hashed verifier", s256(testVerifier), "plain", testVerifier, false},
+		{"missing verifier", s256(testVerifier), "S256", "", false},
+		{"no pkce", "", "", "", true},
+		{"verifier without challenge", "", "", testVerifier, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.challenge, tt.method, tt.verifier); got != tt.want {
+				t.Errorf("verifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequest(t *testing.T) {
+	valid := AuthorizeRequest{ResponseType: "code", ClientID: "app", RedirectURI: testRedirectURI, Scope: "openid"}
+
+	tests := []struct {
+		name   string
+		change func(*AuthorizeRequest)
+		want   error
+	}{
+		{"valid", func(r *AuthorizeRequest) {}, nil},
+		{"unknown client", func(r *AuthorizeRequest) { r.ClientID = "unknown" }, ErrInvalidClient},
+		{"unregistered redirect uri", func(r *AuthorizeRequest) { r.RedirectURI = "https://evil.example.com/callback" }, ErrInvalidRequest},
+		{"token response type", func(r *AuthorizeRequest) { r.ResponseType = "token" }, ErrUnsupportedResponseType},
+		{"public client without pkce", func(r *AuthorizeRequest) { r.ClientID = "spa" }, ErrInvalidRequest},
+		{"public client with pkce", func(r *AuthorizeRequest) {
+			r.ClientID, r.CodeChallenge, r.CodeChallengeMethod = "spa", s256(testVerifier), "S256"
+		}, nil},
+		{"unknown challenge method", func(r *AuthorizeRequest) {
+			r.CodeChallenge, r.CodeChallengeMethod = s256(testVerifier), "S512"
+		}, ErrInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t)
+			req := valid
+			tt.change(&req)
+
+			_, err := s.AuthorizeWithToken(context.Background(), req, "access")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	authorize := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "spa",
+		RedirectURI:         testRedirectURI,
+		Scope:               "openid",
+		State:               "xyz",
+		CodeChallenge:       s256(testVerifier),
+		CodeChallengeMethod: "S256",
+	}
+	valid := TokenRequest{GrantType: GrantAuthorizationCode, ClientID: "spa", RedirectURI: testRedirectURI, CodeVerifier: testVerifier}
+
+	tests := []struct {
+		name   string
+		change func(*TokenRequest)
+		want   error
+	}{
+		{"valid", func(r *TokenRequest) {}, nil},
+		{"wrong verifier", func(r *TokenRequest) { r.CodeVerifier = "wrong" }, ErrInvalidGrant},
+		{"missing verifier", func(r *TokenRequest) { r.CodeVerifier = "" }, ErrInvalidGrant},
+		{"other redirect uri", func(r *TokenRequest) { r.RedirectURI = "https://app.example.com/other" }, ErrInvalidGrant},
+		{"other client", func(r *TokenRequest) { r.ClientID, r.ClientSecret = "app", testSecret }, ErrInvalidGrant},
+		{"wrong client secret", func(r *TokenRequest) { r.ClientID, r.ClientSecret = "app", "wrong" }, ErrInvalidClient},
+		{"unknown code", func(r *TokenRequest) { r.Code = "unknown" }, ErrInvalidGrant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t)
+			req := valid
+			req.Code = authorizeCode(t, s, authorize)
+			tt.change(&req)
+
+			res, err := s.Token(context.Background(), req)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error %v, want %v", err, tt.want)
+			}
+			if err == nil && (res.AccessToken == "" || res.IDToken == "") {
+				t.Errorf("response %+v has no access or id token", res)
+			}
+		})
+	}
+}
+
+func TestCodeIsSingleUse(t *testing.T) {
+	s, _ := newTestService(t)
+	code := authorizeCode(t, s, AuthorizeRequest{ResponseType: "code", ClientID: "app", RedirectURI: testRedirectURI, Scope: "openid"})
+	req := TokenRequest{GrantType: GrantAuthorizationCode, ClientID: "app", ClientSecret: testSecret, RedirectURI: testRedirectURI, Code: code}
+
+	if _, err := s.Token(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Token(context.Background(), req); !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("second exchange: error %v, want %v", err, ErrInvalidGrant)
+	}
+}
+
+func TestCodeFailedExchangeIsNotRetried(t *testing.T) {
+	s, _ := newTestService(t)
+	code := authorizeCode(t, s, AuthorizeRequest{
+		ResponseType: "code", ClientID: "spa", RedirectURI: testRedirectURI, Scope: "openid",
+		CodeChallenge: s256(testVerifier), CodeChallengeMethod: "S256",
+	})
+	req := TokenRequest{GrantType: GrantAuthorizationCode, ClientID: "spa", RedirectURI: testRedirectURI, Code: code}
+
+	// guessing the verifier burns the code
+	req.CodeVerifier = "wrong"
+	if _, err := s.Token(context.Background(), req); !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("error %v, want %v", err, ErrInvalidGrant)
+	}
+	req.CodeVerifier = testVerifier
+	if _, err := s.Token(context.Background(), req); !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("error %v, want %v", err, ErrInvalidGrant)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s, repos := newTestService(t)
+	ctx := context.Background()
+
+	code := authorizeCode(t, s, AuthorizeRequest{ResponseType: "code", ClientID: "app", RedirectURI: testRedirectURI, Scope: "openid offline_access"})
+	res, err := s.Token(ctx, TokenRequest{GrantType: GrantAuthorizationCode, ClientID: "app", ClientSecret: testSecret, RedirectURI: testRedirectURI, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RefreshToken == "" {
+		t.Fatal("offline_access issued no refresh token")
+	}
+
+	refresh := TokenRequest{GrantType: GrantRefreshToken, ClientID: "app", ClientSecret: testSecret, RefreshToken: res.RefreshToken}
+
+	rotated, err := s.Token(ctx, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == res.RefreshToken {
+		t.Fatalf("refresh token %q was not rotated", rotated.RefreshToken)
+	}
+	if len(repos.refreshTokens.tokens) != 1 {
+		t.Errorf("%d refresh tokens stored, want the rotated one", len(repos.refreshTokens.tokens))
+	}
+
+	if _, err := s.Token(ctx, refresh); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("old refresh token: error %v, want %v", err, ErrInvalidGrant)
+	}
+
+	refresh.RefreshToken = rotated.RefreshToken
+	refresh.Scope = "openid email"
+	if _, err := s.Token(ctx, refresh); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("wider scope: error %v, want %v", err, ErrInvalidScope)
+	}
+}
+
+func TestRefreshTokenNeedsOfflineAccess(t *testing.T) {
+	s, _ := newTestService(t)
+
+	code := authorizeCode(t, s, AuthorizeRequest{ResponseType: "code", ClientID: "app", RedirectURI: testRedirectURI, Scope: "openid"})
+	res, err := s.Token(context.Background(), TokenRequest{GrantType: GrantAuthorizationCode, ClientID: "app", ClientSecret: testSecret, RedirectURI: testRedirectURI, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RefreshToken != "" {
+		t.Error("refresh token issued without offline_access")
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	token := func(scope string) string {
+		t.Helper()
+
+		code := authorizeCode(t, s, AuthorizeRequest{ResponseType: "code", ClientID: "app", RedirectURI: testRedirectURI, Scope: scope})
+		res, err := s.Token(ctx, TokenRequest{GrantType: GrantAuthorizationCode, ClientID: "app", ClientSecret: testSecret, RedirectURI: testRedirectURI, Code: code})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.AccessToken
+	}
+
+	info, err := s.UserInfo(ctx, token("openid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UserInfo{Subject: "user-1", Email: "user@example.com", Name: "Jane Doe", GivenName: "Jane", FamilyName: "Doe"}
+	if info != want {
+		t.Errorf("userinfo %+v, want %+v", info, want)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"without openid scope", token("email")},
+		{"garbage", "garbage"},
+	}
+	for _, tt := range tests {
+		if _, err := s.UserInfo(ctx, tt.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, ErrInvalidToken)
+		}
+	}
+
+	// tokens of another signer
+	other, _ := newTestService(t)
+	if _, err := other.UserInfo(ctx, token("openid")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of another signer: error %v, want %v", err, ErrInvalidToken)
+	}
+}
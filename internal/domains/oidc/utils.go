@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func verifyPKCE(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(verifier)) == 1
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + params.Encode()
+}
+
+// ErrorCode maps an error to one of the codes clients understand.
+func ErrorCode(err error) string {
+	for _, e := range []error{
+		ErrInvalidRequest,
+		ErrInvalidClient,
+		ErrInvalidGrant,
+		ErrInvalidScope,
+		ErrInvalidToken,
+		ErrUnauthorizedClient,
+		ErrUnsupportedGrantType,
+		ErrUnsupportedResponseType,
+		ErrAccessDenied,
+		ErrLoginRequired,
+	} {
+		if errors.Is(err, e) {
+			return e.Error()
+		}
+	}
+	return "server_error"
+}
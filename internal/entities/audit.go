@@ -0,0 +1,16 @@
+package entities
+
+import "time"
+
+// AuditEvent records a security relevant action. Unlike domain events
+// it is kept for investigation and never delivered anywhere.
+type AuditEvent struct {
+	ID         string         `json:"id" bson:"_id"`
+	Type       string         `json:"type" bson:"type"`
+	UserID     string         `json:"user_id" bson:"user_id"`
+	TenantID   string         `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	IP         string         `json:"ip" bson:"ip"`
+	UserAgent  string         `json:"user_agent" bson:"user_agent"`
+	Data       map[string]any `json:"data,omitempty" bson:"data,omitempty"`
+	OccurredAt time.Time      `json:"occurred_at" bson:"occurred_at"`
+}
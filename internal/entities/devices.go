@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+// KnownDevice is a device the user has logged in from before, it
+// outlives the sessions on it. Devices are told apart by a hash of the
+// user agent. Country, City and the coordinates come from the geoip
+// database and are empty without one.
+type KnownDevice struct {
+	ID          string    `json:"id" bson:"_id"`
+	UserID      string    `json:"user_id" bson:"user_id"`
+	TenantID    string    `json:"-" bson:"tenant_id,omitempty"`
+	Fingerprint string    `json:"-" bson:"fingerprint"`
+	DeviceName  string    `json:"device_name" bson:"device_name"`
+	UserAgent   string    `json:"user_agent" bson:"user_agent"`
+	IP          string    `json:"ip" bson:"ip"`
+	Country     string    `json:"country,omitempty" bson:"country,omitempty"`
+	City        string    `json:"city,omitempty" bson:"city,omitempty"`
+	Latitude    float64   `json:"latitude,omitempty" bson:"latitude,omitempty"`
+	Longitude   float64   `json:"longitude,omitempty" bson:"longitude,omitempty"`
+	FirstSeenAt time.Time `json:"first_seen_at" bson:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" bson:"last_seen_at"`
+}
@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+type Event struct {
+	ID            string         `json:"id" bson:"_id"`
+	Type          string         `json:"type" bson:"type"`
+	Payload       map[string]any `json:"payload" bson:"payload"`
+	OccurredAt    time.Time      `json:"occurred_at" bson:"occurred_at"`
+	Attempts      int            `json:"-" bson:"attempts"`
+	NextAttemptAt time.Time      `json:"-" bson:"next_attempt_at"`
+	LastError     string         `json:"-" bson:"last_error,omitempty"`
+	PublishedAt   *time.Time     `json:"-" bson:"published_at"`
+}
@@ -0,0 +1,20 @@
+package entities
+
+import "time"
+
+// Impersonation is support staff acting as a user. Its token is only
+// valid until it expires or the impersonation is ended.
+type Impersonation struct {
+	ID         string     `json:"id" bson:"_id"`
+	TenantID   string     `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	ActorID    string     `json:"actor_id" bson:"actor_id"`
+	ActorEmail string     `json:"actor_email" bson:"actor_email"`
+	UserID     string     `json:"user_id" bson:"user_id"`
+	UserEmail  string     `json:"user_email" bson:"user_email"`
+	Reason     string     `json:"reason" bson:"reason"`
+	ReadOnly   bool       `json:"read_only" bson:"read_only"`
+	StartedAt  time.Time  `json:"started_at" bson:"started_at"`
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty" bson:"ended_at,omitempty"`
+	EndedBy    string     `json:"ended_by,omitempty" bson:"ended_by,omitempty"`
+}
@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+// MagicLink is a single use login token sent by email. Only the hash
+// of the token is stored.
+type MagicLink struct {
+	TokenHash string     `json:"-" bson:"_id"`
+	Email     string     `json:"email" bson:"email"`
+	TenantID  string     `json:"-" bson:"tenant_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" bson:"used_at"`
+}
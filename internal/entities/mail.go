@@ -0,0 +1,21 @@
+package entities
+
+import "time"
+
+// Mail is a rendered email waiting in the send queue. The bodies are
+// dropped once it is sent, they can carry links with tokens.
+type Mail struct {
+	ID            string     `json:"id" bson:"_id"`
+	Template      string     `json:"template" bson:"template"`
+	Locale        string     `json:"locale" bson:"locale"`
+	From          string     `json:"from" bson:"from"`
+	To            string     `json:"to" bson:"to"`
+	Subject       string     `json:"subject" bson:"subject"`
+	Text          string     `json:"text,omitempty" bson:"text,omitempty"`
+	HTML          string     `json:"html,omitempty" bson:"html,omitempty"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	Attempts      int        `json:"-" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"-" bson:"next_attempt_at"`
+	LastError     string     `json:"-" bson:"last_error,omitempty"`
+	SentAt        *time.Time `json:"-" bson:"sent_at"`
+}
@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+// OAuthState is stored between the redirect to an external identity
+// provider and the callback from it.
+type OAuthState struct {
+	State        string    `json:"state" bson:"_id"`
+	Provider     string    `json:"provider" bson:"provider"`
+	TenantID     string    `json:"tenant_id" bson:"tenant_id,omitempty"`
+	Nonce        string    `json:"nonce" bson:"nonce"`
+	CodeVerifier string    `json:"code_verifier" bson:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at" bson:"expires_at"`
+}
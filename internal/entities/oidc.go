@@ -0,0 +1,44 @@
+package entities
+
+import "time"
+
+// OIDCClient is an application allowed to use the service as its
+// OpenID Connect provider. Public clients have no secret and have to
+// use PKCE.
+type OIDCClient struct {
+	ID                     string    `json:"client_id" bson:"_id"`
+	Name                   string    `json:"name" bson:"name"`
+	SecretHash             string    `json:"-" bson:"secret_hash"`
+	Public                 bool      `json:"public" bson:"public"`
+	RedirectURIs           []string  `json:"redirect_uris" bson:"redirect_uris"`
+	PostLogoutRedirectURIs []string  `json:"post_logout_redirect_uris" bson:"post_logout_redirect_uris"`
+	GrantTypes             []string  `json:"grant_types" bson:"grant_types"`
+	Scopes                 []string  `json:"scopes" bson:"scopes"`
+	CreatedAt              time.Time `json:"created_at" bson:"created_at"`
+}
+
+type OIDCAuthorizationCode struct {
+	CodeHash            string    `bson:"_id"`
+	ClientID            string    `bson:"client_id"`
+	RedirectURI         string    `bson:"redirect_uri"`
+	Subject             string    `bson:"subject"`
+	Email               string    `bson:"email"`
+	TenantID            string    `bson:"tenant_id,omitempty"`
+	Scope               string    `bson:"scope"`
+	Nonce               string    `bson:"nonce"`
+	CodeChallenge       string    `bson:"code_challenge"`
+	CodeChallengeMethod string    `bson:"code_challenge_method"`
+	AuthTime            time.Time `bson:"auth_time"`
+	ExpiresAt           time.Time `bson:"expires_at"`
+}
+
+type OIDCRefreshToken struct {
+	TokenHash string    `bson:"_id"`
+	ClientID  string    `bson:"client_id"`
+	Subject   string    `bson:"subject"`
+	Email     string    `bson:"email"`
+	TenantID  string    `bson:"tenant_id,omitempty"`
+	Scope     string    `bson:"scope"`
+	AuthTime  time.Time `bson:"auth_time"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
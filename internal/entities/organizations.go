@@ -0,0 +1,47 @@
+package entities
+
+import "time"
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a customer account users belong to. Roles within it
+// are kept on the membership, not in fusionauth.
+type Organization struct {
+	ID        string    `json:"id" bson:"_id"`
+	TenantID  string    `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Name      string    `json:"name" bson:"name"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Membership puts a user in an organization. Its id is the organization
+// id and the user id, a user can be a member once.
+type Membership struct {
+	ID             string    `json:"-" bson:"_id"`
+	OrganizationID string    `json:"organization_id" bson:"organization_id"`
+	UserID         string    `json:"user_id" bson:"user_id"`
+	Email          string    `json:"email" bson:"email"`
+	Roles          []string  `json:"roles" bson:"roles"`
+	InvitedBy      string    `json:"invited_by,omitempty" bson:"invited_by,omitempty"`
+	JoinedAt       time.Time `json:"joined_at" bson:"joined_at"`
+}
+
+// Invitation asks someone to join an organization. The link sent by
+// email carries a token, only its hash is stored.
+type Invitation struct {
+	ID             string     `json:"id" bson:"_id"`
+	TokenHash      string     `json:"-" bson:"token_hash"`
+	OrganizationID string     `json:"organization_id" bson:"organization_id"`
+	TenantID       string     `json:"-" bson:"tenant_id,omitempty"`
+	Email          string     `json:"email" bson:"email"`
+	Roles          []string   `json:"roles" bson:"roles"`
+	InvitedBy      string     `json:"invited_by" bson:"invited_by"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at" bson:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+	AcceptedBy     string     `json:"accepted_by,omitempty" bson:"accepted_by,omitempty"`
+}
@@ -0,0 +1,29 @@
+package entities
+
+import "time"
+
+// Passkey is a WebAuthn credential registered by a user.
+type Passkey struct {
+	ID              string     `json:"id" bson:"_id"`
+	UserID          string     `json:"-" bson:"user_id"`
+	Name            string     `json:"name" bson:"name"`
+	PublicKey       []byte     `json:"-" bson:"public_key"`
+	AttestationType string     `json:"-" bson:"attestation_type"`
+	Transports      []string   `json:"transports" bson:"transports"`
+	AAGUID          []byte     `json:"-" bson:"aaguid"`
+	SignCount       uint32     `json:"-" bson:"sign_count"`
+	BackupEligible  bool       `json:"backup_eligible" bson:"backup_eligible"`
+	BackupState     bool       `json:"backup_state" bson:"backup_state"`
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at" bson:"last_used_at"`
+}
+
+// WebAuthnChallenge keeps the state of a registration or login
+// ceremony between its begin and finish requests.
+type WebAuthnChallenge struct {
+	ID          string    `bson:"_id"`
+	Kind        string    `bson:"kind"`
+	UserID      string    `bson:"user_id"`
+	SessionData []byte    `bson:"session_data"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
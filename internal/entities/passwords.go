@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// PasswordHistory is a bcrypt hash of a password the user had, kept to
+// stop them from going back to it.
+type PasswordHistory struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	Hash      []byte    `json:"-" bson:"hash"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,46 @@
+package entities
+
+import "time"
+
+const (
+	DataRequestPending   = "pending"
+	DataRequestCompleted = "completed"
+	DataRequestFailed    = "failed"
+	DataRequestCanceled  = "canceled"
+)
+
+// DataExport is a user's request for a copy of everything stored about
+// them. The archive is compiled in the background.
+type DataExport struct {
+	ID          string     `json:"id" bson:"_id"`
+	UserID      string     `json:"-" bson:"user_id"`
+	TenantID    string     `json:"-" bson:"tenant_id,omitempty"`
+	Email       string     `json:"-" bson:"email"`
+	Status      string     `json:"status" bson:"status"`
+	Archive     []byte     `json:"-" bson:"archive,omitempty"`
+	Attempts    int        `json:"-" bson:"attempts"`
+	LastError   string     `json:"-" bson:"last_error,omitempty"`
+	RequestedAt time.Time  `json:"requested_at" bson:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at" bson:"expires_at"`
+}
+
+// ErasureRecord tracks the erasure of a user's data. Once completed it
+// no longer holds anything that identifies the user, only the hash of
+// their id, what was removed from each store and a digest over both.
+type ErasureRecord struct {
+	ID          string         `json:"id" bson:"_id"`
+	SubjectHash string         `json:"subject_hash" bson:"subject_hash"`
+	Reason      string         `json:"reason" bson:"reason"`
+	Status      string         `json:"status" bson:"status"`
+	UserID      string         `json:"-" bson:"user_id,omitempty"`
+	TenantID    string         `json:"-" bson:"tenant_id,omitempty"`
+	Email       string         `json:"-" bson:"email,omitempty"`
+	Stores      map[string]int `json:"stores,omitempty" bson:"stores,omitempty"`
+	Attempts    int            `json:"-" bson:"attempts"`
+	LastError   string         `json:"-" bson:"last_error,omitempty"`
+	RequestedAt time.Time      `json:"requested_at" bson:"requested_at"`
+	ScheduledAt *time.Time     `json:"scheduled_at,omitempty" bson:"scheduled_at,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	Digest      string         `json:"digest,omitempty" bson:"digest,omitempty"`
+}
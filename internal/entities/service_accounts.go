@@ -0,0 +1,34 @@
+package entities
+
+import "time"
+
+// ServiceAccount is a machine identity. It authenticates with API keys
+// instead of a password, its scopes bound the scopes of its keys.
+type ServiceAccount struct {
+	ID          string    `json:"id" bson:"_id"`
+	TenantID    string    `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Name        string    `json:"name" bson:"name"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Scopes      []string  `json:"scopes" bson:"scopes"`
+	CreatedBy   string    `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
+
+// APIKey belongs to a service account. The key handed out is the
+// prefix followed by a secret, only the hash of the secret is stored.
+type APIKey struct {
+	ID               string     `json:"id" bson:"_id"`
+	ServiceAccountID string     `json:"service_account_id" bson:"service_account_id"`
+	TenantID         string     `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Name             string     `json:"name" bson:"name"`
+	Prefix           string     `json:"prefix" bson:"prefix"`
+	SecretHash       string     `json:"-" bson:"secret_hash"`
+	Scopes           []string   `json:"scopes" bson:"scopes"`
+	CreatedBy        string     `json:"created_by" bson:"created_by"`
+	CreatedAt        time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt        time.Time  `json:"expires_at" bson:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	LastUsedIP       string     `json:"last_used_ip,omitempty" bson:"last_used_ip,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	ReplacedBy       string     `json:"replaced_by,omitempty" bson:"replaced_by,omitempty"`
+}
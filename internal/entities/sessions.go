@@ -0,0 +1,39 @@
+package entities
+
+import "time"
+
+// UserSession is a device the user is logged in on and the family of
+// refresh tokens issued to it. Clients get a token of our own that is
+// rotated on every refresh, only its hash is stored. The FusionAuth
+// refresh token behind it never leaves the server and is stored
+// encrypted. AccessTokenHash is the hash of the access token issued
+// last, it links access tokens to the organization the session
+// switched to.
+type UserSession struct {
+	ID                   string    `json:"id" bson:"_id"`
+	UserID               string    `json:"user_id" bson:"user_id"`
+	TenantID             string    `json:"-" bson:"tenant_id,omitempty"`
+	RefreshTokenHash     string    `json:"-" bson:"refresh_token_hash"`
+	Generation           int       `json:"-" bson:"generation"`
+	ProviderRefreshToken string    `json:"-" bson:"provider_refresh_token"`
+	ProviderTokenID      string    `json:"-" bson:"provider_token_id"`
+	AccessTokenHash      string    `json:"-" bson:"access_token_hash,omitempty"`
+	ActiveOrganizationID string    `json:"active_organization_id,omitempty" bson:"active_organization_id,omitempty"`
+	DeviceName           string    `json:"device_name" bson:"device_name"`
+	UserAgent            string    `json:"user_agent" bson:"user_agent"`
+	IP                   string    `json:"ip" bson:"ip"`
+	CreatedAt            time.Time `json:"created_at" bson:"created_at"`
+	LastUsedAt           time.Time `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt            time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// RotatedRefreshToken is a refresh token that has already been
+// exchanged. Seeing it again means it was stolen, or the client that
+// rotated it was.
+type RotatedRefreshToken struct {
+	TokenHash string    `json:"-" bson:"_id"`
+	SessionID string    `json:"session_id" bson:"session_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	RotatedAt time.Time `json:"rotated_at" bson:"rotated_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
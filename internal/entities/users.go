@@ -3,10 +3,51 @@ package entities
 import "time"
 
 type User struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Firstname string    `json:"firstname"`
-	Lastname  string    `json:"lastname"`
+	ID         string         `json:"id"`
+	ProviderID string         `json:"provider_id"`
+	Email      string         `json:"email"`
+	Firstname  string         `json:"firstname"`
+	Lastname   string         `json:"lastname"`
+	Identities []UserIdentity `json:"identities,omitempty"`
+	// TenantID is empty for users of the default tenant.
+	TenantID string `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	// Roles come from the user's fusionauth registration and are not
+	// stored.
+	Roles []string `json:"roles,omitempty" bson:"-"`
+	// ActiveOrganizationID is the organization the session of the
+	// access token switched to.
+	ActiveOrganizationID string `json:"active_organization_id,omitempty" bson:"-"`
+	// ImpersonatorID is the admin the token was issued to when support
+	// staff impersonates the user, ImpersonationID the impersonation.
+	ImpersonatorID        string `json:"impersonator_id,omitempty" bson:"-"`
+	ImpersonationID       string `json:"impersonation_id,omitempty" bson:"-"`
+	ImpersonationReadOnly bool   `json:"impersonation_read_only,omitempty" bson:"-"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// DeletionScheduledAt is set when the user deleted their account,
+	// the account is removed for good once it has passed.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// EmailChange is a pending change of the user's email. It is applied
+// once the new address is confirmed, only the hash of the token sent
+// there is stored.
+type EmailChange struct {
+	TokenHash string    `json:"-" bson:"_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	TenantID  string    `json:"-" bson:"tenant_id,omitempty"`
+	Email     string    `json:"email" bson:"email"`
+	NewEmail  string    `json:"new_email" bson:"new_email"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// UserIdentity links a user to an account at an external identity
+// provider such as Google or GitHub.
+type UserIdentity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	LinkedAt time.Time `json:"linked_at"`
 }
@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type AuditRepository struct {
+	conn *mongo.Client
+}
+
+func (r AuditRepository) Add(ctx context.Context, event entities.AuditEvent) error {
+	_, err := r.conn.Database("poc-auth").Collection("audit_log").InsertOne(ctx, event)
+	return err
+}
+
+func (r AuditRepository) ListByUser(ctx context.Context, userID string) ([]entities.AuditEvent, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("audit_log").Find(ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "occurred_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []entities.AuditEvent{}
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Pseudonymize keeps the user's audit events but replaces their id with
+// the pseudonym and drops the client details and data.
+func (r AuditRepository) Pseudonymize(ctx context.Context, userID, pseudonym string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("audit_log").UpdateMany(ctx,
+		bson.M{"user_id": userID},
+		bson.M{
+			"$set":   bson.M{"user_id": pseudonym},
+			"$unset": bson.M{"ip": "", "user_agent": "", "data": ""},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type KnownDevicesRepository struct {
+	conn *mongo.Client
+}
+
+// ListByUser returns the user's devices, the one used last first.
+func (r KnownDevicesRepository) ListByUser(ctx context.Context, userID string) ([]entities.KnownDevice, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("known_devices").Find(ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.M{"last_seen_at": -1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []entities.KnownDevice
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// Save records a login from the device. A device the user already has
+// keeps its id and first_seen_at, everything else is replaced.
+func (r KnownDevicesRepository) Save(ctx context.Context, device entities.KnownDevice) error {
+	_, err := r.conn.Database("poc-auth").Collection("known_devices").UpdateOne(ctx,
+		bson.M{"user_id": device.UserID, "fingerprint": device.Fingerprint},
+		bson.M{
+			"$set": bson.M{
+				"tenant_id":    device.TenantID,
+				"device_name":  device.DeviceName,
+				"user_agent":   device.UserAgent,
+				"ip":           device.IP,
+				"country":      device.Country,
+				"city":         device.City,
+				"latitude":     device.Latitude,
+				"longitude":    device.Longitude,
+				"last_seen_at": device.LastSeenAt,
+			},
+			"$setOnInsert": bson.M{
+				"_id":           device.ID,
+				"first_seen_at": device.FirstSeenAt,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r KnownDevicesRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("known_devices").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(res.DeletedCount), nil
+}
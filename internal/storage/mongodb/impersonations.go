@@ -0,0 +1,93 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type ImpersonationsRepository struct {
+	conn *mongo.Client
+}
+
+func (r ImpersonationsRepository) Create(ctx context.Context, impersonation entities.Impersonation) error {
+	_, err := r.conn.Database("poc-auth").Collection("impersonations").InsertOne(ctx, impersonation)
+	return err
+}
+
+func (r ImpersonationsRepository) Get(ctx context.Context, id string) (entities.Impersonation, error) {
+	var impersonation entities.Impersonation
+
+	err := r.conn.Database("poc-auth").Collection("impersonations").FindOne(ctx, tenantFilter(ctx, bson.M{"_id": id})).Decode(&impersonation)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.Impersonation{}, auth.ErrImpersonationNotFound
+		}
+		return entities.Impersonation{}, err
+	}
+
+	return impersonation, nil
+}
+
+// ListActive lists the impersonations that were neither ended nor
+// expired at now, newest first.
+func (r ImpersonationsRepository) ListActive(ctx context.Context, now time.Time) ([]entities.Impersonation, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("impersonations").Find(ctx,
+		tenantFilter(ctx, bson.M{"ended_at": bson.M{"$exists": false}, "expires_at": bson.M{"$gt": now}}),
+		options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonations := []entities.Impersonation{}
+	if err := cur.All(ctx, &impersonations); err != nil {
+		return nil, err
+	}
+
+	return impersonations, nil
+}
+
+// End ends an impersonation once, ending it again does nothing and
+// returns false.
+func (r ImpersonationsRepository) End(ctx context.Context, id, endedBy string, endedAt time.Time) (bool, error) {
+	coll := r.conn.Database("poc-auth").Collection("impersonations")
+
+	res, err := coll.UpdateOne(ctx,
+		tenantFilter(ctx, bson.M{"_id": id, "ended_at": bson.M{"$exists": false}}),
+		bson.M{"$set": bson.M{"ended_at": endedAt, "ended_by": endedBy}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if res.MatchedCount == 0 {
+		n, err := coll.CountDocuments(ctx, tenantFilter(ctx, bson.M{"_id": id}))
+		if err != nil {
+			return false, err
+		}
+		if n == 0 {
+			return false, auth.ErrImpersonationNotFound
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// DeleteByUser deletes the impersonations of the user, the audit log
+// keeps that they happened.
+func (r ImpersonationsRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("impersonations").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
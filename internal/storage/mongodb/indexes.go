@@ -0,0 +1,62 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// expiringCollections hold documents that are useless once their
+// expires_at has passed, mongodb removes them about a minute later.
+// Checks against expires_at stay in place, the removal is not exact.
+var expiringCollections = []string{
+	"oauth_states",
+	"magic_links",
+	"email_changes",
+	"sessions",
+	"rotated_refresh_tokens",
+	"oidc_codes",
+	"oidc_refresh_tokens",
+	"webauthn_challenges",
+	"data_exports",
+}
+
+// EnsureIndexes creates the indexes the repositories rely on. Creating
+// an index that already exists is a no-op, so it runs on every start.
+func (r RepoCombiner) EnsureIndexes(ctx context.Context) error {
+	db := r.conn.Database("poc-auth")
+
+	// emails are unique per tenant, users of the default tenant have no
+	// tenant_id and share the null key
+	_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetName("tenant_id_email").SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create users index: %w", err)
+	}
+
+	// VerifyToken looks sessions up by the access token on every request
+	_, err = db.Collection("sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "access_token_hash", Value: 1}},
+		Options: options.Index().SetName("access_token_hash").SetSparse(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create sessions index: %w", err)
+	}
+
+	for _, name := range expiringCollections {
+		_, err := db.Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create %s ttl index: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type MagicLinksRepository struct {
+	conn *mongo.Client
+}
+
+func (r MagicLinksRepository) Create(ctx context.Context, link entities.MagicLink) error {
+	_, err := r.conn.Database("poc-auth").Collection("magic_links").InsertOne(ctx, link)
+	return err
+}
+
+func (r MagicLinksRepository) CountSince(ctx context.Context, email string, since time.Time) (int, error) {
+	n, err := r.conn.Database("poc-auth").Collection("magic_links").CountDocuments(ctx, bson.M{
+		"email":      email,
+		"created_at": bson.M{"$gte": since},
+	})
+	return int(n), err
+}
+
+// Consume marks an unused and unexpired link as used. The check and
+// the update happen in one operation, so a link can not be replayed
+// by concurrent requests.
+func (r MagicLinksRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (entities.MagicLink, error) {
+	var link entities.MagicLink
+
+	err := r.conn.Database("poc-auth").Collection("magic_links").FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":        tokenHash,
+			"used_at":    nil,
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&link)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.MagicLink{}, auth.ErrInvalidMagicLink
+		}
+		return entities.MagicLink{}, err
+	}
+
+	return link, nil
+}
+
+func (r MagicLinksRepository) DeleteByEmail(ctx context.Context, email string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("magic_links").DeleteMany(ctx, bson.M{"email": email})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
@@ -0,0 +1,78 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type MailQueueRepository struct {
+	conn *mongo.Client
+}
+
+func (r MailQueueRepository) Add(ctx context.Context, mail entities.Mail) error {
+	_, err := r.conn.Database("poc-auth").Collection("mail_queue").InsertOne(ctx, mail)
+	return err
+}
+
+func (r MailQueueRepository) ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.Mail, error) {
+	filter := bson.M{
+		"sent_at":         nil,
+		"next_attempt_at": bson.M{"$lte": now},
+		"attempts":        bson.M{"$lt": maxAttempts},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cur, err := r.conn.Database("poc-auth").Collection("mail_queue").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var mails []entities.Mail
+	if err := cur.All(ctx, &mails); err != nil {
+		return nil, err
+	}
+
+	return mails, nil
+}
+
+// MarkSent drops the bodies of the mail, only that it was sent is
+// kept.
+func (r MailQueueRepository) MarkSent(ctx context.Context, id string, sentAt time.Time) error {
+	_, err := r.conn.Database("poc-auth").Collection("mail_queue").UpdateByID(ctx, id, bson.M{
+		"$set":   bson.M{"sent_at": sentAt},
+		"$unset": bson.M{"text": "", "html": ""},
+	})
+	return err
+}
+
+func (r MailQueueRepository) MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, reason string) error {
+	_, err := r.conn.Database("poc-auth").Collection("mail_queue").UpdateByID(ctx, id, bson.M{
+		"$inc": bson.M{"attempts": 1},
+		"$set": bson.M{
+			"next_attempt_at": nextAttemptAt,
+			"last_error":      reason,
+		},
+	})
+	return err
+}
+
+// EraseUser deletes the mails sent to the user's email.
+func (r MailQueueRepository) EraseUser(ctx context.Context, userID, email, pseudonym string) (int, error) {
+	if email == "" {
+		return 0, nil
+	}
+
+	res, err := r.conn.Database("poc-auth").Collection("mail_queue").DeleteMany(ctx, bson.M{"to": email})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
@@ -0,0 +1,37 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type OAuthStatesRepository struct {
+	conn *mongo.Client
+}
+
+func (r OAuthStatesRepository) Create(ctx context.Context, state entities.OAuthState) error {
+	_, err := r.conn.Database("poc-auth").Collection("oauth_states").InsertOne(ctx, state)
+	return err
+}
+
+// Take returns the state and deletes it in one operation so that every
+// state can be used only once.
+func (r OAuthStatesRepository) Take(ctx context.Context, state string) (entities.OAuthState, error) {
+	var s entities.OAuthState
+
+	err := r.conn.Database("poc-auth").Collection("oauth_states").FindOneAndDelete(ctx, bson.M{"_id": state}).Decode(&s)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.OAuthState{}, auth.ErrInvalidOAuthState
+		}
+		return entities.OAuthState{}, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,114 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/oidc"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type OIDCClientsRepository struct {
+	conn *mongo.Client
+}
+
+func (r OIDCClientsRepository) GetByID(ctx context.Context, id string) (entities.OIDCClient, error) {
+	var client entities.OIDCClient
+
+	err := r.conn.Database("poc-auth").Collection("oidc_clients").FindOne(ctx, bson.M{"_id": id}).Decode(&client)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.OIDCClient{}, oidc.ErrInvalidClient
+		}
+		return entities.OIDCClient{}, err
+	}
+
+	return client, nil
+}
+
+type OIDCCodesRepository struct {
+	conn *mongo.Client
+}
+
+func (r OIDCCodesRepository) Create(ctx context.Context, code entities.OIDCAuthorizationCode) error {
+	_, err := r.conn.Database("poc-auth").Collection("oidc_codes").InsertOne(ctx, code)
+	return err
+}
+
+// Take deletes the code while reading it, codes are single use.
+func (r OIDCCodesRepository) Take(ctx context.Context, codeHash string) (entities.OIDCAuthorizationCode, error) {
+	var code entities.OIDCAuthorizationCode
+
+	err := r.conn.Database("poc-auth").Collection("oidc_codes").FindOneAndDelete(ctx, bson.M{"_id": codeHash}).Decode(&code)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.OIDCAuthorizationCode{}, oidc.ErrInvalidGrant
+		}
+		return entities.OIDCAuthorizationCode{}, err
+	}
+
+	return code, nil
+}
+
+type OIDCRefreshTokensRepository struct {
+	conn *mongo.Client
+}
+
+func (r OIDCRefreshTokensRepository) Create(ctx context.Context, token entities.OIDCRefreshToken) error {
+	_, err := r.conn.Database("poc-auth").Collection("oidc_refresh_tokens").InsertOne(ctx, token)
+	return err
+}
+
+func (r OIDCRefreshTokensRepository) Take(ctx context.Context, tokenHash string) (entities.OIDCRefreshToken, error) {
+	var token entities.OIDCRefreshToken
+
+	err := r.conn.Database("poc-auth").Collection("oidc_refresh_tokens").FindOneAndDelete(ctx, bson.M{"_id": tokenHash}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.OIDCRefreshToken{}, oidc.ErrInvalidGrant
+		}
+		return entities.OIDCRefreshToken{}, err
+	}
+
+	return token, nil
+}
+
+func (r OIDCRefreshTokensRepository) DeleteBySubject(ctx context.Context, subject, clientID string) error {
+	_, err := r.conn.Database("poc-auth").Collection("oidc_refresh_tokens").DeleteMany(ctx, bson.M{
+		"subject":   subject,
+		"client_id": clientID,
+	})
+	return err
+}
+
+// EraseUser deletes the user's unused authorization codes.
+func (r OIDCCodesRepository) EraseUser(ctx context.Context, userID, email, pseudonym string) (int, error) {
+	return deleteSubject(ctx, r.conn.Database("poc-auth").Collection("oidc_codes"), userID, email)
+}
+
+// EraseUser deletes the refresh tokens issued to clients for the user.
+func (r OIDCRefreshTokensRepository) EraseUser(ctx context.Context, userID, email, pseudonym string) (int, error) {
+	return deleteSubject(ctx, r.conn.Database("poc-auth").Collection("oidc_refresh_tokens"), userID, email)
+}
+
+func deleteSubject(ctx context.Context, coll *mongo.Collection, subject, email string) (int, error) {
+	var match bson.A
+	if subject != "" {
+		match = append(match, bson.M{"subject": subject})
+	}
+	if email != "" {
+		match = append(match, bson.M{"email": email})
+	}
+	if len(match) == 0 {
+		return 0, nil
+	}
+
+	res, err := coll.DeleteMany(ctx, bson.M{"$or": match})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
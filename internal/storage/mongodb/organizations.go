@@ -0,0 +1,266 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type OrganizationsRepository struct {
+	conn *mongo.Client
+}
+
+func (r OrganizationsRepository) Create(ctx context.Context, org entities.Organization) error {
+	_, err := r.conn.Database("poc-auth").Collection("organizations").InsertOne(ctx, org)
+	return err
+}
+
+func (r OrganizationsRepository) Get(ctx context.Context, id string) (entities.Organization, error) {
+	var org entities.Organization
+
+	err := r.conn.Database("poc-auth").Collection("organizations").FindOne(ctx, tenantFilter(ctx, bson.M{"_id": id})).Decode(&org)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.Organization{}, auth.ErrOrganizationNotFound
+		}
+		return entities.Organization{}, err
+	}
+
+	return org, nil
+}
+
+func (r OrganizationsRepository) List(ctx context.Context) ([]entities.Organization, error) {
+	return r.find(ctx, bson.M{})
+}
+
+func (r OrganizationsRepository) ListByIDs(ctx context.Context, ids []string) ([]entities.Organization, error) {
+	return r.find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (r OrganizationsRepository) find(ctx context.Context, filter bson.M) ([]entities.Organization, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("organizations").Find(ctx, tenantFilter(ctx, filter),
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := []entities.Organization{}
+	if err := cur.All(ctx, &orgs); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (r OrganizationsRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.conn.Database("poc-auth").Collection("organizations").DeleteOne(ctx, tenantFilter(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return auth.ErrOrganizationNotFound
+	}
+
+	return nil
+}
+
+type MembershipsRepository struct {
+	conn *mongo.Client
+}
+
+func (r MembershipsRepository) Create(ctx context.Context, membership entities.Membership) error {
+	membership.ID = membership.OrganizationID + ":" + membership.UserID
+
+	_, err := r.conn.Database("poc-auth").Collection("memberships").InsertOne(ctx, membership)
+	if mongo.IsDuplicateKeyError(err) {
+		return auth.ErrAlreadyOrganizationMember
+	}
+	return err
+}
+
+func (r MembershipsRepository) Get(ctx context.Context, orgID, userID string) (entities.Membership, error) {
+	var membership entities.Membership
+
+	err := r.conn.Database("poc-auth").Collection("memberships").FindOne(ctx, bson.M{"_id": orgID + ":" + userID}).Decode(&membership)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.Membership{}, auth.ErrMembershipNotFound
+		}
+		return entities.Membership{}, err
+	}
+
+	return membership, nil
+}
+
+func (r MembershipsRepository) ListByOrganization(ctx context.Context, orgID string) ([]entities.Membership, error) {
+	return r.find(ctx, bson.M{"organization_id": orgID})
+}
+
+func (r MembershipsRepository) ListByUser(ctx context.Context, userID string) ([]entities.Membership, error) {
+	return r.find(ctx, bson.M{"user_id": userID})
+}
+
+func (r MembershipsRepository) find(ctx context.Context, filter bson.M) ([]entities.Membership, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("memberships").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := []entities.Membership{}
+	if err := cur.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+func (r MembershipsRepository) UpdateRoles(ctx context.Context, orgID, userID string, roles []string) error {
+	res, err := r.conn.Database("poc-auth").Collection("memberships").UpdateByID(ctx, orgID+":"+userID, bson.M{
+		"$set": bson.M{"roles": roles},
+	})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return auth.ErrMembershipNotFound
+	}
+
+	return nil
+}
+
+func (r MembershipsRepository) Delete(ctx context.Context, orgID, userID string) error {
+	res, err := r.conn.Database("poc-auth").Collection("memberships").DeleteOne(ctx, bson.M{"_id": orgID + ":" + userID})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return auth.ErrMembershipNotFound
+	}
+
+	return nil
+}
+
+func (r MembershipsRepository) DeleteByOrganization(ctx context.Context, orgID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("memberships").DeleteMany(ctx, bson.M{"organization_id": orgID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (r MembershipsRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("memberships").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+type InvitationsRepository struct {
+	conn *mongo.Client
+}
+
+func (r InvitationsRepository) Create(ctx context.Context, invitation entities.Invitation) error {
+	_, err := r.conn.Database("poc-auth").Collection("invitations").InsertOne(ctx, invitation)
+	return err
+}
+
+func (r InvitationsRepository) Get(ctx context.Context, id string) (entities.Invitation, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r InvitationsRepository) GetByTokenHash(ctx context.Context, tokenHash string) (entities.Invitation, error) {
+	return r.findOne(ctx, bson.M{"token_hash": tokenHash})
+}
+
+func (r InvitationsRepository) findOne(ctx context.Context, filter bson.M) (entities.Invitation, error) {
+	var invitation entities.Invitation
+
+	err := r.conn.Database("poc-auth").Collection("invitations").FindOne(ctx, tenantFilter(ctx, filter)).Decode(&invitation)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.Invitation{}, auth.ErrInvalidInvitation
+		}
+		return entities.Invitation{}, err
+	}
+
+	return invitation, nil
+}
+
+func (r InvitationsRepository) ListByOrganization(ctx context.Context, orgID string) ([]entities.Invitation, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("invitations").Find(ctx,
+		bson.M{"organization_id": orgID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := []entities.Invitation{}
+	if err := cur.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// MarkAccepted only succeeds once, an invitation can not be accepted
+// twice.
+func (r InvitationsRepository) MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) error {
+	res, err := r.conn.Database("poc-auth").Collection("invitations").UpdateOne(ctx,
+		bson.M{"_id": id, "accepted_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"accepted_at": acceptedAt, "accepted_by": userID}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return auth.ErrInvalidInvitation
+	}
+
+	return nil
+}
+
+func (r InvitationsRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.conn.Database("poc-auth").Collection("invitations").DeleteOne(ctx, tenantFilter(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return auth.ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+func (r InvitationsRepository) DeleteByOrganization(ctx context.Context, orgID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("invitations").DeleteMany(ctx, bson.M{"organization_id": orgID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+// DeleteByEmail removes every invitation sent to the address.
+func (r InvitationsRepository) DeleteByEmail(ctx context.Context, email string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("invitations").DeleteMany(ctx, bson.M{"email": email})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type OutboxRepository struct {
+	conn *mongo.Client
+}
+
+func (r OutboxRepository) Add(ctx context.Context, event entities.Event) error {
+	_, err := r.conn.Database("poc-auth").Collection("outbox").InsertOne(ctx, event)
+	return err
+}
+
+func (r OutboxRepository) ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.Event, error) {
+	filter := bson.M{
+		"published_at":    nil,
+		"next_attempt_at": bson.M{"$lte": now},
+		"attempts":        bson.M{"$lt": maxAttempts},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "occurred_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cur, err := r.conn.Database("poc-auth").Collection("outbox").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []entities.Event
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (r OutboxRepository) MarkPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	_, err := r.conn.Database("poc-auth").Collection("outbox").UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"published_at": publishedAt},
+	})
+	return err
+}
+
+func (r OutboxRepository) MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, reason string) error {
+	_, err := r.conn.Database("poc-auth").Collection("outbox").UpdateByID(ctx, id, bson.M{
+		"$inc": bson.M{"attempts": 1},
+		"$set": bson.M{
+			"next_attempt_at": nextAttemptAt,
+			"last_error":      reason,
+		},
+	})
+	return err
+}
+
+// EraseUser replaces the user's id and drops their personal details in
+// the payloads of their events.
+func (r OutboxRepository) EraseUser(ctx context.Context, userID, email, pseudonym string) (int, error) {
+	var match bson.A
+	if userID != "" {
+		match = append(match, bson.M{"payload.user_id": userID})
+	}
+	if email != "" {
+		match = append(match, bson.M{"payload.email": email}, bson.M{"payload.old_email": email})
+	}
+	if len(match) == 0 {
+		return 0, nil
+	}
+
+	res, err := r.conn.Database("poc-auth").Collection("outbox").UpdateMany(ctx,
+		bson.M{"$or": match},
+		bson.M{
+			"$set": bson.M{"payload.user_id": pseudonym},
+			"$unset": bson.M{
+				"payload.email":     "",
+				"payload.old_email": "",
+				"payload.firstname": "",
+				"payload.lastname":  "",
+			},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type PasskeysRepository struct {
+	conn *mongo.Client
+}
+
+func (r PasskeysRepository) Create(ctx context.Context, passkey entities.Passkey) error {
+	_, err := r.conn.Database("poc-auth").Collection("passkeys").InsertOne(ctx, passkey)
+	if mongo.IsDuplicateKeyError(err) {
+		return auth.ErrPasskeyExists
+	}
+	return err
+}
+
+func (r PasskeysRepository) ListByUser(ctx context.Context, userID string) ([]entities.Passkey, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("passkeys").Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	var passkeys []entities.Passkey
+	if err := cur.All(ctx, &passkeys); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+func (r PasskeysRepository) UpdateSignCount(ctx context.Context, id string, signCount uint32, usedAt time.Time) error {
+	_, err := r.conn.Database("poc-auth").Collection("passkeys").UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"sign_count":   signCount,
+			"last_used_at": usedAt,
+		},
+	})
+	return err
+}
+
+func (r PasskeysRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("passkeys").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+type WebAuthnChallengesRepository struct {
+	conn *mongo.Client
+}
+
+func (r WebAuthnChallengesRepository) Create(ctx context.Context, challenge entities.WebAuthnChallenge) error {
+	_, err := r.conn.Database("poc-auth").Collection("webauthn_challenges").InsertOne(ctx, challenge)
+	return err
+}
+
+// Take deletes the challenge while reading it, every ceremony can be
+// finished only once.
+func (r WebAuthnChallengesRepository) Take(ctx context.Context, id string) (entities.WebAuthnChallenge, error) {
+	var challenge entities.WebAuthnChallenge
+
+	err := r.conn.Database("poc-auth").Collection("webauthn_challenges").FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&challenge)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.WebAuthnChallenge{}, auth.ErrInvalidPasskeyChallenge
+		}
+		return entities.WebAuthnChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+func (r WebAuthnChallengesRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("webauthn_challenges").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
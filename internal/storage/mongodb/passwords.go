@@ -0,0 +1,45 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type PasswordHistoryRepository struct {
+	conn *mongo.Client
+}
+
+func (r PasswordHistoryRepository) Add(ctx context.Context, entry entities.PasswordHistory) error {
+	_, err := r.conn.Database("poc-auth").Collection("password_history").InsertOne(ctx, entry)
+	return err
+}
+
+func (r PasswordHistoryRepository) ListRecent(ctx context.Context, userID string, limit int) ([]entities.PasswordHistory, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("password_history").Find(ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entities.PasswordHistory
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r PasswordHistoryRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("password_history").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
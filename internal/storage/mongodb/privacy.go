@@ -0,0 +1,151 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type DataExportsRepository struct {
+	conn *mongo.Client
+}
+
+func (r DataExportsRepository) Create(ctx context.Context, export entities.DataExport) error {
+	_, err := r.conn.Database("poc-auth").Collection("data_exports").InsertOne(ctx, export)
+	return err
+}
+
+// Get returns the export only to the user who requested it.
+func (r DataExportsRepository) Get(ctx context.Context, id, userID string) (entities.DataExport, error) {
+	var export entities.DataExport
+
+	err := r.conn.Database("poc-auth").Collection("data_exports").FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&export)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.DataExport{}, auth.ErrDataExportNotFound
+		}
+		return entities.DataExport{}, err
+	}
+
+	return export, nil
+}
+
+func (r DataExportsRepository) ListPending(ctx context.Context, maxAttempts, limit int) ([]entities.DataExport, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("data_exports").Find(ctx,
+		bson.M{"status": entities.DataRequestPending, "attempts": bson.M{"$lt": maxAttempts}},
+		options.Find().SetSort(bson.D{{Key: "requested_at", Value: 1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var exports []entities.DataExport
+	if err := cur.All(ctx, &exports); err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+// Update replaces the export, it is used to store the archive or the
+// failure of an attempt.
+func (r DataExportsRepository) Update(ctx context.Context, export entities.DataExport) error {
+	_, err := r.conn.Database("poc-auth").Collection("data_exports").ReplaceOne(ctx, bson.M{"_id": export.ID}, export)
+	return err
+}
+
+func (r DataExportsRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("data_exports").DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (r DataExportsRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("data_exports").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+type ErasuresRepository struct {
+	conn *mongo.Client
+}
+
+func (r ErasuresRepository) Create(ctx context.Context, record entities.ErasureRecord) error {
+	_, err := r.conn.Database("poc-auth").Collection("erasures").InsertOne(ctx, record)
+	return err
+}
+
+func (r ErasuresRepository) Get(ctx context.Context, id string) (entities.ErasureRecord, error) {
+	var record entities.ErasureRecord
+
+	err := r.conn.Database("poc-auth").Collection("erasures").FindOne(ctx, bson.M{"_id": id}).Decode(&record)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.ErasureRecord{}, auth.ErrErasureNotFound
+		}
+		return entities.ErasureRecord{}, err
+	}
+
+	return record, nil
+}
+
+// ListPending returns pending erasures that are due at now, records
+// without a schedule are due right away.
+func (r ErasuresRepository) ListPending(ctx context.Context, now time.Time, maxAttempts, limit int) ([]entities.ErasureRecord, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("erasures").Find(ctx,
+		bson.M{
+			"status":   entities.DataRequestPending,
+			"attempts": bson.M{"$lt": maxAttempts},
+			"$or": bson.A{
+				bson.M{"scheduled_at": bson.M{"$exists": false}},
+				bson.M{"scheduled_at": bson.M{"$lte": now}},
+			},
+		},
+		options.Find().SetSort(bson.D{{Key: "requested_at", Value: 1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []entities.ErasureRecord
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Update replaces the record. Fields left empty on a completed record,
+// such as the user's id and email, are removed from the document.
+func (r ErasuresRepository) Update(ctx context.Context, record entities.ErasureRecord) error {
+	_, err := r.conn.Database("poc-auth").Collection("erasures").ReplaceOne(ctx, bson.M{"_id": record.ID}, record)
+	return err
+}
+
+// CancelScheduled cancels the user's pending erasures that are not due
+// at now yet.
+func (r ErasuresRepository) CancelScheduled(ctx context.Context, userID string, now time.Time) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("erasures").UpdateMany(ctx,
+		tenantFilter(ctx, bson.M{
+			"user_id":      userID,
+			"status":       entities.DataRequestPending,
+			"scheduled_at": bson.M{"$gt": now},
+		}),
+		bson.M{"$set": bson.M{"status": entities.DataRequestCanceled}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
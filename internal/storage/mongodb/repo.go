@@ -36,3 +36,111 @@ func (r RepoCombiner) Check(ctx context.Context) error {
 func (r RepoCombiner) Users() UsersRepository {
 	return UsersRepository(r)
 }
+
+func (r RepoCombiner) Outbox() OutboxRepository {
+	return OutboxRepository(r)
+}
+
+func (r RepoCombiner) MailQueue() MailQueueRepository {
+	return MailQueueRepository(r)
+}
+
+func (r RepoCombiner) OAuthStates() OAuthStatesRepository {
+	return OAuthStatesRepository(r)
+}
+
+func (r RepoCombiner) OIDCClients() OIDCClientsRepository {
+	return OIDCClientsRepository(r)
+}
+
+func (r RepoCombiner) OIDCCodes() OIDCCodesRepository {
+	return OIDCCodesRepository(r)
+}
+
+func (r RepoCombiner) OIDCRefreshTokens() OIDCRefreshTokensRepository {
+	return OIDCRefreshTokensRepository(r)
+}
+
+func (r RepoCombiner) MagicLinks() MagicLinksRepository {
+	return MagicLinksRepository(r)
+}
+
+func (r RepoCombiner) Passkeys() PasskeysRepository {
+	return PasskeysRepository(r)
+}
+
+func (r RepoCombiner) WebAuthnChallenges() WebAuthnChallengesRepository {
+	return WebAuthnChallengesRepository(r)
+}
+
+func (r RepoCombiner) Sessions() SessionsRepository {
+	return SessionsRepository(r)
+}
+
+func (r RepoCombiner) RotatedRefreshTokens() RotatedRefreshTokensRepository {
+	return RotatedRefreshTokensRepository(r)
+}
+
+func (r RepoCombiner) Audit() AuditRepository {
+	return AuditRepository(r)
+}
+
+func (r RepoCombiner) PasswordHistory() PasswordHistoryRepository {
+	return PasswordHistoryRepository(r)
+}
+
+func (r RepoCombiner) EmailChanges() EmailChangesRepository {
+	return EmailChangesRepository(r)
+}
+
+func (r RepoCombiner) DataExports() DataExportsRepository {
+	return DataExportsRepository(r)
+}
+
+func (r RepoCombiner) Erasures() ErasuresRepository {
+	return ErasuresRepository(r)
+}
+
+func (r RepoCombiner) ServiceAccounts() ServiceAccountsRepository {
+	return ServiceAccountsRepository(r)
+}
+
+func (r RepoCombiner) APIKeys() APIKeysRepository {
+	return APIKeysRepository(r)
+}
+
+func (r RepoCombiner) Organizations() OrganizationsRepository {
+	return OrganizationsRepository(r)
+}
+
+func (r RepoCombiner) Memberships() MembershipsRepository {
+	return MembershipsRepository(r)
+}
+
+func (r RepoCombiner) Invitations() InvitationsRepository {
+	return InvitationsRepository(r)
+}
+
+func (r RepoCombiner) Impersonations() ImpersonationsRepository {
+	return ImpersonationsRepository(r)
+}
+
+func (r RepoCombiner) KnownDevices() KnownDevicesRepository {
+	return KnownDevicesRepository(r)
+}
+
+// WithTransaction runs fn in a transaction. Repositories called with
+// the context fn gets take part in it. Transactions need mongodb to run
+// as a replica set, a single node one is enough.
+func (r RepoCombiner) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := r.conn.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
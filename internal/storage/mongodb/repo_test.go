@@ -0,0 +1,160 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// newTestRepo connects to MONGODB_TEST_URI and creates the indexes.
+// Tests use tenants of their own and remove what they stored in them.
+func newTestRepo(t *testing.T) RepoCombiner {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+
+	conn, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Disconnect(ctx) })
+
+	r := RepoCombiner{conn: conn}
+	if err := r.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// testTenant returns a context with a tenant of its own, whose
+// documents are removed when the test ends.
+func testTenant(t *testing.T, r RepoCombiner) context.Context {
+	t.Helper()
+
+	tenant := "test-" + uuid.New().String()
+	t.Cleanup(func() {
+		for _, name := range []string{"users", "sessions", "email_changes"} {
+			r.conn.Database("poc-auth").Collection(name).DeleteMany(context.Background(), bson.M{"tenant_id": tenant})
+		}
+	})
+
+	return auth.WithTenant(context.Background(), tenant)
+}
+
+func TestEnsureIndexesIsRepeatable(t *testing.T) {
+	r := newTestRepo(t)
+
+	if err := r.EnsureIndexes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range expiringCollections {
+		specs, err := r.conn.Database("poc-auth").Collection(name).Indexes().ListSpecifications(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, spec := range specs {
+			if spec.Name == "expires_at_ttl" && spec.ExpireAfterSeconds != nil && *spec.ExpireAfterSeconds == 0 {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s has no ttl index on expires_at", name)
+		}
+	}
+}
+
+func TestUsersEmailIsUniquePerTenant(t *testing.T) {
+	r := newTestRepo(t)
+	acme, globex := testTenant(t, r), testTenant(t, r)
+	users := r.Users()
+
+	for _, ctx := range []context.Context{acme, globex} {
+		if _, err := users.Create(ctx, entities.User{TenantID: auth.TenantFromContext(ctx), Email: "user@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := users.Create(acme, entities.User{TenantID: auth.TenantFromContext(acme), Email: "user@example.com"})
+	if !errors.Is(err, auth.ErrEmailTaken) {
+		t.Fatalf("error %v, want %v", err, auth.ErrEmailTaken)
+	}
+
+	if _, err := users.Create(acme, entities.User{TenantID: auth.TenantFromContext(acme), Email: "other@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.ChangeEmail(acme, "other@example.com", "user@example.com"); !errors.Is(err, auth.ErrEmailTaken) {
+		t.Fatalf("error %v, want %v", err, auth.ErrEmailTaken)
+	}
+}
+
+func TestUsersAreScopedToTenant(t *testing.T) {
+	r := newTestRepo(t)
+	acme, globex := testTenant(t, r), testTenant(t, r)
+	users := r.Users()
+
+	if _, err := users.Create(acme, entities.User{TenantID: auth.TenantFromContext(acme), Email: "user@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.GetByEmail(globex, "user@example.com"); !errors.Is(err, auth.ErrEmailNotFound) {
+		t.Errorf("error %v, want %v", err, auth.ErrEmailNotFound)
+	}
+	if err := users.ChangeEmail(globex, "user@example.com", "new@example.com"); !errors.Is(err, auth.ErrEmailNotFound) {
+		t.Errorf("error %v, want %v", err, auth.ErrEmailNotFound)
+	}
+	if n, err := users.Delete(globex, "user@example.com"); err != nil || n != 0 {
+		t.Errorf("deleted %d users of another tenant, error %v", n, err)
+	}
+
+	if _, err := users.GetByEmail(acme, "user@example.com"); err != nil {
+		t.Errorf("user is gone from its tenant: %v", err)
+	}
+}
+
+func TestSessionsAreScopedToTenant(t *testing.T) {
+	r := newTestRepo(t)
+	acme, globex := testTenant(t, r), testTenant(t, r)
+	sessions := r.Sessions()
+
+	hash := uuid.New().String()
+	err := sessions.Create(acme, entities.UserSession{
+		ID:               uuid.New().String(),
+		UserID:           "user-1",
+		TenantID:         auth.TenantFromContext(acme),
+		RefreshTokenHash: hash,
+		ExpiresAt:        time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sessions.GetByTokenHash(globex, hash); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Errorf("error %v, want %v", err, auth.ErrSessionNotFound)
+	}
+	if list, err := sessions.ListByUser(globex, "user-1"); err != nil || len(list) != 0 {
+		t.Errorf("listed %d sessions of another tenant, error %v", len(list), err)
+	}
+
+	if _, err := sessions.GetByTokenHash(acme, hash); err != nil {
+		t.Errorf("session is gone from its tenant: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type ServiceAccountsRepository struct {
+	conn *mongo.Client
+}
+
+func (r ServiceAccountsRepository) Create(ctx context.Context, account entities.ServiceAccount) error {
+	_, err := r.conn.Database("poc-auth").Collection("service_accounts").InsertOne(ctx, account)
+	return err
+}
+
+func (r ServiceAccountsRepository) Get(ctx context.Context, id string) (entities.ServiceAccount, error) {
+	var account entities.ServiceAccount
+
+	err := r.conn.Database("poc-auth").Collection("service_accounts").FindOne(ctx, tenantFilter(ctx, bson.M{"_id": id})).Decode(&account)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.ServiceAccount{}, auth.ErrServiceAccountNotFound
+		}
+		return entities.ServiceAccount{}, err
+	}
+
+	return account, nil
+}
+
+func (r ServiceAccountsRepository) List(ctx context.Context) ([]entities.ServiceAccount, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("service_accounts").Find(ctx, tenantFilter(ctx, bson.M{}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []entities.ServiceAccount{}
+	if err := cur.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (r ServiceAccountsRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.conn.Database("poc-auth").Collection("service_accounts").DeleteOne(ctx, tenantFilter(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return auth.ErrServiceAccountNotFound
+	}
+
+	return nil
+}
+
+type APIKeysRepository struct {
+	conn *mongo.Client
+}
+
+func (r APIKeysRepository) Create(ctx context.Context, key entities.APIKey) error {
+	_, err := r.conn.Database("poc-auth").Collection("api_keys").InsertOne(ctx, key)
+	return err
+}
+
+func (r APIKeysRepository) Get(ctx context.Context, id string) (entities.APIKey, error) {
+	var key entities.APIKey
+
+	err := r.conn.Database("poc-auth").Collection("api_keys").FindOne(ctx, tenantFilter(ctx, bson.M{"_id": id})).Decode(&key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.APIKey{}, auth.ErrAPIKeyNotFound
+		}
+		return entities.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (r APIKeysRepository) ListByAccount(ctx context.Context, accountID string) ([]entities.APIKey, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("api_keys").Find(ctx,
+		bson.M{"service_account_id": accountID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []entities.APIKey{}
+	if err := cur.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r APIKeysRepository) MarkUsed(ctx context.Context, id string, usedAt time.Time, ip string) error {
+	_, err := r.conn.Database("poc-auth").Collection("api_keys").UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"last_used_at": usedAt, "last_used_ip": ip},
+	})
+	return err
+}
+
+// Replace shortens the expiry of a rotated key and links it to the key
+// that replaces it.
+func (r APIKeysRepository) Replace(ctx context.Context, id, replacedBy string, expiresAt time.Time) error {
+	_, err := r.conn.Database("poc-auth").Collection("api_keys").UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"replaced_by": replacedBy, "expires_at": expiresAt},
+	})
+	return err
+}
+
+// Revoke keeps the time a key was first revoked, revoking it again
+// does nothing.
+func (r APIKeysRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) error {
+	coll := r.conn.Database("poc-auth").Collection("api_keys")
+
+	res, err := coll.UpdateOne(ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		n, err := coll.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return auth.ErrAPIKeyNotFound
+		}
+	}
+
+	return nil
+}
+
+func (r APIKeysRepository) RevokeByAccount(ctx context.Context, accountID string, revokedAt time.Time) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("api_keys").UpdateMany(ctx,
+		bson.M{"service_account_id": accountID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
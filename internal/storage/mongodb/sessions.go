@@ -0,0 +1,171 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type SessionsRepository struct {
+	conn *mongo.Client
+}
+
+func (r SessionsRepository) Create(ctx context.Context, session entities.UserSession) error {
+	_, err := r.conn.Database("poc-auth").Collection("sessions").InsertOne(ctx, session)
+	return err
+}
+
+func (r SessionsRepository) GetByTokenHash(ctx context.Context, tokenHash string) (entities.UserSession, error) {
+	var session entities.UserSession
+
+	err := r.conn.Database("poc-auth").Collection("sessions").FindOne(ctx, tenantFilter(ctx, bson.M{"refresh_token_hash": tokenHash})).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.UserSession{}, auth.ErrSessionNotFound
+		}
+		return entities.UserSession{}, err
+	}
+
+	return session, nil
+}
+
+// GetByAccessTokenHash returns the session that issued the access
+// token last.
+func (r SessionsRepository) GetByAccessTokenHash(ctx context.Context, tokenHash string) (entities.UserSession, error) {
+	var session entities.UserSession
+
+	err := r.conn.Database("poc-auth").Collection("sessions").FindOne(ctx, tenantFilter(ctx, bson.M{"access_token_hash": tokenHash})).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.UserSession{}, auth.ErrSessionNotFound
+		}
+		return entities.UserSession{}, err
+	}
+
+	return session, nil
+}
+
+func (r SessionsRepository) SetActiveOrganization(ctx context.Context, id, orgID string) error {
+	res, err := r.conn.Database("poc-auth").Collection("sessions").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"active_organization_id": orgID}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return auth.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// ClearActiveOrganization unsets the organization on the user's
+// sessions that switched to it.
+func (r SessionsRepository) ClearActiveOrganization(ctx context.Context, userID, orgID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("sessions").UpdateMany(ctx,
+		bson.M{"user_id": userID, "active_organization_id": orgID},
+		bson.M{"$unset": bson.M{"active_organization_id": ""}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (r SessionsRepository) ListByUser(ctx context.Context, userID string) ([]entities.UserSession, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("sessions").Find(ctx,
+		tenantFilter(ctx, bson.M{"user_id": userID}),
+		options.Find().SetSort(bson.M{"last_used_at": -1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []entities.UserSession
+	if err := cur.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Rotate saves the session only if its refresh token is still the one
+// that was exchanged. A concurrent refresh with the same token loses.
+func (r SessionsRepository) Rotate(ctx context.Context, session entities.UserSession, previousHash string) error {
+	res, err := r.conn.Database("poc-auth").Collection("sessions").ReplaceOne(ctx,
+		bson.M{"_id": session.ID, "refresh_token_hash": previousHash},
+		session,
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return auth.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// Delete removes the session only if it belongs to the user, so one
+// user can not revoke the sessions of another by guessing ids.
+func (r SessionsRepository) Delete(ctx context.Context, id, userID string) (entities.UserSession, error) {
+	var session entities.UserSession
+
+	err := r.conn.Database("poc-auth").Collection("sessions").FindOneAndDelete(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.UserSession{}, auth.ErrSessionNotFound
+		}
+		return entities.UserSession{}, err
+	}
+
+	return session, nil
+}
+
+func (r SessionsRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("sessions").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+type RotatedRefreshTokensRepository struct {
+	conn *mongo.Client
+}
+
+func (r RotatedRefreshTokensRepository) Create(ctx context.Context, token entities.RotatedRefreshToken) error {
+	_, err := r.conn.Database("poc-auth").Collection("rotated_refresh_tokens").InsertOne(ctx, token)
+	return err
+}
+
+func (r RotatedRefreshTokensRepository) Get(ctx context.Context, tokenHash string) (entities.RotatedRefreshToken, error) {
+	var token entities.RotatedRefreshToken
+
+	err := r.conn.Database("poc-auth").Collection("rotated_refresh_tokens").FindOne(ctx, bson.M{"_id": tokenHash}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.RotatedRefreshToken{}, auth.ErrSessionNotFound
+		}
+		return entities.RotatedRefreshToken{}, err
+	}
+
+	return token, nil
+}
+
+func (r RotatedRefreshTokensRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("rotated_refresh_tokens").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
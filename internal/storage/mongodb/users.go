@@ -2,11 +2,14 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
 	"github.com/rasulov-emirlan/poc-auth/internal/entities"
@@ -40,20 +43,114 @@ func (r UsersRepository) Create(ctx context.Context, user entities.User) (entiti
 func (r UsersRepository) GetByEmail(ctx context.Context, email string) (entities.User, error) {
 	var user entities.User
 
-	err := r.conn.Database("poc-auth").Collection("users").FindOne(ctx, entities.User{Email: email}).Decode(&user)
+	err := r.conn.Database("poc-auth").Collection("users").FindOne(ctx, tenantFilter(ctx, bson.M{"email": email})).Decode(&user)
 	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.User{}, auth.ErrEmailNotFound
+		}
 		return entities.User{}, err
 	}
 
 	return user, nil
 }
 
+// ChangeEmail moves the user to a new email, which has to be free.
+func (r UsersRepository) ChangeEmail(ctx context.Context, email, newEmail string) error {
+	res, err := r.conn.Database("poc-auth").Collection("users").UpdateOne(ctx,
+		tenantFilter(ctx, bson.M{"email": email}),
+		bson.M{"$set": bson.M{"email": newEmail, "updatedat": time.Now()}},
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return auth.ErrEmailTaken
+		}
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return auth.ErrEmailNotFound
+	}
+
+	return nil
+}
+
+// ListDeletionDue returns users whose scheduled deletion is due, of
+// all tenants.
+func (r UsersRepository) ListDeletionDue(ctx context.Context, now time.Time, limit int) ([]entities.User, error) {
+	cur, err := r.conn.Database("poc-auth").Collection("users").Find(ctx,
+		bson.M{"deletionscheduledat": bson.M{"$lte": now}},
+		options.Find().SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []entities.User
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r UsersRepository) Delete(ctx context.Context, email string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("users").DeleteOne(ctx, tenantFilter(ctx, bson.M{"email": email}))
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
 func (r UsersRepository) Update(ctx context.Context, user entities.User) (entities.User, error) {
 	user.UpdatedAt = time.Now()
-	_, err := r.conn.Database("poc-auth").Collection("users").UpdateOne(ctx, entities.User{Email: user.Email}, user)
+	_, err := r.conn.Database("poc-auth").Collection("users").UpdateOne(ctx, tenantFilter(ctx, bson.M{"email": user.Email}), bson.M{"$set": user})
 	if err != nil {
 		return entities.User{}, err
 	}
 
 	return user, nil
 }
+
+// tenantFilter scopes a query to the tenant of the request. Documents
+// of the default tenant have no tenant_id, which nil matches.
+func tenantFilter(ctx context.Context, filter bson.M) bson.M {
+	if tenantID := auth.TenantFromContext(ctx); tenantID != "" {
+		filter["tenant_id"] = tenantID
+	} else {
+		filter["tenant_id"] = nil
+	}
+	return filter
+}
+
+type EmailChangesRepository struct {
+	conn *mongo.Client
+}
+
+func (r EmailChangesRepository) Create(ctx context.Context, change entities.EmailChange) error {
+	_, err := r.conn.Database("poc-auth").Collection("email_changes").InsertOne(ctx, change)
+	return err
+}
+
+// Take deletes the change while reading it, a confirmation link works
+// once.
+func (r EmailChangesRepository) Take(ctx context.Context, tokenHash string) (entities.EmailChange, error) {
+	var change entities.EmailChange
+
+	err := r.conn.Database("poc-auth").Collection("email_changes").FindOneAndDelete(ctx, bson.M{"_id": tokenHash}).Decode(&change)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return entities.EmailChange{}, auth.ErrInvalidEmailChange
+		}
+		return entities.EmailChange{}, err
+	}
+
+	return change, nil
+}
+
+func (r EmailChangesRepository) DeleteByUser(ctx context.Context, userID string) (int, error) {
+	res, err := r.conn.Database("poc-auth").Collection("email_changes").DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
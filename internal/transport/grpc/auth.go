@@ -0,0 +1,127 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	authv1 "github.com/rasulov-emirlan/poc-auth/pkg/pb/auth/v1"
+)
+
+type authHandler struct {
+	authv1.UnimplementedAuthServiceServer
+
+	service auth.Service
+	log     *slog.Logger
+}
+
+func (h authHandler) Login(ctx context.Context, req *authv1.LoginRequest) (*authv1.Session, error) {
+	email := normalizeEmail(req.GetEmail())
+	if email == "" || req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email and password are required")
+	}
+
+	res, err := h.service.Login(ctx, email, req.GetPassword())
+	if err != nil {
+		return nil, h.statusError(ctx, err)
+	}
+
+	return toSession(res), nil
+}
+
+func (h authHandler) Register(ctx context.Context, req *authv1.RegisterRequest) (*authv1.Session, error) {
+	email := normalizeEmail(req.GetEmail())
+	if email == "" || req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email and password are required")
+	}
+
+	res, err := h.service.Register(ctx, email, req.GetPassword(), req.GetFirstname(), req.GetLastname(), req.GetInvitation())
+	if err != nil {
+		return nil, h.statusError(ctx, err)
+	}
+
+	// the user joins the organization like over REST
+	if req.GetInvitation() != "" {
+		user, err := h.service.VerifyToken(ctx, res.AccessToken)
+		if err != nil {
+			return nil, h.statusError(ctx, err)
+		}
+
+		if _, err := h.service.AcceptInvitation(ctx, user, req.GetInvitation()); err != nil {
+			return nil, h.statusError(ctx, err)
+		}
+	}
+
+	return toSession(res), nil
+}
+
+func (h authHandler) RefreshToken(ctx context.Context, req *authv1.RefreshTokenRequest) (*authv1.Session, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+
+	res, err := h.service.RefreshToken(ctx, req.GetRefreshToken())
+	if err != nil {
+		return nil, h.statusError(ctx, err)
+	}
+
+	return toSession(res), nil
+}
+
+func (h authHandler) VerifyToken(ctx context.Context, req *authv1.VerifyTokenRequest) (*authv1.User, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "access_token is required")
+	}
+
+	user, err := h.service.VerifyToken(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, h.statusError(ctx, err)
+	}
+
+	return &authv1.User{
+		Id:        user.ProviderID,
+		Email:     user.Email,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+	}, nil
+}
+
+func (h authHandler) ForgotPassword(ctx context.Context, req *authv1.ForgotPasswordRequest) (*authv1.ForgotPasswordResponse, error) {
+	email := normalizeEmail(req.GetEmail())
+	if email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if err := h.service.ForgotPassword(ctx, email); err != nil {
+		return nil, h.statusError(ctx, err)
+	}
+
+	return &authv1.ForgotPasswordResponse{}, nil
+}
+
+func (h authHandler) ResetPassword(ctx context.Context, req *authv1.ResetPasswordRequest) (*authv1.ResetPasswordResponse, error) {
+	if req.GetToken() == "" || req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token and password are required")
+	}
+
+	if err := h.service.ResetPassword(ctx, req.GetPassword(), req.GetToken()); err != nil {
+		return nil, h.statusError(ctx, err)
+	}
+
+	return &authv1.ResetPasswordResponse{}, nil
+}
+
+func toSession(s auth.Session) *authv1.Session {
+	return &authv1.Session{
+		AccessToken:  s.AccessToken,
+		RefreshToken: s.RefreshToken,
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
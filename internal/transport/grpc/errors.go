@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+)
+
+// statusError maps domain errors to grpc status codes. Unknown errors
+// are logged and returned without details, like a 500 of the REST api
+// they can carry internals.
+func (h authHandler) statusError(ctx context.Context, err error) error {
+	// hooks wrap it with their own reason
+	if errors.Is(err, auth.ErrHookRejected) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	for _, m := range errorCodes {
+		for _, target := range m.errs {
+			if errors.Is(err, target) {
+				return status.Error(m.code, target.Error())
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	h.log.ErrorContext(ctx, "grpc call failed", "error", err)
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// errorCodes maps domain errors to grpc status codes. Errors wrapping
+// one of them get its code and message.
+var errorCodes = []struct {
+	code codes.Code
+	errs []error
+}{
+	{codes.InvalidArgument, []error{
+		auth.ErrFirstnameOrLastnameTooShort,
+		auth.ErrPasswordTooShort, auth.ErrPasswordTooLong, auth.ErrPasswordTooSimple,
+		auth.ErrPasswordContainsPersonalInfo, auth.ErrPasswordReused, auth.ErrPasswordBreached,
+		auth.ErrInvalidInvitation,
+	}},
+	{codes.Unauthenticated, []error{
+		auth.ErrInvalidCredentials, auth.ErrInvalidToken,
+		auth.ErrSessionNotFound, auth.ErrRefreshTokenReused,
+	}},
+	{codes.PermissionDenied, []error{
+		auth.ErrRegistrationDisabled,
+		auth.ErrEmailDomainNotAllowed, auth.ErrDisposableEmail, auth.ErrInvitationRequired,
+		auth.ErrInvitationEmailMismatch,
+	}},
+	{codes.NotFound, []error{
+		auth.ErrEmailNotFound, auth.ErrUserNotFound, auth.ErrInvitationNotFound,
+	}},
+	{codes.AlreadyExists, []error{
+		auth.ErrEmailTaken,
+	}},
+	{codes.ResourceExhausted, []error{
+		auth.ErrTooManyRequests,
+	}},
+}
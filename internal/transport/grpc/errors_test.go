@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+)
+
+func TestStatusErrorMapsWrappedErrors(t *testing.T) {
+	h := authHandler{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	for _, m := range errorCodes {
+		for _, target := range m.errs {
+			for _, err := range []error{target, fmt.Errorf("failed to do something: %w", target)} {
+				st := status.Convert(h.statusError(context.Background(), err))
+
+				if st.Code() != m.code {
+					t.Errorf("%q: code %s, want %s", err, st.Code(), m.code)
+				}
+				if st.Message() != target.Error() {
+					t.Errorf("%q: message %q, want %q", err, st.Message(), target.Error())
+				}
+			}
+		}
+	}
+}
+
+func TestStatusErrorCodes(t *testing.T) {
+	h := authHandler{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		ctx  context.Context
+		err  error
+		want codes.Code
+	}{
+		{context.Background(), fmt.Errorf("failed to register: %w", auth.ErrEmailTaken), codes.AlreadyExists},
+		{context.Background(), fmt.Errorf("failed to log in: %w", auth.ErrInvalidCredentials), codes.Unauthenticated},
+		{context.Background(), fmt.Errorf("hook: %w", auth.ErrHookRejected), codes.PermissionDenied},
+		{context.Background(), errors.New("connection refused"), codes.Internal},
+		{canceled, errors.New("connection refused"), codes.Canceled},
+	}
+
+	for _, tt := range tests {
+		if got := status.Code(h.statusError(tt.ctx, tt.err)); got != tt.want {
+			t.Errorf("%q: code %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
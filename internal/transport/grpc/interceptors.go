@@ -0,0 +1,109 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/pkg/logging"
+	"github.com/rasulov-emirlan/poc-auth/pkg/realip"
+)
+
+const (
+	requestIDHeader = "x-request-id"
+	tenantHeader    = "x-tenant-id"
+)
+
+// interceptorRequestID takes the request id from the x-request-id
+// metadata or generates one, and sends it back in the response header.
+func interceptorRequestID(ctx context.Context, req any, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (any, error) {
+	reqID := firstMetadata(ctx, requestIDHeader)
+	if reqID == "" {
+		reqID = uuid.New().String()
+	}
+
+	_ = gogrpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, reqID))
+
+	return handler(context.WithValue(ctx, logging.ReqIdKey, reqID), req)
+}
+
+// interceptorClientInfo records the calling client the same way the
+// REST api does. Trusted services calling on behalf of a user can
+// forward the user's address in x-forwarded-for, it is ignored on calls
+// from anyone else.
+func interceptorClientInfo(resolver realip.Resolver) gogrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (any, error) {
+		var remoteAddr string
+		if p, ok := peer.FromContext(ctx); ok {
+			remoteAddr = p.Addr.String()
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		ctx = auth.WithClientInfo(ctx, auth.ClientInfo{
+			IP:         resolver.ClientIP(remoteAddr, md.Get("x-forwarded-for")),
+			UserAgent:  firstMetadata(ctx, "user-agent"),
+			DeviceName: firstMetadata(ctx, "x-device-name"),
+			Locale:     firstMetadata(ctx, "accept-language"),
+		})
+
+		return handler(ctx, req)
+	}
+}
+
+// interceptorTenant takes the tenant from the x-tenant-id metadata,
+// calls without it are for the default tenant.
+func interceptorTenant(cfg config.Config, service auth.Service) gogrpc.UnaryServerInterceptor {
+	if !cfg.Tenancy.Enabled {
+		return func(ctx context.Context, req any, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (any, error) {
+			return handler(ctx, req)
+		}
+	}
+
+	return func(ctx context.Context, req any, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (any, error) {
+		tenantID := firstMetadata(ctx, tenantHeader)
+		if !service.HasTenant(tenantID) {
+			return nil, status.Error(codes.NotFound, "unknown tenant")
+		}
+
+		return handler(auth.WithTenant(ctx, tenantID), req)
+	}
+}
+
+func interceptorLogging(log *slog.Logger) gogrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		res, err := handler(ctx, req)
+
+		log.InfoContext(ctx, "grpc call",
+			"method", info.FullMethod,
+			"code", status.Code(err).String(),
+			"duration", time.Since(start),
+		)
+
+		return res, err
+	}
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,66 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/pkg/realip"
+)
+
+func TestInterceptorClientInfo(t *testing.T) {
+	resolver, err := realip.New([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := interceptorClientInfo(resolver)
+
+	tests := []struct {
+		name         string
+		peer         string
+		forwardedFor string
+		want         string
+	}{
+		{name: "direct call", peer: "203.0.113.7:51234", want: "203.0.113.7"},
+		{name: "forged by a client", peer: "203.0.113.7:51234", forwardedFor: "198.51.100.1", want: "203.0.113.7"},
+		{name: "forwarded by a trusted service", peer: "10.0.0.5:51234", forwardedFor: "198.51.100.1", want: "198.51.100.1"},
+		{name: "forged before a trusted service", peer: "10.0.0.5:51234", forwardedFor: "192.0.2.9, 198.51.100.1", want: "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tt.peer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+			md := metadata.Pairs("user-agent", "billing/1.0", "x-device-name", "Work laptop")
+			if tt.forwardedFor != "" {
+				md.Append("x-forwarded-for", tt.forwardedFor)
+			}
+			ctx = metadata.NewIncomingContext(ctx, md)
+
+			var got auth.ClientInfo
+			_, err = interceptor(ctx, nil, &gogrpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+				got = auth.ClientInfoFromContext(ctx)
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.IP != tt.want {
+				t.Errorf("ip %q, want %q", got.IP, tt.want)
+			}
+			if got.UserAgent != "billing/1.0" || got.DeviceName != "Work laptop" {
+				t.Errorf("client info %+v", got)
+			}
+		})
+	}
+}
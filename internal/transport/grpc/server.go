@@ -0,0 +1,76 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	gogrpc "google.golang.org/grpc"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	authv1 "github.com/rasulov-emirlan/poc-auth/pkg/pb/auth/v1"
+	"github.com/rasulov-emirlan/poc-auth/pkg/realip"
+)
+
+type server struct {
+	srvr *gogrpc.Server
+	addr string
+}
+
+type ServerConfigs struct {
+	Cfg        config.Config
+	AuthDomain auth.Service
+	Logger     *slog.Logger
+	IPResolver realip.Resolver
+}
+
+func NewServer(cfg ServerConfigs) server {
+	srvr := gogrpc.NewServer(
+		gogrpc.ChainUnaryInterceptor(
+			interceptorRequestID,
+			interceptorClientInfo(cfg.IPResolver),
+			interceptorTenant(cfg.Cfg, cfg.AuthDomain),
+			interceptorLogging(cfg.Logger),
+		),
+	)
+
+	authv1.RegisterAuthServiceServer(srvr, authHandler{
+		service: cfg.AuthDomain,
+		log:     cfg.Logger,
+	})
+
+	return server{
+		srvr: srvr,
+		addr: cfg.Cfg.GRPC.Port,
+	}
+}
+
+func (s server) Start() error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	// Serve returns nil once the server is stopped
+	return s.srvr.Serve(lis)
+}
+
+// Shutdown waits for running calls to finish, calls still running when
+// ctx is done are canceled.
+func (s server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		s.srvr.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.srvr.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+)
+
+const (
+	githubAuthorizeURL = "https://github.com/login/oauth/authorize"
+	githubTokenURL     = "https://github.com/login/oauth/access_token"
+	githubAPIURL       = "https://api.github.com"
+)
+
+// GitHubProvider uses plain OAuth2 since GitHub does not support
+// OpenID Connect for user logins. The nonce is therefore not used, the
+// state and PKCE still protect the flow.
+type GitHubProvider struct {
+	clientID     string
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	apiURL       string
+	scopes       []string
+	client       *http.Client
+}
+
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func NewGitHubProvider(cfg ProviderConfig) GitHubProvider {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+
+	return GitHubProvider{
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		authURL:      withDefault(cfg.AuthURL, githubAuthorizeURL),
+		tokenURL:     withDefault(cfg.TokenURL, githubTokenURL),
+		apiURL:       strings.TrimSuffix(withDefault(cfg.APIURL, githubAPIURL), "/"),
+		scopes:       scopes,
+		client:       cfg.client(),
+	}
+}
+
+func (p GitHubProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge, redirectURI string) (string, error) {
+	return authCodeURL(p.authURL, url.Values{
+		"client_id":             {p.clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}), nil
+}
+
+func (p GitHubProvider) Exchange(ctx context.Context, code, codeVerifier, nonce, redirectURI string) (auth.ExternalIdentity, error) {
+	token, err := exchangeCode(ctx, p.client, p.tokenURL, url.Values{
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"code_verifier": {codeVerifier},
+	})
+	if err != nil {
+		return auth.ExternalIdentity{}, err
+	}
+
+	var user githubUser
+	if err := p.get(ctx, token.AccessToken, "/user", &user); err != nil {
+		return auth.ExternalIdentity{}, err
+	}
+
+	var emails []githubEmail
+	if err := p.get(ctx, token.AccessToken, "/user/emails", &emails); err != nil {
+		return auth.ExternalIdentity{}, err
+	}
+
+	identity := auth.ExternalIdentity{
+		Provider: "github",
+		Subject:  strconv.FormatInt(user.ID, 10),
+	}
+	identity.Firstname, identity.Lastname = splitName(user.Name)
+	if identity.Firstname == "" {
+		identity.Firstname = user.Login
+	}
+
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+		}
+	}
+
+	return identity, nil
+}
+
+func (p GitHubProvider) get(ctx context.Context, accessToken, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create github request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call github: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("github %s returned status %d", path, res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode github response: %w", err)
+	}
+
+	return nil
+}
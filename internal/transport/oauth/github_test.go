@@ -0,0 +1,139 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newStubGitHub serves the token endpoint and the user api of GitHub.
+// It accepts the code "code" with the verifier "verifier" and the
+// access token it hands out.
+func newStubGitHub(t *testing.T, emails []githubEmail) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") != "verifier" || r.FormValue("client_secret") != "secret" {
+			writeJSON(w, tokenResponse{Error: "bad_verification_code"})
+			return
+		}
+		writeJSON(w, tokenResponse{AccessToken: "access", TokenType: "bearer"})
+	})
+	mux.HandleFunc("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, githubUser{ID: 42, Login: "jdoe", Name: "Jane Doe"})
+	})
+	mux.HandleFunc("/api/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, emails)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newTestGitHubProvider(baseURL string) GitHubProvider {
+	return NewGitHubProvider(ProviderConfig{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthURL:      baseURL + "/login/oauth/authorize",
+		TokenURL:     baseURL + "/login/oauth/access_token",
+		APIURL:       baseURL + "/api/",
+	})
+}
+
+func TestGitHubDefaultEndpoints(t *testing.T) {
+	p := NewGitHubProvider(ProviderConfig{ClientID: "client"})
+
+	raw, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge", "https://app/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(raw, githubAuthorizeURL+"?") {
+		t.Errorf("authorization url %q does not start with %q", raw, githubAuthorizeURL)
+	}
+	if p.tokenURL != githubTokenURL || p.apiURL != githubAPIURL {
+		t.Errorf("endpoints %q and %q, want the github.com ones", p.tokenURL, p.apiURL)
+	}
+}
+
+func TestGitHubAuthCodeURL(t *testing.T) {
+	raw, err := newTestGitHubProvider("https://github.example.com").AuthCodeURL(context.Background(), "state", "nonce", "challenge", "https://app/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Host != "github.example.com" || u.Path != "/login/oauth/authorize" {
+		t.Errorf("authorization url %q does not use the configured endpoint", raw)
+	}
+
+	q := u.Query()
+	if q.Get("state") != "state" || q.Get("code_challenge") != "challenge" || q.Get("scope") != "read:user user:email" {
+		t.Errorf("unexpected query %v", q)
+	}
+}
+
+func TestGitHubExchange(t *testing.T) {
+	srv := newStubGitHub(t, []githubEmail{
+		{Email: "old@example.com", Verified: true},
+		{Email: "user@example.com", Primary: true, Verified: true},
+	})
+
+	identity, err := newTestGitHubProvider(srv.URL).Exchange(context.Background(), "code", "verifier", "", "https://app/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.Provider != "github" || identity.Subject != "42" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	if identity.Email != "user@example.com" || !identity.EmailVerified {
+		t.Errorf("email %q verified %v, want the verified primary email", identity.Email, identity.EmailVerified)
+	}
+	if identity.Firstname != "Jane" || identity.Lastname != "Doe" {
+		t.Errorf("name is %q %q, want Jane Doe", identity.Firstname, identity.Lastname)
+	}
+}
+
+func TestGitHubExchangeUnverifiedPrimaryEmail(t *testing.T) {
+	srv := newStubGitHub(t, []githubEmail{
+		{Email: "verified@example.com", Verified: true},
+		{Email: "user@example.com", Primary: true},
+	})
+
+	identity, err := newTestGitHubProvider(srv.URL).Exchange(context.Background(), "code", "verifier", "", "https://app/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.Email != "user@example.com" || identity.EmailVerified {
+		t.Errorf("email %q verified %v, want the unverified primary email", identity.Email, identity.EmailVerified)
+	}
+}
+
+func TestGitHubExchangeRejectsInvalidCode(t *testing.T) {
+	srv := newStubGitHub(t, nil)
+
+	_, err := newTestGitHubProvider(srv.URL).Exchange(context.Background(), "wrong", "verifier", "", "https://app/callback")
+	if err == nil {
+		t.Fatal("exchange succeeded, want an error")
+	}
+}
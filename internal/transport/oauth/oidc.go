@@ -0,0 +1,178 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+var (
+	ErrNoIDToken     = errors.New("token response has no id_token")
+	ErrNonceMismatch = errors.New("id_token nonce does not match")
+)
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Name          string `json:"name"`
+}
+
+// OIDCProvider works with any OpenID Connect compliant provider. The
+// endpoints are discovered lazily from the issuer on first use.
+type OIDCProvider struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	client       *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      *jwks.RemoteSet
+}
+
+func NewOIDCProvider(name string, cfg ProviderConfig) *OIDCProvider {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &OIDCProvider{
+		name:         name,
+		issuer:       strings.TrimSuffix(cfg.Issuer, "/"),
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		scopes:       scopes,
+		client:       cfg.client(),
+	}
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge, redirectURI string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return authCodeURL(d.AuthorizationEndpoint, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}), nil
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce, redirectURI string) (auth.ExternalIdentity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return auth.ExternalIdentity{}, err
+	}
+
+	token, err := exchangeCode(ctx, p.client, d.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"code_verifier": {codeVerifier},
+	})
+	if err != nil {
+		return auth.ExternalIdentity{}, err
+	}
+
+	if token.IDToken == "" {
+		return auth.ExternalIdentity{}, ErrNoIDToken
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(token.IDToken, &claims, p.keys.Keyfunc(ctx),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384"}),
+	)
+	if err != nil {
+		return auth.ExternalIdentity{}, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if claims.Nonce != nonce {
+		return auth.ExternalIdentity{}, ErrNonceMismatch
+	}
+
+	firstname, lastname := claims.GivenName, claims.FamilyName
+	if firstname == "" && lastname == "" {
+		firstname, lastname = splitName(claims.Name)
+	}
+
+	return auth.ExternalIdentity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Firstname:     firstname,
+		Lastname:      lastname,
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch discovery document: status %d", res.StatusCode)
+	}
+
+	var d discovery
+	if err := json.NewDecoder(res.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", d.Issuer, p.issuer)
+	}
+
+	p.discovery = &d
+	p.keys = jwks.NewRemoteSet(d.JWKSURI, p.client)
+
+	return p.discovery, nil
+}
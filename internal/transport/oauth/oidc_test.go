@@ -0,0 +1,226 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+// stubOIDC is a minimal OpenID Connect provider. It accepts the code
+// "code" with the verifier "verifier" and answers with an id_token made
+// from claims and signed by signer. Its jwks endpoint serves the key
+// of published.
+type stubOIDC struct {
+	*httptest.Server
+	signer    jwks.Signer
+	published jwks.Signer
+	claims    func(issuer string) jwt.MapClaims
+}
+
+func newStubOIDC(t *testing.T, claims func(issuer string) jwt.MapClaims) *stubOIDC {
+	t.Helper()
+
+	signer, err := jwks.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &stubOIDC{signer: signer, published: signer, claims: claims}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, discovery{
+			Issuer:                s.URL,
+			AuthorizationEndpoint: s.URL + "/authorize",
+			TokenEndpoint:         s.URL + "/token",
+			JWKSURI:               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.published.Set())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") != "verifier" || r.FormValue("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, tokenResponse{Error: "invalid_grant"})
+			return
+		}
+
+		idToken, err := s.signer.Sign(s.claims(s.URL))
+		if err != nil {
+			t.Error(err)
+		}
+		writeJSON(w, tokenResponse{AccessToken: "access", TokenType: "Bearer", IDToken: idToken})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func validClaims(issuer string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            issuer,
+		"sub":            "subject",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          "nonce",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+}
+
+func newTestOIDCProvider(issuer string) *OIDCProvider {
+	return NewOIDCProvider("stub", ProviderConfig{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Issuer:       issuer,
+	})
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	stub := newStubOIDC(t, validClaims)
+
+	raw, err := newTestOIDCProvider(stub.URL).AuthCodeURL(context.Background(), "state", "nonce", "challenge", "https://app/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := u.Scheme + "://" + u.Host + u.Path; got != stub.URL+"/authorize" {
+		t.Errorf("authorization endpoint %q, want %q", got, stub.URL+"/authorize")
+	}
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"client_id":             "client",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+		"redirect_uri":          "https://app/callback",
+		"scope":                 "openid email profile",
+	} {
+		if q.Get(key) != want {
+			t.Errorf("%s is %q, want %q", key, q.Get(key), want)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	stub := newStubOIDC(t, validClaims)
+
+	identity, err := newTestOIDCProvider(stub.URL).Exchange(context.Background(), "code", "verifier", "nonce", "https://app/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.Provider != "stub" || identity.Subject != "subject" || identity.Email != "user@example.com" || !identity.EmailVerified {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	if identity.Firstname != "Jane" || identity.Lastname != "Doe" {
+		t.Errorf("name is %q %q, want Jane Doe", identity.Firstname, identity.Lastname)
+	}
+}
+
+func TestOIDCExchangeEmailNotVerified(t *testing.T) {
+	stub := newStubOIDC(t, func(issuer string) jwt.MapClaims {
+		claims := validClaims(issuer)
+		claims["email_verified"] = "false"
+		return claims
+	})
+
+	identity, err := newTestOIDCProvider(stub.URL).Exchange(context.Background(), "code", "verifier", "nonce", "https://app/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.EmailVerified {
+		t.Error("email is verified, want not verified")
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidIDTokens(t *testing.T) {
+	tests := map[string]func(claims jwt.MapClaims){
+		"nonce":    func(claims jwt.MapClaims) { claims["nonce"] = "other" },
+		"audience": func(claims jwt.MapClaims) { claims["aud"] = "other" },
+		"issuer":   func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		"expired":  func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no exp":   func(claims jwt.MapClaims) { delete(claims, "exp") },
+	}
+
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub := newStubOIDC(t, func(issuer string) jwt.MapClaims {
+				claims := validClaims(issuer)
+				modify(claims)
+				return claims
+			})
+
+			_, err := newTestOIDCProvider(stub.URL).Exchange(context.Background(), "code", "verifier", "nonce", "https://app/callback")
+			if err == nil {
+				t.Fatal("exchange succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeRejectsForeignKey(t *testing.T) {
+	stub := newStubOIDC(t, validClaims)
+
+	// the id_token is signed by a key the jwks endpoint does not serve
+	other, err := jwks.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.signer = other
+
+	_, err = newTestOIDCProvider(stub.URL).Exchange(context.Background(), "code", "verifier", "nonce", "https://app/callback")
+	if !errors.Is(err, jwks.ErrKeyNotFound) {
+		t.Fatalf("error %v, want %v", err, jwks.ErrKeyNotFound)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidCode(t *testing.T) {
+	stub := newStubOIDC(t, validClaims)
+
+	_, err := newTestOIDCProvider(stub.URL).Exchange(context.Background(), "wrong", "verifier", "nonce", "https://app/callback")
+	if err == nil {
+		t.Fatal("exchange succeeded, want an error")
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	stub := newStubOIDC(t, validClaims)
+
+	// the discovery document below the configured issuer names another
+	// issuer
+	p := newTestOIDCProvider(stub.URL + "/tenant")
+	stub.Config.Handler.(*http.ServeMux).HandleFunc("/tenant/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, discovery{Issuer: stub.URL})
+	})
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge", "https://app/callback"); err == nil {
+		t.Fatal("discovery succeeded, want an issuer mismatch")
+	}
+}
@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProviderConfig configures a provider. Issuer is used by OpenID
+// Connect providers. AuthURL, TokenURL and APIURL override the
+// endpoints of providers without discovery, such as GitHub Enterprise.
+type ProviderConfig struct {
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	APIURL       string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+func (c ProviderConfig) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func authCodeURL(endpoint string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + params.Encode()
+}
+
+func exchangeCode(ctx context.Context, client *http.Client, endpoint string, params url.Values) (tokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer res.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return tokenResponse{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if token.Error != "" {
+		return tokenResponse{}, fmt.Errorf("token endpoint returned %s: %s", token.Error, token.ErrorDescription)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return tokenResponse{}, fmt.Errorf("token endpoint returned status %d", res.StatusCode)
+	}
+
+	return token, nil
+}
+
+func withDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func splitName(name string) (string, string) {
+	firstname, lastname, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return firstname, strings.TrimSpace(lastname)
+}
@@ -0,0 +1,163 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type (
+	AuthUpdateMeRequest struct {
+		Firstname       *string `json:"firstname" validate:"omitempty,min=1,max=100"`
+		Lastname        *string `json:"lastname" validate:"omitempty,min=1,max=100"`
+		Email           *string `json:"email" validate:"omitempty,email,max=254"`
+		CurrentPassword string  `json:"current_password" validate:"required_with=Email"`
+	}
+
+	AuthMeResponse struct {
+		ID                 string `json:"id"`
+		Email              string `json:"email"`
+		Firstname          string `json:"firstname"`
+		Lastname           string `json:"lastname"`
+		EmailChangePending bool   `json:"email_change_pending,omitempty"`
+	}
+
+	AuthDeleteMeResponse struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+
+	AuthVerifyEmailChangeRequest struct {
+		Token string `json:"token" query:"token" validate:"required"`
+	}
+)
+
+func (r *AuthUpdateMeRequest) Normalize() {
+	if r.Firstname != nil {
+		firstname := normalizeName(*r.Firstname)
+		r.Firstname = &firstname
+	}
+	if r.Lastname != nil {
+		lastname := normalizeName(*r.Lastname)
+		r.Lastname = &lastname
+	}
+	if r.Email != nil {
+		email := normalizeEmail(*r.Email)
+		r.Email = &email
+	}
+}
+
+// @Summary Get profile
+// @Description Returns the logged in user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} AuthMeResponse
+// @Failure 401
+// @Router /me [get]
+func (h authHandler) Me(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	return ctx.JSON(http.StatusOK, AuthMeResponse{
+		ID:        user.ProviderID,
+		Email:     user.Email,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+	})
+}
+
+// @Summary Update profile
+// @Description Updates the user's names. A new email needs the current password and is applied once the link sent to it is followed.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param AuthUpdateMeRequest body AuthUpdateMeRequest true "Update Profile Request"
+// @Success 200 {object} AuthMeResponse
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 403
+// @Failure 409
+// @Router /me [patch]
+func (h authHandler) UpdateMe(ctx echo.Context) error {
+	var req AuthUpdateMeRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.UpdateProfile(ctx.Request().Context(), user, auth.ProfileUpdate{
+		Firstname: req.Firstname,
+		Lastname:  req.Lastname,
+		Email:     req.Email,
+
+		CurrentPassword: req.CurrentPassword,
+	})
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, AuthMeResponse{
+		ID:                 user.ProviderID,
+		Email:              res.Email,
+		Firstname:          res.Firstname,
+		Lastname:           res.Lastname,
+		EmailChangePending: req.Email != nil && *req.Email != user.Email,
+	})
+}
+
+// @Summary Verify email change
+// @Description Applies an email change with the token sent to the new address
+// @Tags auth
+// @Accept json
+// @Param token query string false "Email change token"
+// @Param AuthVerifyEmailChangeRequest body AuthVerifyEmailChangeRequest false "Verify Email Change Request"
+// @Success 204
+// @Failure 400
+// @Router /me/email/verify [get]
+// @Router /me/email/verify [post]
+func (h authHandler) VerifyEmailChange(ctx echo.Context) error {
+	var req AuthVerifyEmailChangeRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := h.service.ConfirmEmailChange(ctx.Request().Context(), req.Token); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// @Summary Delete account
+// @Description Schedules the account for deletion and logs the user out everywhere. Logging in before the grace period is over cancels the deletion.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} AuthDeleteMeResponse
+// @Router /me [delete]
+func (h authHandler) DeleteMe(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	deleteAt, err := h.service.DeleteAccount(ctx.Request().Context(), user)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	h.cookies.clearSession(ctx)
+
+	return ctx.JSON(http.StatusAccepted, AuthDeleteMeResponse{DeletionScheduledAt: deleteAt})
+}
@@ -1,44 +1,84 @@
 package rest
 
 import (
+	"errors"
+	"html/template"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/labstack/echo/v4"
 
 	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
 )
 
-const refreshTokenKey = "refresh_token"
-
 type authHandler struct {
-	service auth.Service
+	service   auth.Service
+	cookies   cookiePolicy
+	adminRole string
 }
 
 type (
 	AuthLoginRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Password string `json:"password" validate:"required"`
+		// Invitation is an organization invitation token accepted
+		// once the user is logged in.
+		Invitation string `json:"invitation,omitempty"`
 	}
 
 	AuthRegisterRequest struct {
-		Email     string `json:"email"`
-		Password  string `json:"password"`
-		Firstname string `json:"firstname"`
-		Lastname  string `json:"lastname"`
+		Email     string `json:"email" validate:"required,email,max=254"`
+		Password  string `json:"password" validate:"required"`
+		Firstname string `json:"firstname" validate:"required,max=100"`
+		Lastname  string `json:"lastname" validate:"required,max=100"`
+		// Invitation is an organization invitation token accepted
+		// once the user is registered.
+		Invitation string `json:"invitation,omitempty"`
 	}
 
 	AuthLoginResponse struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
+		AccessToken  string `json:"access_token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+	}
+
+	AuthForgotPasswordRequest struct {
+		Email string `json:"email" validate:"required,email,max=254"`
 	}
 
 	AuthResetPasswordRequest struct {
-		Password string `json:"password"`
+		Password string `json:"password" validate:"required"`
+	}
+
+	AuthChangePasswordRequest struct {
+		CurrentPassword     string `json:"current_password" validate:"required"`
+		NewPassword         string `json:"new_password" validate:"required"`
+		RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+	}
+
+	AuthRefreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	AuthMagicLinkRequest struct {
+		Email string `json:"email" validate:"required,email,max=254"`
+	}
+
+	AuthMagicLinkVerifyRequest struct {
+		Token string `json:"token" query:"token" form:"token" validate:"required"`
 	}
 )
 
+func (r *AuthLoginRequest) Normalize()          { r.Email = normalizeEmail(r.Email) }
+func (r *AuthForgotPasswordRequest) Normalize() { r.Email = normalizeEmail(r.Email) }
+func (r *AuthMagicLinkRequest) Normalize()      { r.Email = normalizeEmail(r.Email) }
+
+func (r *AuthRegisterRequest) Normalize() {
+	r.Email = normalizeEmail(r.Email)
+	r.Firstname = normalizeName(r.Firstname)
+	r.Lastname = normalizeName(r.Lastname)
+}
+
 // @Summary User login
 // @Description Logs in a user by email and password
 // @Tags auth
@@ -46,6 +86,7 @@ type (
 // @Produce json
 // @Param AuthLoginRequest body AuthLoginRequest true "Login Request"
 // @Success 200 {object} AuthLoginResponse
+// @Failure 400 {object} ValidationErrorResponse
 // @Router /login [post]
 func (h authHandler) Login(ctx echo.Context) error {
 	var req AuthLoginRequest
@@ -54,24 +95,28 @@ func (h authHandler) Login(ctx echo.Context) error {
 		return responsError(ctx, err)
 	}
 
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if req.Invitation != "" {
+		if err := h.service.CheckInvitation(ctx.Request().Context(), req.Invitation, req.Email); err != nil {
+			return responsError(ctx, err)
+		}
+	}
+
 	res, err := h.service.Login(ctx.Request().Context(), req.Email, req.Password)
 	if err != nil {
 		return responsError(ctx, err)
 	}
 
-	ctx.SetCookie(&http.Cookie{
-		Name:     refreshTokenKey,
-		Value:    res.RefreshToken,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour * 30),
-		HttpOnly: true,
-		Secure:   true,
-	})
+	if req.Invitation != "" {
+		if err := h.acceptInvitation(ctx, res, req.Invitation); err != nil {
+			return responsError(ctx, err)
+		}
+	}
 
-	return ctx.JSON(http.StatusOK, AuthLoginResponse{
-		AccessToken:  res.AccessToken,
-		RefreshToken: res.RefreshToken,
-	})
+	return h.cookies.sessionResponse(ctx, res)
 }
 
 // @Summary User registration
@@ -81,6 +126,8 @@ func (h authHandler) Login(ctx echo.Context) error {
 // @Produce json
 // @Param AuthRegisterRequest body AuthRegisterRequest true "Register Request"
 // @Success 200 {object} AuthLoginResponse
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 403 {object} map[string]string
 // @Router /register [post]
 func (h authHandler) Register(ctx echo.Context) error {
 	var req AuthRegisterRequest
@@ -89,24 +136,22 @@ func (h authHandler) Register(ctx echo.Context) error {
 		return responsError(ctx, err)
 	}
 
-	res, err := h.service.Register(ctx.Request().Context(), req.Email, req.Password, req.Firstname, req.Lastname)
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.Register(ctx.Request().Context(), req.Email, req.Password, req.Firstname, req.Lastname, req.Invitation)
 	if err != nil {
 		return responsError(ctx, err)
 	}
 
-	ctx.SetCookie(&http.Cookie{
-		Name:     refreshTokenKey,
-		Value:    res.RefreshToken,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour * 30),
-		HttpOnly: true,
-		Secure:   true,
-	})
+	if req.Invitation != "" {
+		if err := h.acceptInvitation(ctx, res, req.Invitation); err != nil {
+			return responsError(ctx, err)
+		}
+	}
 
-	return ctx.JSON(http.StatusOK, AuthLoginResponse{
-		AccessToken:  res.AccessToken,
-		RefreshToken: res.RefreshToken,
-	})
+	return h.cookies.sessionResponse(ctx, res)
 }
 
 // @Summary Forgot password
@@ -114,13 +159,22 @@ func (h authHandler) Register(ctx echo.Context) error {
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param email path string true "User Email"
+// @Param AuthForgotPasswordRequest body AuthForgotPasswordRequest true "Forgot Password Request"
 // @Success 204
-// @Router /forgot-password/{email} [post]
+// @Failure 400 {object} ValidationErrorResponse
+// @Router /forgot-password [post]
 func (h authHandler) ForgotPassword(ctx echo.Context) error {
-	email := ctx.Param("email")
+	var req AuthForgotPasswordRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
 
-	if err := h.service.ForgotPassword(ctx.Request().Context(), email); err != nil {
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := h.service.ForgotPassword(ctx.Request().Context(), req.Email); err != nil {
 		return responsError(ctx, err)
 	}
 
@@ -143,6 +197,10 @@ func (h authHandler) ResetPassword(ctx echo.Context) error {
 		return responsError(ctx, err)
 	}
 
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
 	token := ctx.Param("token")
 
 	if err := h.service.ResetPassword(ctx.Request().Context(), req.Password, token); err != nil {
@@ -152,44 +210,242 @@ func (h authHandler) ResetPassword(ctx echo.Context) error {
 	return ctx.NoContent(http.StatusOK)
 }
 
+// @Summary Change password
+// @Description Changes the password of the logged in user. Other sessions can be revoked at the same time, the current one is kept.
+// @Tags auth
+// @Accept json
+// @Security BearerAuth
+// @Param AuthChangePasswordRequest body AuthChangePasswordRequest true "Change Password Request"
+// @Success 204
+// @Failure 403
+// @Router /change-password [post]
+func (h authHandler) ChangePassword(ctx echo.Context) error {
+	var req AuthChangePasswordRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	user := ctx.Get("user").(entities.User)
+
+	err := h.service.ChangePassword(ctx.Request().Context(), user, req.CurrentPassword, req.NewPassword, req.RevokeOtherSessions, h.cookies.refreshToken(ctx))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// @Summary Verify email
+// @Description Verifies the user's email address
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param verificationId path string true "Verification ID"
+// @Success 204
+// @Router /verify-email/{verificationId} [post]
+func (h authHandler) VerifyEmail(ctx echo.Context) error {
+	verificationId := ctx.Param("verificationId")
+
+	if err := h.service.VerifyEmail(ctx.Request().Context(), verificationId); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusOK)
+}
+
 // @Summary Refresh token
-// @Description Refreshes the authentication token
+// @Description Exchanges the refresh token cookie, or the refresh token in the body for clients without cookies, for a new session. The session cookies are cleared if the token is rejected.
 // @Tags auth
 // @Accept json
 // @Produce json
+// @Param X-CSRF-Token header string false "CSRF token from /auth/csrf, required with the cookie"
+// @Param AuthRefreshRequest body AuthRefreshRequest false "Refresh Request"
 // @Success 200 {object} AuthLoginResponse
+// @Failure 401
 // @Router /refresh [post]
 func (h authHandler) Refresh(ctx echo.Context) error {
-	refreshToken, err := ctx.Cookie(refreshTokenKey)
+	refreshToken := h.cookies.refreshToken(ctx)
+	if refreshToken == "" {
+		var req AuthRefreshRequest
+		if err := ctx.Bind(&req); err != nil {
+			return responsError(ctx, err)
+		}
+		refreshToken = req.RefreshToken
+	}
+
+	if refreshToken == "" {
+		return responsError(ctx, auth.ErrSessionNotFound)
+	}
+
+	res, err := h.service.RefreshToken(ctx.Request().Context(), refreshToken)
+	if errors.Is(err, auth.ErrSessionNotFound) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		h.cookies.clearSession(ctx)
+	}
 	if err != nil {
 		return responsError(ctx, err)
 	}
 
-	res, err := h.service.RefreshToken(ctx.Request().Context(), refreshToken.Value)
+	return h.cookies.sessionResponse(ctx, res)
+}
+
+// @Summary Start OAuth login
+// @Description Redirects the user to the external identity provider
+// @Tags auth
+// @Param provider path string true "Provider" Enums(google, github, oidc)
+// @Success 302
+// @Router /oauth/{provider}/start [get]
+func (h authHandler) OAuthStart(ctx echo.Context) error {
+	redirectURL, err := h.service.OAuthStart(ctx.Request().Context(), ctx.Param("provider"))
 	if err != nil {
 		return responsError(ctx, err)
 	}
 
-	ctx.SetCookie(&http.Cookie{
-		Name:     refreshTokenKey,
-		Value:    res.RefreshToken,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour * 30),
-		HttpOnly: true,
-		Secure:   true,
-	})
+	return ctx.Redirect(http.StatusFound, redirectURL)
+}
 
-	return ctx.JSON(http.StatusOK, AuthLoginResponse{
-		AccessToken:  res.AccessToken,
-		RefreshToken: res.RefreshToken,
-	})
+// @Summary OAuth callback
+// @Description Finishes the login with an external identity provider
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider" Enums(google, github, oidc)
+// @Param state query string true "State"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} AuthLoginResponse
+// @Router /oauth/{provider}/callback [get]
+func (h authHandler) OAuthCallback(ctx echo.Context) error {
+	if errCode := ctx.QueryParam("error"); errCode != "" {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errCode})
+	}
+
+	res, err := h.service.OAuthCallback(ctx.Request().Context(), ctx.Param("provider"), ctx.QueryParam("state"), ctx.QueryParam("code"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return h.cookies.sessionResponse(ctx, res)
 }
 
-func (h authHandler) middlewareExtractUser(next echo.HandlerFunc) echo.HandlerFunc {
+// @Summary Request magic link
+// @Description Emails a single use login link. Responds the same way whether or not the email is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param AuthMagicLinkRequest body AuthMagicLinkRequest true "Magic Link Request"
+// @Success 202
+// @Failure 429
+// @Router /magic-link [post]
+func (h authHandler) RequestMagicLink(ctx echo.Context) error {
+	var req AuthMagicLinkRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := h.service.RequestMagicLink(ctx.Request().Context(), req.Email); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusAccepted)
+}
+
+// magicLinkPage asks the user to confirm the login. Mail scanners open
+// links to check them, the token is only used by the form's POST.
+var magicLinkPage = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="referrer" content="no-referrer">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Log in</title>
+</head>
+<body>
+<form method="post">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// @Summary Confirm magic link
+// @Description The page the magic link opens. It does not use the token, it asks the user to confirm the login, which posts the token to the same url.
+// @Tags auth
+// @Produce html
+// @Param token query string true "Token"
+// @Success 200 {string} string "Confirmation page"
+// @Router /magic-link/verify [get]
+func (h authHandler) ConfirmMagicLink(ctx echo.Context) error {
+	var req AuthMagicLinkVerifyRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	var page strings.Builder
+	if err := magicLinkPage.Execute(&page, req.Token); err != nil {
+		return responsError(ctx, err)
+	}
+
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	return ctx.HTML(http.StatusOK, page.String())
+}
+
+// @Summary Verify magic link
+// @Description Exchanges the token from a magic link for a session. The token can be sent as a query parameter, as json or as a form.
+// @Tags auth
+// @Accept json
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token query string false "Token"
+// @Param AuthMagicLinkVerifyRequest body AuthMagicLinkVerifyRequest false "Magic Link Verify Request"
+// @Success 200 {object} AuthLoginResponse
+// @Router /magic-link/verify [post]
+func (h authHandler) VerifyMagicLink(ctx echo.Context) error {
+	var req AuthMagicLinkVerifyRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.VerifyMagicLink(ctx.Request().Context(), req.Token)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return h.cookies.sessionResponse(ctx, res)
+}
+
+// middlewareAuthenticate accepts a Bearer access token, from the header
+// or the cookie, or an API key of a service account sent as
+// "Authorization: ApiKey <key>". It sets "user" for tokens and
+// "service_account" and "api_key" for keys. Read only impersonations
+// are limited to reading.
+func (h authHandler) middlewareAuthenticate(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
 		accessToken := ctx.Request().Header.Get("Authorization")
 		if accessToken == "" {
-			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "access token required"})
+			accessToken = h.cookies.accessToken(ctx)
+			if accessToken == "" {
+				return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "access token required"})
+			}
+			accessToken = "Bearer " + accessToken
 		}
 
 		accessParts := strings.Split(accessToken, " ")
@@ -197,17 +453,42 @@ func (h authHandler) middlewareExtractUser(next echo.HandlerFunc) echo.HandlerFu
 			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid access token"})
 		}
 
-		if accessParts[0] != "Bearer" {
-			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "token has to be bearer"})
+		switch accessParts[0] {
+		case "Bearer":
+			res, err := h.service.VerifyToken(ctx.Request().Context(), accessParts[1])
+			if err != nil {
+				return responsError(ctx, err)
+			}
+
+			if res.ImpersonationReadOnly && !allowedReadOnly(ctx) {
+				return responsError(ctx, auth.ErrImpersonationReadOnly)
+			}
+
+			ctx.Set("user", res)
+		case "ApiKey":
+			account, key, err := h.service.AuthenticateAPIKey(ctx.Request().Context(), accessParts[1])
+			if err != nil {
+				return responsError(ctx, err)
+			}
+
+			ctx.Set("service_account", account)
+			ctx.Set("api_key", key)
+		default:
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "token has to be bearer or an api key"})
 		}
 
-		res, err := h.service.VerifyToken(ctx.Request().Context(), accessParts[1])
-		if err != nil {
-			return responsError(ctx, err)
-		}
+		return next(ctx)
+	}
+}
 
-		ctx.Set("user", res)
+// middlewareExtractUser is middlewareAuthenticate for routes that act on
+// the user's own account, service accounts are rejected.
+func (h authHandler) middlewareExtractUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return h.middlewareAuthenticate(func(ctx echo.Context) error {
+		if _, ok := ctx.Get("user").(entities.User); !ok {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": "user access token required"})
+		}
 
 		return next(ctx)
-	}
+	})
 }
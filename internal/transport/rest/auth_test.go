@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestConfirmMagicLinkDoesNotUseToken(t *testing.T) {
+	router := echo.New()
+	router.Validator = newRequestValidator()
+
+	// the zero service panics on use, the page must not touch it
+	h := authHandler{}
+	router.GET("/auth/magic-link/verify", h.ConfirmMagicLink)
+
+	req := httptest.NewRequest(http.MethodGet, `/auth/magic-link/verify?token=abc"><script>`, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, `<form method="post">`) {
+		t.Error("page has no form posting the token")
+	}
+	if !strings.Contains(body, `value="abc&#34;&gt;&lt;script&gt;"`) {
+		t.Errorf("token is not escaped in %s", body)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("page may be cached")
+	}
+}
+
+func TestConfirmMagicLinkRequiresToken(t *testing.T) {
+	router := echo.New()
+	router.Validator = newRequestValidator()
+	router.GET("/auth/magic-link/verify", authHandler{}.ConfirmMagicLink)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/magic-link/verify", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+)
+
+const hostPrefix = "__Host-"
+
+// cookiePolicy decides how a session is handed to the client. Every
+// handler that starts a session responds through sessionResponse.
+type cookiePolicy struct {
+	refreshName     string
+	accessName      string
+	domain          string
+	path            string
+	sameSite        http.SameSite
+	secure          bool
+	accessCookie    bool
+	tokensInBody    bool
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+func newCookiePolicy(cfg config.Config) cookiePolicy {
+	c := cfg.Cookies
+
+	p := cookiePolicy{
+		refreshName:     c.RefreshTokenName,
+		accessName:      c.AccessTokenName,
+		domain:          c.Domain,
+		path:            c.Path,
+		secure:          c.Secure,
+		accessCookie:    c.AccessToken,
+		tokensInBody:    c.TokensInBody,
+		accessTokenTTL:  cfg.Sessions.AccessTokenTTL,
+		refreshTokenTTL: cfg.Sessions.RefreshTokenTTL,
+	}
+
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		p.sameSite = http.SameSiteStrictMode
+	case "none":
+		// browsers drop SameSite=None cookies that are not secure
+		p.sameSite = http.SameSiteNoneMode
+		p.secure = true
+	default:
+		p.sameSite = http.SameSiteLaxMode
+	}
+
+	if c.HostPrefix {
+		p.refreshName = hostPrefix + strings.TrimPrefix(p.refreshName, hostPrefix)
+		p.accessName = hostPrefix + strings.TrimPrefix(p.accessName, hostPrefix)
+		p.domain = ""
+		p.path = "/"
+		p.secure = true
+	}
+
+	return p
+}
+
+// sessionResponse sets the session cookies and writes the tokens that
+// are not delivered as cookies, or all of them if tokens_in_body is on.
+func (p cookiePolicy) sessionResponse(ctx echo.Context, session auth.Session) error {
+	ctx.SetCookie(p.cookie(p.refreshName, session.RefreshToken, p.refreshTokenTTL))
+
+	if p.accessCookie {
+		ctx.SetCookie(p.cookie(p.accessName, session.AccessToken, p.accessTokenTTL))
+	}
+
+	var res AuthLoginResponse
+	if p.tokensInBody || !p.accessCookie {
+		res.AccessToken = session.AccessToken
+	}
+	if p.tokensInBody {
+		res.RefreshToken = session.RefreshToken
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// clearSession removes the session cookies from the browser.
+func (p cookiePolicy) clearSession(ctx echo.Context) {
+	ctx.SetCookie(p.cookie(p.refreshName, "", -1))
+
+	if p.accessCookie {
+		ctx.SetCookie(p.cookie(p.accessName, "", -1))
+	}
+}
+
+func (p cookiePolicy) refreshToken(ctx echo.Context) string {
+	cookie, err := ctx.Cookie(p.refreshName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// accessToken returns the access token cookie, it is only read when
+// access tokens are delivered as cookies.
+func (p cookiePolicy) accessToken(ctx echo.Context) string {
+	if !p.accessCookie {
+		return ""
+	}
+
+	cookie, err := ctx.Cookie(p.accessName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (p cookiePolicy) cookie(name, value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   p.domain,
+		Path:     p.path,
+		HttpOnly: true,
+		Secure:   p.secure,
+		SameSite: p.sameSite,
+	}
+
+	if maxAge < 0 {
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+	} else {
+		c.MaxAge = int(maxAge.Seconds())
+		c.Expires = time.Now().Add(maxAge)
+	}
+
+	return c
+}
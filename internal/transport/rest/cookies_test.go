@@ -0,0 +1,194 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+)
+
+func testCookieConfig() config.Config {
+	var cfg config.Config
+	cfg.Cookies.RefreshTokenName = "refresh_token"
+	cfg.Cookies.AccessTokenName = "access_token"
+	cfg.Cookies.Domain = "example.com"
+	cfg.Cookies.Path = "/auth"
+	cfg.Cookies.SameSite = "strict"
+	cfg.Cookies.Secure = true
+	cfg.Sessions.AccessTokenTTL = 15 * time.Minute
+	cfg.Sessions.RefreshTokenTTL = 30 * 24 * time.Hour
+	return cfg
+}
+
+// serveSession logs in on a router that hands out and clears sessions
+// like the auth handlers do, and returns the response cookies by name.
+func serveSession(t *testing.T, cfg config.Config, method string) (*httptest.ResponseRecorder, map[string]*http.Cookie) {
+	t.Helper()
+
+	h := authHandler{cookies: newCookiePolicy(cfg)}
+
+	router := echo.New()
+	router.POST("/auth/login", func(ctx echo.Context) error {
+		return h.cookies.sessionResponse(ctx, auth.Session{AccessToken: "access", RefreshToken: "refresh"})
+	})
+	router.DELETE("/auth/me", func(ctx echo.Context) error {
+		h.cookies.clearSession(ctx)
+		return ctx.NoContent(http.StatusNoContent)
+	})
+
+	path := "/auth/login"
+	if method == http.MethodDelete {
+		path = "/auth/me"
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range rec.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	return rec, cookies
+}
+
+func TestSessionCookies(t *testing.T) {
+	rec, cookies := serveSession(t, testCookieConfig(), http.MethodPost)
+
+	if len(cookies) != 1 {
+		t.Fatalf("cookies %v, want only the refresh token", cookies)
+	}
+
+	c := cookies["refresh_token"]
+	if c == nil || c.Value != "refresh" {
+		t.Fatalf("refresh cookie %v", c)
+	}
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteStrictMode {
+		t.Errorf("refresh cookie is not locked down: %v", c)
+	}
+	if c.Domain != "example.com" || c.Path != "/auth" {
+		t.Errorf("refresh cookie domain %q path %q", c.Domain, c.Path)
+	}
+	if want := int((30 * 24 * time.Hour).Seconds()); c.MaxAge != want {
+		t.Errorf("refresh cookie max age %d, want %d", c.MaxAge, want)
+	}
+
+	var res AuthLoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.AccessToken != "access" || res.RefreshToken != "" {
+		t.Errorf("body %+v, want only the access token", res)
+	}
+}
+
+func TestSessionCookiesHostPrefix(t *testing.T) {
+	cfg := testCookieConfig()
+	cfg.Cookies.HostPrefix = true
+	cfg.Cookies.Secure = false
+	cfg.Cookies.AccessToken = true
+
+	_, cookies := serveSession(t, cfg, http.MethodPost)
+
+	for _, name := range []string{"__Host-refresh_token", "__Host-access_token"} {
+		c := cookies[name]
+		if c == nil {
+			t.Fatalf("no %s cookie in %v", name, cookies)
+		}
+		// browsers reject __Host- cookies that are not secure, have a
+		// domain or a path other than /
+		if !c.Secure || c.Domain != "" || c.Path != "/" {
+			t.Errorf("%s secure %v domain %q path %q", name, c.Secure, c.Domain, c.Path)
+		}
+	}
+}
+
+func TestSessionCookiesSameSite(t *testing.T) {
+	tests := []struct {
+		sameSite string
+		want     http.SameSite
+		secure   bool
+	}{
+		{"strict", http.SameSiteStrictMode, false},
+		{"Strict", http.SameSiteStrictMode, false},
+		{"lax", http.SameSiteLaxMode, false},
+		{"", http.SameSiteLaxMode, false},
+		{"none", http.SameSiteNoneMode, true},
+	}
+
+	for _, tt := range tests {
+		cfg := testCookieConfig()
+		cfg.Cookies.SameSite = tt.sameSite
+		cfg.Cookies.Secure = false
+
+		_, cookies := serveSession(t, cfg, http.MethodPost)
+
+		c := cookies["refresh_token"]
+		if c.SameSite != tt.want || c.Secure != tt.secure {
+			t.Errorf("%q: samesite %v secure %v, want %v %v", tt.sameSite, c.SameSite, c.Secure, tt.want, tt.secure)
+		}
+	}
+}
+
+func TestSessionAccessCookie(t *testing.T) {
+	tests := []struct {
+		name         string
+		tokensInBody bool
+		want         AuthLoginResponse
+	}{
+		{"cookies only", false, AuthLoginResponse{}},
+		{"tokens in body", true, AuthLoginResponse{AccessToken: "access", RefreshToken: "refresh"}},
+	}
+
+	for _, tt := range tests {
+		cfg := testCookieConfig()
+		cfg.Cookies.AccessToken = true
+		cfg.Cookies.TokensInBody = tt.tokensInBody
+
+		rec, cookies := serveSession(t, cfg, http.MethodPost)
+
+		c := cookies["access_token"]
+		if c == nil || c.Value != "access" || !c.HttpOnly || !c.Secure {
+			t.Fatalf("%s: access cookie %v", tt.name, c)
+		}
+		if want := int((15 * time.Minute).Seconds()); c.MaxAge != want {
+			t.Errorf("%s: access cookie max age %d, want %d", tt.name, c.MaxAge, want)
+		}
+
+		var res AuthLoginResponse
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res != tt.want {
+			t.Errorf("%s: body %+v, want %+v", tt.name, res, tt.want)
+		}
+	}
+}
+
+func TestClearSession(t *testing.T) {
+	cfg := testCookieConfig()
+	cfg.Cookies.HostPrefix = true
+	cfg.Cookies.AccessToken = true
+
+	_, cookies := serveSession(t, cfg, http.MethodDelete)
+
+	for _, name := range []string{"__Host-refresh_token", "__Host-access_token"} {
+		c := cookies[name]
+		if c == nil {
+			t.Fatalf("%s is not cleared: %v", name, cookies)
+		}
+		// the attributes must match the ones the cookie was set with or
+		// the browser keeps it
+		if c.Value != "" || c.MaxAge >= 0 || c.Expires.After(time.Unix(0, 0)) {
+			t.Errorf("%s value %q max age %d expires %v", name, c.Value, c.MaxAge, c.Expires)
+		}
+		if !c.Secure || !c.HttpOnly || c.Path != "/" || c.Domain != "" {
+			t.Errorf("%s secure %v httponly %v path %q domain %q", name, c.Secure, c.HttpOnly, c.Path, c.Domain)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+)
+
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+// @Summary CSRF token
+// @Description Returns the token to send in the X-CSRF-Token header with requests that authenticate with cookies. The same token is set as a cookie.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} CSRFTokenResponse
+// @Router /csrf [get]
+func (h authHandler) CSRFToken(ctx echo.Context) error {
+	token, _ := ctx.Get("csrf").(string)
+	return ctx.JSON(http.StatusOK, CSRFTokenResponse{CSRFToken: token})
+}
+
+func middlewareCORS(cfg config.Config) echo.MiddlewareFunc {
+	if len(cfg.CORS.AllowOrigins) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     cfg.CORS.AllowOrigins,
+		AllowCredentials: true,
+		AllowHeaders: []string{
+			echo.HeaderAuthorization,
+			echo.HeaderContentType,
+			cfg.CSRF.HeaderName,
+			"X-Device-Name",
+			cfg.Tenancy.Header,
+		},
+		ExposeHeaders: []string{echo.HeaderXRequestID},
+		MaxAge:        int(cfg.CORS.MaxAge.Seconds()),
+	})
+}
+
+// middlewareCSRF protects endpoints that authenticate with cookies. It
+// rejects unsafe requests from untrusted origins and checks the
+// double submitted token. Requests with an Authorization header are
+// skipped, browsers do not attach it on their own.
+func middlewareCSRF(cfg config.Config, cookies cookiePolicy) echo.MiddlewareFunc {
+	if !cfg.CSRF.Enabled {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+
+	// requests without session cookies carry nothing a forged request
+	// could use, token clients send the refresh token in the body
+	skipper := func(ctx echo.Context) bool {
+		if ctx.Request().Header.Get(echo.HeaderAuthorization) != "" {
+			return true
+		}
+
+		switch ctx.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return false
+		}
+
+		return cookies.refreshToken(ctx) == "" && cookies.accessToken(ctx) == ""
+	}
+
+	name := cfg.CSRF.CookieName
+	if strings.HasPrefix(cookies.refreshName, hostPrefix) {
+		name = hostPrefix + strings.TrimPrefix(name, hostPrefix)
+	}
+
+	tokens := middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper:        skipper,
+		TokenLookup:    "header:" + cfg.CSRF.HeaderName,
+		CookieName:     name,
+		CookieDomain:   cookies.domain,
+		CookiePath:     cookies.path,
+		CookieMaxAge:   int(cookies.refreshTokenTTL.Seconds()),
+		CookieSecure:   cookies.secure,
+		CookieSameSite: cookies.sameSite,
+		ErrorHandler: func(err error, ctx echo.Context) error {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": "invalid csrf token"})
+		},
+	})
+
+	trusted := append(slices.Clone(cfg.CORS.AllowOrigins), cfg.CSRF.TrustedOrigins...)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		checked := tokens(next)
+
+		return func(ctx echo.Context) error {
+			if skipper(ctx) {
+				return next(ctx)
+			}
+
+			switch ctx.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				if !trustedOrigin(ctx.Request(), trusted) {
+					return ctx.JSON(http.StatusForbidden, map[string]string{"error": "untrusted origin"})
+				}
+			}
+
+			return checked(ctx)
+		}
+	}
+}
+
+// trustedOrigin checks the Origin header, or the Referer if there is
+// none. Requests without either are not from a browser and allowed.
+func trustedOrigin(req *http.Request, trusted []string) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		referer := req.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+
+		u, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	if slices.Contains(trusted, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return u.Host == req.Host
+}
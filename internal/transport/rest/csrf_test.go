@@ -0,0 +1,175 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+)
+
+func testCSRFConfig() config.Config {
+	var cfg config.Config
+	cfg.CSRF.Enabled = true
+	cfg.CSRF.CookieName = "csrf_token"
+	cfg.CSRF.HeaderName = "X-CSRF-Token"
+	cfg.CORS.AllowOrigins = []string{"https://app.example.com"}
+	cfg.Cookies.RefreshTokenName = "refresh_token"
+	cfg.Cookies.AccessTokenName = "access_token"
+	cfg.Cookies.Path = "/"
+	cfg.Cookies.Secure = true
+	return cfg
+}
+
+func newCSRFRouter(cfg config.Config) *echo.Echo {
+	cookies := newCookiePolicy(cfg)
+	csrf := middlewareCSRF(cfg, cookies)
+	h := authHandler{cookies: cookies}
+
+	router := echo.New()
+	router.GET("/auth/csrf", h.CSRFToken, csrf)
+	router.POST("/auth/refresh", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusNoContent)
+	}, csrf)
+
+	return router
+}
+
+// csrfToken fetches a token and its cookie like a browser would.
+func csrfToken(t *testing.T, router *echo.Echo) (string, *http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/csrf", nil))
+
+	var res CSRFTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Value == res.CSRFToken {
+			return res.CSRFToken, c
+		}
+	}
+	t.Fatalf("no cookie for token %q", res.CSRFToken)
+	return "", nil
+}
+
+func TestCSRF(t *testing.T) {
+	router := newCSRFRouter(testCSRFConfig())
+	token, cookie := csrfToken(t, router)
+
+	session := &http.Cookie{Name: "refresh_token", Value: "refresh"}
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		header  map[string]string
+		want    int
+	}{
+		{
+			name:    "token",
+			cookies: []*http.Cookie{session, cookie},
+			header:  map[string]string{"X-CSRF-Token": token},
+			want:    http.StatusNoContent,
+		},
+		{
+			name:    "missing header",
+			cookies: []*http.Cookie{session, cookie},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "mismatched header",
+			cookies: []*http.Cookie{session, cookie},
+			header:  map[string]string{"X-CSRF-Token": token + "x"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "header without cookie",
+			cookies: []*http.Cookie{session},
+			header:  map[string]string{"X-CSRF-Token": token},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "untrusted origin",
+			cookies: []*http.Cookie{session, cookie},
+			header:  map[string]string{"X-CSRF-Token": token, "Origin": "https://evil.example.com"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "untrusted referer",
+			cookies: []*http.Cookie{session, cookie},
+			header:  map[string]string{"X-CSRF-Token": token, "Referer": "https://evil.example.com/page"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "cors origin",
+			cookies: []*http.Cookie{session, cookie},
+			header:  map[string]string{"X-CSRF-Token": token, "Origin": "https://app.example.com"},
+			want:    http.StatusNoContent,
+		},
+		{
+			name:    "same origin",
+			cookies: []*http.Cookie{session, cookie},
+			header:  map[string]string{"X-CSRF-Token": token, "Origin": "http://example.com"},
+			want:    http.StatusNoContent,
+		},
+		{
+			name:    "bearer token",
+			cookies: []*http.Cookie{session},
+			header:  map[string]string{"Authorization": "Bearer access", "Origin": "https://evil.example.com"},
+			want:    http.StatusNoContent,
+		},
+		{
+			name: "no session cookie",
+			want: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		for _, c := range tt.cookies {
+			req.AddCookie(c)
+		}
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+func TestCSRFHostPrefix(t *testing.T) {
+	cfg := testCSRFConfig()
+	cfg.Cookies.HostPrefix = true
+
+	_, cookie := csrfToken(t, newCSRFRouter(cfg))
+	if cookie.Name != "__Host-csrf_token" || !cookie.Secure || cookie.Path != "/" || cookie.Domain != "" {
+		t.Errorf("cookie %s secure %v path %q domain %q", cookie.Name, cookie.Secure, cookie.Path, cookie.Domain)
+	}
+}
+
+func TestCSRFDisabled(t *testing.T) {
+	cfg := testCSRFConfig()
+	cfg.CSRF.Enabled = false
+	router := newCSRFRouter(cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh"})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
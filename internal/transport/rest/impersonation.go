@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// impersonationEndPath can be called by read only impersonations, it
+// is how they end.
+const impersonationEndPath = "/auth/impersonation/end"
+
+type AdminStartImpersonationRequest struct {
+	UserID   string `json:"user_id" validate:"required"`
+	Reason   string `json:"reason" validate:"required,max=500"`
+	ReadOnly bool   `json:"read_only"`
+	// TTL is a duration like 30m, the server default is used when it
+	// is empty.
+	TTL string `json:"ttl"`
+}
+
+// @Summary Impersonate user
+// @Description Issues a short lived access token for the user to the admin, with the admin in its act claim. Read only impersonations can only make GET requests. Admins can not be impersonated. Needs a user token, API keys can not impersonate.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body AdminStartImpersonationRequest true "Impersonation"
+// @Success 201 {object} auth.ImpersonationToken
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 403
+// @Failure 404
+// @Router /admin/impersonations [post]
+func (h authHandler) StartImpersonation(ctx echo.Context) error {
+	admin, ok := ctx.Get("user").(entities.User)
+	if !ok {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": "user access token required"})
+	}
+
+	var req AdminStartImpersonationRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return responsError(ctx, validationError{fields: map[string]string{"ttl": "must be a duration like 30m"}})
+		}
+		ttl = d
+	}
+
+	res, err := h.service.StartImpersonation(ctx.Request().Context(), admin, req.UserID, req.Reason, req.ReadOnly, ttl)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// @Summary List active impersonations
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {array} entities.Impersonation
+// @Failure 403
+// @Router /admin/impersonations [get]
+func (h authHandler) ListImpersonations(ctx echo.Context) error {
+	res, err := h.service.ListActiveImpersonations(ctx.Request().Context())
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary End impersonation
+// @Description Ends an impersonation, its token stops working right away.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Impersonation ID"
+// @Success 204
+// @Failure 404
+// @Router /admin/impersonations/{id} [delete]
+func (h authHandler) AdminEndImpersonation(ctx echo.Context) error {
+	if err := h.service.EndImpersonation(ctx.Request().Context(), actorID(ctx), ctx.Param("id")); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// @Summary End own impersonation
+// @Description Ends the impersonation the token was issued for.
+// @Tags auth
+// @Security BearerAuth
+// @Success 204
+// @Failure 404
+// @Router /impersonation/end [post]
+func (h authHandler) EndImpersonation(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	if user.ImpersonationID == "" {
+		return responsError(ctx, auth.ErrImpersonationNotFound)
+	}
+
+	if err := h.service.EndImpersonation(ctx.Request().Context(), user.ImpersonatorID, user.ImpersonationID); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// middlewareDenyImpersonation rejects impersonations on routes that
+// take over or remove the account, like changing its password.
+func (h authHandler) middlewareDenyImpersonation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if user, ok := ctx.Get("user").(entities.User); ok && user.ImpersonationID != "" {
+			return responsError(ctx, auth.ErrImpersonationForbidden)
+		}
+
+		return next(ctx)
+	}
+}
+
+// allowedReadOnly tells whether a read only impersonation can make the
+// request.
+func allowedReadOnly(ctx echo.Context) bool {
+	switch ctx.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return ctx.Path() == impersonationEndPath
+}
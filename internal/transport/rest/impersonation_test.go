@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+func TestAllowedReadOnly(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodGet, "/auth/me", true},
+		{http.MethodHead, "/auth/me", true},
+		{http.MethodOptions, "/auth/me", true},
+		{http.MethodPost, "/auth/me/password", false},
+		{http.MethodPut, "/auth/me", false},
+		{http.MethodPatch, "/auth/me", false},
+		{http.MethodDelete, "/auth/me", false},
+		{http.MethodPost, impersonationEndPath, true},
+	}
+
+	for _, tt := range tests {
+		router := echo.New()
+
+		var got bool
+		router.Add(tt.method, tt.path, func(ctx echo.Context) error {
+			got = allowedReadOnly(ctx)
+			return ctx.NoContent(http.StatusNoContent)
+		})
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+		if got != tt.want {
+			t.Errorf("%s %s: allowed %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareDenyImpersonation(t *testing.T) {
+	tests := []struct {
+		name string
+		user entities.User
+		want int
+	}{
+		{"user", entities.User{ProviderID: "user-1"}, http.StatusNoContent},
+		{"impersonation", entities.User{ProviderID: "user-1", ImpersonatorID: "admin-1", ImpersonationID: "impersonation-1"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		router := echo.New()
+		h := authHandler{}
+
+		authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				ctx.Set("user", tt.user)
+				return next(ctx)
+			}
+		}
+		router.POST("/auth/me/password", func(ctx echo.Context) error {
+			return ctx.NoContent(http.StatusNoContent)
+		}, authenticate, h.middlewareDenyImpersonation)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/me/password", nil))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+)
+
+// apiKeyIntrospectScope lets a service account introspect tokens.
+const apiKeyIntrospectScope = "introspect"
+
+type AuthIntrospectRequest struct {
+	Token         string `json:"token" form:"token" validate:"required"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+// @Summary Introspect token
+// @Description Tells other services whether an access token is active and what it grants, as defined by RFC 7662. Callers authenticate with their service credentials using HTTP basic auth, or with an API key that has the introspect scope. Only access tokens are supported, anything else is reported as inactive.
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token"
+// @Param token_type_hint formData string false "Token type hint"
+// @Success 200 {object} auth.TokenIntrospection
+// @Failure 401
+// @Router /introspect [post]
+func (h authHandler) Introspect(ctx echo.Context) error {
+	var req AuthIntrospectRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	if req.TokenTypeHint == "refresh_token" {
+		return ctx.JSON(http.StatusOK, map[string]bool{"active": false})
+	}
+
+	res, err := h.service.IntrospectToken(ctx.Request().Context(), req.Token)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// middlewareServiceAuth lets in the services configured for
+// introspection, authenticated with basic auth, and service accounts
+// with an API key that has the introspect scope.
+func (h authHandler) middlewareServiceAuth(cfg config.Config) echo.MiddlewareFunc {
+	clients := cfg.Introspection.Clients
+
+	basic := middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "introspection",
+		Validator: func(id, secret string, c echo.Context) (bool, error) {
+			expected, ok := clients[id]
+			if !ok || expected == "" {
+				return false, nil
+			}
+			return subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1, nil
+		},
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withBasic := basic(next)
+
+		return func(ctx echo.Context) error {
+			scheme, apiKey, ok := strings.Cut(ctx.Request().Header.Get(echo.HeaderAuthorization), " ")
+			if !ok || scheme != "ApiKey" {
+				return withBasic(ctx)
+			}
+
+			account, key, err := h.service.AuthenticateAPIKey(ctx.Request().Context(), apiKey)
+			if err != nil {
+				return responsError(ctx, err)
+			}
+
+			if !slices.Contains(key.Scopes, apiKeyIntrospectScope) {
+				return ctx.JSON(http.StatusForbidden, map[string]string{"error": "api key lacks the introspect scope"})
+			}
+
+			ctx.Set("service_account", account)
+			ctx.Set("api_key", key)
+
+			return next(ctx)
+		}
+	}
+}
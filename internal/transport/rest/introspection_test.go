@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+)
+
+func TestMiddlewareServiceAuth(t *testing.T) {
+	var cfg config.Config
+	cfg.Introspection.Clients = map[string]string{
+		"billing": "secret1",
+		"reports": "",
+	}
+
+	router := echo.New()
+	h := authHandler{}
+	router.POST("/auth/introspect", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusNoContent)
+	}, h.middlewareServiceAuth(cfg))
+
+	tests := []struct {
+		name string
+		auth func(*http.Request)
+		want int
+	}{
+		{"client", func(r *http.Request) { r.SetBasicAuth("billing", "secret1") }, http.StatusNoContent},
+		{"wrong secret", func(r *http.Request) { r.SetBasicAuth("billing", "secret2") }, http.StatusUnauthorized},
+		{"unknown client", func(r *http.Request) { r.SetBasicAuth("orders", "secret1") }, http.StatusUnauthorized},
+		{"client without secret", func(r *http.Request) { r.SetBasicAuth("reports", "") }, http.StatusUnauthorized},
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusUnauthorized},
+		{"none", func(r *http.Request) {}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/auth/introspect", strings.NewReader(url.Values{"token": {"token"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		tt.auth(req)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package rest
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/oidc"
+)
+
+type oidcHandler struct {
+	service oidc.Service
+}
+
+type OIDCErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// @Summary OpenID Connect discovery
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} oidc.Discovery
+// @Router /.well-known/openid-configuration [get]
+func (h oidcHandler) Discovery(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, h.service.Discovery())
+}
+
+// @Summary JSON Web Key Set
+// @Description Public keys used to sign id and access tokens
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} jwks.Set
+// @Router /.well-known/jwks.json [get]
+func (h oidcHandler) JWKS(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, h.service.JWKS())
+}
+
+// @Summary Authorization endpoint
+// @Description Starts the authorization code flow. The user is identified by a bearer token, by email and password posted from the login page, or is sent to the login page.
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Param response_type query string true "Response type" Enums(code)
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Redirect URI"
+// @Param scope query string false "Scope"
+// @Param state query string false "State"
+// @Param nonce query string false "Nonce"
+// @Param code_challenge query string false "PKCE code challenge"
+// @Param code_challenge_method query string false "PKCE method" Enums(S256, plain)
+// @Success 302
+// @Failure 400 {object} OIDCErrorResponse
+// @Router /oauth2/authorize [get]
+func (h oidcHandler) Authorize(ctx echo.Context) error {
+	var req oidc.AuthorizeRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return oidcError(ctx, fmt.Errorf("%w: %s", oidc.ErrInvalidRequest, err.Error()))
+	}
+
+	if _, err := h.service.ValidateAuthorizeRequest(ctx.Request().Context(), req); err != nil {
+		return oidcError(ctx, err)
+	}
+
+	var (
+		redirectURL string
+		err         error
+	)
+
+	if email := ctx.FormValue("email"); ctx.Request().Method == http.MethodPost && email != "" {
+		redirectURL, err = h.service.AuthorizeWithPassword(ctx.Request().Context(), req, email, ctx.FormValue("password"))
+	} else if token := bearerToken(ctx); token != "" {
+		redirectURL, err = h.service.AuthorizeWithToken(ctx.Request().Context(), req, token)
+	} else {
+		redirectURL, err = h.service.LoginRedirect(req)
+	}
+
+	if err != nil {
+		if oidc.ErrorCode(err) == "server_error" {
+			slog.Default().ErrorContext(ctx.Request().Context(), "failed to authorize", "err", err.Error())
+		}
+		return ctx.Redirect(http.StatusFound, h.service.ErrorRedirect(req, err))
+	}
+
+	return ctx.Redirect(http.StatusFound, redirectURL)
+}
+
+// @Summary Token endpoint
+// @Description Supports the authorization_code, refresh_token and client_credentials grants. Clients authenticate with HTTP basic auth or client_id and client_secret in the body.
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "Grant type" Enums(authorization_code, refresh_token, client_credentials)
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Scope"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} oidc.TokenResponse
+// @Failure 400 {object} OIDCErrorResponse
+// @Failure 401 {object} OIDCErrorResponse
+// @Router /oauth2/token [post]
+func (h oidcHandler) Token(ctx echo.Context) error {
+	var req oidc.TokenRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return oidcError(ctx, fmt.Errorf("%w: %s", oidc.ErrInvalidRequest, err.Error()))
+	}
+
+	if id, secret, ok := ctx.Request().BasicAuth(); ok {
+		req.ClientID, _ = url.QueryUnescape(id)
+		req.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	res, err := h.service.Token(ctx.Request().Context(), req)
+	if err != nil {
+		return oidcError(ctx, err)
+	}
+
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	ctx.Response().Header().Set("Pragma", "no-cache")
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary UserInfo endpoint
+// @Tags oidc
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} oidc.UserInfo
+// @Failure 401 {object} OIDCErrorResponse
+// @Router /oauth2/userinfo [get]
+func (h oidcHandler) UserInfo(ctx echo.Context) error {
+	token := bearerToken(ctx)
+	if token == "" {
+		ctx.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return oidcError(ctx, oidc.ErrInvalidToken)
+	}
+
+	res, err := h.service.UserInfo(ctx.Request().Context(), token)
+	if err != nil {
+		ctx.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return oidcError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary End session endpoint
+// @Description Revokes the client's refresh tokens of the user and redirects to post_logout_redirect_uri if given
+// @Tags oidc
+// @Param id_token_hint query string false "ID token"
+// @Param client_id query string false "Client ID"
+// @Param post_logout_redirect_uri query string false "Post logout redirect URI"
+// @Param state query string false "State"
+// @Success 302
+// @Success 204
+// @Failure 400 {object} OIDCErrorResponse
+// @Router /oauth2/logout [get]
+func (h oidcHandler) EndSession(ctx echo.Context) error {
+	var req oidc.EndSessionRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return oidcError(ctx, fmt.Errorf("%w: %s", oidc.ErrInvalidRequest, err.Error()))
+	}
+
+	redirectURL, err := h.service.EndSession(ctx.Request().Context(), req)
+	if err != nil {
+		return oidcError(ctx, err)
+	}
+
+	if redirectURL == "" {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.Redirect(http.StatusFound, redirectURL)
+}
+
+func oidcError(ctx echo.Context, err error) error {
+	code := oidc.ErrorCode(err)
+
+	status := http.StatusBadRequest
+	switch code {
+	case oidc.ErrInvalidClient.Error(), oidc.ErrInvalidToken.Error():
+		status = http.StatusUnauthorized
+	case "server_error":
+		slog.Default().ErrorContext(ctx.Request().Context(), "oidc request failed", "err", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, OIDCErrorResponse{Error: code})
+	}
+
+	res := OIDCErrorResponse{Error: code}
+	if desc := err.Error(); desc != code {
+		res.ErrorDescription = strings.TrimPrefix(desc, code+": ")
+	}
+
+	return ctx.JSON(status, res)
+}
+
+func bearerToken(ctx echo.Context) string {
+	scheme, token, ok := strings.Cut(ctx.Request().Header.Get("Authorization"), " ")
+	if !ok || scheme != "Bearer" {
+		return ""
+	}
+	return token
+}
@@ -0,0 +1,427 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type (
+	OrganizationCreateRequest struct {
+		Name string `json:"name" validate:"required,max=200"`
+	}
+
+	OrganizationInviteRequest struct {
+		Email string   `json:"email" validate:"required,email,max=254"`
+		Roles []string `json:"roles" validate:"omitempty,dive,oneof=owner admin member"`
+	}
+
+	OrganizationSwitchRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	InvitationAcceptRequest struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	AdminCreateOrganizationRequest struct {
+		Name       string `json:"name" validate:"required,max=200"`
+		OwnerEmail string `json:"owner_email" validate:"required,email,max=254"`
+	}
+
+	AdminCreateOrganizationResponse struct {
+		Organization entities.Organization `json:"organization"`
+		Invitation   entities.Invitation   `json:"invitation"`
+	}
+
+	AdminUpdateMemberRequest struct {
+		Roles []string `json:"roles" validate:"required,min=1,dive,oneof=owner admin member"`
+	}
+)
+
+func (r *OrganizationInviteRequest) Normalize()      { r.Email = normalizeEmail(r.Email) }
+func (r *AdminCreateOrganizationRequest) Normalize() { r.OwnerEmail = normalizeEmail(r.OwnerEmail) }
+
+// @Summary Create organization
+// @Description Creates an organization with the user as its owner.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body OrganizationCreateRequest true "Organization"
+// @Success 201 {object} entities.Organization
+// @Failure 400 {object} ValidationErrorResponse
+// @Router /organizations [post]
+func (h authHandler) CreateOrganization(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	var req OrganizationCreateRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.CreateOrganization(ctx.Request().Context(), user, req.Name)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// @Summary List my organizations
+// @Description Lists the organizations the user is a member of, with their roles and which one is active.
+// @Tags organizations
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} auth.UserOrganization
+// @Router /organizations [get]
+func (h authHandler) ListMyOrganizations(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.ListUserOrganizations(ctx.Request().Context(), user)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Switch organization
+// @Description Makes the organization the active one and refreshes the session, the new access token carries it. Takes the refresh token from the cookie or the body like /refresh.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Organization ID"
+// @Param body body OrganizationSwitchRequest false "Refresh token"
+// @Success 200 {object} AuthLoginResponse
+// @Failure 403
+// @Failure 404
+// @Router /organizations/{id}/switch [post]
+func (h authHandler) SwitchOrganization(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	refreshToken := h.cookies.refreshToken(ctx)
+	if refreshToken == "" {
+		var req OrganizationSwitchRequest
+		if err := ctx.Bind(&req); err != nil {
+			return responsError(ctx, err)
+		}
+		refreshToken = req.RefreshToken
+	}
+
+	if refreshToken == "" {
+		return responsError(ctx, auth.ErrSessionNotFound)
+	}
+
+	res, err := h.service.SwitchOrganization(ctx.Request().Context(), user, ctx.Param("id"), refreshToken)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return h.cookies.sessionResponse(ctx, res)
+}
+
+// @Summary Invite member
+// @Description Emails an invitation to join the organization. Owners and admins can invite, only owners can invite owners.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Organization ID"
+// @Param body body OrganizationInviteRequest true "Invitation"
+// @Success 201 {object} entities.Invitation
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 403
+// @Router /organizations/{id}/invitations [post]
+func (h authHandler) InviteMember(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	var req OrganizationInviteRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.InviteMember(ctx.Request().Context(), user, ctx.Param("id"), req.Email, req.Roles)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// @Summary Accept invitation
+// @Description Adds the logged in user to the organization of the invitation. It has to be accepted with the email it was sent to. New users can pass the token to /register or /login instead.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body InvitationAcceptRequest true "Invitation token"
+// @Success 200 {object} entities.Membership
+// @Failure 400
+// @Failure 403
+// @Router /invitations/accept [post]
+func (h authHandler) AcceptInvitation(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	var req InvitationAcceptRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.AcceptInvitation(ctx.Request().Context(), user, req.Token)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// acceptInvitation accepts the invitation for the user a new session
+// belongs to, after logging in or registering with it.
+func (h authHandler) acceptInvitation(ctx echo.Context, session auth.Session, token string) error {
+	user, err := h.service.VerifyToken(ctx.Request().Context(), session.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.service.AcceptInvitation(ctx.Request().Context(), user, token)
+	return err
+}
+
+// @Summary List organizations
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {array} entities.Organization
+// @Failure 403
+// @Router /admin/organizations [get]
+func (h authHandler) AdminListOrganizations(ctx echo.Context) error {
+	res, err := h.service.ListOrganizations(ctx.Request().Context())
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Create organization for a customer
+// @Description Creates an organization and invites its owner by email.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param body body AdminCreateOrganizationRequest true "Organization"
+// @Success 201 {object} AdminCreateOrganizationResponse
+// @Failure 400 {object} ValidationErrorResponse
+// @Router /admin/organizations [post]
+func (h authHandler) AdminCreateOrganization(ctx echo.Context) error {
+	var req AdminCreateOrganizationRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	org, invitation, err := h.service.CreateOrganizationFor(ctx.Request().Context(), actorID(ctx), req.Name, req.OwnerEmail)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, AdminCreateOrganizationResponse{
+		Organization: org,
+		Invitation:   invitation,
+	})
+}
+
+// @Summary Get organization
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Organization ID"
+// @Success 200 {object} entities.Organization
+// @Failure 404
+// @Router /admin/organizations/{id} [get]
+func (h authHandler) AdminGetOrganization(ctx echo.Context) error {
+	res, err := h.service.GetOrganization(ctx.Request().Context(), ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Delete organization
+// @Description Deletes the organization with its memberships and invitations.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Organization ID"
+// @Success 204
+// @Failure 404
+// @Router /admin/organizations/{id} [delete]
+func (h authHandler) AdminDeleteOrganization(ctx echo.Context) error {
+	if err := h.service.DeleteOrganization(ctx.Request().Context(), actorID(ctx), ctx.Param("id")); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// @Summary List members
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Organization ID"
+// @Success 200 {array} entities.Membership
+// @Failure 404
+// @Router /admin/organizations/{id}/members [get]
+func (h authHandler) AdminListMembers(ctx echo.Context) error {
+	res, err := h.service.ListMembers(ctx.Request().Context(), ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Update member roles
+// @Description Replaces the roles of a member. An organization always keeps an owner.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Organization ID"
+// @Param userId path string true "User ID"
+// @Param body body AdminUpdateMemberRequest true "Roles"
+// @Success 200 {object} entities.Membership
+// @Failure 404
+// @Failure 409
+// @Router /admin/organizations/{id}/members/{userId} [put]
+func (h authHandler) AdminUpdateMember(ctx echo.Context) error {
+	var req AdminUpdateMemberRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.UpdateMemberRoles(ctx.Request().Context(), actorID(ctx), ctx.Param("id"), ctx.Param("userId"), req.Roles)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Remove member
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Organization ID"
+// @Param userId path string true "User ID"
+// @Success 204
+// @Failure 404
+// @Failure 409
+// @Router /admin/organizations/{id}/members/{userId} [delete]
+func (h authHandler) AdminRemoveMember(ctx echo.Context) error {
+	if err := h.service.RemoveMember(ctx.Request().Context(), actorID(ctx), ctx.Param("id"), ctx.Param("userId")); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// @Summary List invitations
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Organization ID"
+// @Success 200 {array} entities.Invitation
+// @Failure 404
+// @Router /admin/organizations/{id}/invitations [get]
+func (h authHandler) AdminListInvitations(ctx echo.Context) error {
+	res, err := h.service.ListInvitations(ctx.Request().Context(), ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Invite member
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Organization ID"
+// @Param body body OrganizationInviteRequest true "Invitation"
+// @Success 201 {object} entities.Invitation
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404
+// @Router /admin/organizations/{id}/invitations [post]
+func (h authHandler) AdminCreateInvitation(ctx echo.Context) error {
+	var req OrganizationInviteRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.CreateInvitation(ctx.Request().Context(), actorID(ctx), ctx.Param("id"), req.Email, req.Roles)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// @Summary Revoke invitation
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Invitation ID"
+// @Success 204
+// @Failure 404
+// @Router /admin/invitations/{id} [delete]
+func (h authHandler) AdminRevokeInvitation(ctx echo.Context) error {
+	if err := h.service.RevokeInvitation(ctx.Request().Context(), actorID(ctx), ctx.Param("id")); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type (
+	AuthPasskeyLoginRequest struct {
+		Email string `json:"email" validate:"omitempty,email,max=254"`
+	}
+
+	AuthPasskeyResponse struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+)
+
+func (r *AuthPasskeyLoginRequest) Normalize() { r.Email = normalizeEmail(r.Email) }
+
+// @Summary Begin passkey registration
+// @Description Returns the options for navigator.credentials.create
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} auth.PasskeyChallenge
+// @Router /passkeys/register/begin [post]
+func (h authHandler) BeginPasskeyRegistration(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.BeginPasskeyRegistration(ctx.Request().Context(), user)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Finish passkey registration
+// @Description Verifies the attestation from navigator.credentials.create and saves the passkey. The body is the credential as returned by the browser.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param challenge_id query string true "Challenge ID"
+// @Param name query string false "Passkey name"
+// @Success 201 {object} AuthPasskeyResponse
+// @Router /passkeys/register/finish [post]
+func (h authHandler) FinishPasskeyRegistration(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.FinishPasskeyRegistration(ctx.Request().Context(), user, ctx.QueryParam("challenge_id"), ctx.QueryParam("name"), ctx.Request().Body)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, AuthPasskeyResponse{
+		ID:        res.ID,
+		Name:      res.Name,
+		CreatedAt: res.CreatedAt,
+	})
+}
+
+// @Summary Begin passkey login
+// @Description Returns the options for navigator.credentials.get. Without an email any discoverable passkey can be used.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param AuthPasskeyLoginRequest body AuthPasskeyLoginRequest false "Passkey Login Request"
+// @Success 200 {object} auth.PasskeyChallenge
+// @Router /passkeys/login/begin [post]
+func (h authHandler) BeginPasskeyLogin(ctx echo.Context) error {
+	var req AuthPasskeyLoginRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.BeginPasskeyLogin(ctx.Request().Context(), req.Email)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Finish passkey login
+// @Description Verifies the assertion from navigator.credentials.get and starts a session. The body is the credential as returned by the browser.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param challenge_id query string true "Challenge ID"
+// @Success 200 {object} AuthLoginResponse
+// @Router /passkeys/login/finish [post]
+func (h authHandler) FinishPasskeyLogin(ctx echo.Context) error {
+	res, err := h.service.FinishPasskeyLogin(ctx.Request().Context(), ctx.QueryParam("challenge_id"), ctx.Request().Body)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return h.cookies.sessionResponse(ctx, res)
+}
@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+type AuthRequestErasureRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+}
+
+// @Summary Request data export
+// @Description Queues an archive of everything stored about the user. Poll the export until its status is completed, then download it.
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} entities.DataExport
+// @Router /me/exports [post]
+func (h authHandler) RequestDataExport(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.RequestDataExport(ctx.Request().Context(), user)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusAccepted, res)
+}
+
+// @Summary Get data export
+// @Description Returns the status of a data export
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Export ID"
+// @Success 200 {object} entities.DataExport
+// @Failure 404
+// @Router /me/exports/{id} [get]
+func (h authHandler) GetDataExport(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.GetDataExport(ctx.Request().Context(), user, ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Download data export
+// @Description Downloads the JSON archive of a completed data export
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Export ID"
+// @Success 200 {object} auth.DataExportArchive
+// @Failure 404
+// @Failure 409
+// @Router /me/exports/{id}/download [get]
+func (h authHandler) DownloadDataExport(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	archive, err := h.service.DownloadDataExport(ctx.Request().Context(), user, ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "data-export-"+ctx.Param("id")+".json"))
+
+	return ctx.Blob(http.StatusOK, echo.MIMEApplicationJSON, archive)
+}
+
+// @Summary Request erasure
+// @Description Schedules the erasure of all of the user's data and logs them out everywhere. Logging in again before scheduled_at cancels it. The returned record can be checked at /erasures/{id}.
+// @Tags privacy
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param AuthRequestErasureRequest body AuthRequestErasureRequest true "Request Erasure Request"
+// @Success 202 {object} entities.ErasureRecord
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 403
+// @Router /me/erasure [post]
+func (h authHandler) RequestErasure(ctx echo.Context) error {
+	var req AuthRequestErasureRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.RequestErasure(ctx.Request().Context(), user, req.CurrentPassword)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	h.cookies.clearSession(ctx)
+
+	return ctx.JSON(http.StatusAccepted, res)
+}
+
+// @Summary Verify erasure
+// @Description Returns an erasure record and whether its digest matches its contents. Completed records hold no personal data.
+// @Tags privacy
+// @Produce json
+// @Param id path string true "Erasure ID"
+// @Success 200 {object} auth.ErasureVerification
+// @Failure 404
+// @Router /erasures/{id} [get]
+func (h authHandler) VerifyErasure(ctx echo.Context) error {
+	res, err := h.service.VerifyErasure(ctx.Request().Context(), ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
@@ -14,12 +14,21 @@ import (
 
 	"github.com/rasulov-emirlan/poc-auth/config"
 	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/oidc"
+	"github.com/rasulov-emirlan/poc-auth/pkg/realip"
 )
 
 // @title POC-Auth API
 // @description This is a sample server for POC-Auth API.
 // @version 1.0
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name Authorization
+// @description Service account API key, sent as "ApiKey <key>".
 
 type server struct {
 	srvr *http.Server
@@ -28,6 +37,8 @@ type server struct {
 type ServerConfigs struct {
 	Cfg        config.Config
 	AuthDomain auth.Service
+	OIDCDomain oidc.Service
+	IPResolver realip.Resolver
 }
 
 func NewServer(cfg ServerConfigs) server {
@@ -38,9 +49,17 @@ func NewServer(cfg ServerConfigs) server {
 	}
 
 	router := echo.New()
+	router.Validator = newRequestValidator()
+	// c.RealIP() feeds rate limits, sessions and login alerts, it must
+	// not trust headers from anyone but our proxies
+	router.IPExtractor = func(req *http.Request) string {
+		return cfg.IPResolver.ClientIP(req.RemoteAddr, req.Header.Values(echo.HeaderXForwardedFor))
+	}
+	router.Pre(middlewareTenant(cfg.Cfg, cfg.AuthDomain))
 	router.Use(middleware.Gzip())
-	router.Use(middleware.CORS())
+	router.Use(middlewareCORS(cfg.Cfg))
 	router.Use(middlewareRequestID)
+	router.Use(middlewareClientInfo)
 	router.Use(slogecho.New(slog.Default()))
 	router.Use(middleware.RemoveTrailingSlash())
 
@@ -49,14 +68,91 @@ func NewServer(cfg ServerConfigs) server {
 	slog.Default().DebugContext(context.Background(), "Server started on port "+cfg.Cfg.Server.Port)
 
 	authHandler := authHandler{
-		service: cfg.AuthDomain,
+		service:   cfg.AuthDomain,
+		cookies:   newCookiePolicy(cfg.Cfg),
+		adminRole: cfg.Cfg.Admin.Role,
 	}
 
+	csrf := middlewareCSRF(cfg.Cfg, authHandler.cookies)
+
+	router.GET("/auth/csrf", authHandler.CSRFToken, csrf)
 	router.POST("/auth/login", authHandler.Login)
 	router.POST("/auth/register", authHandler.Register)
-	router.POST("/auth/refresh", authHandler.Refresh)
-	router.POST("/auth/forgot-password/:email", authHandler.ForgotPassword)
+	router.POST("/auth/refresh", authHandler.Refresh, csrf)
+	router.POST("/auth/forgot-password", authHandler.ForgotPassword)
 	router.POST("/auth/reset-password/:token", authHandler.ResetPassword)
+	router.POST("/auth/verify-email/:verificationId", authHandler.VerifyEmail)
+	router.POST("/auth/change-password", authHandler.ChangePassword, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.GET("/auth/sessions", authHandler.ListSessions, csrf, authHandler.middlewareExtractUser)
+	router.DELETE("/auth/sessions/:id", authHandler.RevokeSession, csrf, authHandler.middlewareExtractUser)
+	router.GET("/auth/me", authHandler.Me, csrf, authHandler.middlewareExtractUser)
+	router.PATCH("/auth/me", authHandler.UpdateMe, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.DELETE("/auth/me", authHandler.DeleteMe, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.GET("/auth/me/email/verify", authHandler.VerifyEmailChange)
+	router.POST("/auth/me/email/verify", authHandler.VerifyEmailChange)
+	router.POST("/auth/me/exports", authHandler.RequestDataExport, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.GET("/auth/me/exports/:id", authHandler.GetDataExport, csrf, authHandler.middlewareExtractUser)
+	router.GET("/auth/me/exports/:id/download", authHandler.DownloadDataExport, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.POST("/auth/me/erasure", authHandler.RequestErasure, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.GET("/auth/erasures/:id", authHandler.VerifyErasure)
+	router.POST("/auth/introspect", authHandler.Introspect, authHandler.middlewareServiceAuth(cfg.Cfg))
+	router.GET("/auth/oauth/:provider/start", authHandler.OAuthStart)
+	router.GET("/auth/oauth/:provider/callback", authHandler.OAuthCallback)
+
+	magicLinkLimit := middlewareRateLimit(cfg.Cfg.MagicLink.RequestsPerMinute)
+	router.POST("/auth/magic-link", authHandler.RequestMagicLink, magicLinkLimit)
+	router.GET("/auth/magic-link/verify", authHandler.ConfirmMagicLink)
+	router.POST("/auth/magic-link/verify", authHandler.VerifyMagicLink, magicLinkLimit)
+
+	router.POST("/auth/passkeys/register/begin", authHandler.BeginPasskeyRegistration, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.POST("/auth/passkeys/register/finish", authHandler.FinishPasskeyRegistration, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.POST("/auth/passkeys/login/begin", authHandler.BeginPasskeyLogin)
+	router.POST("/auth/passkeys/login/finish", authHandler.FinishPasskeyLogin)
+
+	router.POST("/auth/organizations", authHandler.CreateOrganization, csrf, authHandler.middlewareExtractUser)
+	router.GET("/auth/organizations", authHandler.ListMyOrganizations, csrf, authHandler.middlewareExtractUser)
+	router.POST("/auth/organizations/:id/switch", authHandler.SwitchOrganization, csrf, authHandler.middlewareExtractUser, authHandler.middlewareDenyImpersonation)
+	router.POST("/auth/organizations/:id/invitations", authHandler.InviteMember, csrf, authHandler.middlewareExtractUser)
+	router.POST("/auth/invitations/accept", authHandler.AcceptInvitation, csrf, authHandler.middlewareExtractUser)
+
+	router.POST(impersonationEndPath, authHandler.EndImpersonation, csrf, authHandler.middlewareExtractUser)
+
+	admin := router.Group("/auth/admin", csrf, authHandler.middlewareAuthenticate, authHandler.middlewareRequireAdmin)
+	admin.POST("/service-accounts", authHandler.CreateServiceAccount)
+	admin.GET("/service-accounts", authHandler.ListServiceAccounts)
+	admin.GET("/service-accounts/:id", authHandler.GetServiceAccount)
+	admin.DELETE("/service-accounts/:id", authHandler.DeleteServiceAccount)
+	admin.POST("/service-accounts/:id/keys", authHandler.CreateAPIKey)
+	admin.GET("/service-accounts/:id/keys", authHandler.ListAPIKeys)
+	admin.POST("/api-keys/:id/rotate", authHandler.RotateAPIKey)
+	admin.DELETE("/api-keys/:id", authHandler.RevokeAPIKey)
+	admin.GET("/organizations", authHandler.AdminListOrganizations)
+	admin.POST("/organizations", authHandler.AdminCreateOrganization)
+	admin.GET("/organizations/:id", authHandler.AdminGetOrganization)
+	admin.DELETE("/organizations/:id", authHandler.AdminDeleteOrganization)
+	admin.GET("/organizations/:id/members", authHandler.AdminListMembers)
+	admin.PUT("/organizations/:id/members/:userId", authHandler.AdminUpdateMember)
+	admin.DELETE("/organizations/:id/members/:userId", authHandler.AdminRemoveMember)
+	admin.GET("/organizations/:id/invitations", authHandler.AdminListInvitations)
+	admin.POST("/organizations/:id/invitations", authHandler.AdminCreateInvitation)
+	admin.DELETE("/invitations/:id", authHandler.AdminRevokeInvitation)
+	admin.POST("/impersonations", authHandler.StartImpersonation)
+	admin.GET("/impersonations", authHandler.ListImpersonations)
+	admin.DELETE("/impersonations/:id", authHandler.AdminEndImpersonation)
+
+	oidcHandler := oidcHandler{
+		service: cfg.OIDCDomain,
+	}
+
+	router.GET("/.well-known/openid-configuration", oidcHandler.Discovery)
+	router.GET("/.well-known/jwks.json", oidcHandler.JWKS)
+	router.GET("/oauth2/authorize", oidcHandler.Authorize)
+	router.POST("/oauth2/authorize", oidcHandler.Authorize)
+	router.POST("/oauth2/token", oidcHandler.Token)
+	router.GET("/oauth2/userinfo", oidcHandler.UserInfo)
+	router.POST("/oauth2/userinfo", oidcHandler.UserInfo)
+	router.GET("/oauth2/logout", oidcHandler.EndSession)
+	router.POST("/oauth2/logout", oidcHandler.EndSession)
 
 	srvr.Handler = router
 
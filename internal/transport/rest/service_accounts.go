@@ -0,0 +1,238 @@
+package rest
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// apiKeyAdminScope lets a service account use the admin api.
+const apiKeyAdminScope = "admin"
+
+type (
+	AdminCreateServiceAccountRequest struct {
+		Name        string   `json:"name" validate:"required,max=100"`
+		Description string   `json:"description" validate:"max=500"`
+		Scopes      []string `json:"scopes" validate:"required,min=1"`
+	}
+
+	AdminCreateAPIKeyRequest struct {
+		Name   string   `json:"name" validate:"required,max=100"`
+		Scopes []string `json:"scopes"`
+		// TTL is a duration like 720h, the server default is used when
+		// it is empty.
+		TTL string `json:"ttl"`
+	}
+)
+
+// @Summary Create service account
+// @Description Creates an account for another service. It authenticates with API keys, which can only get scopes of the account.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param body body AdminCreateServiceAccountRequest true "Service account"
+// @Success 201 {object} entities.ServiceAccount
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 403
+// @Router /admin/service-accounts [post]
+func (h authHandler) CreateServiceAccount(ctx echo.Context) error {
+	var req AdminCreateServiceAccountRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	res, err := h.service.CreateServiceAccount(ctx.Request().Context(), actorID(ctx), req.Name, req.Description, req.Scopes)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// @Summary List service accounts
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {array} entities.ServiceAccount
+// @Failure 403
+// @Router /admin/service-accounts [get]
+func (h authHandler) ListServiceAccounts(ctx echo.Context) error {
+	res, err := h.service.ListServiceAccounts(ctx.Request().Context())
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Get service account
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Service account ID"
+// @Success 200 {object} entities.ServiceAccount
+// @Failure 404
+// @Router /admin/service-accounts/{id} [get]
+func (h authHandler) GetServiceAccount(ctx echo.Context) error {
+	res, err := h.service.GetServiceAccount(ctx.Request().Context(), ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Delete service account
+// @Description Deletes the account and revokes all of its API keys.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Service account ID"
+// @Success 204
+// @Failure 404
+// @Router /admin/service-accounts/{id} [delete]
+func (h authHandler) DeleteServiceAccount(ctx echo.Context) error {
+	if err := h.service.DeleteServiceAccount(ctx.Request().Context(), actorID(ctx), ctx.Param("id")); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// @Summary Create API key
+// @Description Issues an API key for the service account. The key is only returned here, the server keeps a hash of it. Clients send it as "Authorization: ApiKey <key>".
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Service account ID"
+// @Param body body AdminCreateAPIKeyRequest true "API key"
+// @Success 201 {object} auth.NewAPIKey
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404
+// @Router /admin/service-accounts/{id}/keys [post]
+func (h authHandler) CreateAPIKey(ctx echo.Context) error {
+	var req AdminCreateAPIKeyRequest
+
+	if err := ctx.Bind(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	if err := ctx.Validate(&req); err != nil {
+		return responsError(ctx, err)
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return responsError(ctx, validationError{fields: map[string]string{"ttl": "must be a duration like 720h"}})
+		}
+		ttl = d
+	}
+
+	res, err := h.service.CreateAPIKey(ctx.Request().Context(), actorID(ctx), ctx.Param("id"), req.Name, req.Scopes, ttl)
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// @Summary List API keys
+// @Description Lists the keys of a service account, including revoked and expired ones. Secrets are never returned.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Service account ID"
+// @Success 200 {array} entities.APIKey
+// @Failure 404
+// @Router /admin/service-accounts/{id}/keys [get]
+func (h authHandler) ListAPIKeys(ctx echo.Context) error {
+	res, err := h.service.ListAPIKeys(ctx.Request().Context(), ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Rotate API key
+// @Description Issues a replacement key with the same scopes. The old key keeps working for the configured overlap so clients can switch without downtime.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "API key ID"
+// @Success 201 {object} auth.NewAPIKey
+// @Failure 404
+// @Failure 409
+// @Router /admin/api-keys/{id}/rotate [post]
+func (h authHandler) RotateAPIKey(ctx echo.Context) error {
+	res, err := h.service.RotateAPIKey(ctx.Request().Context(), actorID(ctx), ctx.Param("id"))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// @Summary Revoke API key
+// @Description The key stops working right away.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "API key ID"
+// @Success 204
+// @Failure 404
+// @Router /admin/api-keys/{id} [delete]
+func (h authHandler) RevokeAPIKey(ctx echo.Context) error {
+	if err := h.service.RevokeAPIKey(ctx.Request().Context(), actorID(ctx), ctx.Param("id")); err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// middlewareRequireAdmin lets in users with the admin role and service
+// accounts whose key has the admin scope. It runs after
+// middlewareAuthenticate.
+func (h authHandler) middlewareRequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if user, ok := ctx.Get("user").(entities.User); ok && slices.Contains(user.Roles, h.adminRole) {
+			return next(ctx)
+		}
+
+		if key, ok := ctx.Get("api_key").(entities.APIKey); ok && slices.Contains(key.Scopes, apiKeyAdminScope) {
+			return next(ctx)
+		}
+
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": "admin access required"})
+	}
+}
+
+// actorID is who made an authenticated request, for the audit log.
+func actorID(ctx echo.Context) string {
+	if user, ok := ctx.Get("user").(entities.User); ok {
+		return user.ProviderID
+	}
+	if account, ok := ctx.Get("service_account").(entities.ServiceAccount); ok {
+		return "service_account:" + account.ID
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+func TestMiddlewareRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name string
+		set  map[string]any
+		want int
+	}{
+		{
+			name: "admin user",
+			set:  map[string]any{"user": entities.User{Roles: []string{"superuser"}}},
+			want: http.StatusNoContent,
+		},
+		{
+			name: "user",
+			set:  map[string]any{"user": entities.User{Roles: []string{"member"}}},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "admin key",
+			set: map[string]any{
+				"service_account": entities.ServiceAccount{Scopes: []string{"read", apiKeyAdminScope}},
+				"api_key":         entities.APIKey{Scopes: []string{"read", apiKeyAdminScope}},
+			},
+			want: http.StatusNoContent,
+		},
+		{
+			// the key is limited below the scopes of its account
+			name: "key without admin scope",
+			set: map[string]any{
+				"service_account": entities.ServiceAccount{Scopes: []string{"read", apiKeyAdminScope}},
+				"api_key":         entities.APIKey{Scopes: []string{"read"}},
+			},
+			want: http.StatusForbidden,
+		},
+		{
+			// the admin scope of keys is not the admin role of users
+			name: "user with role named like the scope",
+			set:  map[string]any{"user": entities.User{Roles: []string{apiKeyAdminScope}}},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "unauthenticated",
+			want: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := echo.New()
+			h := authHandler{adminRole: "superuser"}
+
+			authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(ctx echo.Context) error {
+					for k, v := range tt.set {
+						ctx.Set(k, v)
+					}
+					return next(ctx)
+				}
+			}
+			router.GET("/auth/admin/service-accounts", func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusNoContent)
+			}, authenticate, h.middlewareRequireAdmin)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/admin/service-accounts", nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// @Summary List sessions
+// @Description Lists the devices the user is logged in on. The session of the refresh token cookie is marked as current.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} auth.SessionInfo
+// @Router /sessions [get]
+func (h authHandler) ListSessions(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	res, err := h.service.ListSessions(ctx.Request().Context(), user, h.cookies.refreshToken(ctx))
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// @Summary Revoke session
+// @Description Logs the user out on one device. Its refresh token stops working right away.
+// @Tags auth
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 404
+// @Router /sessions/{id} [delete]
+func (h authHandler) RevokeSession(ctx echo.Context) error {
+	user := ctx.Get("user").(entities.User)
+
+	err := h.service.RevokeSession(ctx.Request().Context(), user, ctx.Param("id"))
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return responsError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
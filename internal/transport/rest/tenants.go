@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+)
+
+const tenantPathPrefix = "/t/"
+
+// middlewareTenant puts the tenant of the request in its context. The
+// host is looked up in the configured tenant hosts first, then the
+// /t/<tenant> path prefix and the tenant header are checked, a tenant
+// named there has to match the host's. It runs before routing, so the
+// path prefix is stripped and every route is served under it.
+func middlewareTenant(cfg config.Config, service auth.Service) echo.MiddlewareFunc {
+	if !cfg.Tenancy.Enabled {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+
+	hosts := make(map[string]string)
+	for id, t := range cfg.Tenancy.Tenants {
+		for _, h := range t.Hosts {
+			hosts[strings.ToLower(h)] = id
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+
+			tenantID, fromHost := hosts[hostname(req.Host)]
+
+			named, ok := "", false
+			if rest, found := strings.CutPrefix(req.URL.Path, tenantPathPrefix); found {
+				var path string
+				named, path, _ = strings.Cut(rest, "/")
+				req.URL.Path = "/" + path
+				req.URL.RawPath = ""
+				ok = true
+			} else if h := req.Header.Get(cfg.Tenancy.Header); h != "" {
+				named, ok = h, true
+			}
+
+			if ok {
+				if fromHost && named != tenantID {
+					return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "tenant does not match the host"})
+				}
+				tenantID = named
+			}
+
+			if !service.HasTenant(tenantID) {
+				return ctx.JSON(http.StatusNotFound, map[string]string{"error": "unknown tenant"})
+			}
+
+			ctx.SetRequest(req.WithContext(auth.WithTenant(req.Context(), tenantID)))
+
+			return next(ctx)
+		}
+	}
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -2,22 +2,121 @@ package rest
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+
 	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
 	"github.com/rasulov-emirlan/poc-auth/pkg/logging"
 )
 
 func responsError(ctx echo.Context, err error) error {
-	switch err {
-	case auth.ErrEmailNotFound:
-		return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
-	case auth.ErrEmailTaken:
-		return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
-	default:
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	var verr validationError
+	if errors.As(err, &verr) {
+		return ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:  "invalid request",
+			Fields: verr.fields,
+		})
+	}
+
+	var herr *echo.HTTPError
+	if errors.As(err, &herr) {
+		return ctx.JSON(herr.Code, map[string]string{"error": fmt.Sprint(herr.Message)})
+	}
+
+	// hooks wrap it with their own reason
+	if errors.Is(err, auth.ErrHookRejected) {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	for _, m := range errorStatuses {
+		for _, target := range m.errs {
+			if errors.Is(err, target) {
+				return ctx.JSON(m.status, map[string]string{"error": target.Error()})
+			}
+		}
+	}
+
+	return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// errorStatuses maps domain errors to http statuses. Errors wrapping
+// one of them get its status and message.
+var errorStatuses = []struct {
+	status int
+	errs   []error
+}{
+	{http.StatusBadRequest, []error{
+		auth.ErrInvalidOAuthState, auth.ErrInvalidPasskeyChallenge,
+		auth.ErrPasswordTooShort, auth.ErrPasswordTooLong, auth.ErrPasswordTooSimple,
+		auth.ErrPasswordContainsPersonalInfo, auth.ErrPasswordReused, auth.ErrPasswordBreached,
+		auth.ErrInvalidEmailChange, auth.ErrFirstnameOrLastnameTooShort,
+		auth.ErrInvalidAPIKeyTTL, auth.ErrInvalidScope, auth.ErrScopeNotAllowed,
+		auth.ErrInvalidOrganizationRole, auth.ErrInvalidInvitation, auth.ErrInvalidImpersonationTTL,
+	}},
+	{http.StatusUnauthorized, []error{
+		auth.ErrInvalidMagicLink, auth.ErrInvalidPasskey, auth.ErrPasskeyCloned,
+		auth.ErrSessionNotFound, auth.ErrRefreshTokenReused, auth.ErrInvalidCredentials, auth.ErrInvalidToken,
+		auth.ErrInvalidAPIKey,
+	}},
+	{http.StatusForbidden, []error{
+		auth.ErrOAuthEmailNotVerified, auth.ErrOAuthAccountNotVerified, auth.ErrRegistrationDisabled,
+		auth.ErrEmailDomainNotAllowed, auth.ErrDisposableEmail, auth.ErrInvitationRequired,
+		auth.ErrWrongPassword,
+		auth.ErrNotOrganizationMember, auth.ErrOrganizationRoleRequired, auth.ErrInvitationEmailMismatch,
+		auth.ErrImpersonationNotAllowed, auth.ErrImpersonationReadOnly, auth.ErrImpersonationForbidden,
+	}},
+	{http.StatusNotFound, []error{
+		auth.ErrEmailNotFound, auth.ErrUnknownOAuthProvider,
+		auth.ErrDataExportNotFound, auth.ErrErasureNotFound,
+		auth.ErrServiceAccountNotFound, auth.ErrAPIKeyNotFound,
+		auth.ErrOrganizationNotFound, auth.ErrMembershipNotFound, auth.ErrInvitationNotFound,
+		auth.ErrUserNotFound, auth.ErrImpersonationNotFound,
+	}},
+	{http.StatusConflict, []error{
+		auth.ErrEmailTaken, auth.ErrPasskeyExists, auth.ErrDataExportNotReady, auth.ErrAPIKeyRevoked,
+		auth.ErrAlreadyOrganizationMember, auth.ErrLastOrganizationOwner,
+	}},
+	{http.StatusTooManyRequests, []error{
+		auth.ErrTooManyRequests,
+	}},
+}
+
+// middlewareRateLimit limits requests per client ip. Limits are kept in
+// memory, so they apply per instance.
+func middlewareRateLimit(perMinute int) echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(float64(perMinute) / 60),
+			Burst:     perMinute,
+			ExpiresIn: 3 * time.Minute,
+		}),
+		DenyHandler: func(ctx echo.Context, identifier string, err error) error {
+			return responsError(ctx, auth.ErrTooManyRequests)
+		},
+	})
+}
+
+// middlewareClientInfo records the device a request comes from, it is
+// saved with the sessions issued by the request. Clients can name the
+// device with the X-Device-Name header.
+func middlewareClientInfo(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := auth.WithClientInfo(req.Context(), auth.ClientInfo{
+			IP:         c.RealIP(),
+			UserAgent:  req.UserAgent(),
+			DeviceName: req.Header.Get("X-Device-Name"),
+			Locale:     req.Header.Get("Accept-Language"),
+		})
+		c.SetRequest(req.WithContext(ctx))
+		return next(c)
 	}
 }
 
@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/auth"
+)
+
+func TestResponsErrorMapsWrappedErrors(t *testing.T) {
+	for _, m := range errorStatuses {
+		for _, target := range m.errs {
+			for _, err := range []error{target, fmt.Errorf("failed to do something: %w", target)} {
+				rec := httptest.NewRecorder()
+				ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+				if err := responsError(ctx, err); err != nil {
+					t.Fatal(err)
+				}
+
+				if rec.Code != m.status {
+					t.Errorf("%q: status %d, want %d", err, rec.Code, m.status)
+				}
+
+				var body map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body["error"] != target.Error() {
+					t.Errorf("%q: error %q, want %q", err, body["error"], target.Error())
+				}
+			}
+		}
+	}
+}
+
+func TestResponsErrorStatuses(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("failed to register: %w", auth.ErrEmailTaken), http.StatusConflict},
+		{fmt.Errorf("failed to change password: %w", auth.ErrWrongPassword), http.StatusForbidden},
+		{fmt.Errorf("hook: %w", auth.ErrHookRejected), http.StatusForbidden},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+		if err := responsError(ctx, tt.err); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != tt.want {
+			t.Errorf("%q: status %d, want %d", tt.err, rec.Code, tt.want)
+		}
+	}
+}
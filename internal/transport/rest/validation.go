@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/net/idna"
+)
+
+// ValidationErrorResponse lists what is wrong with each field of the
+// request, keyed by the json name of the field.
+type ValidationErrorResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields"`
+}
+
+// normalizer is implemented by requests that clean up their fields,
+// it runs before the request is validated.
+type normalizer interface {
+	Normalize()
+}
+
+type requestValidator struct {
+	validate *validator.Validate
+}
+
+type validationError struct {
+	fields map[string]string
+}
+
+func (e validationError) Error() string {
+	return fmt.Sprintf("invalid request: %v", e.fields)
+}
+
+func newRequestValidator() requestValidator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	return requestValidator{validate: v}
+}
+
+func (v requestValidator) Validate(i any) error {
+	if n, ok := i.(normalizer); ok {
+		n.Normalize()
+	}
+
+	err := v.validate.Struct(i)
+
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	fields := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		fields[fe.Field()] = fieldMessage(fe)
+	}
+
+	return validationError{fields: fields}
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email"
+	case "min":
+		return "must be at least " + fe.Param() + " characters long"
+	case "max":
+		return "must be at most " + fe.Param() + " characters long"
+	default:
+		return "is invalid"
+	}
+}
+
+// normalizeEmail trims the email, lower cases it and converts an
+// internationalized domain to its ascii form. Emails that can not be
+// converted are returned trimmed, validation rejects them.
+func normalizeEmail(email string) string {
+	email = strings.TrimSpace(email)
+
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return email
+	}
+
+	return strings.ToLower(local) + "@" + strings.ToLower(domain)
+}
+
+// normalizeName trims the name and collapses the whitespace inside it,
+// a name of only spaces becomes empty and fails validation.
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"user@example.com", "user@example.com"},
+		{"  User@Example.COM \n", "user@example.com"},
+		{"user@example.com.", "user@example.com"},
+		{"user@bücher.de", "user@xn--bcher-kva.de"},
+		{"User@BÜCHER.de", "user@xn--bcher-kva.de"},
+		{"user@пример.рф", "user@xn--e1afmkfd.xn--p1ai"},
+		{"user@xn--bcher-kva.de", "user@xn--bcher-kva.de"},
+		{"user", "user"},
+		{" user ", "user"},
+		{"", ""},
+		// not convertible, kept as is for validation to reject
+		{"User@exa mple.com", "User@exa mple.com"},
+		{"User@-example.com", "User@-example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeEmail(tt.email); got != tt.want {
+			t.Errorf("normalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Jane", "Jane"},
+		{"  Jane\t", "Jane"},
+		{"Mary   Jane", "Mary Jane"},
+		{"Mary\n Jane", "Mary Jane"},
+		{"Åsa", "Åsa"},
+		{"   ", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeName(tt.name); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateNormalizesRequest(t *testing.T) {
+	v := newRequestValidator()
+
+	req := AuthRegisterRequest{
+		Email:     " Jane@Bücher.DE ",
+		Password:  "password",
+		Firstname: " Mary  Jane ",
+		Lastname:  "Doe\n",
+	}
+	if err := v.Validate(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Email != "jane@xn--bcher-kva.de" || req.Firstname != "Mary Jane" || req.Lastname != "Doe" {
+		t.Errorf("normalized %+v", req)
+	}
+}
+
+func TestValidateFieldErrors(t *testing.T) {
+	v := newRequestValidator()
+	blank := "  "
+
+	tests := []struct {
+		name   string
+		req    any
+		fields map[string]string
+	}{
+		{
+			name: "register",
+			req:  &AuthRegisterRequest{Email: "user@exa mple.com", Firstname: "   "},
+			fields: map[string]string{
+				"email":     "must be a valid email",
+				"password":  "is required",
+				"firstname": "is required",
+				"lastname":  "is required",
+			},
+		},
+		{
+			name:   "update profile",
+			req:    &AuthUpdateMeRequest{Firstname: &blank},
+			fields: map[string]string{"firstname": "must be at least 1 characters long"},
+		},
+	}
+
+	for _, tt := range tests {
+		err := v.Validate(tt.req)
+
+		var verr validationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("%s: error %v, want a validation error", tt.name, err)
+		}
+		if len(verr.fields) != len(tt.fields) {
+			t.Errorf("%s: fields %v, want %v", tt.name, verr.fields, tt.fields)
+		}
+		for field, msg := range tt.fields {
+			if verr.fields[field] != msg {
+				t.Errorf("%s: %s %q, want %q", tt.name, field, verr.fields[field], msg)
+			}
+		}
+	}
+}
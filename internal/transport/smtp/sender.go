@@ -0,0 +1,143 @@
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+const (
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+	TLSNone     = "none"
+)
+
+var ErrStartTLSNotSupported = errors.New("smtp server does not support STARTTLS")
+
+// Sender sends mails through an SMTP server, one connection per mail.
+type Sender struct {
+	host     string
+	addr     string
+	username string
+	password string
+	tls      string
+	timeout  time.Duration
+}
+
+func NewSender(cfg config.Config) (Sender, error) {
+	c := cfg.Mailer.SMTP
+
+	if c.Host == "" {
+		return Sender{}, errors.New("smtp host is not configured")
+	}
+
+	switch c.TLS {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return Sender{}, fmt.Errorf("unknown smtp tls mode %q", c.TLS)
+	}
+
+	return Sender{
+		host:     c.Host,
+		addr:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		username: c.Username,
+		password: c.Password,
+		tls:      c.TLS,
+		timeout:  c.Timeout,
+	}, nil
+}
+
+func (s Sender) Send(ctx context.Context, m entities.Mail) error {
+	msg, err := mailer.Message(m, time.Now())
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("failed to parse from address: %w", err)
+	}
+
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return mailer.ErrInvalidRecipient
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet smtp server: %w", err)
+	}
+	defer c.Close()
+
+	if s.tls == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrStartTLSNotSupported
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL failed: %w", err)
+	}
+
+	if err := c.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("smtp RCPT failed: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp server rejected mail: %w", err)
+	}
+
+	return c.Quit()
+}
+
+func (s Sender) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.timeout}
+
+	if s.tls == TLSImplicit {
+		return (&tls.Dialer{
+			NetDialer: dialer,
+			Config:    &tls.Config{ServerName: s.host},
+		}).DialContext(ctx, "tcp", s.addr)
+	}
+
+	return dialer.DialContext(ctx, "tcp", s.addr)
+}
@@ -0,0 +1,259 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/domains/mailer"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+// fakeServer speaks just enough SMTP for the sender and records what it
+// was told. Recipients in reject are refused.
+type fakeServer struct {
+	net.Listener
+	reject string
+
+	mu       sync.Mutex
+	auth     string
+	from     string
+	rcpt     string
+	data     string
+	commands []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	srv := &fakeServer{Listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	return srv
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.ToUpper(verb))
+		s.mu.Unlock()
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			reply("250-localhost", "250 AUTH PLAIN")
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = arg
+			s.mu.Unlock()
+			reply("235 2.7.0 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = arg
+			s.mu.Unlock()
+			reply("250 ok")
+		case "RCPT":
+			if s.reject != "" && strings.Contains(arg, s.reject) {
+				reply("550 5.1.1 no such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = arg
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func newTestSender(t *testing.T, srv *fakeServer, tls, username string) Sender {
+	t.Helper()
+
+	var cfg config.Config
+	host, port, _ := net.SplitHostPort(srv.Addr().String())
+	cfg.Mailer.SMTP.Host = host
+	cfg.Mailer.SMTP.Port, _ = strconv.Atoi(port)
+	cfg.Mailer.SMTP.TLS = tls
+	cfg.Mailer.SMTP.Username = username
+	cfg.Mailer.SMTP.Password = "password"
+	cfg.Mailer.SMTP.Timeout = 5 * time.Second
+
+	sender, err := NewSender(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender
+}
+
+func testMail() entities.Mail {
+	return entities.Mail{
+		ID:      "mail-1",
+		From:    "poc-auth <no-reply@example.com>",
+		To:      "Jane <user@example.com>",
+		Subject: "Verify your email",
+		Text:    "https://example.com/verify?token=abc\n",
+	}
+}
+
+func TestSenderSend(t *testing.T) {
+	srv := newFakeServer(t)
+	sender := newTestSender(t, srv, TLSNone, "mailer")
+
+	if err := sender.Send(context.Background(), testMail()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.from != "FROM:<no-reply@example.com>" || srv.rcpt != "TO:<user@example.com>" {
+		t.Errorf("envelope %q %q", srv.from, srv.rcpt)
+	}
+
+	want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00password"))
+	if srv.auth != want {
+		t.Errorf("auth %q, want %q", srv.auth, want)
+	}
+
+	if !strings.Contains(srv.data, "Subject: Verify your email\r\n") || !strings.Contains(srv.data, "token=3Dabc") {
+		t.Errorf("data %q", srv.data)
+	}
+}
+
+func TestSenderWithoutAuth(t *testing.T) {
+	srv := newFakeServer(t)
+	sender := newTestSender(t, srv, TLSNone, "")
+
+	if err := sender.Send(context.Background(), testMail()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for _, cmd := range srv.commands {
+		if cmd == "AUTH" {
+			t.Error("authenticated without a username")
+		}
+	}
+}
+
+func TestSenderStartTLSRequired(t *testing.T) {
+	srv := newFakeServer(t)
+	sender := newTestSender(t, srv, TLSStartTLS, "mailer")
+
+	if err := sender.Send(context.Background(), testMail()); !errors.Is(err, ErrStartTLSNotSupported) {
+		t.Fatalf("error %v, want %v", err, ErrStartTLSNotSupported)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.auth != "" {
+		t.Error("credentials were sent without tls")
+	}
+}
+
+func TestSenderRejectedRecipient(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.reject = "user@example.com"
+	sender := newTestSender(t, srv, TLSNone, "")
+
+	err := sender.Send(context.Background(), testMail())
+	if err == nil || !strings.Contains(err.Error(), "RCPT") {
+		t.Errorf("error %v, want the recipient to be rejected", err)
+	}
+}
+
+func TestSenderInvalidRecipient(t *testing.T) {
+	srv := newFakeServer(t)
+	sender := newTestSender(t, srv, TLSNone, "")
+
+	m := testMail()
+	m.To = "user"
+	if err := sender.Send(context.Background(), m); !errors.Is(err, mailer.ErrInvalidRecipient) {
+		t.Errorf("error %v, want %v", err, mailer.ErrInvalidRecipient)
+	}
+}
+
+func TestNewSenderConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		tls  string
+		ok   bool
+	}{
+		{"starttls", "smtp.example.com", TLSStartTLS, true},
+		{"tls", "smtp.example.com", TLSImplicit, true},
+		{"none", "smtp.example.com", TLSNone, true},
+		{"no host", "", TLSStartTLS, false},
+		{"unknown tls", "smtp.example.com", "ssl", false},
+	}
+
+	for _, tt := range tests {
+		var cfg config.Config
+		cfg.Mailer.SMTP.Host = tt.host
+		cfg.Mailer.SMTP.TLS = tt.tls
+
+		if _, err := NewSender(cfg); (err == nil) != tt.ok {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+	}
+}
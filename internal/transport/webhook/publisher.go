@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+const (
+	HeaderEventID   = "X-Event-Id"
+	HeaderEventType = "X-Event-Type"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Publisher posts events to a webhook. A failed delivery is retried by
+// the events relay with backoff, not here.
+type Publisher struct {
+	client *http.Client
+	url    string
+	secret []byte
+}
+
+func NewPublisher(cfg config.Config) Publisher {
+	return Publisher{
+		client: &http.Client{
+			Timeout: cfg.Events.Webhook.Timeout,
+		},
+		url:    cfg.Events.Webhook.URL,
+		secret: []byte(cfg.Events.Webhook.Secret),
+	}
+}
+
+// Publish posts the event as JSON to the configured url. The body is
+// signed with HMAC-SHA256 over "<timestamp>.<body>" so receivers can
+// verify both origin and freshness.
+func (p Publisher) Publish(ctx context.Context, event entities.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, event.ID)
+	req.Header.Set(HeaderEventType, event.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(p.secret, timestamp, body))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded signature receivers are expected to
+// compare against the X-Webhook-Signature header.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rasulov-emirlan/poc-auth/config"
+	"github.com/rasulov-emirlan/poc-auth/internal/entities"
+)
+
+func newTestPublisher(url string) Publisher {
+	var cfg config.Config
+	cfg.Events.Webhook.URL = url
+	cfg.Events.Webhook.Secret = "secret"
+	cfg.Events.Webhook.Timeout = time.Second
+	return NewPublisher(cfg)
+}
+
+func TestPublishSignsEvent(t *testing.T) {
+	event := entities.Event{ID: "1", Type: "user.registered", Payload: map[string]any{"user_id": "u"}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if r.Header.Get(HeaderEventID) != event.ID || r.Header.Get(HeaderEventType) != event.Type {
+			t.Errorf("unexpected event headers %v", r.Header)
+		}
+
+		want := "sha256=" + Sign([]byte("secret"), r.Header.Get(HeaderTimestamp), body)
+		if got := r.Header.Get(HeaderSignature); got != want {
+			t.Errorf("signature %q, want %q", got, want)
+		}
+
+		var got entities.Event
+		if err := json.Unmarshal(body, &got); err != nil || got.ID != event.ID {
+			t.Errorf("unexpected body %s", body)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := newTestPublisher(srv.URL).Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishDoesNotRetry(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := newTestPublisher(srv.URL).Publish(context.Background(), entities.Event{ID: "1", Type: "user.registered"})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected the status in the error, got %v", err)
+	}
+
+	// retries are left to the relay and its backoff
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one request, got %d", got)
+	}
+}
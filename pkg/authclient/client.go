@@ -0,0 +1,238 @@
+// Package authclient is a client for the poc-auth REST api, with
+// middleware that authenticates requests to other services by the
+// access tokens it issues.
+package authclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	clientID     string
+	clientSecret string
+	tenant       string
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithServiceCredentials sets the credentials used for introspection,
+// they are configured on the server in introspection.clients.
+func WithServiceCredentials(id, secret string) Option {
+	return func(client *Client) {
+		client.clientID = id
+		client.clientSecret = secret
+	}
+}
+
+// WithTenant sends every request for the tenant, for servers with
+// tenancy enabled that do not tell tenants apart by host.
+func WithTenant(tenant string) Option {
+	return func(client *Client) {
+		client.tenant = tenant
+	}
+}
+
+// New creates a client for the server at baseURL, e.g.
+// http://localhost:8080.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type (
+	Session struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	RegisterRequest struct {
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+		Firstname string `json:"firstname"`
+		Lastname  string `json:"lastname"`
+	}
+
+	// User is the user a token belongs to. Names are only known when
+	// the user was fetched from the server, roles only when the token
+	// was validated.
+	User struct {
+		ID        string   `json:"id"`
+		Email     string   `json:"email"`
+		Firstname string   `json:"firstname,omitempty"`
+		Lastname  string   `json:"lastname,omitempty"`
+		Roles     []string `json:"roles,omitempty"`
+		TenantID  string   `json:"tenant_id,omitempty"`
+		OrgID     string   `json:"active_organization_id,omitempty"`
+		// ImpersonatorID is set when an admin impersonates the user.
+		ImpersonatorID string `json:"impersonator_id,omitempty"`
+		// ReadOnly is set for impersonations that may only read, the
+		// service should refuse changes.
+		ReadOnly  bool      `json:"impersonation_read_only,omitempty"`
+		ExpiresAt time.Time `json:"-"`
+	}
+
+	Introspection struct {
+		Active    bool     `json:"active"`
+		Subject   string   `json:"sub,omitempty"`
+		Email     string   `json:"email,omitempty"`
+		Roles     []string `json:"roles,omitempty"`
+		Scope     string   `json:"scope,omitempty"`
+		ClientID  string   `json:"client_id,omitempty"`
+		TokenType string   `json:"token_type,omitempty"`
+		ExpiresAt int64    `json:"exp,omitempty"`
+		IssuedAt  int64    `json:"iat,omitempty"`
+		Issuer    string   `json:"iss,omitempty"`
+		Tenant    string   `json:"tenant,omitempty"`
+		OrgID     string   `json:"org_id,omitempty"`
+		// Act is the admin impersonating the user.
+		Act *Actor `json:"act,omitempty"`
+	}
+
+	Actor struct {
+		Subject string `json:"sub"`
+	}
+)
+
+// Error is returned for responses with an error status. Fields is set
+// for rejected request bodies.
+type Error struct {
+	StatusCode int               `json:"-"`
+	Message    string            `json:"error"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("auth: %d %s", e.StatusCode, e.Message)
+}
+
+// Login requires the server to return tokens in the body, which is the
+// default of cookies.tokens_in_body.
+func (c *Client) Login(ctx context.Context, email, password string) (Session, error) {
+	var res Session
+	err := c.do(ctx, http.MethodPost, "/auth/login", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, &res)
+	return res, err
+}
+
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (Session, error) {
+	var res Session
+	err := c.do(ctx, http.MethodPost, "/auth/register", "", req, &res)
+	return res, err
+}
+
+// Refresh exchanges a refresh token for a new session, the old refresh
+// token stops working.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (Session, error) {
+	var res Session
+	err := c.do(ctx, http.MethodPost, "/auth/refresh", "", map[string]string{
+		"refresh_token": refreshToken,
+	}, &res)
+	return res, err
+}
+
+// Me returns the user the access token belongs to.
+func (c *Client) Me(ctx context.Context, accessToken string) (User, error) {
+	var res User
+	err := c.do(ctx, http.MethodGet, "/auth/me", accessToken, nil, &res)
+	return res, err
+}
+
+// Introspect asks the server whether a token is active. It needs
+// WithServiceCredentials.
+func (c *Client) Introspect(ctx context.Context, token string) (Introspection, error) {
+	form := url.Values{"token": {token}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/auth/introspect", strings.NewReader(form.Encode()))
+	if err != nil {
+		return Introspection{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	var res Introspection
+	err = c.send(req, &res)
+	return res, err
+}
+
+func (c *Client) do(ctx context.Context, method, path, accessToken string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	return c.send(req, out)
+}
+
+func (c *Client) send(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+	if c.tenant != "" {
+		req.Header.Set("X-Tenant-ID", c.tenant)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(res.StatusCode)
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type contextKey struct{}
+
+// EchoContextKey is the key the echo middleware stores the User under.
+const EchoContextKey = "user"
+
+func ContextWithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the user put into the request context by
+// the middleware.
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKey{}).(User)
+	return user, ok
+}
+
+// Middleware rejects requests without a valid bearer token and puts
+// the user into the request context.
+func Middleware(v Validator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, code, err := authenticate(r, v)
+			if err != nil {
+				writeError(w, code, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithUser(r.Context(), user)))
+		})
+	}
+}
+
+// EchoMiddleware is Middleware for echo. The user is also set on the
+// echo context under EchoContextKey.
+func EchoMiddleware(v Validator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, code, err := authenticate(c.Request(), v)
+			if err != nil {
+				writeError(c.Response(), code, err)
+				return nil
+			}
+
+			c.Set(EchoContextKey, user)
+			c.SetRequest(c.Request().WithContext(ContextWithUser(c.Request().Context(), user)))
+
+			return next(c)
+		}
+	}
+}
+
+func authenticate(r *http.Request, v Validator) (User, int, error) {
+	token, ok := bearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		return User{}, http.StatusUnauthorized, errors.New("access token required")
+	}
+
+	user, err := v.Validate(r.Context(), token)
+	if errors.Is(err, ErrInvalidToken) {
+		return User{}, http.StatusUnauthorized, ErrInvalidToken
+	}
+	if err != nil {
+		return User{}, http.StatusServiceUnavailable, errors.New("failed to validate access token")
+	}
+
+	return user, http.StatusOK, nil
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
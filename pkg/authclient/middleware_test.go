@@ -0,0 +1,65 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type validatorFunc func(ctx context.Context, token string) (User, error)
+
+func (f validatorFunc) Validate(ctx context.Context, token string) (User, error) {
+	return f(ctx, token)
+}
+
+func TestMiddleware(t *testing.T) {
+	v := validatorFunc(func(ctx context.Context, token string) (User, error) {
+		switch token {
+		case "valid":
+			return User{ID: "user-1"}, nil
+		case "unavailable":
+			return User{}, errors.New("connection refused")
+		}
+		return User{}, ErrInvalidToken
+	})
+
+	handler := Middleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok || user.ID != "user-1" {
+			t.Errorf("user %+v in context", user)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"Bearer valid", http.StatusNoContent},
+		{"bearer valid", http.StatusNoContent},
+		{"", http.StatusUnauthorized},
+		{"Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Bearer invalid", http.StatusUnauthorized},
+		{"Bearer unavailable", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%q: status %d, want %d", tt.header, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: no WWW-Authenticate header", tt.header)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+// ErrInvalidToken is returned by validators for tokens that are
+// malformed, expired, revoked or not signed by a known key.
+var ErrInvalidToken = errors.New("authclient: invalid or expired token")
+
+var (
+	ErrIssuerRequired   = errors.New("authclient: jwks validator needs WithIssuer")
+	ErrAudienceRequired = errors.New("authclient: jwks validator needs WithAudience")
+)
+
+// Validator checks an access token and returns the user it belongs to.
+type Validator interface {
+	Validate(ctx context.Context, token string) (User, error)
+}
+
+// JWKSValidator validates tokens locally with the keys published by
+// the token issuer. It needs no call per request, but a revoked token
+// stays valid until it expires.
+type JWKSValidator struct {
+	keys       *jwks.RemoteSet
+	httpClient *http.Client
+	issuer     string
+	audience   string
+}
+
+type JWKSOption func(*JWKSValidator)
+
+// WithIssuer requires the iss claim to match.
+func WithIssuer(issuer string) JWKSOption {
+	return func(v *JWKSValidator) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim to contain the audience, for
+// fusionauth tokens it is the application id.
+func WithAudience(audience string) JWKSOption {
+	return func(v *JWKSValidator) {
+		v.audience = audience
+	}
+}
+
+func WithJWKSHTTPClient(c *http.Client) JWKSOption {
+	return func(v *JWKSValidator) {
+		v.httpClient = c
+	}
+}
+
+// NewJWKSValidator validates tokens with the key set at jwksURL, for
+// fusionauth that is <fusionauth host>/.well-known/jwks.json. The
+// application has to sign access tokens with an asymmetric key, HMAC
+// keys are not published. The issuer and audience are required, any
+// application signing with the same key would be let in otherwise.
+func NewJWKSValidator(jwksURL string, opts ...JWKSOption) (*JWKSValidator, error) {
+	v := &JWKSValidator{}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	if v.issuer == "" {
+		return nil, ErrIssuerRequired
+	}
+	if v.audience == "" {
+		return nil, ErrAudienceRequired
+	}
+
+	v.keys = jwks.NewRemoteSet(jwksURL, v.httpClient)
+
+	return v, nil
+}
+
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+	Scope string   `json:"scope"`
+	Act   *Actor   `json:"act"`
+}
+
+func (v *JWKSValidator) Validate(ctx context.Context, token string) (User, error) {
+	var claims accessTokenClaims
+
+	_, err := jwt.ParseWithClaims(token, &claims, v.keys.Keyfunc(ctx),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if keySetUnavailable(err) {
+			return User{}, fmt.Errorf("failed to validate token: %w", err)
+		}
+		return User{}, errors.Join(ErrInvalidToken, err)
+	}
+
+	user := User{
+		ID:    claims.Subject,
+		Email: claims.Email,
+		Roles: claims.Roles,
+	}
+	if claims.Act != nil {
+		user.ImpersonatorID = claims.Act.Subject
+		user.ReadOnly = readOnlyScope(claims.Scope)
+	}
+	if claims.ExpiresAt != nil {
+		user.ExpiresAt = claims.ExpiresAt.Time
+	}
+
+	return user, nil
+}
+
+// keySetUnavailable tells a key set that could not be fetched apart
+// from a token that does not match it.
+func keySetUnavailable(err error) bool {
+	if !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		return false
+	}
+
+	return !errors.Is(err, jwks.ErrKeyNotFound) &&
+		!errors.Is(err, jwks.ErrMissingKeyID) &&
+		!errors.Is(err, jwks.ErrUnexpectedKeyType) &&
+		!errors.Is(err, jwks.ErrUnsupportedKey)
+}
+
+// readOnlyScope tells whether the scope of an impersonation token
+// allows reading only.
+func readOnlyScope(scope string) bool {
+	return !slices.Contains(strings.Fields(scope), "write")
+}
+
+// RemoteValidator validates tokens with the introspection endpoint, so
+// revoked tokens and deleted users are noticed within the server's
+// cache ttl.
+type RemoteValidator struct {
+	client *Client
+}
+
+// NewRemoteValidator needs a client created WithServiceCredentials.
+func NewRemoteValidator(client *Client) *RemoteValidator {
+	return &RemoteValidator{client: client}
+}
+
+func (v *RemoteValidator) Validate(ctx context.Context, token string) (User, error) {
+	res, err := v.client.Introspect(ctx, token)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to introspect token: %w", err)
+	}
+
+	if !res.Active {
+		return User{}, ErrInvalidToken
+	}
+
+	user := User{
+		ID:    res.Subject,
+		Email: res.Email,
+		Roles: res.Roles,
+	}
+	if res.Act != nil {
+		user.ImpersonatorID = res.Act.Subject
+		user.ReadOnly = readOnlyScope(res.Scope)
+	}
+	if res.ExpiresAt != 0 {
+		user.ExpiresAt = time.Unix(res.ExpiresAt, 0)
+	}
+
+	return user, nil
+}
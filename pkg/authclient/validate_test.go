@@ -0,0 +1,250 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rasulov-emirlan/poc-auth/pkg/jwks"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "app"
+)
+
+// newKeySet serves the key set of a fresh signer.
+func newKeySet(t *testing.T) (jwks.Signer, string) {
+	t.Helper()
+
+	signer, err := jwks.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(signer.Set())
+	}))
+	t.Cleanup(srv.Close)
+
+	return signer, srv.URL
+}
+
+func testClaims() accessTokenClaims {
+	return accessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Email: "user@example.com",
+		Roles: []string{"member"},
+	}
+}
+
+func TestNewJWKSValidatorRequiresIssuerAndAudience(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []JWKSOption
+		want error
+	}{
+		{"none", nil, ErrIssuerRequired},
+		{"issuer", []JWKSOption{WithIssuer(testIssuer)}, ErrAudienceRequired},
+		{"audience", []JWKSOption{WithAudience(testAudience)}, ErrIssuerRequired},
+		{"both", []JWKSOption{WithIssuer(testIssuer), WithAudience(testAudience)}, nil},
+	}
+
+	for _, tt := range tests {
+		_, err := NewJWKSValidator("http://localhost/.well-known/jwks.json", tt.opts...)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestJWKSValidator(t *testing.T) {
+	signer, url := newKeySet(t)
+	other, err := jwks.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewJWKSValidator(url, WithIssuer(testIssuer), WithAudience(testAudience))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer jwks.Signer
+		claims func(*accessTokenClaims)
+		want   User
+		err    error
+	}{
+		{
+			name:   "valid",
+			signer: signer,
+			claims: func(c *accessTokenClaims) {},
+			want:   User{ID: "user-1", Email: "user@example.com", Roles: []string{"member"}},
+		},
+		{
+			name:   "impersonation",
+			signer: signer,
+			claims: func(c *accessTokenClaims) {
+				c.Scope = "read write"
+				c.Act = &Actor{Subject: "admin-1"}
+			},
+			want: User{ID: "user-1", Email: "user@example.com", Roles: []string{"member"}, ImpersonatorID: "admin-1"},
+		},
+		{
+			name:   "read only impersonation",
+			signer: signer,
+			claims: func(c *accessTokenClaims) {
+				c.Scope = "read"
+				c.Act = &Actor{Subject: "admin-1"}
+			},
+			want: User{ID: "user-1", Email: "user@example.com", Roles: []string{"member"}, ImpersonatorID: "admin-1", ReadOnly: true},
+		},
+		{
+			name:   "other issuer",
+			signer: signer,
+			claims: func(c *accessTokenClaims) { c.Issuer = "https://evil.example.com" },
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "other audience",
+			signer: signer,
+			claims: func(c *accessTokenClaims) { c.Audience = jwt.ClaimStrings{"other-app"} },
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "expired",
+			signer: signer,
+			claims: func(c *accessTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) },
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "no expiry",
+			signer: signer,
+			claims: func(c *accessTokenClaims) { c.ExpiresAt = nil },
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "unknown key",
+			signer: other,
+			claims: func(c *accessTokenClaims) {},
+			err:    ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			tt.claims(&claims)
+
+			token, err := tt.signer.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := v.Validate(context.Background(), token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			user.ExpiresAt = time.Time{}
+			if !reflect.DeepEqual(user, tt.want) {
+				t.Errorf("user %+v, want %+v", user, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKSValidatorKeySetUnavailable(t *testing.T) {
+	signer, err := jwks.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	v, err := NewJWKSValidator(srv.URL, WithIssuer(testIssuer), WithAudience(testAudience))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signer.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Validate(context.Background(), token)
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("error %v, want the key set to be unavailable", err)
+	}
+}
+
+func TestRemoteValidator(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Introspection
+		want User
+		err  error
+	}{
+		{
+			name: "active",
+			res:  Introspection{Active: true, Subject: "user-1", Email: "user@example.com", Scope: "offline_access"},
+			want: User{ID: "user-1", Email: "user@example.com"},
+		},
+		{
+			name: "read only impersonation",
+			res:  Introspection{Active: true, Subject: "user-1", Scope: "read", Act: &Actor{Subject: "admin-1"}},
+			want: User{ID: "user-1", ImpersonatorID: "admin-1", ReadOnly: true},
+		},
+		{
+			name: "inactive",
+			res:  Introspection{},
+			err:  ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if id, secret, ok := r.BasicAuth(); !ok || id != "billing" || secret != "secret1" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if r.PostFormValue("token") != "token" {
+					t.Errorf("introspected %q", r.PostFormValue("token"))
+				}
+				_ = json.NewEncoder(w).Encode(tt.res)
+			}))
+			defer srv.Close()
+
+			v := NewRemoteValidator(New(srv.URL, WithServiceCredentials("billing", "secret1")))
+
+			user, err := v.Validate(context.Background(), "token")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if err == nil && !reflect.DeepEqual(user, tt.want) {
+				t.Errorf("user %+v, want %+v", user, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package breached checks passwords against a local copy of a breached
+// password list, such as the one published by Have I Been Pwned.
+//
+// Passwords are looked up by the SHA-1 of the password, split into a
+// five character prefix and the remaining suffix the way the k-anonymity
+// range API does. Two layouts are supported:
+//
+//   - a directory with one file per prefix, named after the prefix with
+//     an optional .txt extension, holding SUFFIX:COUNT lines. This is
+//     what the official downloader produces. Files are read on demand,
+//     so the full list does not have to fit in memory.
+//   - a single file of HASH or HASH:COUNT lines, loaded into memory.
+//     Useful for smaller lists such as the most common passwords.
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLen = 5
+
+type List struct {
+	dir      string
+	suffixes map[string]map[string]struct{}
+}
+
+// Open loads the list at path, which is either a directory of prefix
+// files or a single hash file.
+func Open(path string) (*List, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+
+	if info.IsDir() {
+		return &List{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	l := &List{suffixes: make(map[string]map[string]struct{})}
+
+	err = scanHashes(f, func(hash string) {
+		if len(hash) != sha1.Size*2 {
+			return
+		}
+		prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+		if l.suffixes[prefix] == nil {
+			l.suffixes[prefix] = make(map[string]struct{})
+		}
+		l.suffixes[prefix][suffix] = struct{}{}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	return l, nil
+}
+
+// Contains reports whether the password is on the list.
+func (l *List) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+
+	if l.dir == "" {
+		_, ok := l.suffixes[prefix][suffix]
+		return ok, nil
+	}
+
+	f, err := l.openRange(prefix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open range %s: %w", prefix, err)
+	}
+	defer f.Close()
+
+	found := false
+	err = scanHashes(f, func(s string) {
+		if s == suffix {
+			found = true
+		}
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read range %s: %w", prefix, err)
+	}
+
+	return found, nil
+}
+
+func (l *List) openRange(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(l.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(l.dir, prefix))
+	}
+	return f, err
+}
+
+// scanHashes calls fn with the upper cased hash of every line, without
+// the count.
+func scanHashes(r io.Reader, fn func(hash string)) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		fn(strings.ToUpper(hash))
+	}
+	return s.Err()
+}
@@ -0,0 +1,80 @@
+// Package disposable tells whether an email domain belongs to a
+// disposable email provider.
+//
+// A list of well known providers is bundled. New providers show up all
+// the time, more can be loaded from a file of one domain per line, such
+// as the lists maintained by the disposable-email-domains project.
+// Empty lines and lines starting with # are skipped.
+package disposable
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+//go:embed domains.txt
+var bundled string
+
+type List struct {
+	domains map[string]struct{}
+}
+
+// New returns the bundled list.
+func New() *List {
+	l := &List{domains: make(map[string]struct{})}
+
+	// the bundled list is read from memory, it can not fail
+	_ = l.read(strings.NewReader(bundled))
+
+	return l
+}
+
+// Open returns the bundled list together with the domains in the file
+// at path.
+func Open(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disposable email domains: %w", err)
+	}
+	defer f.Close()
+
+	l := New()
+	if err := l.read(f); err != nil {
+		return nil, fmt.Errorf("failed to read disposable email domains: %w", err)
+	}
+
+	return l, nil
+}
+
+func (l *List) read(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.ToLower(strings.TrimSpace(s.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.domains[line] = struct{}{}
+	}
+	return s.Err()
+}
+
+// Contains reports whether the domain or one of its parent domains is
+// on the list, subdomains of disposable providers are disposable too.
+func (l *List) Contains(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for {
+		if _, ok := l.domains[domain]; ok {
+			return true
+		}
+
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
@@ -0,0 +1,62 @@
+package disposable
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContains(t *testing.T) {
+	l := New()
+
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"mailinator.com", true},
+		{"Mailinator.COM", true},
+		{"mailinator.com.", true},
+		{"eu.mailinator.com", true},
+		{"a.b.mailinator.com", true},
+		{"notmailinator.com", false},
+		{"mailinator.com.example.com", false},
+		{"example.com", false},
+		{"com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := l.Contains(tt.domain); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	data := "# more providers\n\n  Throwaway.example \n#commented.example\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !l.Contains("throwaway.example") || !l.Contains("mx.throwaway.example") {
+		t.Error("domain from the file is missing")
+	}
+	if !l.Contains("mailinator.com") {
+		t.Error("bundled domains are missing")
+	}
+	if l.Contains("commented.example") || l.Contains("# more providers") {
+		t.Error("comments are on the list")
+	}
+}
+
+func TestOpenMissingFile(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("opened a missing file")
+	}
+}
@@ -0,0 +1,189 @@
+// Package geoip looks up the coarse location of an IP address in a local
+// CSV database.
+//
+// Every line of the database is a network in CIDR notation followed by
+// the country code and, optionally, the city, latitude and longitude:
+//
+//	network,country,city,latitude,longitude
+//	203.0.113.0/24,KG,Bishkek,42.87,74.59
+//	2001:db8::/32,DE,,,
+//
+// A header line starting with network and lines starting with # are
+// skipped. Networks must not overlap. The whole database is loaded into
+// memory, lookups are a binary search.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// earthRadius is the mean radius of the earth in kilometers.
+const earthRadius = 6371.0
+
+type Location struct {
+	Country   string  `json:"country"`
+	City      string  `json:"city,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+}
+
+// HasCoordinates reports whether the database knew where the network
+// is, not only its country.
+func (l Location) HasCoordinates() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
+
+// String returns the city and country, such as "Bishkek, KG".
+func (l Location) String() string {
+	if l.City == "" {
+		return l.Country
+	}
+	return l.City + ", " + l.Country
+}
+
+type network struct {
+	first, last netip.Addr
+	location    Location
+}
+
+type DB struct {
+	networks []network
+}
+
+// Open loads the database at path.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+	defer f.Close()
+
+	db, err := read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geoip database: %w", err)
+	}
+
+	return db, nil
+}
+
+func read(r io.Reader) (*DB, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+
+	db := &DB{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 2 || record[0] == "network" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", record[0], err)
+		}
+
+		loc := Location{Country: strings.ToUpper(record[1])}
+		if len(record) > 2 {
+			loc.City = record[2]
+		}
+		if len(record) > 4 && record[3] != "" && record[4] != "" {
+			if loc.Latitude, err = strconv.ParseFloat(record[3], 64); err != nil {
+				return nil, fmt.Errorf("invalid latitude of %s: %w", record[0], err)
+			}
+			if loc.Longitude, err = strconv.ParseFloat(record[4], 64); err != nil {
+				return nil, fmt.Errorf("invalid longitude of %s: %w", record[0], err)
+			}
+		}
+
+		prefix = prefix.Masked()
+		db.networks = append(db.networks, network{
+			first:    prefix.Addr(),
+			last:     lastAddr(prefix),
+			location: loc,
+		})
+	}
+
+	sort.Slice(db.networks, func(i, j int) bool {
+		return db.networks[i].first.Less(db.networks[j].first)
+	})
+
+	return db, nil
+}
+
+// Lookup returns the location of the ip, ok is false for addresses
+// that are not in the database or can not be parsed.
+func (db *DB) Lookup(ip string) (Location, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+	addr = addr.Unmap()
+
+	// the last network that starts at or before the address
+	i := sort.Search(len(db.networks), func(i int) bool {
+		return addr.Less(db.networks[i].first)
+	}) - 1
+	if i < 0 {
+		return Location{}, false
+	}
+
+	n := db.networks[i]
+	if n.first.BitLen() != addr.BitLen() || n.last.Less(addr) {
+		return Location{}, false
+	}
+
+	return n.location, true
+}
+
+// Distance returns the great circle distance between two locations in
+// kilometers.
+func Distance(a, b Location) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// lastAddr returns the last address of a masked prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+
+	if addr.Is4() {
+		b := addr.As4()
+		for i := bits; i < 32; i++ {
+			b[i/8] |= 1 << (7 - i%8)
+		}
+		return netip.AddrFrom4(b)
+	}
+
+	b := addr.As16()
+	for i := bits; i < 128; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	return netip.AddrFrom16(b)
+}
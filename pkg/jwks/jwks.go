@@ -0,0 +1,232 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrKeyNotFound       = errors.New("key not found")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrMissingKeyID      = errors.New("token has no kid header")
+	ErrUnexpectedKeyType = errors.New("unexpected key type for signing method")
+)
+
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewKey converts a public key into its JWK representation.
+func NewKey(kid, alg string, pub crypto.PublicKey) (Key, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: alg,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return Key{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Alg: alg,
+			Crv: pub.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+	default:
+		return Key{}, ErrUnsupportedKey
+	}
+}
+
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode y: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// RemoteSet is a key set fetched over HTTP and cached. Unknown key ids
+// trigger a refetch, so key rotation on the issuer side is picked up
+// without restarts.
+type RemoteSet struct {
+	url         string
+	client      *http.Client
+	minInterval time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func NewRemoteSet(url string, client *http.Client) *RemoteSet {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RemoteSet{
+		url:         url,
+		client:      client,
+		minInterval: time.Minute,
+	}
+}
+
+func (r *RemoteSet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.keys[kid]; ok {
+		return key, nil
+	}
+
+	if r.keys != nil && time.Since(r.fetchedAt) < r.minInterval {
+		return nil, ErrKeyNotFound
+	}
+
+	if err := r.fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	if key, ok := r.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// Keyfunc returns a jwt.Keyfunc resolving keys by the kid header and
+// making sure the key type matches the signing method.
+func (r *RemoteSet) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrMissingKeyID
+		}
+
+		key, err := r.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			if _, ok := key.(*rsa.PublicKey); !ok {
+				return nil, ErrUnexpectedKeyType
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := key.(*ecdsa.PublicKey); !ok {
+				return nil, ErrUnexpectedKeyType
+			}
+		default:
+			return nil, ErrUnexpectedKeyType
+		}
+
+		return key, nil
+	}
+}
+
+func (r *RemoteSet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create jwks request: %w", err)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch jwks: status %d", res.StatusCode)
+	}
+
+	var set Set
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	r.keys = keys
+	r.fetchedAt = time.Now()
+
+	return nil
+}
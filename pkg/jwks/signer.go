@@ -0,0 +1,106 @@
+package jwks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidPEM = errors.New("no rsa private key found in pem")
+
+// Signer signs tokens with a single RSA key and publishes its public
+// part as a key set.
+type Signer struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+func NewSigner(key *rsa.PrivateKey) Signer {
+	der := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+
+	return Signer{
+		kid: base64.RawURLEncoding.EncodeToString(sum[:16]),
+		key: key,
+	}
+}
+
+// LoadSigner reads a PKCS#1 or PKCS#8 encoded RSA private key.
+func LoadSigner(path string) (Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Signer{}, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return Signer{}, ErrInvalidPEM
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return Signer{}, fmt.Errorf("failed to parse signing key: %w", err)
+			}
+			return NewSigner(key), nil
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return Signer{}, fmt.Errorf("failed to parse signing key: %w", err)
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return Signer{}, ErrInvalidPEM
+			}
+			return NewSigner(rsaKey), nil
+		}
+	}
+}
+
+// GenerateSigner creates a signer with a fresh key. Tokens signed by it
+// become invalid once the process exits.
+func GenerateSigner() (Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return Signer{}, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return NewSigner(key), nil
+}
+
+func (s Signer) KeyID() string {
+	return s.kid
+}
+
+func (s Signer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.key)
+}
+
+// Parse verifies the signature of the token and decodes it into claims.
+func (s Signer) Parse(token string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if kid, _ := t.Header["kid"].(string); kid != s.kid {
+			return nil, ErrKeyNotFound
+		}
+		return &s.key.PublicKey, nil
+	}, opts...)
+	return err
+}
+
+func (s Signer) Set() Set {
+	key, _ := NewKey(s.kid, jwt.SigningMethodRS256.Alg(), &s.key.PublicKey)
+	return Set{Keys: []Key{key}}
+}
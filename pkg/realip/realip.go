@@ -0,0 +1,105 @@
+// Package realip finds the address of a client behind reverse proxies.
+//
+// X-Forwarded-For can be set by anyone, so it is only read when the
+// request comes from a trusted proxy. Each proxy appends the address it
+// got the request from, the client is the last address in the header
+// that is not a trusted proxy itself.
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Resolver without trusted proxies always returns the address of the
+// connection.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New trusts the proxies, given as addresses or networks in CIDR
+// notation.
+func New(proxies []string) (Resolver, error) {
+	var r Resolver
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return Resolver{}, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+			}
+			addr = addr.Unmap()
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return Resolver{}, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// ClientIP returns the address of the client. remoteAddr is the
+// address of the connection, with or without a port, forwardedFor the
+// values of every X-Forwarded-For header in order.
+func (r Resolver) ClientIP(remoteAddr string, forwardedFor []string) string {
+	ip := stripPort(remoteAddr)
+	if !r.isTrusted(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, v := range forwardedFor {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := stripPort(strings.TrimSpace(hops[i]))
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// whatever is left of garbage was not added by our proxies
+			return ip
+		}
+
+		ip = hop
+		if !r.isTrusted(ip) {
+			return ip
+		}
+	}
+
+	return ip
+}
+
+func (r Resolver) isTrusted(ip string) bool {
+	if len(r.trusted) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
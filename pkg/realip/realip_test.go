@@ -0,0 +1,53 @@
+package realip
+
+import "testing"
+
+func TestClientIP(t *testing.T) {
+	r, err := New([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"untrusted peer spoofing", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"client prepends a spoofed hop", "10.0.0.2:4000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "192.0.2.1:4000", []string{"198.51.100.1, 10.1.1.1"}, "198.51.100.1"},
+		{"several headers", "10.0.0.2:4000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"only trusted hops", "10.0.0.2:4000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"trusted proxy without header", "10.0.0.2:4000", nil, "10.0.0.2"},
+		{"garbage hop", "10.0.0.2:4000", []string{"198.51.100.1, unknown"}, "10.0.0.2"},
+		{"ipv6 peer", "[2001:db8::1]:4000", nil, "2001:db8::1"},
+		{"hop with port", "10.0.0.2:4000", []string{"198.51.100.1:5000"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.ClientIP(tt.remoteAddr, tt.forwardedFor); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	var r Resolver
+
+	if got := r.ClientIP("127.0.0.1:4000", []string{"198.51.100.1"}); got != "127.0.0.1" {
+		t.Errorf("ClientIP() = %q, want the connection's address", got)
+	}
+}
+
+func TestNewRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if _, err := New([]string{proxy}); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", proxy)
+		}
+	}
+}